@@ -0,0 +1,172 @@
+// Package agentkit implements the peridot agent.AgentServer streaming
+// protocol once, so that individual agents only need to supply the
+// function that actually carries out their job.
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package agentkit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+	"github.com/swinslow/peridot-jobrunner/pkg/status"
+)
+
+// Runner is implemented by each agent. Its Run method is the function
+// that actually carries out the substantive action of the agent, for a
+// single job. It does not do any gRPC communication itself, but instead
+// uses the Reporter to send job status information back to the
+// Controller.
+//
+// Run should return nil if the job succeeded, or an error describing
+// why it failed. The error's message will be reported to the Controller
+// as the job's final output message, with ERROR health.
+//
+// If the job is stopped before Run returns, by Agent.Stop, Run's ctx is
+// cancelled. agent.proto has no health value for a stopped job, so once
+// Run returns an error the job is reported as STOPPED with ERROR
+// health, and with StoppedMsg as its final output message in place of
+// the error. Controllers can tell it apart from a failed job by that
+// message. A job that is stopped before it has started is reported as
+// STOPPED with OK health, and the same message.
+type Runner interface {
+	Run(ctx context.Context, cfg agent.JobConfig, rpt Reporter) error
+}
+
+// Agent implements agent.AgentServer on behalf of a Runner.
+type Agent struct {
+	r Runner
+
+	// mu guards jobs, which holds the stop channel of each job that
+	// the Agent is handling, and stopping, which is whether Stop has
+	// been called
+	mu       sync.Mutex
+	jobs     map[chan struct{}]bool
+	stopping bool
+}
+
+// New creates a new Agent that will handle jobs using the given Runner.
+// The returned Agent can be passed directly to agent.RegisterAgentServer.
+func New(r Runner) *Agent {
+	return &Agent{r: r, jobs: map[chan struct{}]bool{}}
+}
+
+// Stop asks each job that the Agent is handling, or is given from now
+// on, to stop. A running job's context is cancelled, and once its
+// Runner has returned the job is reported to the controller as STOPPED.
+// agent.proto has no message for the controller to ask for this
+// itself, so Serve calls Stop when the agent is asked to shut down.
+func (a *Agent) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stopping = true
+	for stop := range a.jobs {
+		// a job only needs to be asked once
+		select {
+		case stop <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// addJob registers a new job with the Agent, returning the channel on
+// which Stop asks it to stop.
+func (a *Agent) addJob() chan struct{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stop := make(chan struct{}, 1)
+	if a.stopping {
+		stop <- struct{}{}
+	}
+	a.jobs[stop] = true
+	return stop
+}
+
+// removeJob unregisters the job with the stop channel stop.
+func (a *Agent) removeJob(stop chan struct{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.jobs, stop)
+}
+
+type reqType uint8
+
+const (
+	reqStart = reqType(iota)
+	reqStatus
+)
+
+// StoppedMsg is the final output message for a job that was stopped by
+// Agent.Stop before it finished.
+const StoppedMsg = "stopped before finishing because the agent was stopped"
+
+type reqMsg struct {
+	t   reqType
+	cfg *agent.JobConfig
+}
+
+type statusCurrent struct {
+	run            status.Status
+	health         status.Health
+	started        time.Time
+	finished       time.Time
+	outputMessages string
+	progress       *Progress
+}
+
+// addOutput appends msg to the output messages, on a new line.
+func (st *statusCurrent) addOutput(msg string) {
+	if st.outputMessages != "" {
+		st.outputMessages += "\n"
+	}
+	st.outputMessages += msg
+}
+
+// messages returns the output messages to report for this status,
+// including the latest progress if the job is still running.
+func (st *statusCurrent) messages() string {
+	if st.progress == nil || st.run == status.Status_STOPPED {
+		return st.outputMessages
+	}
+	if st.outputMessages == "" {
+		return st.progress.String()
+	}
+	return st.outputMessages + "\n" + st.progress.String()
+}
+
+type statusUpdate struct {
+	run       status.Status
+	health    status.Health
+	now       time.Time
+	outputMsg string
+	progress  *Progress
+}
+
+// progressOnly returns whether this update changes nothing but the
+// job's progress. These are frequent, so they are not reported to the
+// controller straight away; the next heartbeat or status request
+// picks them up instead.
+func (su *statusUpdate) progressOnly() bool {
+	return su.progress != nil &&
+		su.run == status.Status_STATUS_SAME &&
+		su.health == status.Health_HEALTH_SAME &&
+		su.outputMsg == ""
+}
+
+type rptType struct {
+	sRpt   bool
+	status statusCurrent
+}
+
+// setStatusError is a helper function to send a statusUpdate
+// to the setStatus channel with ERROR status, and with the specified
+// error message.
+func setStatusError(setStatus chan<- statusUpdate, msg string) {
+	setStatus <- statusUpdate{
+		run:       status.Status_STOPPED,
+		health:    status.Health_ERROR,
+		now:       time.Now(),
+		outputMsg: msg,
+	}
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+// Package archive provides the pieces that agents which retrieve code
+// as archives have in common: downloading a file while computing its
+// checksums, and safely extracting tar and zip archives into a job's
+// codeOutputDir.
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Format is a kind of archive that Extract can unpack.
+type Format string
+
+const (
+	FormatTar    Format = "tar"
+	FormatTarGz  Format = "tar.gz"
+	FormatTarXz  Format = "tar.xz"
+	FormatTarBz2 Format = "tar.bz2"
+	FormatZip    Format = "zip"
+)
+
+// ParseFormat returns the Format named by s, which may be any of the
+// Format values or one of the usual short forms, such as "tgz".
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "tar":
+		return FormatTar, nil
+	case "tar.gz", "tgz":
+		return FormatTarGz, nil
+	case "tar.xz", "txz":
+		return FormatTarXz, nil
+	case "tar.bz2", "tbz2", "tbz":
+		return FormatTarBz2, nil
+	case "zip":
+		return FormatZip, nil
+	default:
+		return "", fmt.Errorf("unsupported archive format %q; must be tar, tar.gz, tar.xz, tar.bz2 or zip", s)
+	}
+}
+
+// magic numbers that identify each compression or archive format
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	bzip2Magic = []byte("BZh")
+	zipMagic   = []byte("PK\x03\x04")
+	// "ustar" appears at offset 257 of a POSIX or GNU tar header
+	tarMagic       = []byte("ustar")
+	tarMagicOffset = 257
+)
+
+// DetectFormat works out the Format of the archive at path from its
+// first few bytes, since URLs don't always end in the right suffix.
+// Compressed files are assumed to hold a tar archive.
+func DetectFormat(path string) (Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, tarMagicOffset+len(tarMagic))
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("couldn't read %s: %v", path, err)
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return FormatTarGz, nil
+	case bytes.HasPrefix(head, xzMagic):
+		return FormatTarXz, nil
+	case bytes.HasPrefix(head, bzip2Magic):
+		return FormatTarBz2, nil
+	case bytes.HasPrefix(head, zipMagic):
+		return FormatZip, nil
+	case len(head) == tarMagicOffset+len(tarMagic) && bytes.Equal(head[tarMagicOffset:], tarMagic):
+		return FormatTar, nil
+	default:
+		return "", fmt.Errorf("couldn't tell what kind of archive %s is; set its format explicitly", path)
+	}
+}
@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package archive
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+)
+
+// Checksums holds the checksums of a file as lower-case hex strings,
+// keyed by SPDX algorithm name: "SHA1", "SHA256" or "SHA512".
+type Checksums map[string]string
+
+// checksumLengths gives the length in hex digits of each algorithm's
+// checksums.
+var checksumLengths = map[string]int{
+	"SHA1":   40,
+	"SHA256": 64,
+	"SHA512": 128,
+}
+
+// ValidateChecksum checks that sum looks like a hex checksum for alg.
+func ValidateChecksum(alg string, sum string) error {
+	n, ok := checksumLengths[alg]
+	if !ok {
+		return fmt.Errorf("unsupported checksum algorithm %s", alg)
+	}
+	if _, err := hex.DecodeString(sum); err != nil || len(sum) != n {
+		return fmt.Errorf("%s checksum %q is not %d hex digits", strings.ToLower(alg), sum, n)
+	}
+	return nil
+}
+
+// Verify checks that sums match each of the expected checksums, which
+// are hex strings in either case.
+func (sums Checksums) Verify(expected Checksums) error {
+	algs := []string{}
+	for alg := range expected {
+		algs = append(algs, alg)
+	}
+	sort.Strings(algs)
+	for _, alg := range algs {
+		got, ok := sums[alg]
+		if !ok {
+			return fmt.Errorf("no %s checksum to compare against", alg)
+		}
+		if !strings.EqualFold(got, expected[alg]) {
+			return fmt.Errorf("%s checksum mismatch: expected %s, got %s", alg, strings.ToLower(expected[alg]), got)
+		}
+	}
+	return nil
+}
+
+// ValidateBaseURL checks that u is an http, https or file URL that
+// Download and Fetch can read from, such as the base URL of a package
+// mirror, and returns it without any trailing "/".
+func ValidateBaseURL(u string) (string, error) {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return "", fmt.Errorf("url %q is invalid: %v", u, err)
+	}
+	switch pu.Scheme {
+	case "http", "https":
+		if pu.Host == "" {
+			return "", fmt.Errorf("url %q has no host", u)
+		}
+	case "file":
+		if pu.Path == "" {
+			return "", fmt.Errorf("url %q has no path", u)
+		}
+	default:
+		return "", fmt.Errorf("url %q has unsupported scheme %q; must be http, https or file", u, pu.Scheme)
+	}
+	return strings.TrimSuffix(u, "/"), nil
+}
+
+// progressInterval is how many bytes Download reads between progress
+// reports.
+const progressInterval = 256 * 1024
+
+// Download fetches the http, https or file URL u into a new temporary
+// file, and returns the file's path and checksums. It reports progress
+// through rpt as it goes. The caller is responsible for removing the
+// file; it is already removed if Download returns an error.
+//
+// Callers should check that the URL is one that the job may use first,
+// since Download will read any local file that a file URL names.
+func Download(ctx context.Context, u string, rpt agentkit.Reporter) (string, Checksums, error) {
+	body, total, err := open(ctx, u)
+	if err != nil {
+		return "", nil, err
+	}
+	defer body.Close()
+
+	tmp, err := ioutil.TempFile("", "peridot-download-")
+	if err != nil {
+		return "", nil, fmt.Errorf("couldn't create temporary file for download: %v", err)
+	}
+	hashes := map[string]hash.Hash{
+		"SHA1":   sha1.New(),
+		"SHA256": sha256.New(),
+		"SHA512": sha512.New(),
+	}
+	w := io.MultiWriter(tmp, hashes["SHA1"], hashes["SHA256"], hashes["SHA512"])
+
+	p := agentkit.Progress{Phase: "downloading", Unit: "bytes", Total: total}
+	rpt.Progress(p)
+	buf := make([]byte, 32*1024)
+	lastReported := int64(0)
+	for {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var n int
+		n, err = body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				err = werr
+				break
+			}
+			p.Done += int64(n)
+			if p.Done-lastReported >= progressInterval {
+				rpt.Progress(p)
+				lastReported = p.Done
+			}
+		}
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			break
+		}
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", nil, fmt.Errorf("couldn't download %s: %v", u, err)
+	}
+	rpt.Progress(p)
+
+	sums := Checksums{}
+	for alg, h := range hashes {
+		sums[alg] = hex.EncodeToString(h.Sum(nil))
+	}
+	return tmp.Name(), sums, nil
+}
+
+// maxFetchBytes is the most that Fetch will read.
+const maxFetchBytes = 64 * 1024 * 1024
+
+// Fetch reads the http, https or file URL u into memory, for small
+// documents such as package metadata. As with Download, callers should
+// check that the URL is one that the job may use first.
+func Fetch(ctx context.Context, u string) ([]byte, error) {
+	body, _, err := open(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(body, maxFetchBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read %s: %v", u, err)
+	}
+	if len(b) > maxFetchBytes {
+		return nil, fmt.Errorf("couldn't read %s: larger than %d bytes", u, maxFetchBytes)
+	}
+	return b, nil
+}
+
+// open starts reading the http, https or file URL u, and returns the
+// body and its length, or 0 if that isn't known.
+func open(ctx context.Context, u string) (io.ReadCloser, int64, error) {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return nil, 0, fmt.Errorf("url %q is invalid: %v", u, err)
+	}
+
+	switch pu.Scheme {
+	case "http", "https":
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, 0, fmt.Errorf("url %q is invalid: %v", u, err)
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, 0, fmt.Errorf("couldn't download %s: %v", u, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, 0, fmt.Errorf("couldn't download %s: %s", u, resp.Status)
+		}
+		total := resp.ContentLength
+		if total < 0 {
+			total = 0
+		}
+		return resp.Body, total, nil
+	case "file":
+		f, err := os.Open(pu.Path)
+		if err != nil {
+			return nil, 0, fmt.Errorf("couldn't open %s: %v", u, err)
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, fmt.Errorf("couldn't open %s: %v", u, err)
+		}
+		if fi.IsDir() {
+			f.Close()
+			return nil, 0, fmt.Errorf("couldn't open %s: is a directory", u)
+		}
+		return f, fi.Size(), nil
+	default:
+		return nil, 0, fmt.Errorf("url %q has unsupported scheme %q", u, pu.Scheme)
+	}
+}
@@ -0,0 +1,461 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/ulikunitz/xz"
+)
+
+// The limits on what Extract writes, unless Options sets others.
+const (
+	DefaultMaxEntries = 200000
+	DefaultMaxBytes   = 4 << 30
+)
+
+// Options controls how Extract unpacks an archive.
+type Options struct {
+	// StripComponents removes this many leading directories from each
+	// path in the archive, like tar's --strip-components. Entries with
+	// no more components than that are skipped.
+	StripComponents int
+
+	// MaxEntries limits how many files, directories and links Extract
+	// creates, and MaxBytes how many bytes it writes in all, so that a
+	// small archive that expands to far more can't fill the disk. Zero
+	// means DefaultMaxEntries or DefaultMaxBytes, and a negative value
+	// means no limit.
+	MaxEntries int
+	MaxBytes   int64
+}
+
+// Extract unpacks the archive at archivePath, of the given format, into
+// destDir, and returns how many files it wrote. It reports progress
+// through rpt as it goes.
+//
+// Archives are untrusted, so Extract refuses entries that would be
+// written outside destDir, whether by an absolute path, by ".." or
+// through a symbolic link, and symbolic links that point outside
+// destDir. Symbolic links are created only once everything else has
+// been extracted, so that no entry can be written through one. Device
+// files and other special files are skipped. Extraction stops with an
+// error once the archive has more entries, or more bytes, than opts
+// allows.
+func Extract(ctx context.Context, archivePath string, format Format, destDir string, opts Options, rpt agentkit.Reporter) (int, error) {
+	if opts.MaxEntries == 0 {
+		opts.MaxEntries = DefaultMaxEntries
+	}
+	if opts.MaxBytes == 0 {
+		opts.MaxBytes = DefaultMaxBytes
+	}
+	ex := &extractor{
+		ctx:     ctx,
+		destDir: destDir,
+		opts:    opts,
+		rpt:     rpt,
+		p:       agentkit.Progress{Phase: "extracting", Unit: "files"},
+	}
+
+	var err error
+	if format == FormatZip {
+		err = ex.extractZip(archivePath)
+	} else {
+		err = ex.extractTarFile(archivePath, format)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := ex.createSymlinks(); err != nil {
+		return 0, err
+	}
+	return ex.files, nil
+}
+
+// extractor holds the state of one call to Extract.
+type extractor struct {
+	ctx     context.Context
+	destDir string
+	opts    Options
+	rpt     agentkit.Reporter
+	p       agentkit.Progress
+
+	files    int
+	symlinks []symlink
+
+	// entries and bytes are what has been written so far, to check
+	// against the limits in opts
+	entries int
+	bytes   int64
+}
+
+// symlink is a symbolic link waiting to be created, at rel (relative to
+// destDir, with "/" separators) and pointing to target.
+type symlink struct {
+	rel    string
+	target string
+}
+
+// extractTarFile unpacks a tar archive, decompressing it first as
+// format says.
+func (ex *extractor) extractTarFile(archivePath string, format Format) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader
+	switch format {
+	case FormatTar:
+		r = f
+	case FormatTarGz:
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("couldn't decompress gzip archive: %v", err)
+		}
+		defer gz.Close()
+		r = gz
+	case FormatTarXz:
+		xzr, err := xz.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("couldn't decompress xz archive: %v", err)
+		}
+		r = xzr
+	case FormatTarBz2:
+		r = bzip2.NewReader(f)
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		if err := ex.ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't read tar archive: %v", err)
+		}
+
+		rel, ok, err := ex.relPath(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = ex.mkdir(rel)
+		case tar.TypeReg, tar.TypeRegA:
+			err = ex.writeFile(rel, tr, hdr.FileInfo().Mode())
+		case tar.TypeSymlink:
+			err = ex.addSymlink(rel, hdr.Linkname)
+		case tar.TypeLink:
+			err = ex.hardLink(rel, hdr.Linkname)
+		case tar.TypeXGlobalHeader:
+			// pax global headers hold metadata, not files
+		default:
+			log.Printf("==> skipping %s in archive: unsupported type %q", hdr.Name, hdr.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extractZip unpacks a zip archive.
+func (ex *extractor) extractZip(archivePath string) error {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("couldn't read zip archive: %v", err)
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		if err := ex.ctx.Err(); err != nil {
+			return err
+		}
+		rel, ok, err := ex.relPath(zf.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		mode := zf.Mode()
+		switch {
+		case mode.IsDir():
+			err = ex.mkdir(rel)
+		case mode&os.ModeSymlink != 0:
+			err = ex.zipSymlink(rel, zf)
+		case mode.IsRegular():
+			err = ex.zipFile(rel, zf)
+		default:
+			log.Printf("==> skipping %s in archive: unsupported mode %v", zf.Name, mode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ex *extractor) zipFile(rel string, zf *zip.File) error {
+	rc, err := zf.Open()
+	if err != nil {
+		return fmt.Errorf("couldn't read %s from zip archive: %v", zf.Name, err)
+	}
+	defer rc.Close()
+	return ex.writeFile(rel, rc, zf.Mode())
+}
+
+func (ex *extractor) zipSymlink(rel string, zf *zip.File) error {
+	rc, err := zf.Open()
+	if err != nil {
+		return fmt.Errorf("couldn't read %s from zip archive: %v", zf.Name, err)
+	}
+	defer rc.Close()
+	target, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return fmt.Errorf("couldn't read %s from zip archive: %v", zf.Name, err)
+	}
+	return ex.addSymlink(rel, string(target))
+}
+
+// relPath turns name, a path from the archive, into a clean relative
+// path within destDir, with "/" separators, after stripping leading
+// components. It returns false if the entry should be skipped, and an
+// error if name would escape destDir.
+func (ex *extractor) relPath(name string) (string, bool, error) {
+	if strings.HasPrefix(name, "/") || filepath.IsAbs(name) {
+		return "", false, fmt.Errorf("archive entry %q has an absolute path", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", false, fmt.Errorf("archive entry %q is outside the archive's directory", name)
+		}
+	}
+
+	rel := path.Clean(name)
+	if rel == "." {
+		return "", false, nil
+	}
+	if ex.opts.StripComponents > 0 {
+		parts := strings.Split(rel, "/")
+		if len(parts) <= ex.opts.StripComponents {
+			return "", false, nil
+		}
+		rel = strings.Join(parts[ex.opts.StripComponents:], "/")
+	}
+	return rel, true, nil
+}
+
+// checkParents makes sure that none of the directories leading to rel
+// is a symbolic link, so that writing rel can't end up outside destDir.
+// Symlinks from the archive aren't created until the end, but this also
+// guards against one that was already in destDir.
+func (ex *extractor) checkParents(rel string) error {
+	p := ex.destDir
+	parts := strings.Split(rel, "/")
+	for _, part := range parts[:len(parts)-1] {
+		p = filepath.Join(p, part)
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("archive entry %q would be written through a symbolic link", rel)
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("archive entry %q is inside %q, which is not a directory", rel, part)
+		}
+	}
+	return nil
+}
+
+// addEntry counts another entry created from the archive, and checks
+// that there haven't been too many.
+func (ex *extractor) addEntry() error {
+	ex.entries++
+	if ex.opts.MaxEntries > 0 && ex.entries > ex.opts.MaxEntries {
+		return fmt.Errorf("archive has more than %d entries", ex.opts.MaxEntries)
+	}
+	return nil
+}
+
+func (ex *extractor) mkdir(rel string) error {
+	if err := ex.checkParents(rel); err != nil {
+		return err
+	}
+	if err := ex.addEntry(); err != nil {
+		return err
+	}
+	return os.MkdirAll(filepath.Join(ex.destDir, filepath.FromSlash(rel)), 0755)
+}
+
+// writeFile writes r to rel, replacing any file already there, as tar
+// does when an archive has more than one entry for the same path.
+func (ex *extractor) writeFile(rel string, r io.Reader, mode os.FileMode) error {
+	if err := ex.checkParents(rel); err != nil {
+		return err
+	}
+	if err := ex.addEntry(); err != nil {
+		return err
+	}
+	p := filepath.Join(ex.destDir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(p); err == nil {
+		if fi.IsDir() {
+			return fmt.Errorf("archive entry %q is a file, but is already a directory", rel)
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+	}
+
+	// like git, only keep track of whether files are executable
+	perm := os.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	// the sizes in an archive's headers can't be trusted, so count
+	// what is actually written, allowing one byte more than the limit
+	// to find out whether there was more
+	if ex.opts.MaxBytes > 0 {
+		r = io.LimitReader(r, ex.opts.MaxBytes-ex.bytes+1)
+	}
+	n, err := io.Copy(f, r)
+	ex.bytes += n
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("couldn't extract %s: %v", rel, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if ex.opts.MaxBytes > 0 && ex.bytes > ex.opts.MaxBytes {
+		return fmt.Errorf("archive extracts to more than %d bytes", ex.opts.MaxBytes)
+	}
+
+	ex.files++
+	ex.p.Done = int64(ex.files)
+	ex.rpt.Progress(ex.p)
+	return nil
+}
+
+// hardLink makes rel a copy of linkname, which must be a regular file
+// that has already been extracted.
+func (ex *extractor) hardLink(rel string, linkname string) error {
+	targetRel, ok, err := ex.relPath(linkname)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("archive entry %q links to %q, which was not extracted", rel, linkname)
+	}
+	if err := ex.checkParents(targetRel); err != nil {
+		return err
+	}
+	target := filepath.Join(ex.destDir, filepath.FromSlash(targetRel))
+	fi, err := os.Lstat(target)
+	if err != nil || !fi.Mode().IsRegular() {
+		return fmt.Errorf("archive entry %q links to %q, which is not a file extracted before it", rel, linkname)
+	}
+
+	f, err := os.Open(target)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return ex.writeFile(rel, f, fi.Mode())
+}
+
+// addSymlink checks that a symbolic link at rel to target would stay
+// within destDir, and records it to be created at the end.
+func (ex *extractor) addSymlink(rel string, target string) error {
+	if target == "" || strings.HasPrefix(target, "/") || filepath.IsAbs(target) {
+		return fmt.Errorf("archive entry %q is a symbolic link to absolute path %q", rel, target)
+	}
+	resolved := path.Join(path.Dir(rel), target)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return fmt.Errorf("archive entry %q is a symbolic link to %q, outside the archive's directory", rel, target)
+	}
+	if err := ex.addEntry(); err != nil {
+		return err
+	}
+	ex.symlinks = append(ex.symlinks, symlink{rel: rel, target: target})
+	return nil
+}
+
+// createSymlinks creates the symbolic links recorded by addSymlink, and
+// then checks that each one that can be resolved, now that all of them
+// exist, still resolves to somewhere within destDir. This catches
+// links that only escape by way of another link.
+func (ex *extractor) createSymlinks() error {
+	for _, sl := range ex.symlinks {
+		if err := ex.checkParents(sl.rel); err != nil {
+			return err
+		}
+		p := filepath.Join(ex.destDir, filepath.FromSlash(sl.rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if fi, err := os.Lstat(p); err == nil {
+			if fi.IsDir() {
+				return fmt.Errorf("archive entry %q is a symbolic link, but is already a directory", sl.rel)
+			}
+			if err := os.Remove(p); err != nil {
+				return err
+			}
+		}
+		if err := os.Symlink(sl.target, p); err != nil {
+			return err
+		}
+	}
+
+	root, err := filepath.EvalSymlinks(ex.destDir)
+	if err != nil {
+		return err
+	}
+	for _, sl := range ex.symlinks {
+		p := filepath.Join(ex.destDir, filepath.FromSlash(sl.rel))
+		resolved, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			// dangling links can't be followed anywhere
+			continue
+		}
+		if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+			return fmt.Errorf("archive entry %q is a symbolic link that resolves outside the archive's directory", sl.rel)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,394 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+)
+
+// nopReporter discards everything reported to it.
+type nopReporter struct{}
+
+func (nopReporter) Running()                     {}
+func (nopReporter) Output(msg string)            {}
+func (nopReporter) Degraded(msg string)          {}
+func (nopReporter) Progress(p agentkit.Progress) {}
+
+// entry is an entry in a test archive. It is a directory if dir is
+// true, a symbolic link if link is set, a hard link if hard is set,
+// and otherwise a file holding body.
+type entry struct {
+	name string
+	body string
+	dir  bool
+	link string
+	hard string
+}
+
+// writeArchive writes entries as an archive of format to path.
+func writeArchive(t *testing.T, path string, format Format, entries []entry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if format == FormatZip {
+		zw := zip.NewWriter(f)
+		for _, e := range entries {
+			fh := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+			body := e.body
+			switch {
+			case e.dir:
+				fh.Name += "/"
+				fh.SetMode(os.ModeDir | 0755)
+			case e.link != "":
+				fh.SetMode(os.ModeSymlink | 0777)
+				body = e.link
+			default:
+				fh.SetMode(0644)
+			}
+			w, err := zw.CreateHeader(fh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(w, body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	var w io.Writer = f
+	if format == FormatTarGz {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.body))}
+		switch {
+		case e.dir:
+			hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0755, 0
+		case e.link != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.link, 0
+		case e.hard != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeLink, e.hard, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			if _, err := io.WriteString(tw, e.body); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listTree returns what is in dir: each file's content, "-> target" for
+// each symbolic link and "/" for each directory, by path relative to
+// dir with "/" separators.
+func listTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	got := map[string]string{}
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			got[rel] = "-> " + target
+		case fi.IsDir():
+			got[rel] = "/"
+		default:
+			b, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			got[rel] = string(b)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    Format
+		entries   []entry
+		opts      Options
+		want      map[string]string
+		wantFiles int
+		wantErr   string
+	}{
+		{
+			name:   "files and directories",
+			format: FormatTarGz,
+			entries: []entry{
+				{name: "src", dir: true},
+				{name: "src/a.c", body: "int a;"},
+				{name: "README", body: "hello"},
+			},
+			want:      map[string]string{"src": "/", "src/a.c": "int a;", "README": "hello"},
+			wantFiles: 2,
+		},
+		{
+			name:   "strip components",
+			format: FormatTar,
+			entries: []entry{
+				{name: "pkg-1.0/a.c", body: "a"},
+				{name: "pkg-1.0/sub/b.c", body: "b"},
+				{name: "top", body: "skipped"},
+			},
+			opts:      Options{StripComponents: 1},
+			want:      map[string]string{"a.c": "a", "sub": "/", "sub/b.c": "b"},
+			wantFiles: 2,
+		},
+		{
+			name:    "absolute path",
+			format:  FormatTar,
+			entries: []entry{{name: "/etc/evil", body: "x"}},
+			wantErr: "absolute path",
+		},
+		{
+			name:    "parent directory",
+			format:  FormatTar,
+			entries: []entry{{name: "../evil", body: "x"}},
+			wantErr: "outside the archive's directory",
+		},
+		{
+			name:    "parent directory within path",
+			format:  FormatZip,
+			entries: []entry{{name: "a/../../evil", body: "x"}},
+			wantErr: "outside the archive's directory",
+		},
+		{
+			name:   "symbolic link within archive",
+			format: FormatTar,
+			entries: []entry{
+				{name: "sub/a.c", body: "a"},
+				{name: "link", link: "sub/a.c"},
+			},
+			want:      map[string]string{"sub": "/", "sub/a.c": "a", "link": "-> sub/a.c"},
+			wantFiles: 1,
+		},
+		{
+			name:    "symbolic link to absolute path",
+			format:  FormatTar,
+			entries: []entry{{name: "link", link: "/etc/passwd"}},
+			wantErr: "absolute path",
+		},
+		{
+			name:    "symbolic link outside archive",
+			format:  FormatZip,
+			entries: []entry{{name: "sub/link", link: "../../etc"}},
+			wantErr: "outside the archive's directory",
+		},
+		{
+			name:   "symbolic link escaping through another",
+			format: FormatTar,
+			entries: []entry{
+				{name: "d", dir: true},
+				{name: "d/up", link: ".."},
+				{name: "d/esc", link: "up/.."},
+			},
+			wantErr: "resolves outside the archive's directory",
+		},
+		{
+			name:   "file written through symbolic link",
+			format: FormatTar,
+			entries: []entry{
+				{name: "sub", dir: true},
+				{name: "link", link: "sub"},
+				{name: "link/f", body: "x"},
+			},
+			wantErr: "already a directory",
+		},
+		{
+			name:   "hard link",
+			format: FormatTar,
+			entries: []entry{
+				{name: "a", body: "same"},
+				{name: "b", hard: "a"},
+			},
+			want:      map[string]string{"a": "same", "b": "same"},
+			wantFiles: 2,
+		},
+		{
+			name:    "hard link outside archive",
+			format:  FormatTar,
+			entries: []entry{{name: "b", hard: "../a"}},
+			wantErr: "outside the archive's directory",
+		},
+		{
+			name:   "too many entries",
+			format: FormatZip,
+			entries: []entry{
+				{name: "a", body: "a"},
+				{name: "b", body: "b"},
+				{name: "c", body: "c"},
+			},
+			opts:    Options{MaxEntries: 2},
+			wantErr: "more than 2 entries",
+		},
+		{
+			name:      "entries at limit",
+			format:    FormatZip,
+			entries:   []entry{{name: "a", body: "a"}, {name: "b", body: "b"}},
+			opts:      Options{MaxEntries: 2},
+			want:      map[string]string{"a": "a", "b": "b"},
+			wantFiles: 2,
+		},
+		{
+			name:    "too many bytes",
+			format:  FormatTarGz,
+			entries: []entry{{name: "a", body: "12345"}, {name: "b", body: strings.Repeat("0", 1<<20)}},
+			opts:    Options{MaxBytes: 1000},
+			wantErr: "more than 1000 bytes",
+		},
+		{
+			name:      "bytes at limit",
+			format:    FormatZip,
+			entries:   []entry{{name: "a", body: "12345"}, {name: "b", body: "67890"}},
+			opts:      Options{MaxBytes: 10},
+			want:      map[string]string{"a": "12345", "b": "67890"},
+			wantFiles: 2,
+		},
+		{
+			name:      "no limits",
+			format:    FormatTar,
+			entries:   []entry{{name: "a", body: "12345"}},
+			opts:      Options{MaxEntries: -1, MaxBytes: -1},
+			want:      map[string]string{"a": "12345"},
+			wantFiles: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "extract-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+			archivePath := filepath.Join(root, "archive")
+			writeArchive(t, archivePath, tt.format, tt.entries)
+			destDir := filepath.Join(root, "out")
+			if err := os.Mkdir(destDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			files, err := Extract(context.Background(), archivePath, tt.format, destDir, tt.opts, nopReporter{})
+
+			// whatever happens, nothing may be written beside destDir
+			names := []string{}
+			fis, _ := ioutil.ReadDir(root)
+			for _, fi := range fis {
+				names = append(names, fi.Name())
+			}
+			sort.Strings(names)
+			if strings.Join(names, ",") != "archive,out" {
+				t.Errorf("got %v beside the output directory, want only the archive", names)
+			}
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+			if files != tt.wantFiles {
+				t.Errorf("got %d files, want %d", files, tt.wantFiles)
+			}
+			got := listTree(t, destDir)
+			if len(got) != len(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			for p, want := range tt.want {
+				if got[p] != want {
+					t.Errorf("%s: got %q, want %q", p, got[p], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Format
+		wantErr bool
+	}{
+		{s: "tar", want: FormatTar},
+		{s: "TGZ", want: FormatTarGz},
+		{s: "tar.gz", want: FormatTarGz},
+		{s: "txz", want: FormatTarXz},
+		{s: "tbz", want: FormatTarBz2},
+		{s: "zip", want: FormatZip},
+		{s: "rar", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFormat(tt.s)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q, error %t", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "detect-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, format := range []Format{FormatTar, FormatTarGz, FormatZip} {
+		p := filepath.Join(dir, string(format))
+		writeArchive(t, p, format, []entry{{name: "a", body: "a"}})
+		if got, err := DetectFormat(p); err != nil || got != format {
+			t.Errorf("DetectFormat of %s archive = %q, %v", format, got, err)
+		}
+	}
+	p := filepath.Join(dir, "text")
+	if err := ioutil.WriteFile(p, []byte("not an archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DetectFormat(p); err == nil {
+		t.Errorf("DetectFormat of a text file succeeded, want error")
+	}
+}
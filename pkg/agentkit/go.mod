@@ -0,0 +1,10 @@
+module github.com/swinslow/peridot-agents/pkg/agentkit
+
+go 1.13
+
+require (
+	github.com/spdx/tools-golang v0.5.5
+	github.com/swinslow/peridot-jobrunner v0.0.0-20191124161321-701dbac8170c
+	github.com/ulikunitz/xz v0.5.15
+	google.golang.org/grpc v1.25.1
+)
@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package agentkit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// TimeoutKey is the job key/value that sets an upper bound on how long
+// a job may run, for any agent built on agentkit. Its value is a Go
+// duration string such as "90s" or "30m". If the job is still running
+// when the timeout expires, its context is cancelled and the job stops
+// with ERROR health.
+const TimeoutKey = "timeout"
+
+// HeartbeatKey is the job key/value that sets how often a running job
+// sends a status report to the controller, even if nothing else has
+// happened, so that a long-running job can be told apart from a hung
+// one. Its value is a Go duration string, or "0" to turn heartbeats
+// off. If not set, DefaultHeartbeat is used.
+const HeartbeatKey = "heartbeat"
+
+// DefaultHeartbeat is how often a running job sends a status report if
+// the job does not set HeartbeatKey.
+const DefaultHeartbeat = 30 * time.Second
+
+// getHeartbeat returns the interval configured by the job's
+// HeartbeatKey key/value, or DefaultHeartbeat if none was configured.
+// It returns zero if heartbeats are turned off.
+func getHeartbeat(cfg agent.JobConfig) (time.Duration, error) {
+	heartbeat := DefaultHeartbeat
+	for _, jkv := range cfg.Jkvs {
+		if jkv.Key == HeartbeatKey {
+			d, err := time.ParseDuration(jkv.Value)
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s value %q: %v", HeartbeatKey, jkv.Value, err)
+			}
+			if d < 0 {
+				return 0, fmt.Errorf("invalid %s value %q: must not be negative", HeartbeatKey, jkv.Value)
+			}
+			heartbeat = d
+		}
+	}
+	return heartbeat, nil
+}
+
+// getTimeout returns the duration configured by the job's TimeoutKey
+// key/value, or zero if none was configured.
+func getTimeout(cfg agent.JobConfig) (time.Duration, error) {
+	var timeout time.Duration
+	for _, jkv := range cfg.Jkvs {
+		if jkv.Key == TimeoutKey {
+			d, err := time.ParseDuration(jkv.Value)
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s value %q: %v", TimeoutKey, jkv.Value, err)
+			}
+			if d <= 0 {
+				return 0, fmt.Errorf("invalid %s value %q: must be positive", TimeoutKey, jkv.Value)
+			}
+			timeout = d
+		}
+	}
+	return timeout, nil
+}
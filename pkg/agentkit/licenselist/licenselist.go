@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+// Package licenselist loads the SPDX license list, from a directory
+// laid out as in the spdx/license-list-data repository, for agents
+// that check or match licenses against it.
+package licenselist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultDir is where the agents' Docker images bundle a copy of the
+// license list.
+const DefaultDir = "/spdx-license-list-data"
+
+// Dir returns the directory named by the environment variable env, or
+// DefaultDir if it isn't set.
+func Dir(env string) string {
+	if dir := os.Getenv(env); dir != "" {
+		return dir
+	}
+	return DefaultDir
+}
+
+// ID is a license or exception on the license list.
+type ID struct {
+	ID         string
+	Deprecated bool
+}
+
+// List holds the identifiers on the license list. Licenses and
+// Exceptions are keyed by the identifier in lower case, because
+// identifiers are matched without regard to case.
+type List struct {
+	Dir        string
+	Version    string
+	Licenses   map[string]*ID
+	Exceptions map[string]*ID
+}
+
+// Load reads the license list in dir, from json/licenses.json and
+// json/exceptions.json.
+func Load(dir string) (*List, error) {
+	var licenses struct {
+		LicenseListVersion string `json:"licenseListVersion"`
+		Licenses           []struct {
+			LicenseID    string `json:"licenseId"`
+			IsDeprecated bool   `json:"isDeprecatedLicenseId"`
+		} `json:"licenses"`
+	}
+	if err := readJSON(filepath.Join(dir, "json", "licenses.json"), &licenses); err != nil {
+		return nil, err
+	}
+	var exceptions struct {
+		Exceptions []struct {
+			LicenseExceptionID string `json:"licenseExceptionId"`
+			IsDeprecated       bool   `json:"isDeprecatedLicenseId"`
+		} `json:"exceptions"`
+	}
+	if err := readJSON(filepath.Join(dir, "json", "exceptions.json"), &exceptions); err != nil {
+		return nil, err
+	}
+
+	l := &List{
+		Dir:        dir,
+		Version:    licenses.LicenseListVersion,
+		Licenses:   map[string]*ID{},
+		Exceptions: map[string]*ID{},
+	}
+	for _, lic := range licenses.Licenses {
+		l.Licenses[strings.ToLower(lic.LicenseID)] = &ID{ID: lic.LicenseID, Deprecated: lic.IsDeprecated}
+	}
+	for _, e := range exceptions.Exceptions {
+		l.Exceptions[strings.ToLower(e.LicenseExceptionID)] = &ID{ID: e.LicenseExceptionID, Deprecated: e.IsDeprecated}
+	}
+	if len(l.Licenses) == 0 {
+		return nil, fmt.Errorf("no licenses found in %s", filepath.Join(dir, "json", "licenses.json"))
+	}
+	return l, nil
+}
+
+// readJSON parses the JSON file at path into v.
+func readJSON(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("couldn't parse %s: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// Current returns the identifiers of the licenses that aren't
+// deprecated, in order.
+func (l *List) Current() []string {
+	ids := []string{}
+	for _, lic := range l.Licenses {
+		if !lic.Deprecated {
+			ids = append(ids, lic.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Segments returns the text that a file must contain to match the
+// license id, as segments that are each matched separately, because
+// the replaceable or optional text between them can be anything. The
+// text is read from the license's template in
+// template/<id>.template.txt, with the parts that it marks as
+// replaceable or optional left out, or if there isn't one, from its
+// plain text in text/<id>.txt.
+func (l *List) Segments(id string) ([]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(l.Dir, "template", id+".template.txt"))
+	if err == nil {
+		segments, err := TemplateSegments(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read template for %s: %v", id, err)
+		}
+		return segments, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	b, err = ioutil.ReadFile(filepath.Join(l.Dir, "text", id+".txt"))
+	if err != nil {
+		return nil, err
+	}
+	return []string{string(b)}, nil
+}
+
+// TemplateSegments splits a license template into the runs of text
+// between its markup, leaving out the text inside <<beginOptional>>
+// and <<endOptional>>, which may be nested, and the <<var;...>> markup
+// for replaceable text.
+func TemplateSegments(tmpl string) ([]string, error) {
+	segments := []string{}
+	depth := 0
+	for {
+		start := strings.Index(tmpl, "<<")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(tmpl[start:], ">>")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated markup %q", tmpl[start:])
+		}
+		if depth == 0 {
+			segments = append(segments, tmpl[:start])
+		}
+
+		switch markup := tmpl[start+2 : start+end]; {
+		case markup == "beginOptional" || strings.HasPrefix(markup, "beginOptional;"):
+			depth++
+		case markup == "endOptional":
+			if depth == 0 {
+				return nil, fmt.Errorf("<<endOptional>> without <<beginOptional>>")
+			}
+			depth--
+		case strings.HasPrefix(markup, "var;"):
+		default:
+			return nil, fmt.Errorf("unknown markup <<%s>>", markup)
+		}
+		tmpl = tmpl[start+end+2:]
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("<<beginOptional>> without <<endOptional>>")
+	}
+	return append(segments, tmpl), nil
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package licenselist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeList writes a small license list to a new directory, and
+// returns it.
+func writeList(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "licenselist-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"json/licenses.json": `{"licenseListVersion": "3.7", "licenses": [
+			{"licenseId": "MIT", "isDeprecatedLicenseId": false},
+			{"licenseId": "Apache-2.0", "isDeprecatedLicenseId": false},
+			{"licenseId": "GPL-2.0", "isDeprecatedLicenseId": true}
+		]}`,
+		"json/exceptions.json": `{"exceptions": [
+			{"licenseExceptionId": "Classpath-exception-2.0", "isDeprecatedLicenseId": false}
+		]}`,
+		"text/MIT.txt":                     "MIT License text",
+		"text/Apache-2.0.txt":              "Apache License text",
+		"template/Apache-2.0.template.txt": "Apache <<var;name=x;original=y;match=.+>>License<<beginOptional>> optional<<endOptional>> text",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeList(t)
+	defer os.RemoveAll(dir)
+
+	l, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if l.Version != "3.7" {
+		t.Errorf("Version = %q, want %q", l.Version, "3.7")
+	}
+	if got := l.Licenses["gpl-2.0"]; got == nil || got.ID != "GPL-2.0" || !got.Deprecated {
+		t.Errorf("Licenses[gpl-2.0] = %+v, want deprecated GPL-2.0", got)
+	}
+	if got := l.Exceptions["classpath-exception-2.0"]; got == nil || got.ID != "Classpath-exception-2.0" {
+		t.Errorf("Exceptions[classpath-exception-2.0] = %+v, want Classpath-exception-2.0", got)
+	}
+	if want := []string{"Apache-2.0", "MIT"}; !reflect.DeepEqual(l.Current(), want) {
+		t.Errorf("Current() = %v, want %v", l.Current(), want)
+	}
+
+	// the template is preferred to the plain text
+	segs, err := l.Segments("Apache-2.0")
+	if err != nil {
+		t.Fatalf("Segments(Apache-2.0): %v", err)
+	}
+	if want := []string{"Apache ", "License", " text"}; !reflect.DeepEqual(segs, want) {
+		t.Errorf("Segments(Apache-2.0) = %q, want %q", segs, want)
+	}
+	segs, err = l.Segments("MIT")
+	if err != nil {
+		t.Fatalf("Segments(MIT): %v", err)
+	}
+	if want := []string{"MIT License text"}; !reflect.DeepEqual(segs, want) {
+		t.Errorf("Segments(MIT) = %q, want %q", segs, want)
+	}
+}
+
+func TestLoadMissingIndex(t *testing.T) {
+	dir := writeList(t)
+	defer os.RemoveAll(dir)
+	if err := os.Remove(filepath.Join(dir, "json", "exceptions.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil {
+		t.Errorf("Load without exceptions.json succeeded, want error")
+	}
+}
+
+func TestTemplateSegments(t *testing.T) {
+	tests := []struct {
+		tmpl    string
+		want    []string
+		wantErr bool
+	}{
+		{tmpl: "plain", want: []string{"plain"}},
+		{tmpl: "a <<var;name=n;original=o;match=.+>> b", want: []string{"a ", " b"}},
+		{tmpl: "a<<beginOptional>>x<<beginOptional;name=n>>y<<endOptional>>z<<endOptional>>b", want: []string{"a", "b"}},
+		{tmpl: "a <<beginOptional>> b", wantErr: true},
+		{tmpl: "a <<endOptional>> b", wantErr: true},
+		{tmpl: "a <<var;name=n", wantErr: true},
+		{tmpl: "a <<unknown>> b", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := TemplateSegments(tt.tmpl)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("TemplateSegments(%q) = %q, want error", tt.tmpl, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("TemplateSegments(%q): %v", tt.tmpl, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("TemplateSegments(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package agentkit
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// PrepareCodeOutputDir checks that the job has a codeOutputDir, and
+// creates it if need be. The directory must be empty, so that if the
+// agent fails part-way, RemoveDirContents can clean up after it without
+// removing anything that was already there.
+func PrepareCodeOutputDir(dir string) error {
+	// check that we got a non-empty code output directory
+	if dir == "" {
+		return fmt.Errorf("no codeOutputDir specified")
+	}
+
+	// try to create directory at this location
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("couldn't create codeOutputDir %s: %v", dir, err)
+	}
+
+	// check whether path is a directory
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("tried to create codeOutputDir %s but path not found: %v", dir, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("tried to create codeOutputDir %s but it is not a directory", dir)
+	}
+
+	// and check that it's empty
+	isEmpty, err := isDirEmpty(dir)
+	if err != nil {
+		return fmt.Errorf("couldn't read codeOutputDir %s: %v", dir, err)
+	}
+	if !isEmpty {
+		return fmt.Errorf("codeOutputDir %s is not empty", dir)
+	}
+	return nil
+}
+
+// RemoveDirContents removes everything inside dir, but not dir itself.
+// Errors are logged rather than returned, since it is used for cleaning
+// up after a job that has already failed.
+func RemoveDirContents(dir string) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Printf("==> couldn't list %s for clean-up: %v", dir, err)
+		return
+	}
+	for _, fi := range fis {
+		p := filepath.Join(dir, fi.Name())
+		if err := os.RemoveAll(p); err != nil {
+			log.Printf("==> couldn't remove %s during clean-up: %v", p, err)
+		}
+	}
+}
+
+// isDirEmpty returns whether dir has nothing in it.
+func isDirEmpty(dir string) (bool, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	_, err = f.Readdirnames(1)
+	if err == io.EOF {
+		return true, nil
+	}
+	return false, err
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package agentkit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// ValidatePathPattern checks that pattern is a pattern that MatchPath
+// can use.
+func ValidatePathPattern(pattern string) error {
+	p := strings.TrimSuffix(strings.TrimPrefix(pattern, "/"), "/")
+	if p == "" {
+		return fmt.Errorf("path pattern %q is empty", pattern)
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == "**" {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("path pattern %q is invalid: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// MatchPath reports whether rel, a path relative to the top of a tree
+// with "/" as separator, matches pattern. isDir says whether rel is a
+// directory. Patterns are globs as for path.Match, with these
+// additions, as in .gitignore files:
+//
+//   - a pattern with no "/" in it, other than a trailing one, matches
+//     a file or directory with that name anywhere in the tree;
+//   - otherwise, the pattern matches relative to the top of the tree,
+//     whether or not it starts with "/";
+//   - a "**" component matches any number of directories, including
+//     none; and
+//   - a pattern ending in "/" only matches directories.
+//
+// Invalid patterns match nothing.
+func MatchPath(pattern string, rel string, isDir bool) bool {
+	if strings.HasSuffix(pattern, "/") {
+		if !isDir {
+			return false
+		}
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+// MatchPathOrParent reports whether rel, or any of the directories
+// leading to it, matches pattern, so that a pattern naming a directory
+// also covers everything inside it.
+func MatchPathOrParent(pattern string, rel string, isDir bool) bool {
+	if MatchPath(pattern, rel, isDir) {
+		return true
+	}
+	for dir := path.Dir(rel); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if MatchPath(pattern, dir, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches a pattern against a path, both split into
+// their "/"-separated components.
+func matchSegments(pat []string, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			// try letting "**" swallow each possible number of segments
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pat[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat = pat[1:]
+		segs = segs[1:]
+	}
+	return len(segs) == 0
+}
+
+// IgnoreList decides which paths in a tree to ignore, from patterns
+// with the same meaning as the lines of a .gitignore file: each is a
+// pattern for MatchPath, or a "!" and a pattern to stop ignoring what
+// an earlier pattern ignored. Later patterns take precedence, and
+// anything inside an ignored directory is ignored too.
+type IgnoreList struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	pattern string
+	negate  bool
+}
+
+// Add adds pattern to the list.
+func (il *IgnoreList) Add(pattern string) error {
+	negate := strings.HasPrefix(pattern, "!")
+	if negate {
+		pattern = pattern[1:]
+	}
+	if err := ValidatePathPattern(pattern); err != nil {
+		return err
+	}
+	il.rules = append(il.rules, ignoreRule{pattern: pattern, negate: negate})
+	return nil
+}
+
+// AddFile adds the patterns in the gitignore-style file at path to the
+// list, and returns how many there were. Blank lines and lines starting
+// with "#" are skipped, and trailing spaces are removed unless escaped
+// with "\". Errors reading the file are returned as they are, so that
+// callers can check for os.IsNotExist.
+func (il *IgnoreList) AddFile(path string) (int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+			line = strings.TrimSuffix(line, " ")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := il.Add(line); err != nil {
+			return n, fmt.Errorf("%s:%d: %v", path, i+1, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Len returns the number of patterns in the list.
+func (il *IgnoreList) Len() int {
+	return len(il.rules)
+}
+
+// Ignored reports whether rel, a path relative to the top of the tree
+// with "/" as separator, should be ignored. isDir says whether rel is
+// a directory.
+func (il *IgnoreList) Ignored(rel string, isDir bool) bool {
+	if il == nil || len(il.rules) == 0 {
+		return false
+	}
+	rel = strings.TrimPrefix(rel, "/")
+	// as in git, nothing can be un-ignored inside an ignored directory
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if il.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return il.match(rel, isDir)
+}
+
+// match reports whether the last rule matching rel ignores it.
+func (il *IgnoreList) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range il.rules {
+		if MatchPath(r.pattern, rel, isDir) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
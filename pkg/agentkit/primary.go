@@ -1,5 +1,5 @@
 // SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
-package main
+package agentkit
 
 import (
 	"context"
@@ -10,43 +10,9 @@ import (
 	"github.com/swinslow/peridot-jobrunner/pkg/status"
 )
 
-type idsearcher struct{}
-
-type reqType uint8
-
-const (
-	reqStart = reqType(iota)
-	reqStatus
-)
-
-type reqMsg struct {
-	t   reqType
-	cfg *agent.JobConfig
-}
-
-type statusCurrent struct {
-	run            status.Status
-	health         status.Health
-	started        time.Time
-	finished       time.Time
-	outputMessages string
-}
-
-type statusUpdate struct {
-	run       status.Status
-	health    status.Health
-	now       time.Time
-	outputMsg string
-}
-
-type rptType struct {
-	sRpt   bool
-	status statusCurrent
-}
-
 // NewJob is the bidirectional streaming RPC that communicates with
 // the Controller.
-func (i *idsearcher) NewJob(stream agent.Agent_NewJobServer) error {
+func (a *Agent) NewJob(stream agent.Agent_NewJobServer) error {
 	defer log.Printf("==> CLOSING NewJob")
 	// now in a new, separate goroutine to handle this stream.
 
@@ -72,17 +38,51 @@ func (i *idsearcher) NewJob(stream agent.Agent_NewJobServer) error {
 	// the runAgent goroutine -- in which case we need to close it
 	createdAgent := false
 
+	// the job gets its own context, so that it can be cancelled
+	// when Agent.Stop asks for it to be stopped
+	jobCtx, jobCancel := context.WithCancel(ctx)
+	defer jobCancel()
+	stopRequested := false
+	stop := a.addJob()
+	defer a.removeJob(stop)
+
+	// heartbeat ticks while the job is running, to send a status
+	// report even if nothing has changed. it stays nil (and so never
+	// fires) until the job starts
+	var heartbeat <-chan time.Time
+
 	recvReq := make(chan reqMsg)
 	// receiver will own recvReq channel
 
 	// create sender goroutine
-	go i.sender(ctx, &stream, rptWanted)
+	go a.sender(ctx, &stream, rptWanted)
 
 	// create receiver goroutine
-	go i.receiver(ctx, &stream, recvReq)
+	go a.receiver(ctx, &stream, recvReq)
 
-	// now we just sit and listen on channels until it's time to exit
+	// stopJob handles a request to stop the job
 	exiting := false
+	stopJob := func() {
+		if !createdAgent {
+			// nothing is running, so there is nothing to clean
+			// up; just report that we're stopped
+			st.run = status.Status_STOPPED
+			st.finished = time.Now()
+			st.addOutput(StoppedMsg)
+			exiting = true
+			rptWanted <- rptType{sRpt: true, status: st}
+			return
+		}
+		if !stopRequested {
+			// cancel the job and keep listening. runAgent will
+			// send the final STOPPED update once the Runner has
+			// returned and cleaned up after itself
+			stopRequested = true
+			jobCancel()
+		}
+	}
+
+	// now we just sit and listen on channels until it's time to exit
 	for !exiting {
 		select {
 		case <-stream.Context().Done():
@@ -92,6 +92,11 @@ func (i *idsearcher) NewJob(stream agent.Agent_NewJobServer) error {
 			exiting = true
 			break
 		case su := <-setStatus:
+			// if the Runner failed because it was stopped,
+			// report that instead of the resulting cancellation error
+			if su.run == status.Status_STOPPED && stopRequested && su.health == status.Health_ERROR {
+				su.outputMsg = StoppedMsg
+			}
 			// update status values where filled in
 			if su.run != status.Status_STATUS_SAME {
 				st.run = su.run
@@ -100,7 +105,10 @@ func (i *idsearcher) NewJob(stream agent.Agent_NewJobServer) error {
 				st.health = su.health
 			}
 			if su.outputMsg != "" {
-				st.outputMessages += su.outputMsg
+				st.addOutput(su.outputMsg)
+			}
+			if su.progress != nil {
+				st.progress = su.progress
 			}
 			// additionally, if run status is now STOPPED, we are finished
 			// and exiting
@@ -108,7 +116,12 @@ func (i *idsearcher) NewJob(stream agent.Agent_NewJobServer) error {
 				st.finished = su.now
 				exiting = true
 			}
-			// finally, tell sender to send a status update
+			// finally, tell sender to send a status update, unless only
+			// the progress changed; that waits for the next heartbeat
+			if !su.progressOnly() {
+				rptWanted <- rptType{sRpt: true, status: st}
+			}
+		case <-heartbeat:
 			rptWanted <- rptType{sRpt: true, status: st}
 		case r, ok := <-recvReq:
 			if !ok {
@@ -119,12 +132,34 @@ func (i *idsearcher) NewJob(stream agent.Agent_NewJobServer) error {
 			}
 			switch r.t {
 			case reqStart:
+				if createdAgent {
+					log.Printf("==> ignoring start request; job already started")
+					break
+				}
+				interval, err := getHeartbeat(*r.cfg)
+				if err != nil {
+					// bad configuration; report it without starting
+					st.run = status.Status_STOPPED
+					st.health = status.Health_ERROR
+					st.finished = time.Now()
+					st.addOutput(err.Error())
+					exiting = true
+					rptWanted <- rptType{sRpt: true, status: st}
+					break
+				}
+				if interval > 0 {
+					ticker := time.NewTicker(interval)
+					defer ticker.Stop()
+					heartbeat = ticker.C
+				}
 				// create agent goroutine
-				go i.runAgent(ctx, *r.cfg, setStatus)
+				go a.runAgent(jobCtx, *r.cfg, setStatus)
 				createdAgent = true
 			case reqStatus:
 				rptWanted <- rptType{sRpt: true, status: st}
 			}
+		case <-stop:
+			stopJob()
 		}
 	}
 
@@ -134,12 +169,17 @@ func (i *idsearcher) NewJob(stream agent.Agent_NewJobServer) error {
 		close(setStatus)
 	} else {
 		// need to make sure the setStatus channel gets unblocked
-		// before we exit
+		// before we exit. the controller can no longer receive these
+		// updates, so log any final messages (such as the job having
+		// been cancelled) instead
 		for {
-			_, ok := <-setStatus
+			su, ok := <-setStatus
 			if !ok {
 				break
 			}
+			if su.outputMsg != "" {
+				log.Printf("==> job update after stream closed: %s", su.outputMsg)
+			}
 		}
 	}
 
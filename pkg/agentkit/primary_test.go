@@ -0,0 +1,366 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package agentkit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+	"github.com/swinslow/peridot-jobrunner/pkg/status"
+)
+
+// testTimeout is how long the tests wait for anything to happen before
+// deciding that it won't.
+const testTimeout = 5 * time.Second
+
+// fakeStream stands in for the controller's end of a NewJob stream.
+// Only the methods that NewJob uses are implemented; the embedded
+// interface is nil.
+type fakeStream struct {
+	agent.Agent_NewJobServer
+
+	ctx  context.Context
+	recv chan *agent.ControllerMsg
+	sent chan *agent.StatusReport
+}
+
+func newFakeStream() *fakeStream {
+	return &fakeStream{
+		ctx:  context.Background(),
+		recv: make(chan *agent.ControllerMsg),
+		sent: make(chan *agent.StatusReport, 100),
+	}
+}
+
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeStream) Recv() (*agent.ControllerMsg, error) {
+	m, ok := <-s.recv
+	if !ok {
+		return nil, io.EOF
+	}
+	return m, nil
+}
+
+func (s *fakeStream) Send(m *agent.AgentMsg) error {
+	s.sent <- m.GetStatus()
+	return nil
+}
+
+// start sends the controller's request to start a job with cfg.
+func (s *fakeStream) start(cfg *agent.JobConfig) {
+	s.recv <- &agent.ControllerMsg{Cm: &agent.ControllerMsg_Start{Start: &agent.StartReq{Config: cfg}}}
+}
+
+// status sends the controller's request for a status report.
+func (s *fakeStream) status() {
+	s.recv <- &agent.ControllerMsg{Cm: &agent.ControllerMsg_Status{Status: &agent.StatusReq{}}}
+}
+
+// next returns the next status report that the agent sends.
+func (s *fakeStream) next(t *testing.T) *agent.StatusReport {
+	t.Helper()
+	select {
+	case rpt := <-s.sent:
+		return rpt
+	case <-time.After(testTimeout):
+		t.Fatalf("timed out waiting for a status report")
+		return nil
+	}
+}
+
+// final returns the status report that says the job has stopped,
+// skipping any before it.
+func (s *fakeStream) final(t *testing.T) *agent.StatusReport {
+	t.Helper()
+	for {
+		if rpt := s.next(t); rpt.RunStatus == status.Status_STOPPED {
+			return rpt
+		}
+	}
+}
+
+// runnerFunc adapts a function to the Runner interface.
+type runnerFunc func(ctx context.Context, cfg agent.JobConfig, rpt Reporter) error
+
+func (f runnerFunc) Run(ctx context.Context, cfg agent.JobConfig, rpt Reporter) error {
+	return f(ctx, cfg, rpt)
+}
+
+// serve runs a's NewJob on a new fake stream, returning the stream and
+// a channel that is closed once NewJob has returned.
+func serve(a *Agent) (*fakeStream, <-chan struct{}) {
+	s := newFakeStream()
+	done := make(chan struct{})
+	go func() {
+		a.NewJob(s)
+		close(done)
+	}()
+	return s, done
+}
+
+// wait closes the controller's end of the stream, as the controller
+// does once the job has stopped, and waits for NewJob to return.
+func wait(t *testing.T, s *fakeStream, done <-chan struct{}) {
+	t.Helper()
+	close(s.recv)
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatalf("timed out waiting for NewJob to return")
+	}
+}
+
+func TestStop(t *testing.T) {
+	tests := []struct {
+		name string
+		// start is whether the job is started before it is stopped
+		start      bool
+		wantHealth status.Health
+	}{
+		{name: "running job", start: true, wantHealth: status.Health_ERROR},
+		{name: "job not yet started", start: false, wantHealth: status.Health_OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			a := New(runnerFunc(func(ctx context.Context, cfg agent.JobConfig, rpt Reporter) error {
+				rpt.Running()
+				close(started)
+				<-ctx.Done()
+				return ctx.Err()
+			}))
+			s, done := serve(a)
+
+			// a status report shows that NewJob has registered the job
+			s.status()
+			s.next(t)
+			if tt.start {
+				s.start(&agent.JobConfig{})
+				select {
+				case <-started:
+				case <-time.After(testTimeout):
+					t.Fatalf("timed out waiting for the job to start")
+				}
+			}
+
+			a.Stop()
+			rpt := s.final(t)
+			if rpt.HealthStatus != tt.wantHealth {
+				t.Errorf("got health %v, want %v", rpt.HealthStatus, tt.wantHealth)
+			}
+			if !strings.Contains(rpt.OutputMessages, StoppedMsg) {
+				t.Errorf("got output %q, want it to contain %q", rpt.OutputMessages, StoppedMsg)
+			}
+			wait(t, s, done)
+			if n := len(a.jobs); n != 0 {
+				t.Errorf("got %d jobs still registered, want 0", n)
+			}
+		})
+	}
+}
+
+func TestStreamClosedCancelsJob(t *testing.T) {
+	tests := []struct {
+		name string
+		// cancelStream is whether the stream's context is cancelled,
+		// rather than the controller closing its end of the stream
+		cancelStream bool
+	}{
+		{name: "controller closes stream", cancelStream: false},
+		{name: "stream context done", cancelStream: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			ctxErr := make(chan error, 1)
+			a := New(runnerFunc(func(ctx context.Context, cfg agent.JobConfig, rpt Reporter) error {
+				rpt.Running()
+				close(started)
+				<-ctx.Done()
+				ctxErr <- ctx.Err()
+				return ctx.Err()
+			}))
+
+			s := newFakeStream()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			s.ctx = ctx
+			done := make(chan struct{})
+			go func() {
+				a.NewJob(s)
+				close(done)
+			}()
+
+			s.start(&agent.JobConfig{})
+			select {
+			case <-started:
+			case <-time.After(testTimeout):
+				t.Fatalf("timed out waiting for the job to start")
+			}
+
+			if tt.cancelStream {
+				cancel()
+			} else {
+				close(s.recv)
+			}
+			select {
+			case err := <-ctxErr:
+				if err != context.Canceled {
+					t.Errorf("got job context error %v, want %v", err, context.Canceled)
+				}
+			case <-time.After(testTimeout):
+				t.Fatalf("timed out waiting for the job's context to be cancelled")
+			}
+
+			if tt.cancelStream {
+				wait(t, s, done)
+				return
+			}
+			select {
+			case <-done:
+			case <-time.After(testTimeout):
+				t.Fatalf("timed out waiting for NewJob to return")
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout string
+		// runErr is the error that the Runner returns once its context
+		// is done, or nil to return the context's own error
+		runErr     error
+		wantRun    bool
+		wantOutput string
+	}{
+		{name: "context error", timeout: "50ms", wantRun: true, wantOutput: "timed out after 50ms"},
+		{name: "runner error", timeout: "50ms", runErr: io.ErrUnexpectedEOF, wantRun: true, wantOutput: "timed out after 50ms: unexpected EOF"},
+		{name: "invalid", timeout: "soon", wantOutput: `invalid timeout value "soon"`},
+		{name: "not positive", timeout: "0s", wantOutput: `invalid timeout value "0s": must be positive`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran := false
+			ctxErr := make(chan error, 1)
+			a := New(runnerFunc(func(ctx context.Context, cfg agent.JobConfig, rpt Reporter) error {
+				ran = true
+				rpt.Running()
+				<-ctx.Done()
+				ctxErr <- ctx.Err()
+				if tt.runErr != nil {
+					return tt.runErr
+				}
+				return ctx.Err()
+			}))
+			s, done := serve(a)
+
+			s.start(&agent.JobConfig{Jkvs: []*agent.JobConfig_JobKV{
+				{Key: TimeoutKey, Value: tt.timeout},
+				{Key: HeartbeatKey, Value: "0"},
+			}})
+			rpt := s.final(t)
+			if rpt.HealthStatus != status.Health_ERROR {
+				t.Errorf("got health %v, want %v", rpt.HealthStatus, status.Health_ERROR)
+			}
+			if rpt.OutputMessages != tt.wantOutput && !strings.HasPrefix(rpt.OutputMessages, tt.wantOutput+":") {
+				t.Errorf("got output %q, want %q", rpt.OutputMessages, tt.wantOutput)
+			}
+			wait(t, s, done)
+
+			if ran != tt.wantRun {
+				t.Errorf("got runner called %t, want %t", ran, tt.wantRun)
+			}
+			if tt.wantRun {
+				if err := <-ctxErr; err != context.DeadlineExceeded {
+					t.Errorf("got job context error %v, want %v", err, context.DeadlineExceeded)
+				}
+			}
+		})
+	}
+}
+
+func TestProgressWaitsForReport(t *testing.T) {
+	a := New(runnerFunc(func(ctx context.Context, cfg agent.JobConfig, rpt Reporter) error {
+		rpt.Running()
+		for i := int64(1); i <= 100; i++ {
+			rpt.Progress(Progress{Phase: "scanning", Done: i, Total: 100, Unit: "files"})
+		}
+		rpt.Output("scanned")
+		return nil
+	}))
+	s, done := serve(a)
+
+	// with heartbeats off, progress alone never sends a report
+	s.start(&agent.JobConfig{Jkvs: []*agent.JobConfig_JobKV{{Key: HeartbeatKey, Value: "0"}}})
+	want := []struct {
+		run    status.Status
+		output string
+	}{
+		{status.Status_RUNNING, ""},
+		{status.Status_RUNNING, "scanned\nprogress: scanning; files: 100/100"},
+		{status.Status_STOPPED, "scanned"},
+	}
+	for i, w := range want {
+		rpt := s.next(t)
+		if rpt.RunStatus != w.run || rpt.OutputMessages != w.output {
+			t.Errorf("report %d: got %v %q, want %v %q", i, rpt.RunStatus, rpt.OutputMessages, w.run, w.output)
+		}
+	}
+	wait(t, s, done)
+	if n := len(s.sent); n != 0 {
+		t.Errorf("got %d more reports, want none", n)
+	}
+}
+
+func TestHeartbeatSendsProgress(t *testing.T) {
+	const steps = 3
+	next := make(chan struct{})
+	a := New(runnerFunc(func(ctx context.Context, cfg agent.JobConfig, rpt Reporter) error {
+		rpt.Running()
+		for i := int64(1); i <= steps; i++ {
+			rpt.Progress(Progress{Phase: "scanning", Done: i, Total: steps, Unit: "files"})
+			<-next
+		}
+		return nil
+	}))
+	s, done := serve(a)
+
+	s.start(&agent.JobConfig{Jkvs: []*agent.JobConfig_JobKV{{Key: HeartbeatKey, Value: "10ms"}}})
+	// only heartbeats report progress, so each step is seen in turn;
+	// the runner moves on to the next once it has been
+	seen := int64(0)
+	for {
+		rpt := s.next(t)
+		if rpt.RunStatus == status.Status_STOPPED {
+			break
+		}
+		i := strings.LastIndex(rpt.OutputMessages, "files: ")
+		if i < 0 {
+			continue
+		}
+		var got, total int64
+		if _, err := fmt.Sscanf(rpt.OutputMessages[i:], "files: %d/%d", &got, &total); err != nil {
+			t.Fatalf("couldn't parse progress in %q: %v", rpt.OutputMessages, err)
+		}
+		if got < seen {
+			t.Errorf("got progress %d after %d", got, seen)
+		}
+		if got > seen {
+			seen = got
+			next <- struct{}{}
+		}
+	}
+	if seen != steps {
+		t.Errorf("got progress up to %d, want %d", seen, steps)
+	}
+	wait(t, s, done)
+}
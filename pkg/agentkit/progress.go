@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package agentkit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Progress describes how far along a running job is. The most recent
+// Progress is included in each status report sent while the job is
+// running, as the last line of its output messages.
+type Progress struct {
+	// Phase is a short description of what the job is doing now,
+	// such as "cloning" or "searching".
+	Phase string
+
+	// Done and Total count the units of work finished so far and
+	// expected overall in this phase, such as files scanned. Total is
+	// zero if it is not known.
+	Done  int64
+	Total int64
+
+	// Unit names what Done and Total are counting, such as "files" or
+	// "objects".
+	Unit string
+
+	// Bytes is the number of bytes transferred so far, for phases that
+	// transfer data. It is zero if not applicable.
+	Bytes int64
+}
+
+// String formats the Progress as a single line of semicolon-separated
+// "key: value" fields, such as
+// "progress: searching; files: 120/400".
+func (p Progress) String() string {
+	fields := []string{"progress: " + p.Phase}
+	if p.Done > 0 || p.Total > 0 {
+		unit := p.Unit
+		if unit == "" {
+			unit = "done"
+		}
+		if p.Total > 0 {
+			fields = append(fields, fmt.Sprintf("%s: %d/%d", unit, p.Done, p.Total))
+		} else {
+			fields = append(fields, fmt.Sprintf("%s: %d", unit, p.Done))
+		}
+	}
+	if p.Bytes > 0 {
+		fields = append(fields, fmt.Sprintf("bytes: %d", p.Bytes))
+	}
+	return strings.Join(fields, "; ")
+}
@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package agentkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// ProvenanceFilename is the name of the JSON provenance record that
+	// an agent which retrieves code writes into its SpdxOutputDir.
+	ProvenanceFilename = "provenance.json"
+
+	// ProvenanceSPDXFilename is the name of the SPDX tag-value fragment
+	// that goes alongside the JSON provenance record, holding the
+	// package fields that it determines.
+	ProvenanceSPDXFilename = "provenance.spdx"
+)
+
+// Provenance records where the code that an agent retrieved came from,
+// so that later agents can describe it accurately.
+type Provenance struct {
+	// Agent is the name of the agent that retrieved the code, such as
+	// "retrieve-github".
+	Agent string `json:"agent"`
+
+	// Name is what the code is called where it came from, such as a
+	// package or repository name, for use as the SPDX PackageName.
+	Name string `json:"name,omitempty"`
+
+	// URL is where the code was retrieved from.
+	URL string `json:"url"`
+
+	// DownloadLocation is the SPDX PackageDownloadLocation for the
+	// code, such as "git+https://github.com/org/repo.git@<commit>".
+	DownloadLocation string `json:"downloadLocation"`
+
+	// Version is the SPDX PackageVersion for the code, such as a tag
+	// name or commit hash.
+	Version string `json:"version,omitempty"`
+
+	// Ref is the branch, tag or other ref that was asked for, if any,
+	// and Commit is the commit that was retrieved, for code that came
+	// from a version control system.
+	Ref    string `json:"ref,omitempty"`
+	Commit string `json:"commit,omitempty"`
+
+	// Checksums holds the checksums of the file that was downloaded,
+	// for code that came from an archive, keyed by SPDX algorithm name
+	// such as "SHA256".
+	Checksums map[string]string `json:"checksums,omitempty"`
+
+	// Signer describes the key whose signature on the retrieved
+	// version was verified, if signatures were checked.
+	Signer string `json:"signer,omitempty"`
+
+	// Submodules lists the submodules that were retrieved along with
+	// the code, including nested ones.
+	Submodules []SubmoduleProvenance `json:"submodules,omitempty"`
+
+	// RetrievedAt is when the code was retrieved.
+	RetrievedAt time.Time `json:"retrievedAt"`
+}
+
+// SubmoduleProvenance records where one submodule came from.
+type SubmoduleProvenance struct {
+	// Path is where the submodule was placed, relative to the
+	// retrieved code, with "/" as separator.
+	Path string `json:"path"`
+
+	URL    string `json:"url"`
+	Commit string `json:"commit"`
+}
+
+// SPDX returns the SPDX tag-value package fields that p determines.
+func (p *Provenance) SPDX() string {
+	s := fmt.Sprintf("# provenance recorded by %s at %s\n", p.Agent, p.RetrievedAt.Format(time.RFC3339))
+	if p.Name != "" {
+		s += fmt.Sprintf("PackageName: %s\n", p.Name)
+	}
+	s += fmt.Sprintf("PackageDownloadLocation: %s\n", p.DownloadLocation)
+	if p.Version != "" {
+		s += fmt.Sprintf("PackageVersion: %s\n", p.Version)
+	}
+	algs := []string{}
+	for alg := range p.Checksums {
+		algs = append(algs, alg)
+	}
+	sort.Strings(algs)
+	for _, alg := range algs {
+		s += fmt.Sprintf("PackageChecksum: %s: %s\n", alg, p.Checksums[alg])
+	}
+	return s
+}
+
+// WriteProvenance writes p into dir, both as JSON in ProvenanceFilename
+// and as SPDX in ProvenanceSPDXFilename.
+func WriteProvenance(dir string, p *Provenance) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("couldn't create directory %s for provenance: %v", dir, err)
+	}
+
+	// signers look like "Name <email>", so don't escape "<" and ">"
+	var js bytes.Buffer
+	enc := json.NewEncoder(&js)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(p); err != nil {
+		return fmt.Errorf("couldn't encode provenance: %v", err)
+	}
+	jsPath := filepath.Join(dir, ProvenanceFilename)
+	if err := ioutil.WriteFile(jsPath, js.Bytes(), 0644); err != nil {
+		return fmt.Errorf("couldn't write provenance to %s: %v", jsPath, err)
+	}
+
+	spdxPath := filepath.Join(dir, ProvenanceSPDXFilename)
+	if err := ioutil.WriteFile(spdxPath, []byte(p.SPDX()), 0644); err != nil {
+		return fmt.Errorf("couldn't write provenance to %s: %v", spdxPath, err)
+	}
+	return nil
+}
+
+// ReadProvenance reads a JSON provenance record written by
+// WriteProvenance. path may be either the file itself, or the
+// directory that it was written into.
+func ReadProvenance(path string) (*Provenance, error) {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		path = filepath.Join(path, ProvenanceFilename)
+	}
+	js, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read provenance: %v", err)
+	}
+	p := &Provenance{}
+	if err := json.Unmarshal(js, p); err != nil {
+		return nil, fmt.Errorf("couldn't parse provenance in %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// FindProvenance returns the first provenance record found at any of
+// paths, each of which may be a provenance file written by
+// WriteProvenance or a directory holding one, along with the path of
+// the file it came from. It returns nil if none of paths has one.
+func FindProvenance(paths []string) (*Provenance, string, error) {
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if fi.IsDir() {
+			path = filepath.Join(path, ProvenanceFilename)
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+		} else if filepath.Base(path) != ProvenanceFilename {
+			continue
+		}
+		p, err := ReadProvenance(path)
+		if err != nil {
+			return nil, "", err
+		}
+		return p, path, nil
+	}
+	return nil, "", nil
+}
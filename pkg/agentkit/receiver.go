@@ -1,5 +1,5 @@
 // SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
-package main
+package agentkit
 
 import (
 	"context"
@@ -9,7 +9,7 @@ import (
 	"github.com/swinslow/peridot-jobrunner/pkg/agent"
 )
 
-func (n *nop) receiver(
+func (a *Agent) receiver(
 	ctx context.Context,
 	stream *agent.Agent_NewJobServer,
 	recvReq chan<- reqMsg,
@@ -42,6 +42,10 @@ func (n *nop) receiver(
 			recvReq <- reqMsg{t: reqStart, cfg: x.Start.Config}
 		case *agent.ControllerMsg_Status:
 			recvReq <- reqMsg{t: reqStatus}
+		// agent.proto has no stop message; stop requests come from
+		// Agent.Stop instead
+		default:
+			log.Printf("==> receiver ignoring unsupported controller message %T", x)
 		}
 	}
 }
@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package agentkit
+
+import (
+	"github.com/swinslow/peridot-jobrunner/pkg/status"
+)
+
+// Reporter is passed to a Runner's Run method, and is the way that the
+// Runner communicates changes in the job's status back to the Controller.
+type Reporter interface {
+	// Running records that the job is configured and is now running.
+	Running()
+
+	// Output appends msg to the job's output messages, without
+	// otherwise changing its status.
+	Output(msg string)
+
+	// Degraded sets the job's health to DEGRADED and appends msg to
+	// the job's output messages. The job continues running.
+	Degraded(msg string)
+
+	// Progress records how far along the job is. It replaces any
+	// earlier Progress, and may be called as often as is convenient:
+	// progress is sent to the controller with the next heartbeat or
+	// status report, rather than immediately.
+	Progress(p Progress)
+}
+
+// reporter is the Reporter used by runAgent. It sends its updates
+// over the setStatus channel to the NewJob handler.
+type reporter struct {
+	setStatus chan<- statusUpdate
+}
+
+func (r *reporter) Running() {
+	r.setStatus <- statusUpdate{run: status.Status_RUNNING}
+}
+
+func (r *reporter) Output(msg string) {
+	r.setStatus <- statusUpdate{outputMsg: msg}
+}
+
+func (r *reporter) Degraded(msg string) {
+	r.setStatus <- statusUpdate{
+		health:    status.Health_DEGRADED,
+		outputMsg: msg,
+	}
+}
+
+func (r *reporter) Progress(p Progress) {
+	r.setStatus <- statusUpdate{progress: &p}
+}
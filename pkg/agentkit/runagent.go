@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package agentkit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+	"github.com/swinslow/peridot-jobrunner/pkg/status"
+)
+
+// runAgent calls the Runner to carry out the job, and converts its
+// result into the final status update for the job.
+func (a *Agent) runAgent(
+	ctx context.Context,
+	cfg agent.JobConfig,
+	setStatus chan<- statusUpdate,
+) {
+	defer log.Printf("==> CLOSING runAgent")
+
+	// now that we exist, we own setStatus and are responsible for
+	// closing it when we are done
+	defer close(setStatus)
+
+	// if the job has a timeout, the Runner only gets until then
+	timeout, err := getTimeout(cfg)
+	if err != nil {
+		setStatusError(setStatus, err.Error())
+		return
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err = a.r.Run(ctx, cfg, &reporter{setStatus: setStatus})
+	if err != nil {
+		// if the job timed out or was cancelled, report that rather
+		// than whatever error the Runner returned on its way out
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			setStatusError(setStatus, doneMsg(fmt.Sprintf("timed out after %v", timeout), ctx.Err(), err))
+		case context.Canceled:
+			setStatusError(setStatus, doneMsg("cancelled", ctx.Err(), err))
+		default:
+			setStatusError(setStatus, err.Error())
+		}
+		return
+	}
+
+	// success!
+	setStatus <- statusUpdate{
+		run: status.Status_STOPPED,
+		now: time.Now(),
+	}
+}
+
+// doneMsg builds the final output message for a job whose context was
+// done before its Runner finished. ctxErr is the context's error, and
+// err is the error that the Runner returned.
+func doneMsg(reason string, ctxErr error, err error) string {
+	if err == ctxErr {
+		return reason
+	}
+	return fmt.Sprintf("%s: %v", reason, err)
+}
@@ -1,5 +1,5 @@
 // SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
-package main
+package agentkit
 
 import (
 	"context"
@@ -9,7 +9,7 @@ import (
 )
 
 // sendMsg is responsible for actually sending the applicable message
-func (n *nop) sendMsg(stream *agent.Agent_NewJobServer, mw *rptType) error {
+func (a *Agent) sendMsg(stream *agent.Agent_NewJobServer, mw *rptType) error {
 	if mw.sRpt {
 		// send back a StatusReport now
 		rpt := &agent.StatusReport{
@@ -17,7 +17,7 @@ func (n *nop) sendMsg(stream *agent.Agent_NewJobServer, mw *rptType) error {
 			HealthStatus:   mw.status.health,
 			TimeStarted:    mw.status.started.Unix(),
 			TimeFinished:   mw.status.finished.Unix(),
-			OutputMessages: mw.status.outputMessages,
+			OutputMessages: mw.status.messages(),
 		}
 		am := &agent.AgentMsg{Am: &agent.AgentMsg_Status{Status: rpt}}
 		log.Printf("== agent SEND Status %s\n", rpt.String())
@@ -34,7 +34,7 @@ func (n *nop) sendMsg(stream *agent.Agent_NewJobServer, mw *rptType) error {
 // gRPC stream. Even the main handler will not call Send.
 // sender is also responsible for listening for status change requests
 // from runAgent.
-func (n *nop) sender(
+func (a *Agent) sender(
 	ctx context.Context,
 	stream *agent.Agent_NewJobServer,
 	rptWanted <-chan rptType,
@@ -56,7 +56,7 @@ func (n *nop) sender(
 			// wants a report sent. Set the appropriate variable(s),
 			// and we'll actually send when we get out of the current
 			// loop.
-			err := n.sendMsg(stream, &mw)
+			err := a.sendMsg(stream, &mw)
 			if err != nil {
 				exiting = true
 			}
@@ -70,7 +70,7 @@ func (n *nop) sender(
 		if !ok {
 			break
 		}
-		err := n.sendMsg(stream, &mw)
+		err := a.sendMsg(stream, &mw)
 		if err != nil {
 			log.Printf("==> sender ERROR while sending final message: %v", err)
 		}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package agentkit
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"google.golang.org/grpc"
+
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// Serve listens on addr and serves r as a peridot agent until the
+// process gets SIGINT or SIGTERM. It then stops any jobs that are
+// running, through Agent.Stop, and returns once each of them has
+// reported to the controller that it has stopped. A second signal
+// stops the server without waiting.
+func Serve(addr string, r Runner) error {
+	// open a socket for listening
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("couldn't open port %v: %v", addr, err)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	return serveUntil(lis, New(r), sigs)
+}
+
+// serveUntil does the work of Serve, on an already-open listener, stopping
+// when sigs delivers a signal.
+func serveUntil(lis net.Listener, a *Agent, sigs <-chan os.Signal) error {
+	// create and register new GRPC server for agent
+	server := grpc.NewServer()
+	agent.RegisterAgentServer(server, a)
+
+	stopped := make(chan struct{})
+	go func() {
+		sig, ok := <-sigs
+		if !ok {
+			return
+		}
+		log.Printf("==> got %v; stopping jobs", sig)
+		a.Stop()
+
+		// GracefulStop waits for each job's NewJob to return, which
+		// they do once the controller has seen them stop
+		graceful := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(graceful)
+		}()
+		select {
+		case <-graceful:
+		case sig := <-sigs:
+			log.Printf("==> got %v again; stopping now", sig)
+			server.Stop()
+		}
+		close(stopped)
+	}()
+
+	// start grpc server
+	if err := server.Serve(lis); err != nil {
+		return fmt.Errorf("couldn't start server: %v", err)
+	}
+	<-stopped
+	return nil
+}
@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package agentkit
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+	"github.com/swinslow/peridot-jobrunner/pkg/status"
+)
+
+func TestServeStopsRunningJobOnSignal(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("couldn't listen: %v", err)
+	}
+	a := New(runnerFunc(func(ctx context.Context, cfg agent.JobConfig, rpt Reporter) error {
+		rpt.Running()
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	sigs := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- serveUntil(lis, a, sigs)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, lis.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("couldn't connect: %v", err)
+	}
+	defer conn.Close()
+	stream, err := agent.NewAgentClient(conn).NewJob(ctx)
+	if err != nil {
+		t.Fatalf("couldn't start NewJob: %v", err)
+	}
+	err = stream.Send(&agent.ControllerMsg{Cm: &agent.ControllerMsg_Start{Start: &agent.StartReq{Config: &agent.JobConfig{}}}})
+	if err != nil {
+		t.Fatalf("couldn't send start request: %v", err)
+	}
+
+	// recv returns the next status report from the agent
+	recv := func() *agent.StatusReport {
+		t.Helper()
+		m, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("couldn't receive status report: %v", err)
+		}
+		return m.GetStatus()
+	}
+	for recv().RunStatus != status.Status_RUNNING {
+	}
+
+	sigs <- syscall.SIGTERM
+	rpt := recv()
+	for rpt.RunStatus != status.Status_STOPPED {
+		rpt = recv()
+	}
+	if rpt.HealthStatus != status.Health_ERROR {
+		t.Errorf("got health %v, want %v", rpt.HealthStatus, status.Health_ERROR)
+	}
+	if rpt.OutputMessages != StoppedMsg {
+		t.Errorf("got output %q, want %q", rpt.OutputMessages, StoppedMsg)
+	}
+
+	// the controller closes its end once it has seen the job stop,
+	// which lets the server finish shutting down
+	stream.CloseSend()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("serveUntil returned %v, want nil", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatalf("timed out waiting for serveUntil to return")
+	}
+}
+
+func TestStopAppliesToLaterJobs(t *testing.T) {
+	a := New(runnerFunc(func(ctx context.Context, cfg agent.JobConfig, rpt Reporter) error {
+		t.Errorf("job started after agent was stopped")
+		return nil
+	}))
+	a.Stop()
+
+	s, done := serve(a)
+	rpt := s.final(t)
+	if rpt.OutputMessages != StoppedMsg {
+		t.Errorf("got output %q, want %q", rpt.OutputMessages, StoppedMsg)
+	}
+	wait(t, s, done)
+}
@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package spdxdoc
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spdx/tools-golang/builder"
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/spdx/v2/common"
+	"github.com/spdx/tools-golang/tagvalue"
+)
+
+// NewDocument creates an SPDX Document (of the latest version that
+// tools-golang supports), created by the tool called creator, that
+// describes pkgs. The document is named after the first package.
+func NewDocument(creator string, namespace string, pkgs []*spdx.Package) (*spdx.Document, error) {
+	ci, err := builder.BuildCreationInfoSection("Tool", creator, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rlns := []*spdx.Relationship{}
+	for _, pkg := range pkgs {
+		rlns = append(rlns, &spdx.Relationship{
+			RefA:         common.MakeDocElementID("", "DOCUMENT"),
+			RefB:         common.MakeDocElementID("", string(pkg.PackageSPDXIdentifier)),
+			Relationship: common.TypeRelationshipDescribe,
+		})
+	}
+
+	doc := &spdx.Document{
+		SPDXVersion:       spdx.Version,
+		DataLicense:       spdx.DataLicense,
+		SPDXIdentifier:    "DOCUMENT",
+		DocumentName:      pkgs[0].PackageName,
+		DocumentNamespace: namespace,
+		CreationInfo:      ci,
+		Packages:          pkgs,
+		Relationships:     rlns,
+	}
+	return doc, nil
+}
+
+// DocumentNamespace returns the namespace for a document describing pkg, as
+// built by BuildPackage, whose files were examined in the way that
+// details describe. In NamespaceHash mode, the same package with the
+// same files and details gives the same namespace.
+func (pc *PackageConfig) DocumentNamespace(pkg *spdx.Package, details ...string) (string, error) {
+	name := strings.TrimPrefix(string(pkg.PackageSPDXIdentifier), "Package-")
+	hashed := []string{pkg.PackageName, pkg.PackageVersion, pkg.PackageDownloadLocation, pkg.PackageVerificationCode.Value}
+	return pc.Namespace.Namespace(name, append(hashed, details...)...)
+}
+
+// WriteTagValue writes doc as tag-value to the file at path. If it
+// can't, it removes what it wrote of the file.
+func WriteTagValue(doc *spdx.Document, path string) error {
+	w, err := os.Create(path)
+	if err != nil {
+		// can't open file to write SPDX document to disk; error out
+		return fmt.Errorf("can't open file to write SPDX document to disk: %v", err)
+	}
+
+	err = tagvalue.Write(doc, w)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// can't write SPDX document to disk; remove what we wrote
+		// of it and error out
+		os.Remove(path)
+		return fmt.Errorf("can't write SPDX document to disk: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package spdxdoc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LicenseNode is a parsed SPDX license expression. For a single
+// license, Op is "" and ID is its identifier. Otherwise Op is "AND" or
+// "OR", with two or more Members; "WITH", with one member and ID the
+// exception's identifier; or "+", with one member.
+type LicenseNode struct {
+	Op      string
+	ID      string
+	Members []*LicenseNode
+}
+
+var licenseIDRe = regexp.MustCompile(`^(DocumentRef-[A-Za-z0-9.-]+:)?[A-Za-z0-9.-]+$`)
+
+// ParseLicenseExpression parses expr as an SPDX license expression.
+func ParseLicenseExpression(expr string) (*LicenseNode, error) {
+	expr = strings.Replace(expr, "(", " ( ", -1)
+	expr = strings.Replace(expr, ")", " ) ", -1)
+	p := &licenseParser{tokens: strings.Fields(expr)}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return n, nil
+}
+
+// licenseParser is a recursive descent parser for license expressions,
+// in which WITH binds more tightly than AND, which binds more tightly
+// than OR.
+type licenseParser struct {
+	tokens []string
+	pos    int
+}
+
+// next returns the next token, or "" at the end of the expression.
+func (p *licenseParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// accept consumes the next token if it is the operator op, in either
+// upper or lower case.
+func (p *licenseParser) accept(op string) bool {
+	if t := p.next(); t == op || t == strings.ToLower(op) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *licenseParser) parseOr() (*LicenseNode, error) {
+	return p.parseSet("OR", p.parseAnd)
+}
+
+func (p *licenseParser) parseAnd() (*LicenseNode, error) {
+	return p.parseSet("AND", p.parseWith)
+}
+
+// parseSet parses one or more operands, using parseOperand, joined by
+// op.
+func (p *licenseParser) parseSet(op string, parseOperand func() (*LicenseNode, error)) (*LicenseNode, error) {
+	n, err := parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.next() != op && p.next() != strings.ToLower(op) {
+		return n, nil
+	}
+	set := &LicenseNode{Op: op, Members: []*LicenseNode{n}}
+	for p.accept(op) {
+		m, err := parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		set.Members = append(set.Members, m)
+	}
+	return set, nil
+}
+
+func (p *licenseParser) parseWith() (*LicenseNode, error) {
+	n, err := p.parseLicense()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("WITH") {
+		return n, nil
+	}
+	if n.Op != "" && n.Op != "+" {
+		return nil, fmt.Errorf("WITH must follow a single license")
+	}
+	exception := p.next()
+	if !licenseIDRe.MatchString(exception) || isLicenseOperator(exception) {
+		return nil, fmt.Errorf("expected exception after WITH")
+	}
+	p.pos++
+	return &LicenseNode{Op: "WITH", ID: exception, Members: []*LicenseNode{n}}, nil
+}
+
+func (p *licenseParser) parseLicense() (*LicenseNode, error) {
+	t := p.next()
+	if t == "(" {
+		p.pos++
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing \")\"")
+		}
+		p.pos++
+		return n, nil
+	}
+
+	orLater := strings.HasSuffix(t, "+")
+	id := strings.TrimSuffix(t, "+")
+	if !licenseIDRe.MatchString(id) || isLicenseOperator(id) {
+		if t == "" {
+			return nil, fmt.Errorf("unexpected end of expression")
+		}
+		return nil, fmt.Errorf("unexpected %q", t)
+	}
+	p.pos++
+	n := &LicenseNode{ID: id}
+	if orLater {
+		n = &LicenseNode{Op: "+", Members: []*LicenseNode{n}}
+	}
+	return n, nil
+}
+
+// isLicenseOperator reports whether s is one of the operators in
+// license expressions.
+func isLicenseOperator(s string) bool {
+	switch strings.ToUpper(s) {
+	case "AND", "OR", "WITH":
+		return true
+	}
+	return false
+}
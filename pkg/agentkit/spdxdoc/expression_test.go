@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package spdxdoc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLicenseExpression(t *testing.T) {
+	id := func(s string) *LicenseNode { return &LicenseNode{ID: s} }
+	tests := []struct {
+		expr    string
+		want    *LicenseNode
+		wantErr bool
+	}{
+		{expr: "MIT", want: id("MIT")},
+		{expr: "GPL-2.0+", want: &LicenseNode{Op: "+", Members: []*LicenseNode{id("GPL-2.0")}}},
+		{expr: "LicenseRef-foo", want: id("LicenseRef-foo")},
+		{expr: "DocumentRef-other:LicenseRef-foo", want: id("DocumentRef-other:LicenseRef-foo")},
+		{
+			expr: "MIT OR Apache-2.0 AND BSD-3-Clause",
+			want: &LicenseNode{Op: "OR", Members: []*LicenseNode{
+				id("MIT"),
+				{Op: "AND", Members: []*LicenseNode{id("Apache-2.0"), id("BSD-3-Clause")}},
+			}},
+		},
+		{
+			expr: "(MIT or Apache-2.0) and BSD-3-Clause",
+			want: &LicenseNode{Op: "AND", Members: []*LicenseNode{
+				{Op: "OR", Members: []*LicenseNode{id("MIT"), id("Apache-2.0")}},
+				id("BSD-3-Clause"),
+			}},
+		},
+		{
+			expr: "GPL-2.0+ WITH Classpath-exception-2.0 OR MIT",
+			want: &LicenseNode{Op: "OR", Members: []*LicenseNode{
+				{Op: "WITH", ID: "Classpath-exception-2.0", Members: []*LicenseNode{
+					{Op: "+", Members: []*LicenseNode{id("GPL-2.0")}},
+				}},
+				id("MIT"),
+			}},
+		},
+		{expr: "", wantErr: true},
+		{expr: "MIT AND", wantErr: true},
+		{expr: "(MIT", wantErr: true},
+		{expr: "MIT)", wantErr: true},
+		{expr: "MIT Apache-2.0", wantErr: true},
+		{expr: "(MIT OR Apache-2.0) WITH Classpath-exception-2.0", wantErr: true},
+		{expr: "MIT WITH AND", wantErr: true},
+		{expr: "MIT/X11", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLicenseExpression(tt.expr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseLicenseExpression(%q) succeeded, want error", tt.expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseLicenseExpression(%q): %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseLicenseExpression(%q) = %+v, want %+v", tt.expr, got, tt.want)
+		}
+	}
+}
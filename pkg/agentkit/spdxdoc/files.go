@@ -0,0 +1,174 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package spdxdoc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spdx/tools-golang/builder"
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/utils"
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+)
+
+// binarySniffBytes is how much of a file ReadFileStart checks for NUL
+// bytes, which mark it as binary.
+const binarySniffBytes = 8000
+
+// MaxPathsListed is how many paths ListPaths lists by name.
+const MaxPathsListed = 10
+
+// BuildPackage builds the package for the code in pc.Dir, leaving out
+// the paths that pc.Ignore matches, which it returns as ListFiles does.
+// The package has its files hashed and its verification code filled
+// in, and its license and copyright fields set to NOASSERTION for the
+// agent to fill in from its files. Its files are numbered from
+// firstFile, so that they can be given identifiers that are unique
+// within the document. Progress is reported through rpt as it goes,
+// and it returns ctx's error if ctx is done first.
+func BuildPackage(ctx context.Context, rpt agentkit.Reporter, pc *PackageConfig, firstFile int) (*spdx.Package, []string, error) {
+	// build the file section first, so we'll have it available
+	// for calculating the package verification code
+	rpt.Progress(agentkit.Progress{Phase: "listing files"})
+	filepaths, ignored, err := ListFiles(ctx, pc.Dir, pc.Ignore)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := HashFiles(ctx, rpt, "hashing", pc.Dir, filepaths, firstFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// get the verification code
+	code, err := utils.GetVerificationCode(files, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// now build the package section
+	pkg := &spdx.Package{
+		PackageName:                 pc.Name,
+		PackageSPDXIdentifier:       PackageID(pc.Name),
+		PackageVersion:              pc.Version,
+		PackageDownloadLocation:     pc.DownloadLocation,
+		FilesAnalyzed:               true,
+		IsFilesAnalyzedTagPresent:   true,
+		PackageVerificationCode:     &code,
+		PackageLicenseConcluded:     "NOASSERTION",
+		PackageLicenseInfoFromFiles: []string{"NOASSERTION"},
+		PackageLicenseDeclared:      "NOASSERTION",
+		PackageCopyrightText:        "NOASSERTION",
+		Files:                       files,
+	}
+	return pkg, ignored, nil
+}
+
+// HashFiles builds the file sections for filepaths, which are relative
+// to dirRoot, numbering them from firstFile. Progress is reported
+// through rpt under phase, and it returns ctx's error if ctx is done
+// first.
+func HashFiles(ctx context.Context, rpt agentkit.Reporter, phase string, dirRoot string, filepaths []string, firstFile int) ([]*spdx.File, error) {
+	files := []*spdx.File{}
+	total := int64(len(filepaths))
+	for i, fp := range filepaths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		rpt.Progress(agentkit.Progress{Phase: phase, Unit: "files", Done: int64(i), Total: total})
+		newFile, err := builder.BuildFileSection(fp, dirRoot, firstFile+i)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, newFile)
+	}
+	return files, nil
+}
+
+// ListFiles returns the paths, relative to dirRoot and starting with
+// "/", of all files in dirRoot and its subdirectories, other than
+// symbolic links and those that ignore matches. It also returns the
+// paths that were ignored, without the leading "/"; directories end in
+// "/", and nothing inside them is listed. It stops walking and returns
+// ctx's error if ctx is done.
+func ListFiles(ctx context.Context, dirRoot string, ignore *agentkit.IgnoreList) ([]string, []string, error) {
+	paths := []string{}
+	ignored := []string{}
+	prefix := strings.TrimSuffix(dirRoot, "/")
+
+	err := filepath.Walk(dirRoot, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		shortPath := strings.TrimPrefix(path, prefix)
+
+		// don't walk into directories that should be ignored, and
+		// don't include directories themselves
+		if fi.IsDir() {
+			if path != dirRoot && ignore.Ignored(shortPath, true) {
+				ignored = append(ignored, strings.TrimPrefix(shortPath, "/")+"/")
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// don't include path if it's a symbolic link
+		if fi.Mode()&os.ModeSymlink == os.ModeSymlink {
+			return nil
+		}
+
+		// don't include path if it should be ignored
+		if ignore.Ignored(shortPath, false) {
+			ignored = append(ignored, strings.TrimPrefix(shortPath, "/"))
+			return nil
+		}
+
+		// if we got here, record the path
+		paths = append(paths, shortPath)
+		return nil
+	})
+
+	return paths, ignored, err
+}
+
+// ReadFileStart returns up to max bytes from the start of the file at
+// path, and whether the file is binary, in which case it returns no
+// bytes.
+func ReadFileStart(path string, max int64) ([]byte, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(f, max))
+	if err != nil {
+		return nil, false, err
+	}
+	sniff := b
+	if len(sniff) > binarySniffBytes {
+		sniff = sniff[:binarySniffBytes]
+	}
+	if bytes.IndexByte(sniff, 0) >= 0 {
+		return nil, true, nil
+	}
+	return b, false, nil
+}
+
+// ListPaths lists paths, such as those that ListFiles ignored, for the
+// job's output messages, naming no more than MaxPathsListed of them.
+func ListPaths(paths []string) string {
+	more := ""
+	if len(paths) > MaxPathsListed {
+		more = fmt.Sprintf(" and %d more", len(paths)-MaxPathsListed)
+		paths = paths[:MaxPathsListed]
+	}
+	return strings.Join(paths, ", ") + more
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package spdxdoc
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+)
+
+func writeTree(t *testing.T, dir string, paths ...string) {
+	t.Helper()
+	for _, p := range paths {
+		full := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(full, []byte(p+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spdxdoc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir,
+		"README",
+		"src/main.go",
+		"src/main_test.go",
+		"vendor/lib/lib.go",
+		".git/HEAD",
+	)
+	if err := os.Symlink("README", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	ignore := &agentkit.IgnoreList{}
+	for _, pattern := range []string{"/.git/", "vendor/", "*_test.go"} {
+		if err := ignore.Add(pattern); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, ignored, err := ListFiles(context.Background(), dir, ignore)
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+	if want := []string{"/README", "/src/main.go"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+	if want := []string{".git/", "src/main_test.go", "vendor/"}; !reflect.DeepEqual(ignored, want) {
+		t.Errorf("ignored = %v, want %v", ignored, want)
+	}
+}
+
+func TestListFilesStopsWhenCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spdxdoc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir, "a", "b/c")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := ListFiles(ctx, dir, nil); err != context.Canceled {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestListPaths(t *testing.T) {
+	many := []string{}
+	for i := 0; i < MaxPathsListed+3; i++ {
+		many = append(many, string(rune('a'+i)))
+	}
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"a/", "b"}, "a/, b"},
+		{many[:MaxPathsListed], strings.Join(many[:MaxPathsListed], ", ")},
+		{many, strings.Join(many[:MaxPathsListed], ", ") + " and 3 more"},
+	}
+	for _, tt := range tests {
+		if got := ListPaths(tt.paths); got != tt.want {
+			t.Errorf("ListPaths(%v) = %q, want %q", tt.paths, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+// Package spdxdoc provides the pieces that agents which read or write
+// SPDX documents have in common, so that each one finds, names and
+// builds documents in the same way.
+package spdxdoc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// DefaultNamespaceBase is the base URI of document namespaces, for
+// jobs and agents that don't configure their own.
+const DefaultNamespaceBase = "https://peridot/spdxdocs"
+
+// The ways of making each document's namespace unique, which the job
+// chooses with the namespaceMode key/value.
+const (
+	// NamespaceUUID adds a random UUID, so every document's namespace
+	// is different. This is the default.
+	NamespaceUUID = "uuid"
+
+	// NamespaceJobID adds the job's ID, from the jobID key/value.
+	NamespaceJobID = "jobID"
+
+	// NamespaceHash adds a hash of what the document describes, so
+	// that running the agent again on the same inputs gives the same
+	// namespace.
+	NamespaceHash = "hash"
+)
+
+// NamespaceConfig says how to build a document's namespace.
+type NamespaceConfig struct {
+	Base  string
+	Mode  string
+	JobID string
+}
+
+// NewNamespaceConfig reads the namespace configuration for cfg's job,
+// from its namespaceBase, namespaceMode and jobID key/values. If the
+// job doesn't set namespaceBase, it comes from the environment variable
+// named baseEnv, or if that isn't set either, DefaultNamespaceBase.
+func NewNamespaceConfig(cfg agent.JobConfig, baseEnv string) (*NamespaceConfig, error) {
+	nc := &NamespaceConfig{
+		Base: os.Getenv(baseEnv),
+		Mode: NamespaceUUID,
+	}
+	if nc.Base == "" {
+		nc.Base = DefaultNamespaceBase
+	}
+	for _, jkv := range cfg.Jkvs {
+		switch jkv.Key {
+		case "namespaceBase":
+			nc.Base = jkv.Value
+		case "namespaceMode":
+			nc.Mode = jkv.Value
+		case "jobID":
+			nc.JobID = jkv.Value
+		}
+	}
+
+	u, err := url.Parse(nc.Base)
+	if err != nil {
+		return nil, fmt.Errorf("namespaceBase %q is invalid: %v", nc.Base, err)
+	}
+	if !u.IsAbs() || u.Fragment != "" || strings.Contains(nc.Base, "#") {
+		return nil, fmt.Errorf("namespaceBase %q must be an absolute URI without a \"#\"", nc.Base)
+	}
+	nc.Base = strings.TrimSuffix(nc.Base, "/")
+
+	switch nc.Mode {
+	case NamespaceUUID, NamespaceHash:
+	case NamespaceJobID:
+		if nc.JobID == "" {
+			return nil, fmt.Errorf("namespaceMode %s needs the jobID key/value", NamespaceJobID)
+		}
+	default:
+		return nil, fmt.Errorf("namespaceMode %q is invalid; must be %s, %s or %s", nc.Mode, NamespaceUUID, NamespaceJobID, NamespaceHash)
+	}
+	return nc, nil
+}
+
+// Namespace returns the namespace for a document called name, which
+// should only use the characters allowed in an SPDX identifier. In
+// NamespaceHash mode, the hash is of details, which should be enough
+// to tell apart any two documents that the agent could write.
+func (nc *NamespaceConfig) Namespace(name string, details ...string) (string, error) {
+	var unique string
+	switch nc.Mode {
+	case NamespaceJobID:
+		unique = url.PathEscape(nc.JobID)
+	case NamespaceHash:
+		h := sha256.New()
+		for _, s := range details {
+			fmt.Fprintf(h, "%s\x00", s)
+		}
+		unique = fmt.Sprintf("%x", h.Sum(nil))
+	default:
+		var err error
+		if unique, err = NewUUID(); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%s/%s-%s", nc.Base, name, unique), nil
+}
+
+// NewUUID returns a random (version 4) UUID.
+func NewUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("couldn't generate UUID: %v", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
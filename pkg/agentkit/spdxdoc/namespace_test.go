@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package spdxdoc
+
+import (
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// testBaseEnv is the environment variable that the tests read the
+// namespace base from.
+const testBaseEnv = "SPDXDOC_TEST_NAMESPACE_BASE"
+
+func jobWith(kvs ...string) agent.JobConfig {
+	cfg := agent.JobConfig{}
+	for i := 0; i+1 < len(kvs); i += 2 {
+		cfg.Jkvs = append(cfg.Jkvs, &agent.JobConfig_JobKV{Key: kvs[i], Value: kvs[i+1]})
+	}
+	return cfg
+}
+
+func TestNamespace(t *testing.T) {
+	uuidRe := `[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}`
+	tests := []struct {
+		name    string
+		env     string
+		kvs     []string
+		details []string
+		want    string
+	}{
+		{
+			name: "default is uuid under the default base",
+			want: `^https://peridot/spdxdocs/pkg-` + uuidRe + `$`,
+		},
+		{
+			name: "base from environment",
+			env:  "https://example.com/env/",
+			want: `^https://example.com/env/pkg-` + uuidRe + `$`,
+		},
+		{
+			name: "job base overrides environment",
+			env:  "https://example.com/env",
+			kvs:  []string{"namespaceBase", "https://example.com/job/"},
+			want: `^https://example.com/job/pkg-` + uuidRe + `$`,
+		},
+		{
+			name: "jobID is escaped",
+			kvs:  []string{"namespaceMode", "jobID", "jobID", "42/a b"},
+			want: `^https://peridot/spdxdocs/pkg-42%2Fa%20b$`,
+		},
+		{
+			name:    "hash of details",
+			kvs:     []string{"namespaceMode", "hash"},
+			details: []string{"pkg", "1.0"},
+			want:    `^https://peridot/spdxdocs/pkg-[0-9a-f]{64}$`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv(testBaseEnv, tt.env)
+			defer os.Unsetenv(testBaseEnv)
+			nc, err := NewNamespaceConfig(jobWith(tt.kvs...), testBaseEnv)
+			if err != nil {
+				t.Fatalf("NewNamespaceConfig: %v", err)
+			}
+			got, err := nc.Namespace("pkg", tt.details...)
+			if err != nil {
+				t.Fatalf("Namespace: %v", err)
+			}
+			if !regexp.MustCompile(tt.want).MatchString(got) {
+				t.Errorf("got %q, want match for %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamespaceUniqueness(t *testing.T) {
+	namespaces := func(mode string, details ...string) (string, string) {
+		t.Helper()
+		nc, err := NewNamespaceConfig(jobWith("namespaceMode", mode, "jobID", "7"), testBaseEnv)
+		if err != nil {
+			t.Fatalf("NewNamespaceConfig: %v", err)
+		}
+		a, err := nc.Namespace("pkg", details...)
+		if err != nil {
+			t.Fatalf("Namespace: %v", err)
+		}
+		b, err := nc.Namespace("pkg", details...)
+		if err != nil {
+			t.Fatalf("Namespace: %v", err)
+		}
+		return a, b
+	}
+
+	if a, b := namespaces(NamespaceUUID); a == b {
+		t.Errorf("uuid mode gave %q twice", a)
+	}
+	if a, b := namespaces(NamespaceJobID); a != b {
+		t.Errorf("jobID mode gave %q and %q for the same job", a, b)
+	}
+	if a, b := namespaces(NamespaceHash, "pkg", "1.0"); a != b {
+		t.Errorf("hash mode gave %q and %q for the same details", a, b)
+	}
+	a, _ := namespaces(NamespaceHash, "pkg", "1.0")
+	b, _ := namespaces(NamespaceHash, "pkg", "1.1")
+	if a == b {
+		t.Errorf("hash mode gave %q for different details", a)
+	}
+	// details are hashed separately, not just joined
+	a, _ = namespaces(NamespaceHash, "ab", "c")
+	b, _ = namespaces(NamespaceHash, "a", "bc")
+	if a == b {
+		t.Errorf("hash mode gave %q for details that join to the same string", a)
+	}
+}
+
+func TestNewNamespaceConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		kvs  []string
+	}{
+		{"relative base", []string{"namespaceBase", "spdxdocs"}},
+		{"base with fragment", []string{"namespaceBase", "https://example.com/a#b"}},
+		{"unknown mode", []string{"namespaceMode", "random"}},
+		{"jobID mode without jobID", []string{"namespaceMode", "jobID"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewNamespaceConfig(jobWith(tt.kvs...), testBaseEnv); err == nil {
+				t.Errorf("got no error, want one")
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package spdxdoc
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/spdx/tools-golang/spdx/v2/common"
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// PrimarySource is the source of the job's main code input.
+const PrimarySource = "primary"
+
+// PackageConfig holds the configuration that agents which describe the
+// job's primary code input as an SPDX package have in common.
+type PackageConfig struct {
+	// Dir is where the primary code input is.
+	Dir string
+
+	// Name, Version and DownloadLocation are the package's, from the
+	// job or from the provenance record of the agent that retrieved
+	// the code, whose path is ProvenancePath.
+	Name             string
+	Version          string
+	DownloadLocation string
+	ProvenancePath   string
+
+	// Namespace says how to build the document's namespace.
+	Namespace *NamespaceConfig
+
+	// Ignore decides which paths to leave out of the document.
+	Ignore *agentkit.IgnoreList
+}
+
+// NewPackageConfig reads the package configuration for cfg's job. The
+// package is named after the primary source unless the provenance
+// record or the job's packageName key/value says otherwise, and its
+// version comes from the same places. The document leaves out .git,
+// and anything that the job's ignore key/values match. The namespace
+// is configured as NewNamespaceConfig says, using namespaceBaseEnv.
+// Agents read any key/values of their own separately.
+func NewPackageConfig(cfg agent.JobConfig, namespaceBaseEnv string) (*PackageConfig, error) {
+	pc := &PackageConfig{
+		Name:             PrimarySource,
+		DownloadLocation: "NOASSERTION",
+		Ignore:           &agentkit.IgnoreList{},
+	}
+	if err := pc.Ignore.Add("/.git/"); err != nil {
+		return nil, err
+	}
+
+	// check that we got a primary code input
+	for _, ci := range cfg.CodeInputs {
+		if ci.Source == PrimarySource {
+			pc.Dir = ci.Path
+			break
+		}
+	}
+	if pc.Dir == "" {
+		return nil, fmt.Errorf("no primary codeInputs specified")
+	}
+
+	// start with the provenance record, if there is one
+	paths := []string{}
+	for _, spdxInput := range cfg.SpdxInputs {
+		paths = append(paths, spdxInput.Path)
+	}
+	prov, provPath, err := agentkit.FindProvenance(paths)
+	if err != nil {
+		return nil, err
+	}
+	if prov != nil {
+		pc.ProvenancePath = provPath
+		if prov.Name != "" {
+			pc.Name = prov.Name
+		}
+		pc.Version = prov.Version
+		if prov.DownloadLocation != "" {
+			pc.DownloadLocation = prov.DownloadLocation
+		}
+	}
+
+	// and let the job override it
+	for _, jkv := range cfg.Jkvs {
+		switch jkv.Key {
+		case "packageName":
+			if jkv.Value == "" {
+				return nil, fmt.Errorf("packageName must not be empty")
+			}
+			pc.Name = jkv.Value
+		case "packageVersion":
+			pc.Version = jkv.Value
+		case "ignore":
+			if err := pc.Ignore.Add(jkv.Value); err != nil {
+				return nil, fmt.Errorf("invalid ignore: %v", err)
+			}
+		}
+	}
+
+	pc.Namespace, err = NewNamespaceConfig(cfg, namespaceBaseEnv)
+	if err != nil {
+		return nil, err
+	}
+	return pc, nil
+}
+
+// Summary returns the lines of the job's output messages that describe
+// the package, given the namespace of the document that describes it.
+func (pc *PackageConfig) Summary(namespace string) []string {
+	lines := []string{fmt.Sprintf("package: %s", pc.Name)}
+	if pc.Version != "" {
+		lines = append(lines, fmt.Sprintf("version: %s", pc.Version))
+	}
+	lines = append(lines, fmt.Sprintf("namespace: %s", namespace))
+	if pc.ProvenancePath != "" {
+		lines = append(lines, fmt.Sprintf("provenance: %s", pc.ProvenancePath))
+	}
+	return lines
+}
+
+// PackageID returns the SPDX identifier, without its "SPDXRef-" prefix,
+// for a package called name. It can only use letters, numbers, "." and
+// "-", so anything else in name is replaced.
+func PackageID(name string) common.ElementID {
+	return common.ElementID("Package-" + idInvalidRe.ReplaceAllString(name, "-"))
+}
+
+var idInvalidRe = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
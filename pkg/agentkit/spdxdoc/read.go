@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package spdxdoc
+
+import (
+	"bufio"
+	"bytes"
+	encjson "encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spdx/tools-golang/json"
+	"github.com/spdx/tools-golang/rdf"
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/tagvalue"
+	"github.com/spdx/tools-golang/yaml"
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// Format is one of the serialisations of SPDX documents.
+type Format struct {
+	// Ext is the extension of documents in the format.
+	Ext string
+
+	read    func(r io.Reader) (*spdx.Document, error)
+	version func(b []byte) string
+}
+
+// The formats that documents can be read in.
+var (
+	TagValue = &Format{Ext: ".spdx", read: tagvalue.Read, version: keyVersion("SPDXVersion:")}
+	JSON     = &Format{Ext: ".spdx.json", read: json.Read, version: jsonVersion}
+	YAML     = &Format{Ext: ".spdx.yaml", read: yaml.Read, version: keyVersion("spdxVersion:")}
+	RDF      = &Format{Ext: ".spdx.rdf", read: rdf.Read, version: rdfVersion}
+)
+
+// AllFormats are the formats that documents can be read in, in the
+// order that they are preferred when a directory holds the same
+// document in more than one of them, as idsearcher writes it.
+var AllFormats = []*Format{TagValue, JSON, YAML, RDF}
+
+// Input is one of the SPDX documents in a job's spdxInputs.
+type Input struct {
+	// Label names the document in annotations and output messages, as
+	// its spdxInput's source and its filename.
+	Label  string
+	Path   string
+	Format *Format
+}
+
+// FindInputs finds the SPDX documents in cfg's spdxInputs, in order,
+// in any of formats. Each spdxInput is either a document or a
+// directory of them, such as an earlier agent's spdxOutputDir. In a
+// directory, the provenance fragment that retrieval agents write,
+// which isn't a whole document, is skipped; and if preferredOnly is
+// set, a document written in more than one format is only found in
+// the earliest of formats, rather than in each of them.
+func FindInputs(cfg agent.JobConfig, formats []*Format, preferredOnly bool) ([]*Input, error) {
+	inputs := []*Input{}
+	for _, spdxInput := range cfg.SpdxInputs {
+		paths, err := findDocuments(spdxInput.Path, formats, preferredOnly)
+		if err != nil {
+			return nil, fmt.Errorf("spdxInput from source %q: %v", spdxInput.Source, err)
+		}
+		for _, path := range paths {
+			inputs = append(inputs, &Input{
+				Label:  fmt.Sprintf("%s: %s", spdxInput.Source, filepath.Base(path)),
+				Path:   path,
+				Format: findFormat(path, formats),
+			})
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no SPDX documents found in spdxInputs")
+	}
+	return inputs, nil
+}
+
+// findDocuments returns the SPDX documents in formats at path, which
+// is either a document or a directory, as FindInputs describes.
+func findDocuments(path string, formats []*Format, preferredOnly bool) ([]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		if findFormat(path, formats) == nil {
+			exts := []string{}
+			for _, f := range formats {
+				exts = append(exts, f.Ext)
+			}
+			return nil, fmt.Errorf("%s is not an SPDX document in a format that the agent reads (%s)", path, strings.Join(exts, ", "))
+		}
+		return []string{path}, nil
+	}
+
+	fis, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	// names maps each document's name without its extension to the
+	// files that it's found in, and best to the index in formats of
+	// the earliest of them
+	best := map[string]int{}
+	names := map[string][]string{}
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.IsDir() || name == agentkit.ProvenanceSPDXFilename {
+			continue
+		}
+		for i, f := range formats {
+			if !strings.HasSuffix(name, f.Ext) {
+				continue
+			}
+			base := strings.TrimSuffix(name, f.Ext)
+			switch prev, ok := best[base]; {
+			case !preferredOnly:
+				names[base] = append(names[base], name)
+			case !ok || i < prev:
+				best[base] = i
+				names[base] = []string{name}
+			}
+			break
+		}
+	}
+
+	paths := []string{}
+	for _, ns := range names {
+		for _, name := range ns {
+			paths = append(paths, filepath.Join(path, name))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// findFormat returns the one of formats that the document at path is
+// in, from its extension, or nil if it isn't in any of them.
+func findFormat(path string, formats []*Format) *Format {
+	for _, f := range formats {
+		if strings.HasSuffix(path, f.Ext) {
+			return f
+		}
+	}
+	return nil
+}
+
+// Read parses the document, converted to the latest SPDX version that
+// tools-golang supports, and returns it along with the SPDX version
+// that it was written in, which is "" if that can't be found.
+func (in *Input) Read() (*spdx.Document, string, error) {
+	b, err := ioutil.ReadFile(in.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	doc, err := in.Format.read(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", err
+	}
+	return doc, in.Format.version(b), nil
+}
+
+// keyVersion returns a function that finds the SPDX version of a
+// tag-value or YAML document, from the first line starting with key.
+func keyVersion(key string) func(b []byte) string {
+	return func(b []byte) string {
+		sc := bufio.NewScanner(bytes.NewReader(b))
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if strings.HasPrefix(line, key) {
+				return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, key)), `"'`)
+			}
+		}
+		return ""
+	}
+}
+
+// jsonVersion returns the spdxVersion of the JSON document b.
+func jsonVersion(b []byte) string {
+	var doc struct {
+		SPDXVersion string `json:"spdxVersion"`
+	}
+	if err := encjson.Unmarshal(b, &doc); err != nil {
+		return ""
+	}
+	return doc.SPDXVersion
+}
+
+var rdfVersionRe = regexp.MustCompile(`<spdx:specVersion>\s*([^<\s]+)\s*</spdx:specVersion>`)
+
+// rdfVersion returns the specVersion of the RDF document b.
+func rdfVersion(b []byte) string {
+	if m := rdfVersionRe.FindSubmatch(b); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package spdxdoc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+const testTagValue = `SPDXVersion: SPDX-2.2
+DataLicense: CC0-1.0
+SPDXID: SPDXRef-DOCUMENT
+DocumentName: test
+DocumentNamespace: https://example.com/test
+Creator: Tool: test
+Created: 2020-01-01T00:00:00Z
+`
+
+const testJSON = `{
+  "spdxVersion": "SPDX-2.3",
+  "dataLicense": "CC0-1.0",
+  "SPDXID": "SPDXRef-DOCUMENT",
+  "name": "test",
+  "documentNamespace": "https://example.com/test",
+  "creationInfo": {"creators": ["Tool: test"], "created": "2020-01-01T00:00:00Z"}
+}`
+
+func TestFindInputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spdxdoc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir,
+		"out/a.spdx",
+		"out/a.spdx.json",
+		"out/b.spdx.json",
+		"out/notes.txt",
+		"out/"+agentkit.ProvenanceSPDXFilename,
+		"single.spdx.json",
+	)
+	cfg := agent.JobConfig{SpdxInputs: []*agent.JobConfig_SpdxInput{
+		{Source: "idsearcher", Path: filepath.Join(dir, "out")},
+		{Source: "other", Path: filepath.Join(dir, "single.spdx.json")},
+	}}
+
+	labels := func(inputs []*Input) []string {
+		ls := []string{}
+		for _, in := range inputs {
+			ls = append(ls, in.Label)
+		}
+		return ls
+	}
+
+	inputs, err := FindInputs(cfg, AllFormats, true)
+	if err != nil {
+		t.Fatalf("FindInputs: %v", err)
+	}
+	want := []string{"idsearcher: a.spdx", "idsearcher: b.spdx.json", "other: single.spdx.json"}
+	if got := labels(inputs); !reflect.DeepEqual(got, want) {
+		t.Errorf("preferred only: labels = %v, want %v", got, want)
+	}
+	if inputs[0].Format != TagValue || inputs[1].Format != JSON {
+		t.Errorf("preferred only: formats = %v, %v, want tag-value, JSON", inputs[0].Format.Ext, inputs[1].Format.Ext)
+	}
+
+	inputs, err = FindInputs(cfg, AllFormats, false)
+	if err != nil {
+		t.Fatalf("FindInputs: %v", err)
+	}
+	want = []string{"idsearcher: a.spdx", "idsearcher: a.spdx.json", "idsearcher: b.spdx.json", "other: single.spdx.json"}
+	if got := labels(inputs); !reflect.DeepEqual(got, want) {
+		t.Errorf("all: labels = %v, want %v", got, want)
+	}
+
+	// a document named directly must be in one of the formats
+	if _, err := FindInputs(cfg, []*Format{TagValue}, false); err == nil {
+		t.Errorf("FindInputs with single.spdx.json as tag-value only succeeded, want error")
+	}
+}
+
+func TestReadReturnsWrittenVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spdxdoc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		content string
+		format  *Format
+		want    string
+	}{
+		{"test.spdx", testTagValue, TagValue, "SPDX-2.2"},
+		{"test.spdx.json", testJSON, JSON, "SPDX-2.3"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		in := &Input{Label: tt.name, Path: path, Format: tt.format}
+		doc, version, err := in.Read()
+		if err != nil {
+			t.Errorf("%s: Read: %v", tt.name, err)
+			continue
+		}
+		if version != tt.want {
+			t.Errorf("%s: version = %q, want %q", tt.name, version, tt.want)
+		}
+		if doc.DocumentNamespace != "https://example.com/test" {
+			t.Errorf("%s: namespace = %q, want %q", tt.name, doc.DocumentNamespace, "https://example.com/test")
+		}
+	}
+}
+
+func TestFormatVersions(t *testing.T) {
+	tests := []struct {
+		format  *Format
+		content string
+		want    string
+	}{
+		{TagValue, "  SPDXVersion: SPDX-2.1\n", "SPDX-2.1"},
+		{YAML, "spdxVersion: 'SPDX-2.2'\n", "SPDX-2.2"},
+		{RDF, "<spdx:specVersion> SPDX-2.1 </spdx:specVersion>", "SPDX-2.1"},
+		{JSON, "not json", ""},
+	}
+	for _, tt := range tests {
+		if got := tt.format.version([]byte(tt.content)); got != tt.want {
+			t.Errorf("%s version(%q) = %q, want %q", tt.format.Ext, tt.content, got, tt.want)
+		}
+	}
+}
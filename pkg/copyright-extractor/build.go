@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+)
+
+// maxSearchBytes is how much of each file is searched for copyright
+// statements. They are rarely further in than this.
+const maxSearchBytes = 4 << 20
+
+// extractResults records what was found while extracting from a
+// package's files.
+type extractResults struct {
+	// ignored lists the paths left out of the document; unsearched
+	// counts the binary files that were not searched.
+	ignored    []string
+	unsearched int
+
+	// withStatements and withAuthors count the files in which
+	// copyright statements and authors were found.
+	withStatements int
+	withAuthors    int
+
+	// all holds everything that was found, across all of the files.
+	all *findings
+}
+
+// buildPackage builds the package for the code in ec.Dir, and extracts
+// the copyright statements and authors from each of its files, filling
+// in their copyright text and contributors, and the package's copyright
+// text from all of the statements. It returns ctx's error if ctx is
+// done first.
+func buildPackage(ctx context.Context, rpt agentkit.Reporter, ec *extractConfig) (*spdx.Package, *extractResults, error) {
+	res := &extractResults{all: newFindings()}
+	pkg, ignored, err := spdxdoc.BuildPackage(ctx, rpt, ec.PackageConfig, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	res.ignored = ignored
+
+	// and extract from each file
+	total := int64(len(pkg.Files))
+	for i, f := range pkg.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		rpt.Progress(agentkit.Progress{Phase: "extracting", Unit: "files", Done: int64(i), Total: total})
+
+		// a file with no statements may still be copyrighted, so
+		// that is left as NOASSERTION rather than NONE
+		f.FileCopyrightText = "NOASSERTION"
+
+		b, binary, err := spdxdoc.ReadFileStart(filepath.Join(ec.Dir, f.FileName), maxSearchBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		if binary {
+			res.unsearched++
+			continue
+		}
+		fs := extract(string(b))
+
+		if len(fs.statements) > 0 {
+			res.withStatements++
+			lines := []string{}
+			for _, st := range fs.statements {
+				lines = append(lines, st.String())
+				res.all.addStatement(st)
+			}
+			f.FileCopyrightText = strings.Join(lines, "\n")
+		}
+		if len(fs.authors) > 0 {
+			res.withAuthors++
+			f.FileContributors = fs.authors
+			for _, author := range fs.authors {
+				res.all.addAuthor(author)
+			}
+		}
+	}
+
+	// and finally, we can fill in the package's copyright text, with
+	// the holders in order and any statements without one last
+	if len(res.all.statements) > 0 {
+		sts := append([]*statement{}, res.all.statements...)
+		sort.SliceStable(sts, func(i, j int) bool {
+			if (sts[i].key == "") != (sts[j].key == "") {
+				return sts[j].key == ""
+			}
+			return sts[i].key < sts[j].key
+		})
+		lines := []string{}
+		for _, st := range sts {
+			lines = append(lines, st.String())
+		}
+		pkg.PackageCopyrightText = strings.Join(lines, "\n")
+	}
+
+	return pkg, res, nil
+}
+
+// buildDocument creates an SPDX Document describing pkg.
+func buildDocument(pkg *spdx.Package, ec *extractConfig) (*spdx.Document, error) {
+	// the same package, with the same files, gives the same document
+	namespace, err := ec.DocumentNamespace(pkg)
+	if err != nil {
+		return nil, err
+	}
+	return spdxdoc.NewDocument("github.com/swinslow/peridot-agents/pkg/copyright-extractor", namespace, []*spdx.Package{pkg})
+}
@@ -0,0 +1,31 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+const (
+	// namespaceBaseEnv names the environment variable that sets the
+	// base URI of the namespaces of the documents that the agent
+	// writes, for jobs that don't set their own with the namespaceBase
+	// key/value.
+	namespaceBaseEnv = "COPYRIGHT_EXTRACTOR_NAMESPACE_BASE"
+)
+
+// extractConfig holds the configuration for a job. The agent has no
+// key/values of its own, beyond those for any agent that describes the
+// primary code input.
+type extractConfig struct {
+	*spdxdoc.PackageConfig
+}
+
+// newExtractConfig reads the configuration for cfg's job.
+func newExtractConfig(cfg agent.JobConfig) (*extractConfig, error) {
+	pc, err := spdxdoc.NewPackageConfig(cfg, namespaceBaseEnv)
+	if err != nil {
+		return nil, err
+	}
+	return &extractConfig{PackageConfig: pc}, nil
+}
@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+type copyrightExtractor struct{}
+
+// Run is the function that actually carries out the substantive
+// action of the agent, for this job.
+func (ce *copyrightExtractor) Run(ctx context.Context, cfg agent.JobConfig, rpt agentkit.Reporter) error {
+	// check that we got a non-empty output directory
+	if cfg.SpdxOutputDir == "" {
+		// we didn't; error out
+		return fmt.Errorf("no spdxOutputDir specified")
+	}
+
+	// get the code to search, along with the package's name and other
+	// details, from the job or from the agent that retrieved the code
+	ec, err := newExtractConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	// we're all configured; set status as running
+	rpt.Running()
+
+	// build the SPDX package, extracting from its files as we go
+	pkg, res, err := buildPackage(ctx, rpt, ec)
+	if err != nil {
+		// extractor failed or was cancelled; error out
+		return fmt.Errorf("copyright-extractor failed: %v", err)
+	}
+	doc, err := buildDocument(pkg, ec)
+	if err != nil {
+		return fmt.Errorf("copyright-extractor failed: %v", err)
+	}
+
+	// save the SPDX document to disk
+	const docName = "primary.spdx"
+	if err := spdxdoc.WriteTagValue(doc, filepath.Join(cfg.SpdxOutputDir, docName)); err != nil {
+		return err
+	}
+
+	lines := ec.Summary(doc.DocumentNamespace)
+	lines = append(lines, fmt.Sprintf("files with copyright statements: %d of %d", res.withStatements, len(pkg.Files)))
+	lines = append(lines, fmt.Sprintf("copyright statements: %d", len(res.all.statements)))
+	lines = append(lines, fmt.Sprintf("files with authors: %d of %d", res.withAuthors, len(pkg.Files)))
+	lines = append(lines, fmt.Sprintf("authors: %d", len(res.all.authors)))
+	if len(res.ignored) > 0 {
+		lines = append(lines, fmt.Sprintf("ignored: %s", spdxdoc.ListPaths(res.ignored)))
+	}
+	if res.unsearched > 0 {
+		lines = append(lines, fmt.Sprintf("binary files not searched: %d", res.unsearched))
+	}
+	lines = append(lines, fmt.Sprintf("document: %s", docName))
+	rpt.Output(strings.Join(lines, "\n"))
+
+	// success!
+	return nil
+}
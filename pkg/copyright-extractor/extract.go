@@ -0,0 +1,364 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The years that are accepted in copyright statements. Four-digit
+// numbers outside these are more likely to be something else.
+const (
+	minYear = 1950
+	maxYear = 2099
+)
+
+var (
+	// leadingRe and trailingRe match the comment markers and other
+	// decoration around the text of a line.
+	leadingRe  = regexp.MustCompile(`^[\s/*#;!%>|-]*`)
+	trailingRe = regexp.MustCompile(`\s*(?:\*+/|-->|[*#]+)?\s*$`)
+
+	// markerRe matches the ways of marking a copyright statement, at
+	// its start. A statement can use more than one, as in
+	// "Copyright (C)".
+	markerRe = regexp.MustCompile(`(?i)^(?:portions\s+)?(?:(copyright\b|copr\.)|©|\(c\))[\s:]*`)
+
+	// yearsStartRe and yearsEndRe match a year, or a range of years,
+	// at the start or end of the rest of a statement. The end of a
+	// range may be written with only its last two digits.
+	yearsStartRe = regexp.MustCompile(`^(\d{4})(?:\s*[-–]\s*(\d{4}|\d{2})\b)?[\s,;]*`)
+	yearsEndRe   = regexp.MustCompile(`[\s,;]+(\d{4})(?:\s*[-–]\s*(\d{4}|\d{2}))?[\s.]*$`)
+
+	// reservedRe matches the text that ends a statement's holder.
+	reservedRe = regexp.MustCompile(`(?i)[\s.,;]*(?:all rights reserved|some rights reserved|licensed under|released under|distributed under)\b.*$`)
+
+	// placeholderRe matches a template's placeholder, such as
+	// "<name of author>", which unlike an email address has spaces in
+	// it.
+	placeholderRe = regexp.MustCompile(`<[^<>@]*\s[^<>@]*>`)
+
+	// authorRe matches a line naming a file's authors, and authorSepRe
+	// the text between them.
+	authorRe    = regexp.MustCompile(`(?i)^(?:@author\s+|authors?\s*:\s*|written\s+by\s+)(.+)$`)
+	authorSepRe = regexp.MustCompile(`\s*(?:,|;|\band\b)\s*`)
+)
+
+// notHolderWords are the words that, at the start of what follows a
+// copyright marker, show that the line talks about copyright rather
+// than stating it, as in "copyright notice" or "copyright holders".
+var notHolderWords = map[string]bool{
+	"and": true, "as": true, "for": true, "in": true,
+	"info": true, "information": true, "is": true, "law": true,
+	"laws": true, "license": true, "licence": true, "notice": true,
+	"notices": true, "of": true, "on": true, "or": true, "owner": true,
+	"owners": true, "holder": true, "holders": true, "protection": true,
+	"statement": true, "statements": true, "this": true,
+	"to": true, "year": true, "years": true,
+}
+
+// statement is a copyright statement, in normal form.
+type statement struct {
+	// years are the individual years that the statement covers, in
+	// order.
+	years []int
+
+	// holder is the copyright holder as first written, and key is its
+	// normal form, which statements are de-duplicated by.
+	holder string
+	key    string
+}
+
+// String returns the statement in normal form, such as
+// "Copyright 2010, 2012-2014 Example Inc".
+func (st *statement) String() string {
+	parts := []string{"Copyright"}
+	if len(st.years) > 0 {
+		parts = append(parts, formatYears(st.years))
+	}
+	if st.holder != "" {
+		parts = append(parts, st.holder)
+	}
+	return strings.Join(parts, " ")
+}
+
+// merge adds other's years to st, which has the same holder.
+func (st *statement) merge(other *statement) {
+	seen := map[int]bool{}
+	for _, y := range st.years {
+		seen[y] = true
+	}
+	for _, y := range other.years {
+		if !seen[y] {
+			st.years = append(st.years, y)
+		}
+	}
+	sort.Ints(st.years)
+}
+
+// findings are the copyright statements and authors found in a file, or
+// in all of a package's files, de-duplicated.
+type findings struct {
+	statements []*statement
+	authors    []string
+
+	byKey       map[string]*statement
+	seenAuthors map[string]bool
+}
+
+// newFindings returns an empty set of findings.
+func newFindings() *findings {
+	return &findings{byKey: map[string]*statement{}, seenAuthors: map[string]bool{}}
+}
+
+// addStatement adds st, merging its years into any earlier statement
+// with the same holder.
+func (fs *findings) addStatement(st *statement) {
+	if prev, ok := fs.byKey[st.key]; ok {
+		prev.merge(st)
+		return
+	}
+	c := &statement{years: append([]int{}, st.years...), holder: st.holder, key: st.key}
+	fs.byKey[st.key] = c
+	fs.statements = append(fs.statements, c)
+}
+
+// addAuthor adds author, unless it has been seen already.
+func (fs *findings) addAuthor(author string) {
+	key := normalKey(author)
+	if fs.seenAuthors[key] {
+		return
+	}
+	fs.seenAuthors[key] = true
+	fs.authors = append(fs.authors, author)
+}
+
+// extract finds the copyright statements and authors in text.
+func extract(text string) *findings {
+	fs := newFindings()
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := stripDecoration(lines[i])
+
+		if m := authorRe.FindStringSubmatch(line); m != nil {
+			for _, author := range splitAuthors(m[1]) {
+				fs.addAuthor(author)
+			}
+			continue
+		}
+
+		st, needsHolder := parseStatement(line)
+		if st == nil {
+			continue
+		}
+		// the holder may be on the next line, after the years
+		if needsHolder && i+1 < len(lines) {
+			next := stripDecoration(lines[i+1])
+			if holder := cleanHolder(next); holder != "" && isHolder(holder) && !markerRe.MatchString(next) {
+				st.holder, st.key = holder, normalKey(holder)
+				i++
+			}
+		}
+		fs.addStatement(st)
+	}
+	return fs
+}
+
+// stripDecoration returns line without the comment markers and other
+// decoration around it.
+func stripDecoration(line string) string {
+	line = leadingRe.ReplaceAllString(line, "")
+	return trailingRe.ReplaceAllString(line, "")
+}
+
+// parseStatement parses line as a copyright statement, returning nil
+// if it isn't one. needsHolder is true if the statement has years but
+// no holder, which may be on the next line.
+func parseStatement(line string) (st *statement, needsHolder bool) {
+	// strip all of the markers, noting whether any of them was more
+	// than a bare "(c)", which could as well be an item in a list
+	rest := line
+	word := false
+	found := false
+	for {
+		m := markerRe.FindStringSubmatchIndex(rest)
+		if m == nil {
+			break
+		}
+		found = true
+		if m[2] >= 0 || strings.Contains(rest[m[0]:m[1]], "©") {
+			word = true
+		}
+		rest = rest[m[1]:]
+	}
+	if !found {
+		return nil, false
+	}
+
+	st = &statement{}
+	for {
+		m := yearsStartRe.FindStringSubmatch(rest)
+		if m == nil {
+			break
+		}
+		years, ok := parseYears(m[1], m[2])
+		if !ok {
+			break
+		}
+		st.years = append(st.years, years...)
+		rest = rest[len(m[0]):]
+	}
+
+	holder := cleanHolder(rest)
+	// years can also follow the holder
+	for {
+		m := yearsEndRe.FindStringSubmatchIndex(holder)
+		if m == nil {
+			break
+		}
+		years, ok := parseYears(holder[m[2]:m[3]], submatch(holder, m, 2))
+		if !ok {
+			break
+		}
+		st.years = append(st.years, years...)
+		holder = cleanHolder(holder[:m[0]])
+	}
+	sort.Ints(st.years)
+	st.years = uniqueYears(st.years)
+
+	switch {
+	case holder != "" && isHolder(holder):
+		st.holder, st.key = holder, normalKey(holder)
+	case holder != "":
+		// the rest of the line isn't a holder, so this is talking
+		// about copyright rather than stating it
+		return nil, false
+	case len(st.years) == 0:
+		return nil, false
+	}
+	if !word && len(st.years) == 0 {
+		return nil, false
+	}
+	return st, st.holder == ""
+}
+
+// submatch returns the text of the n'th submatch of m in s, or "" if
+// it didn't match.
+func submatch(s string, m []int, n int) string {
+	if m[2*n] < 0 {
+		return ""
+	}
+	return s[m[2*n]:m[2*n+1]]
+}
+
+// parseYears returns the years from start to end, where end may be "",
+// for a single year, or only its last two digits. ok is false if they
+// aren't a plausible range of years.
+func parseYears(start string, end string) (years []int, ok bool) {
+	first, err := strconv.Atoi(start)
+	if err != nil || first < minYear || first > maxYear {
+		return nil, false
+	}
+	last := first
+	if end != "" {
+		if len(end) == 2 {
+			end = start[:2] + end
+		}
+		last, err = strconv.Atoi(end)
+		if err != nil || last < first || last > maxYear {
+			return nil, false
+		}
+	}
+	for y := first; y <= last; y++ {
+		years = append(years, y)
+	}
+	return years, true
+}
+
+// uniqueYears returns years, which are sorted, without duplicates.
+func uniqueYears(years []int) []int {
+	out := []int{}
+	for i, y := range years {
+		if i == 0 || y != years[i-1] {
+			out = append(out, y)
+		}
+	}
+	return out
+}
+
+// formatYears writes years, which are sorted, as a list of years and
+// ranges of consecutive years, such as "2010, 2012-2014".
+func formatYears(years []int) string {
+	parts := []string{}
+	for i := 0; i < len(years); {
+		j := i
+		for j+1 < len(years) && years[j+1] == years[j]+1 {
+			j++
+		}
+		if j == i {
+			parts = append(parts, strconv.Itoa(years[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", years[i], years[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ", ")
+}
+
+// cleanHolder returns s with "by", the text that ends a statement,
+// extra whitespace and trailing punctuation removed.
+func cleanHolder(s string) string {
+	s = reservedRe.ReplaceAllString(s, "")
+	s = strings.Join(strings.Fields(s), " ")
+	if strings.HasPrefix(strings.ToLower(s), "by ") {
+		s = s[3:]
+	}
+	return strings.TrimRight(s, " .,;:")
+}
+
+// isHolder reports whether s, a cleaned holder, looks like the name of
+// a copyright holder rather than the rest of a sentence, a template's
+// placeholder or code.
+func isHolder(s string) bool {
+	if len(s) > 200 || strings.ContainsAny(s, "{}=+\\$`|") || placeholderRe.MatchString(s) {
+		return false
+	}
+	first := []rune(s)[0]
+	if !unicode.IsLetter(first) && !unicode.IsDigit(first) && first != '"' && first != '\'' {
+		return false
+	}
+	fields := strings.FieldsFunc(strings.ToLower(s), isNotWordChar)
+	return len(fields) > 0 && !notHolderWords[fields[0]]
+}
+
+// splitAuthors splits the authors named on an author line, leaving out
+// any years.
+func splitAuthors(s string) []string {
+	authors := []string{}
+	for _, part := range authorSepRe.Split(s, -1) {
+		part = strings.TrimRight(strings.TrimSpace(part), ".")
+		if part == "" || yearsStartRe.MatchString(part) {
+			continue
+		}
+		if len(part) <= 100 && isHolder(part) {
+			authors = append(authors, part)
+		}
+	}
+	return authors
+}
+
+// normalKey returns the normal form of a holder or author's name, in
+// which case, punctuation and spacing don't matter, so that "Example,
+// Inc." and "Example Inc" are the same.
+func normalKey(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), isNotWordChar), " ")
+}
+
+// isNotWordChar reports whether r separates words.
+func isNotWordChar(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '@'
+}
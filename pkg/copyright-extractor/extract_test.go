@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStatement(t *testing.T) {
+	tests := []struct {
+		line string
+		// want is the statement in normal form, or "" if the line isn't
+		// one
+		want            string
+		wantNeedsHolder bool
+	}{
+		{line: "Copyright 2019 Example Inc.", want: "Copyright 2019 Example Inc"},
+		{line: "Copyright (C) 2010-12 Example Inc", want: "Copyright 2010-2012 Example Inc"},
+		{line: "Copyright (c) 2010 - 2012, 2015 by Example, Inc. All rights reserved.", want: "Copyright 2010-2012, 2015 Example, Inc"},
+		{line: "© 2020 Someone <someone@example.com>", want: "Copyright 2020 Someone <someone@example.com>"},
+		{line: "copr. 1999 Someone", want: "Copyright 1999 Someone"},
+		{line: "Portions Copyright 2001 Someone", want: "Copyright 2001 Someone"},
+		{line: "Copyright Example Inc 2014-2016", want: "Copyright 2014-2016 Example Inc"},
+		{line: "Copyright: Example Inc", want: "Copyright Example Inc"},
+		{line: "(c) 2018 Example Inc", want: "Copyright 2018 Example Inc"},
+		// the holder may be on the next line
+		{line: "Copyright (c) 2005, 2006", want: "Copyright 2005-2006", wantNeedsHolder: true},
+		// numbers that aren't years, or ranges of them, are left as
+		// written
+		{line: "Copyright 2012-10 Example", want: "Copyright 2012-10 Example"},
+		{line: "Copyright 1234 Example", want: "Copyright 1234 Example"},
+		// talking about copyright rather than stating it
+		{line: "copyright notice"},
+		{line: "the above copyright notice and this permission notice"},
+		{line: "Copyright holders and contributors"},
+		{line: "Copyright (C) <year> <name of author>"},
+		{line: "Copyright"},
+		// a bare "(c)" is as likely an item in a list
+		{line: "(c) Example Inc"},
+		{line: "(c) the name of the author may not be used"},
+		{line: "Example Inc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			st, needsHolder := parseStatement(tt.line)
+			got := ""
+			if st != nil {
+				got = st.String()
+			}
+			if got != tt.want || needsHolder != tt.wantNeedsHolder {
+				t.Errorf("parseStatement(%q) = %q, %t, want %q, %t", tt.line, got, needsHolder, tt.want, tt.wantNeedsHolder)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		want        []string
+		wantAuthors []string
+	}{
+		{
+			name: "in a comment",
+			text: "/*\n * Copyright (c) 2019 Example Inc.\n * All rights reserved.\n */\n",
+			want: []string{"Copyright 2019 Example Inc"},
+		},
+		{
+			name: "holder on the next line",
+			text: "# Copyright (C) 2010-12,\n#   Example Foundation\n#\n",
+			want: []string{"Copyright 2010-2012 Example Foundation"},
+		},
+		{
+			name: "next line isn't a holder",
+			text: "// Copyright 2010\n// This file is part of Example.\n",
+			want: []string{"Copyright 2010"},
+		},
+		{
+			name: "next line is another statement",
+			text: "Copyright 2010\nCopyright 2011 Example\n",
+			want: []string{"Copyright 2010", "Copyright 2011 Example"},
+		},
+		{
+			name: "same holder merged",
+			text: "Copyright 2010 Example, Inc.\nCopyright (c) 2012-2013 EXAMPLE INC\nCopyright 2011 Other\n",
+			want: []string{"Copyright 2010, 2012-2013 Example, Inc", "Copyright 2011 Other"},
+		},
+		{
+			name: "list items and the license text",
+			text: "(a) the first\n(b) the second\n(c) the third\n\nRedistributions of source code must retain the above copyright notice.\n",
+			want: []string{},
+		},
+		{
+			name:        "authors",
+			text:        "// Author: Ann Example, Bob Example and Cy Example\n// @author Ann Example\n// Written by Dee Example, 2019\n",
+			want:        []string{},
+			wantAuthors: []string{"Ann Example", "Bob Example", "Cy Example", "Dee Example"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := extract(tt.text)
+			got := []string{}
+			for _, st := range fs.statements {
+				got = append(got, st.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got statements %q, want %q", got, tt.want)
+			}
+			if tt.wantAuthors == nil {
+				tt.wantAuthors = []string{}
+			}
+			if authors := append([]string{}, fs.authors...); !reflect.DeepEqual(authors, tt.wantAuthors) {
+				t.Errorf("got authors %q, want %q", authors, tt.wantAuthors)
+			}
+		})
+	}
+}
+
+func TestFormatYears(t *testing.T) {
+	tests := []struct {
+		years []int
+		want  string
+	}{
+		{nil, ""},
+		{[]int{2010}, "2010"},
+		{[]int{2010, 2011}, "2010-2011"},
+		{[]int{2010, 2012, 2013, 2014, 2016}, "2010, 2012-2014, 2016"},
+	}
+	for _, tt := range tests {
+		if got := formatYears(tt.years); got != tt.want {
+			t.Errorf("formatYears(%v) = %q, want %q", tt.years, got, tt.want)
+		}
+	}
+}
+
+func TestNormalKey(t *testing.T) {
+	if a, b := normalKey("Example, Inc."), normalKey("EXAMPLE  inc"); a != b {
+		t.Errorf("normalKey gave %q and %q, want them the same", a, b)
+	}
+	if got := normalKey("Someone <someone@example.com>"); !strings.Contains(got, "someone@example") {
+		t.Errorf("normalKey kept %q, want the email address kept", got)
+	}
+}
@@ -0,0 +1,19 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"log"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+)
+
+const (
+	port = ":3019"
+)
+
+func main() {
+	// serve jobs until we're asked to shut down
+	if err := agentkit.Serve(port, &copyrightExtractor{}); err != nil {
+		log.Fatal(err)
+	}
+}
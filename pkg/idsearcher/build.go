@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/spdx/v2/common"
+	"github.com/spdx/tools-golang/utils"
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+)
+
+// buildPackage builds the package for the code input in, and searches
+// for short-form IDs in each file, filling in license fields as
+// appropriate. It produces the same package as tools-golang's
+// idsearcher.BuildIDsDocument, but is assembled here from the builder
+// sections so that ctx can be checked between files, letting a
+// cancelled job stop walking, hashing and searching the directory
+// rather than running to completion; and so that progress can be
+// reported through rpt as it goes. The package's name and other
+// details come from in.pi, and paths are left out or not searched as
+// in.ic says. Its files are numbered from firstFile, so that they can
+// be given identifiers that are unique within the document.
+func buildPackage(ctx context.Context, rpt agentkit.Reporter, in *codeInput, firstFile int) error {
+	in.ignored = &ignoredPaths{}
+
+	// build the file section first, so we'll have it available
+	// for calculating the package verification code
+	rpt.Progress(agentkit.Progress{Phase: in.phase("listing files")})
+	filepaths, ignored, err := spdxdoc.ListFiles(ctx, in.dir, in.ic.builder)
+	if err != nil {
+		return err
+	}
+	for _, p := range ignored {
+		if strings.HasSuffix(p, "/") {
+			in.ignored.dirs = append(in.ignored.dirs, p)
+		} else {
+			in.ignored.files = append(in.ignored.files, p)
+		}
+	}
+	files, err := spdxdoc.HashFiles(ctx, rpt, in.phase("hashing"), in.dir, filepaths, firstFile)
+	if err != nil {
+		return err
+	}
+
+	// get the verification code
+	code, err := utils.GetVerificationCode(files, "")
+	if err != nil {
+		return err
+	}
+
+	// now build the package section
+	in.pkg = &spdx.Package{
+		FilesAnalyzed:               true,
+		IsFilesAnalyzedTagPresent:   true,
+		PackageVerificationCode:     &code,
+		PackageLicenseConcluded:     "NOASSERTION",
+		PackageLicenseInfoFromFiles: []string{},
+		PackageLicenseDeclared:      "NOASSERTION",
+		PackageCopyrightText:        "NOASSERTION",
+		Files:                       files,
+	}
+	in.pi.apply(in.pkg)
+
+	// now, walk through each file and find its licenses (if any)
+	return searchPackageIDs(ctx, rpt, in)
+}
+
+// buildIDsDocument creates an SPDX Document (of the latest version that
+// tools-golang supports) describing the packages that have been built
+// for inputs, with rels between them. The document is named after the
+// first input's package, and its namespace is built as nc says.
+func buildIDsDocument(inputs []*codeInput, rels []*inputRelationship, nc *spdxdoc.NamespaceConfig) (*spdx.Document, error) {
+	// the namespace covers the files in all of the packages
+	codes := []string{}
+	pkgs := []*spdx.Package{}
+	for _, in := range inputs {
+		codes = append(codes, in.pkg.PackageVerificationCode.Value)
+		pkgs = append(pkgs, in.pkg)
+	}
+	pi := inputs[0].pi
+	name := strings.TrimPrefix(string(pi.spdxID()), "Package-")
+	namespace, err := nc.Namespace(name, pi.name, pi.version, pi.downloadLocation, strings.Join(codes, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := spdxdoc.NewDocument("github.com/spdx/tools-golang/idsearcher", namespace, pkgs)
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range rels {
+		doc.Relationships = append(doc.Relationships, &spdx.Relationship{
+			RefA:         common.MakeDocElementID("", string(rel.a.pkg.PackageSPDXIdentifier)),
+			RefB:         common.MakeDocElementID("", string(rel.b.pkg.PackageSPDXIdentifier)),
+			Relationship: rel.typ,
+		})
+	}
+	return doc, nil
+}
+
+// searchPackageIDs searches each of the files in in's package for
+// short-form IDs, and fills in the file and package license fields from
+// what it finds. Files that the searcher ignores are left as
+// NOASSERTION, and counted in in.ignored. It returns ctx's error if ctx
+// is done before all files have been searched.
+func searchPackageIDs(ctx context.Context, rpt agentkit.Reporter, in *codeInput) error {
+	pkg, ignore, ignored := in.pkg, in.ic.searcher, in.ignored
+	licsForPackage := map[string]int{}
+	total := int64(len(pkg.Files))
+	for i, f := range pkg.Files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rpt.Progress(agentkit.Progress{Phase: in.phase("searching"), Unit: "files", Done: int64(i), Total: total})
+
+		// start by initializing / clearing values
+		f.LicenseInfoInFiles = []string{"NOASSERTION"}
+		f.LicenseConcluded = "NOASSERTION"
+
+		// check whether the searcher should ignore this file
+		if ignore.Ignored(f.FileName, false) {
+			ignored.unsearched++
+			continue
+		}
+
+		fPath := filepath.Join(in.dir, f.FileName)
+		// FIXME this is not preferable -- ignoring error
+		ids, _ := searchFileIDs(fPath)
+
+		// separate out for this file's licenses
+		licsForFile := map[string]int{}
+		licsParens := []string{}
+		for _, lid := range ids {
+			// get individual elements and add for file and package
+			licElements := getIndividualLicenses(lid)
+			for _, elt := range licElements {
+				licsForFile[elt] = 1
+				licsForPackage[elt] = 1
+			}
+			// parenthesize if needed and add to slice for joining
+			licsParens = append(licsParens, makeElement(lid))
+		}
+
+		// OK -- now we can fill in the file's details, or NOASSERTION if none
+		if len(licsForFile) > 0 {
+			f.LicenseInfoInFiles = []string{}
+			for lic := range licsForFile {
+				f.LicenseInfoInFiles = append(f.LicenseInfoInFiles, lic)
+			}
+			sort.Strings(f.LicenseInfoInFiles)
+			// avoid adding parens and joining for single-ID items
+			if len(licsParens) == 1 {
+				f.LicenseConcluded = ids[0]
+			} else {
+				f.LicenseConcluded = strings.Join(licsParens, " AND ")
+			}
+		}
+	}
+
+	// and finally, we can fill in the package's details
+	if len(licsForPackage) == 0 {
+		pkg.PackageLicenseInfoFromFiles = []string{"NOASSERTION"}
+	} else {
+		pkg.PackageLicenseInfoFromFiles = []string{}
+		for lic := range licsForPackage {
+			pkg.PackageLicenseInfoFromFiles = append(pkg.PackageLicenseInfoFromFiles, lic)
+		}
+		sort.Strings(pkg.PackageLicenseInfoFromFiles)
+	}
+
+	return nil
+}
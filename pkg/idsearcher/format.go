@@ -0,0 +1,224 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spdx/tools-golang/convert"
+	"github.com/spdx/tools-golang/json"
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/spdx/common"
+	"github.com/spdx/tools-golang/spdx/v2/v2_1"
+	"github.com/spdx/tools-golang/spdx/v2/v2_2"
+	"github.com/spdx/tools-golang/tagvalue"
+	"github.com/spdx/tools-golang/yaml"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// defaultOutputFormat is the format that documents are written in if
+// the job doesn't choose any with the outputFormats key/value.
+const defaultOutputFormat = "tag-value"
+
+// The ways of dividing the job's packages among documents, which the
+// job chooses with the documents key/value.
+const (
+	// documentsCombined writes a single document, describing the
+	// packages for all of the job's code inputs. This is the default.
+	documentsCombined = "combined"
+
+	// documentsPerInput writes a separate document for each code
+	// input, named after its source.
+	documentsPerInput = "perInput"
+)
+
+// An outputFormat is one of the serialisations that the agent can
+// write its documents in.
+type outputFormat struct {
+	name string
+
+	// ext is added to the document's base name to give the name of
+	// the file it is written to.
+	ext string
+
+	// write writes doc to w, as the given SPDX version.
+	write func(doc *spdx.Document, version string, w io.Writer) error
+}
+
+// outputFormats are the formats that a job can choose from with the
+// outputFormats key/value.
+var outputFormats = []outputFormat{
+	{name: "tag-value", ext: ".spdx", write: converted(tagvalue.Write)},
+	{name: "json", ext: ".spdx.json", write: converted(writeJSON)},
+	{name: "yaml", ext: ".spdx.yaml", write: converted(yaml.Write)},
+	{name: "rdf", ext: ".spdx.rdf", write: writeRDF},
+}
+
+// spdxVersions are the SPDX versions that a job can choose from with
+// the spdxVersion key/value. Documents are built as the latest one,
+// which is the default, and converted to earlier ones when written.
+var spdxVersions = []string{v2_1.Version, v2_2.Version, spdx.Version}
+
+// outputConfig says how to write a job's documents.
+type outputConfig struct {
+	formats   []outputFormat
+	version   string
+	documents string
+}
+
+// newOutputConfig reads the output configuration for cfg's job. The
+// outputFormats key/value is a comma-separated list of format names,
+// and may be given more than once.
+func newOutputConfig(cfg agent.JobConfig) (*outputConfig, error) {
+	oc := &outputConfig{version: spdx.Version, documents: documentsCombined}
+	names := []string{}
+	for _, jkv := range cfg.Jkvs {
+		switch jkv.Key {
+		case "outputFormats":
+			for _, name := range strings.Split(jkv.Value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+		case "spdxVersion":
+			oc.version = jkv.Value
+		case "documents":
+			oc.documents = jkv.Value
+		}
+	}
+	if len(names) == 0 {
+		names = []string{defaultOutputFormat}
+	}
+
+	for _, name := range names {
+		f, err := findOutputFormat(name)
+		if err != nil {
+			return nil, err
+		}
+		if !oc.hasFormat(f.name) {
+			oc.formats = append(oc.formats, f)
+		}
+	}
+
+	if !isSPDXVersion(oc.version) {
+		return nil, fmt.Errorf("spdxVersion %q is invalid; must be one of %s", oc.version, strings.Join(spdxVersions, ", "))
+	}
+	if oc.documents != documentsCombined && oc.documents != documentsPerInput {
+		return nil, fmt.Errorf("documents %q is invalid; must be %s or %s", oc.documents, documentsCombined, documentsPerInput)
+	}
+	return oc, nil
+}
+
+// findOutputFormat returns the output format called name.
+func findOutputFormat(name string) (outputFormat, error) {
+	known := []string{}
+	for _, f := range outputFormats {
+		if f.name == name {
+			return f, nil
+		}
+		known = append(known, f.name)
+	}
+	return outputFormat{}, fmt.Errorf("output format %q is invalid; must be one of %s", name, strings.Join(known, ", "))
+}
+
+// hasFormat reports whether oc already includes the format called name.
+func (oc *outputConfig) hasFormat(name string) bool {
+	for _, f := range oc.formats {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isSPDXVersion reports whether version is one of spdxVersions.
+func isSPDXVersion(version string) bool {
+	for _, v := range spdxVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// writeDocuments writes each of docs in each of oc's formats, to files
+// in dir named after the matching one of bases plus each format's
+// extension, and returns the names of the files. If any can't be
+// written, it removes those that were, so that later agents don't pick
+// up a partial set.
+func (oc *outputConfig) writeDocuments(docs []*spdx.Document, bases []string, dir string) ([]string, error) {
+	written := []string{}
+	for i, doc := range docs {
+		for _, f := range oc.formats {
+			name := bases[i] + f.ext
+			if err := writeDocument(doc, oc.version, f, filepath.Join(dir, name)); err != nil {
+				for _, w := range written {
+					os.Remove(filepath.Join(dir, w))
+				}
+				return nil, err
+			}
+			written = append(written, name)
+		}
+	}
+	return written, nil
+}
+
+// writeDocument writes doc to the file at path, in format f. If it
+// can't, it removes what it wrote of the file.
+func writeDocument(doc *spdx.Document, version string, f outputFormat, path string) error {
+	w, err := os.Create(path)
+	if err != nil {
+		// can't open file to write SPDX document to disk; error out
+		return fmt.Errorf("can't open file to write SPDX document to disk: %v", err)
+	}
+
+	err = f.write(doc, version, w)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// can't write SPDX document to disk; remove what we wrote
+		// of it and error out
+		os.Remove(path)
+		return fmt.Errorf("can't write SPDX document to disk as %s: %v", f.name, err)
+	}
+	return nil
+}
+
+// converted returns a write function for outputFormat that converts
+// the document to the requested SPDX version and then writes it with
+// fn, which is one of tools-golang's writers.
+func converted(fn func(doc common.AnyDocument, w io.Writer) error) func(*spdx.Document, string, io.Writer) error {
+	return func(doc *spdx.Document, version string, w io.Writer) error {
+		d, err := convertDocument(doc, version)
+		if err != nil {
+			return err
+		}
+		return fn(d, w)
+	}
+}
+
+// convertDocument returns doc converted to the given SPDX version.
+func convertDocument(doc *spdx.Document, version string) (common.AnyDocument, error) {
+	var d common.AnyDocument
+	switch version {
+	case v2_1.Version:
+		d = &v2_1.Document{}
+	case v2_2.Version:
+		d = &v2_2.Document{}
+	default:
+		return doc, nil
+	}
+	if err := convert.Document(doc, d); err != nil {
+		return nil, fmt.Errorf("couldn't convert document to %s: %v", version, err)
+	}
+	return d, nil
+}
+
+// writeJSON writes doc to w as indented JSON.
+func writeJSON(doc common.AnyDocument, w io.Writer) error {
+	return json.Write(doc, w, json.Indent("  "))
+}
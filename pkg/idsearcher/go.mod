@@ -3,7 +3,9 @@ module github.com/swinslow/peridot-agents/pkg/idsearcher
 go 1.13
 
 require (
-	github.com/spdx/tools-golang v0.0.0-20190418005930-ea86b81b8378
+	github.com/spdx/tools-golang v0.5.5
+	github.com/swinslow/peridot-agents/pkg/agentkit v0.0.0
 	github.com/swinslow/peridot-jobrunner v0.0.0-20191124161321-701dbac8170c
-	google.golang.org/grpc v1.25.1
 )
+
+replace github.com/swinslow/peridot-agents/pkg/agentkit => ../agentkit
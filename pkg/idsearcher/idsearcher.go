@@ -4,113 +4,121 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
-	"time"
+	"strings"
 
-	sid "github.com/spdx/tools-golang/v0/idsearcher"
-	"github.com/spdx/tools-golang/v0/tvsaver"
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
 	"github.com/swinslow/peridot-jobrunner/pkg/agent"
-	"github.com/swinslow/peridot-jobrunner/pkg/status"
 )
 
-// setStatusError is a helper function to send a statusUpdate
-// to the setStatus channel with ERROR status, and with the specified
-// error message.
-func setStatusError(setStatus chan<- statusUpdate, msg string) {
-	setStatus <- statusUpdate{
-		run:       status.Status_STOPPED,
-		health:    status.Health_ERROR,
-		now:       time.Now(),
-		outputMsg: msg,
-	}
-}
-
-// runAgent is the function that actually carries out the substantive
-// action of the agent, for this job. It does not do any gRPC communication
-// itself, but instead uses signals back to the separate sender goroutine
-// to set job status information.
-func (i *idsearcher) runAgent(
-	ctx context.Context,
-	cfg agent.JobConfig,
-	setStatus chan<- statusUpdate,
-) {
-	defer log.Printf("==> CLOSING runAgent")
-
-	// now that we exist, we own setStatus and are responsible for
-	// closing it when we are done
-	defer close(setStatus)
-
-	// set up package name based on job ID
-	// FIXME consider making package name configurable
-	packageName := "primary"
-
-	// get searching directory and output file path from configuration
-	var packageRootDir string
-	for _, codeInput := range cfg.CodeInputs {
-		if codeInput.Source == "primary" {
-			packageRootDir = codeInput.Path
-		}
-	}
-
-	// check that we found a primary input with a path
-	if packageRootDir == "" {
-		// we didn't; error out
-		setStatusError(setStatus, "no primary codeInputs specified")
-		return
-	}
+type idsearcher struct{}
 
+// Run is the function that actually carries out the substantive
+// action of the agent, for this job.
+func (i *idsearcher) Run(ctx context.Context, cfg agent.JobConfig, rpt agentkit.Reporter) error {
 	// check that we got a non-empty output directory
 	if cfg.SpdxOutputDir == "" {
 		// we didn't; error out
-		setStatusError(setStatus, "no spdxOutputDir specified")
-		return
+		return fmt.Errorf("no spdxOutputDir specified")
 	}
 
-	fileOut := filepath.Join(cfg.SpdxOutputDir, "primary.spdx")
+	// get the code to search, along with each package's name and other
+	// details, from the job or from the agent that retrieved the code,
+	// and the paths to leave out or not search, from the job and from
+	// the ignore file in the code
+	inputs, err := newCodeInputs(cfg)
+	if err != nil {
+		return err
+	}
+	rels, err := newInputRelationships(cfg, inputs)
+	if err != nil {
+		return err
+	}
+	nc, err := spdxdoc.NewNamespaceConfig(cfg, namespaceBaseEnv)
+	if err != nil {
+		return err
+	}
 
-	// set up SPDX idsearcher configuration
-	searchConfig := &sid.Config{
-		// FIXME consider adding unique value (such as job ID or UUID)
-		// FIXME to make this unique
-		NamespacePrefix: "https://peridot/primary/idsearcher",
-		BuilderPathsIgnored: []string{
-			"/.git/",
-		},
-		// FIXME consider making Builder... and SearcherPathsIgnored configurable
+	// get the formats and SPDX version to write the document as
+	oc, err := newOutputConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if oc.documents == documentsPerInput && len(rels) > 0 {
+		return fmt.Errorf("relationships between codeInputs need documents %s", documentsCombined)
 	}
 
 	// we're all configured; set status as running
-	setStatus <- statusUpdate{run: status.Status_RUNNING}
+	rpt.Running()
+
+	// build the SPDX packages, numbering the files across all of them
+	fileNumber := 0
+	for _, in := range inputs {
+		if err := buildPackage(ctx, rpt, in, fileNumber); err != nil {
+			// searcher failed or was cancelled; error out
+			return fmt.Errorf("idsearcher failed: %v", err)
+		}
+		fileNumber += len(in.pkg.Files)
+	}
 
-	// build the SPDX document
-	doc, err := sid.BuildIDsDocument(packageName, packageRootDir, searchConfig)
-	if err != nil {
-		// searcher failed for some reason; error out
-		setStatusError(setStatus, fmt.Sprintf("tools-golang/idsearcher failed: %v", err))
-		return
+	// and the documents to describe them
+	docs := []*spdx.Document{}
+	bases := []string{}
+	if oc.documents == documentsPerInput {
+		for _, in := range inputs {
+			doc, err := buildIDsDocument([]*codeInput{in}, nil, nc)
+			if err != nil {
+				return fmt.Errorf("idsearcher failed: %v", err)
+			}
+			docs = append(docs, doc)
+			bases = append(bases, in.source)
+		}
+	} else {
+		doc, err := buildIDsDocument(inputs, rels, nc)
+		if err != nil {
+			return fmt.Errorf("idsearcher failed: %v", err)
+		}
+		docs = append(docs, doc)
+		bases = append(bases, primarySource)
 	}
 
-	// save the SPDX document to disk
-	w, err := os.Create(fileOut)
+	// save the SPDX documents to disk, in each format
+	written, err := oc.writeDocuments(docs, bases, cfg.SpdxOutputDir)
 	if err != nil {
-		// can't open file to write SPDX document to disk; error out
-		setStatusError(setStatus, fmt.Sprintf("can't open file to write SPDX document to disk: %v", err))
-		return
+		return err
 	}
-	defer w.Close()
 
-	err = tvsaver.Save2_1(doc, w)
-	if err != nil {
-		// can't write SPDX document to disk; error out
-		setStatusError(setStatus, fmt.Sprintf("can't write SPDX document to disk: %v", err))
-		return
+	lines := []string{}
+	for i, in := range inputs {
+		if len(inputs) > 1 {
+			lines = append(lines, fmt.Sprintf("input: %s", in.source))
+		}
+		lines = append(lines, fmt.Sprintf("package: %s", in.pi.name))
+		if in.pi.version != "" {
+			lines = append(lines, fmt.Sprintf("version: %s", in.pi.version))
+		}
+		// with one document, it is listed with the primary input
+		if i < len(docs) {
+			lines = append(lines, fmt.Sprintf("namespace: %s", docs[i].DocumentNamespace))
+		}
+		if in.pi.provenancePath != "" {
+			lines = append(lines, fmt.Sprintf("provenance: %s", in.pi.provenancePath))
+		}
+		if in.ic.ignoreFile != "" {
+			lines = append(lines, fmt.Sprintf("ignore file: %s", in.ic.ignoreFile))
+		}
+		if s := in.ignored.summary(); s != "" {
+			lines = append(lines, s)
+		}
 	}
+	for _, rel := range rels {
+		lines = append(lines, fmt.Sprintf("relationship: %s", rel))
+	}
+	lines = append(lines, fmt.Sprintf("spdx version: %s", oc.version))
+	lines = append(lines, fmt.Sprintf("documents: %s", strings.Join(written, ", ")))
+	rpt.Output(strings.Join(lines, "\n"))
 
 	// success!
-	setStatus <- statusUpdate{
-		run: status.Status_STOPPED,
-		now: time.Now(),
-	}
+	return nil
 }
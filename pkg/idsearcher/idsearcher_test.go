@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// testReporter records what a job reports.
+type testReporter struct {
+	running bool
+	output  []string
+}
+
+func (r *testReporter) Running()                     { r.running = true }
+func (r *testReporter) Output(msg string)            { r.output = append(r.output, msg) }
+func (r *testReporter) Degraded(msg string)          { r.output = append(r.output, msg) }
+func (r *testReporter) Progress(p agentkit.Progress) {}
+
+// writeTree writes files, which map paths to contents, under dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, body := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// kvs returns the job key/values for pairs of keys and values.
+func kvs(pairs ...string) []*agent.JobConfig_JobKV {
+	jkvs := []*agent.JobConfig_JobKV{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		jkvs = append(jkvs, &agent.JobConfig_JobKV{Key: pairs[i], Value: pairs[i+1]})
+	}
+	return jkvs
+}
+
+// runJob runs the agent on cfg, with a new output directory, and
+// returns the combined tag-value document that it wrote, along with its
+// output messages.
+func runJob(t *testing.T, cfg agent.JobConfig) (*spdx.Document, string, error) {
+	t.Helper()
+	outDir, err := ioutil.TempDir("", "idsearcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+	cfg.SpdxOutputDir = outDir
+
+	rpt := &testReporter{}
+	if err := (&idsearcher{}).Run(context.Background(), cfg, rpt); err != nil {
+		return nil, "", err
+	}
+	in := &spdxdoc.Input{Label: "test", Path: filepath.Join(outDir, primarySource+".spdx"), Format: spdxdoc.TagValue}
+	doc, _, err := in.Read()
+	if err != nil {
+		t.Fatalf("couldn't read written document: %v", err)
+	}
+	return doc, strings.Join(rpt.output, "\n"), nil
+}
+
+func TestPackageName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idsearcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	codeDir := filepath.Join(dir, "code")
+	writeTree(t, codeDir, map[string]string{"a.go": "// SPDX-License-Identifier: MIT\n"})
+	provDir := filepath.Join(dir, "retrieved")
+	prov := &agentkit.Provenance{
+		Agent:            "retrieve-github",
+		Name:             "github.com/example/repo",
+		URL:              "https://github.com/example/repo",
+		DownloadLocation: "git+https://github.com/example/repo@v1.0",
+		Version:          "v1.0",
+	}
+	if err := agentkit.WriteProvenance(provDir, prov); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		provenance  bool
+		jkvs        []*agent.JobConfig_JobKV
+		wantErr     string
+		wantName    string
+		wantID      string
+		wantVersion string
+	}{
+		{
+			name:     "default",
+			wantName: "primary",
+			wantID:   "Package-primary",
+		},
+		{
+			name:        "from provenance",
+			provenance:  true,
+			wantName:    "github.com/example/repo",
+			wantID:      "Package-github.com-example-repo",
+			wantVersion: "v1.0",
+		},
+		{
+			name:        "job overrides provenance",
+			provenance:  true,
+			jkvs:        kvs("packageName", "my package", "packageVersion", "2.0"),
+			wantName:    "my package",
+			wantID:      "Package-my-package",
+			wantVersion: "2.0",
+		},
+		{
+			name:    "empty",
+			jkvs:    kvs("packageName", ""),
+			wantErr: "packageName must not be empty",
+		},
+		{
+			name:    "invalid supplier",
+			jkvs:    kvs("packageName", "example", "packageSupplier", "ExampleCo"),
+			wantErr: "invalid packageSupplier",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := agent.JobConfig{
+				CodeInputs: []*agent.JobConfig_CodeInput{{Source: primarySource, Path: codeDir}},
+				Jkvs:       tt.jkvs,
+			}
+			if tt.provenance {
+				cfg.SpdxInputs = []*agent.JobConfig_SpdxInput{{Source: "retrieve-github", Path: provDir}}
+			}
+			doc, output, err := runJob(t, cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+			if len(doc.Packages) != 1 {
+				t.Fatalf("got %d packages, want 1", len(doc.Packages))
+			}
+			pkg := doc.Packages[0]
+			if pkg.PackageName != tt.wantName || string(pkg.PackageSPDXIdentifier) != tt.wantID || pkg.PackageVersion != tt.wantVersion {
+				t.Errorf("got package %q %s %q, want %q %s %q", pkg.PackageName, pkg.PackageSPDXIdentifier, pkg.PackageVersion, tt.wantName, tt.wantID, tt.wantVersion)
+			}
+			if doc.DocumentName != tt.wantName {
+				t.Errorf("got document name %q, want %q", doc.DocumentName, tt.wantName)
+			}
+			if !strings.Contains(output, "package: "+tt.wantName+"\n") {
+				t.Errorf("got output %q, want it to name package %q", output, tt.wantName)
+			}
+		})
+	}
+}
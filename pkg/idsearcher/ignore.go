@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// defaultIgnoreFile is the gitignore-style file that is read from the
+// top of the code being scanned, if it is there, unless the job names
+// a different one with the ignoreFile key/value.
+const defaultIgnoreFile = ".peridotignore"
+
+// ignoreConfig says which paths to leave out of the document, and which
+// to keep in it but not search for short-form IDs.
+type ignoreConfig struct {
+	builder  *agentkit.IgnoreList
+	searcher *agentkit.IgnoreList
+
+	// ignoreFile is the ignore file that was read, if any, relative
+	// to the top of the code.
+	ignoreFile string
+}
+
+// newIgnoreConfig reads the ignore patterns for cfg's job, for the code
+// input at dirRoot. The builder ignores .git, then the patterns in the
+// input's ignore file, then those in the job's ignore key/values, with
+// later patterns taking precedence as in a .gitignore file. The
+// searcher uses the job's searchIgnore key/values. An ignore file named
+// by the job only has to exist in the primary input, which primary
+// says dirRoot is.
+func newIgnoreConfig(cfg agent.JobConfig, dirRoot string, primary bool) (*ignoreConfig, error) {
+	ic := &ignoreConfig{
+		builder:  &agentkit.IgnoreList{},
+		searcher: &agentkit.IgnoreList{},
+	}
+	if err := ic.builder.Add("/.git/"); err != nil {
+		return nil, err
+	}
+
+	ignoreFile := defaultIgnoreFile
+	ignoreFileSet := false
+	builderPatterns := []string{}
+	for _, jkv := range cfg.Jkvs {
+		switch jkv.Key {
+		case "ignoreFile":
+			ignoreFile = jkv.Value
+			ignoreFileSet = true
+		case "ignore":
+			builderPatterns = append(builderPatterns, jkv.Value)
+		case "searchIgnore":
+			if err := ic.searcher.Add(jkv.Value); err != nil {
+				return nil, fmt.Errorf("invalid searchIgnore: %v", err)
+			}
+		}
+	}
+
+	// an empty ignoreFile turns off reading one
+	if ignoreFile != "" {
+		clean := path.Clean(filepath.ToSlash(ignoreFile))
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("ignoreFile %q must be a path within the code being scanned", ignoreFile)
+		}
+		p := filepath.Join(dirRoot, filepath.FromSlash(clean))
+		// the code is untrusted, so don't follow a link out of it,
+		// whether that's the file itself or a directory on the way
+		if fi, err := os.Lstat(p); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return nil, fmt.Errorf("ignoreFile %s is a symbolic link", clean)
+		}
+		resolved, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			root, err := filepath.EvalSymlinks(dirRoot)
+			if err != nil {
+				return nil, err
+			}
+			if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+				return nil, fmt.Errorf("ignoreFile %s resolves outside the code being scanned", clean)
+			}
+			_, err = ic.builder.AddFile(resolved)
+		}
+		switch {
+		case err == nil:
+			ic.ignoreFile = clean
+		case os.IsNotExist(err) && (!ignoreFileSet || !primary):
+			// no ignore file here; that's fine
+		default:
+			return nil, fmt.Errorf("couldn't read ignoreFile: %v", err)
+		}
+	}
+
+	for _, pattern := range builderPatterns {
+		if err := ic.builder.Add(pattern); err != nil {
+			return nil, fmt.Errorf("invalid ignore: %v", err)
+		}
+	}
+	return ic, nil
+}
+
+// ignoredPaths records what was ignored while building a document.
+type ignoredPaths struct {
+	// dirs and files were left out of the document. Nothing inside
+	// the directories is listed.
+	dirs  []string
+	files []string
+
+	// unsearched counts the files in the document that were not
+	// searched for short-form IDs.
+	unsearched int
+}
+
+// summary describes what was ignored, for the job's output messages,
+// or returns "" if nothing was.
+func (ig *ignoredPaths) summary() string {
+	lines := []string{}
+	if n := len(ig.dirs) + len(ig.files); n > 0 {
+		listed := append(append([]string{}, ig.dirs...), ig.files...)
+		lines = append(lines, fmt.Sprintf("ignored: %d directories, %d files (%s)", len(ig.dirs), len(ig.files), spdxdoc.ListPaths(listed)))
+	}
+	if ig.unsearched > 0 {
+		lines = append(lines, fmt.Sprintf("not searched: %d files", ig.unsearched))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,218 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// ignoreTree is the code that the ignore tests scan.
+var ignoreTree = map[string]string{
+	".git/config":    "[core]\n",
+	".peridotignore": "# generated and third-party code\nvendor/\n*.log\n!keep.log\nbuild\n",
+	"a.go":           "// SPDX-License-Identifier: MIT\n",
+	"a_test.go":      "// SPDX-License-Identifier: MIT\n",
+	"app.log":        "log\n",
+	"keep.log":       "log\n",
+	"build/out.o":    "object\n",
+	"docs/README":    "docs\n",
+	"src/build.go":   "// SPDX-License-Identifier: Apache-2.0\n",
+	"sub/app.log":    "log\n",
+	"sub/b_test.go":  "// SPDX-License-Identifier: MIT\n",
+	"sub/docs/notes": "notes\n",
+	"vendor/x.go":    "// SPDX-License-Identifier: BSD-3-Clause\n",
+}
+
+// ignoreJkvs are the job's own ignore patterns for ignoreTree.
+var ignoreJkvs = kvs("ignore", "/docs/", "searchIgnore", "*_test.go")
+
+func TestIgnoreMatching(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idsearcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir, ignoreTree)
+
+	ic, err := newIgnoreConfig(agent.JobConfig{Jkvs: ignoreJkvs}, dir, true)
+	if err != nil {
+		t.Fatalf("newIgnoreConfig: %v", err)
+	}
+	if ic.ignoreFile != defaultIgnoreFile {
+		t.Errorf("got ignore file %q, want %q", ic.ignoreFile, defaultIgnoreFile)
+	}
+
+	tests := []struct {
+		path         string
+		isDir        bool
+		wantBuilder  bool
+		wantSearcher bool
+	}{
+		{path: ".git", isDir: true, wantBuilder: true},
+		{path: ".git/config", wantBuilder: true},
+		{path: "a.go"},
+		{path: "a_test.go", wantSearcher: true},
+		{path: "sub/b_test.go", wantSearcher: true},
+		// from the ignore file
+		{path: "vendor", isDir: true, wantBuilder: true},
+		{path: "vendor/x.go", wantBuilder: true},
+		{path: "app.log", wantBuilder: true},
+		{path: "sub/app.log", wantBuilder: true},
+		{path: "keep.log"},
+		{path: "build", isDir: true, wantBuilder: true},
+		{path: "build", wantBuilder: true},
+		{path: "src/build.go"},
+		// from the job, anchored to the top
+		{path: "docs", isDir: true, wantBuilder: true},
+		{path: "docs/README", wantBuilder: true},
+		{path: "sub/docs", isDir: true},
+		{path: "sub/docs/notes"},
+	}
+	for _, tt := range tests {
+		if got := ic.builder.Ignored(tt.path, tt.isDir); got != tt.wantBuilder {
+			t.Errorf("builder.Ignored(%q, %t) = %t, want %t", tt.path, tt.isDir, got, tt.wantBuilder)
+		}
+		if got := ic.searcher.Ignored(tt.path, tt.isDir); got != tt.wantSearcher {
+			t.Errorf("searcher.Ignored(%q, %t) = %t, want %t", tt.path, tt.isDir, got, tt.wantSearcher)
+		}
+	}
+}
+
+func TestIgnoreJobOverridesIgnoreFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idsearcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir, ignoreTree)
+
+	// the job's patterns come after the ignore file's
+	ic, err := newIgnoreConfig(agent.JobConfig{Jkvs: kvs("ignore", "!app.log")}, dir, true)
+	if err != nil {
+		t.Fatalf("newIgnoreConfig: %v", err)
+	}
+	if ic.builder.Ignored("app.log", false) {
+		t.Errorf("app.log is ignored, want it kept by the job's pattern")
+	}
+	if !ic.builder.Ignored("vendor/x.go", false) {
+		t.Errorf("vendor/x.go is not ignored, want it ignored by the ignore file")
+	}
+}
+
+func TestIgnoreConfigErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idsearcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir, ignoreTree)
+	if err := os.Symlink("/etc/passwd", filepath.Join(dir, "linked")); err != nil {
+		t.Fatal(err)
+	}
+	// directories linked to outside the code, and within it
+	outside, err := ioutil.TempDir("", "idsearcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	writeTree(t, outside, map[string]string{"ignore": "*.go\n"})
+	if err := os.Symlink(outside, filepath.Join(dir, "linked-dir")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub", filepath.Join(dir, "inner-dir")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		jkvs    []*agent.JobConfig_JobKV
+		primary bool
+		wantErr string
+		// wantFile is the ignore file read, if there is no error
+		wantFile string
+	}{
+		{name: "outside code", jkvs: kvs("ignoreFile", "../outside"), primary: true, wantErr: "must be a path within"},
+		{name: "absolute", jkvs: kvs("ignoreFile", "/etc/gitignore"), primary: true, wantErr: "must be a path within"},
+		{name: "symbolic link", jkvs: kvs("ignoreFile", "linked"), primary: true, wantErr: "is a symbolic link"},
+		{name: "in linked directory outside code", jkvs: kvs("ignoreFile", "linked-dir/ignore"), primary: true, wantErr: "resolves outside the code"},
+		{name: "in linked directory within code", jkvs: kvs("ignoreFile", "inner-dir/docs/notes"), primary: true, wantFile: "inner-dir/docs/notes"},
+		{name: "missing from linked directory", jkvs: kvs("ignoreFile", "linked-dir/missing"), primary: false},
+		{name: "missing from primary", jkvs: kvs("ignoreFile", "missing"), primary: true, wantErr: "couldn't read ignoreFile"},
+		{name: "missing from other input", jkvs: kvs("ignoreFile", "missing"), primary: false},
+		{name: "turned off", jkvs: kvs("ignoreFile", ""), primary: true},
+		{name: "named", jkvs: kvs("ignoreFile", "./.peridotignore"), primary: true, wantFile: ".peridotignore"},
+		{name: "invalid ignore", jkvs: kvs("ignore", "["), primary: true, wantErr: "invalid ignore"},
+		{name: "invalid searchIgnore", jkvs: kvs("searchIgnore", "/"), primary: true, wantErr: "invalid searchIgnore"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ic, err := newIgnoreConfig(agent.JobConfig{Jkvs: tt.jkvs}, dir, tt.primary)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+			if ic.ignoreFile != tt.wantFile {
+				t.Errorf("got ignore file %q, want %q", ic.ignoreFile, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestIgnoredFilesLeftOut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idsearcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir, ignoreTree)
+
+	cfg := agent.JobConfig{
+		CodeInputs: []*agent.JobConfig_CodeInput{{Source: primarySource, Path: dir}},
+		Jkvs:       ignoreJkvs,
+	}
+	doc, output, err := runJob(t, cfg)
+	if err != nil {
+		t.Fatalf("got error %v, want nil", err)
+	}
+
+	files := []string{}
+	searched := []string{}
+	for _, f := range doc.Packages[0].Files {
+		files = append(files, f.FileName)
+		if f.LicenseInfoInFiles[0] != "NOASSERTION" {
+			searched = append(searched, f.FileName)
+		}
+	}
+	sort.Strings(files)
+	sort.Strings(searched)
+	wantFiles := []string{"/.peridotignore", "/a.go", "/a_test.go", "/keep.log", "/src/build.go", "/sub/b_test.go", "/sub/docs/notes"}
+	if !reflect.DeepEqual(files, wantFiles) {
+		t.Errorf("got files %v, want %v", files, wantFiles)
+	}
+	wantSearched := []string{"/a.go", "/src/build.go"}
+	if !reflect.DeepEqual(searched, wantSearched) {
+		t.Errorf("got files with licenses %v, want %v", searched, wantSearched)
+	}
+
+	for _, want := range []string{
+		"ignore file: .peridotignore",
+		"ignored: 4 directories, 2 files (.git/, build/, docs/, vendor/, app.log, sub/app.log)",
+		"not searched: 2 files",
+	} {
+		if !strings.Contains(output, want+"\n") {
+			t.Errorf("got output %q, want it to contain %q", output, want)
+		}
+	}
+}
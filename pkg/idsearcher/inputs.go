@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// codeInput is one of the job's code inputs, each of which is described
+// by its own package.
+type codeInput struct {
+	source string
+	dir    string
+
+	pi *packageInfo
+	ic *ignoreConfig
+
+	// label is added to the names of the progress phases for this
+	// input, when there is more than one.
+	label string
+
+	// pkg and ignored are filled in once the package has been built.
+	pkg     *spdx.Package
+	ignored *ignoredPaths
+}
+
+// sourceNameRe matches the sources that can be used in the names of
+// the files that the agent writes.
+var sourceNameRe = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// newCodeInputs reads the code inputs for cfg's job, with the primary
+// input first and the rest in the order the job lists them, along with
+// each one's package details and ignore patterns.
+func newCodeInputs(cfg agent.JobConfig) ([]*codeInput, error) {
+	inputs := []*codeInput{}
+	codeSources := map[string]bool{}
+	for _, ci := range cfg.CodeInputs {
+		if codeSources[ci.Source] {
+			return nil, fmt.Errorf("more than one codeInput from source %q", ci.Source)
+		}
+		codeSources[ci.Source] = true
+	}
+
+	for _, ci := range cfg.CodeInputs {
+		if ci.Path == "" {
+			return nil, fmt.Errorf("codeInput from source %q has no path", ci.Source)
+		}
+		if !sourceNameRe.MatchString(ci.Source) {
+			return nil, fmt.Errorf("codeInput source %q must only use letters, numbers, \".\", \"_\" and \"-\"", ci.Source)
+		}
+		primary := ci.Source == primarySource
+		pi, err := newPackageInfo(cfg, ci.Source, codeSources)
+		if err != nil {
+			return nil, err
+		}
+		ic, err := newIgnoreConfig(cfg, ci.Path, primary)
+		if err != nil {
+			if !primary {
+				err = fmt.Errorf("codeInput %s: %v", ci.Source, err)
+			}
+			return nil, err
+		}
+		in := &codeInput{source: ci.Source, dir: ci.Path, pi: pi, ic: ic}
+		if primary {
+			inputs = append([]*codeInput{in}, inputs...)
+		} else {
+			inputs = append(inputs, in)
+		}
+	}
+
+	// check that we found a primary input
+	if len(inputs) == 0 || inputs[0].source != primarySource {
+		return nil, fmt.Errorf("no primary codeInputs specified")
+	}
+
+	// each package needs its own identifier in a combined document
+	ids := map[string]string{}
+	for _, in := range inputs {
+		if len(inputs) > 1 {
+			in.label = in.source
+		}
+		id := string(in.pi.spdxID())
+		if other, ok := ids[id]; ok {
+			return nil, fmt.Errorf("packages for codeInputs %s and %s would both be %s; use packageName to rename the primary package", other, in.source, id)
+		}
+		ids[id] = in.source
+	}
+	return inputs, nil
+}
+
+// phase returns the name of a progress phase for this input.
+func (in *codeInput) phase(name string) string {
+	if in.label == "" {
+		return name
+	}
+	return fmt.Sprintf("%s %s", name, in.label)
+}
+
+// inputRelationship is a relationship between the packages for two of
+// the job's code inputs, from the job's relationship key/values.
+type inputRelationship struct {
+	a   *codeInput
+	typ string
+	b   *codeInput
+}
+
+// inputRelationshipTypes are the SPDX relationship types that can be
+// used between code inputs.
+var inputRelationshipTypes = []string{
+	"CONTAINS", "CONTAINED_BY",
+	"DEPENDS_ON", "DEPENDENCY_OF",
+	"BUILD_DEPENDENCY_OF", "DEV_DEPENDENCY_OF", "OPTIONAL_DEPENDENCY_OF",
+	"PROVIDED_DEPENDENCY_OF", "TEST_DEPENDENCY_OF", "RUNTIME_DEPENDENCY_OF",
+	"PATCH_FOR", "PATCH_APPLIED",
+	"ANCESTOR_OF", "DESCENDANT_OF", "VARIANT_OF", "COPY_OF",
+	"GENERATES", "GENERATED_FROM",
+	"OTHER",
+}
+
+// newInputRelationships reads the relationships between inputs from
+// cfg's job. Each relationship key/value is written as in SPDX
+// tag-value, with sources in place of identifiers: for example,
+// "primary DEPENDS_ON deps" or "fix PATCH_FOR primary".
+func newInputRelationships(cfg agent.JobConfig, inputs []*codeInput) ([]*inputRelationship, error) {
+	bySource := map[string]*codeInput{}
+	for _, in := range inputs {
+		bySource[in.source] = in
+	}
+
+	rels := []*inputRelationship{}
+	for _, jkv := range cfg.Jkvs {
+		if jkv.Key != "relationship" {
+			continue
+		}
+		fields := strings.Fields(jkv.Value)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("relationship %q must be \"<source> <type> <source>\"", jkv.Value)
+		}
+		a, b := bySource[fields[0]], bySource[fields[2]]
+		for i, in := range []*codeInput{a, b} {
+			if in == nil {
+				return nil, fmt.Errorf("relationship %q: no codeInput from source %q", jkv.Value, fields[i*2])
+			}
+		}
+		if a == b {
+			return nil, fmt.Errorf("relationship %q must be between two different codeInputs", jkv.Value)
+		}
+		typ := strings.ToUpper(fields[1])
+		if !isInputRelationshipType(typ) {
+			return nil, fmt.Errorf("relationship %q: type must be one of %s", jkv.Value, strings.Join(inputRelationshipTypes, ", "))
+		}
+		rels = append(rels, &inputRelationship{a: a, typ: typ, b: b})
+	}
+	return rels, nil
+}
+
+// isInputRelationshipType reports whether typ is one of
+// inputRelationshipTypes.
+func isInputRelationshipType(typ string) bool {
+	for _, t := range inputRelationshipTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the relationship as the job wrote it.
+func (rel *inputRelationship) String() string {
+	return fmt.Sprintf("%s %s %s", rel.a.source, rel.typ, rel.b.source)
+}
@@ -0,0 +1,235 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+func TestNewCodeInputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idsearcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	code := func(source string) *agent.JobConfig_CodeInput {
+		return &agent.JobConfig_CodeInput{Source: source, Path: filepath.Join(dir, source)}
+	}
+
+	tests := []struct {
+		name       string
+		codeInputs []*agent.JobConfig_CodeInput
+		jkvs       []*agent.JobConfig_JobKV
+		wantErr    string
+		// wantSources are the inputs' sources, in order
+		wantSources []string
+	}{
+		{
+			name:        "primary only",
+			codeInputs:  []*agent.JobConfig_CodeInput{code("primary")},
+			wantSources: []string{"primary"},
+		},
+		{
+			name:        "primary first",
+			codeInputs:  []*agent.JobConfig_CodeInput{code("deps"), code("primary"), code("patches")},
+			wantSources: []string{"primary", "deps", "patches"},
+		},
+		{
+			name:       "no primary",
+			codeInputs: []*agent.JobConfig_CodeInput{code("deps")},
+			wantErr:    "no primary codeInputs specified",
+		},
+		{
+			name:       "repeated source",
+			codeInputs: []*agent.JobConfig_CodeInput{code("primary"), code("deps"), code("deps")},
+			wantErr:    `more than one codeInput from source "deps"`,
+		},
+		{
+			name:       "no path",
+			codeInputs: []*agent.JobConfig_CodeInput{code("primary"), {Source: "deps"}},
+			wantErr:    `codeInput from source "deps" has no path`,
+		},
+		{
+			name:       "source not usable in file names",
+			codeInputs: []*agent.JobConfig_CodeInput{code("primary"), code("../deps")},
+			wantErr:    `codeInput source "../deps" must only use`,
+		},
+		{
+			name:       "package IDs clash",
+			codeInputs: []*agent.JobConfig_CodeInput{code("primary"), code("deps")},
+			jkvs:       kvs("packageName", "deps"),
+			wantErr:    "would both be Package-deps",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs, err := newCodeInputs(agent.JobConfig{CodeInputs: tt.codeInputs, Jkvs: tt.jkvs})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+			sources := []string{}
+			for _, in := range inputs {
+				sources = append(sources, in.source)
+				// labels tell the inputs' progress apart, if there are
+				// several
+				wantLabel := ""
+				if len(inputs) > 1 {
+					wantLabel = in.source
+				}
+				if in.label != wantLabel {
+					t.Errorf("%s: got label %q, want %q", in.source, in.label, wantLabel)
+				}
+			}
+			if !reflect.DeepEqual(sources, tt.wantSources) {
+				t.Errorf("got sources %v, want %v", sources, tt.wantSources)
+			}
+		})
+	}
+}
+
+func TestNewInputRelationships(t *testing.T) {
+	inputs := []*codeInput{{source: "primary"}, {source: "deps"}, {source: "fix"}}
+	tests := []struct {
+		name    string
+		jkvs    []*agent.JobConfig_JobKV
+		wantErr string
+		want    []string
+	}{
+		{name: "none", want: []string{}},
+		{
+			name: "several",
+			jkvs: kvs("relationship", "primary depends_on deps", "relationship", "fix PATCH_FOR primary"),
+			want: []string{"primary DEPENDS_ON deps", "fix PATCH_FOR primary"},
+		},
+		{name: "wrong number of fields", jkvs: kvs("relationship", "primary DEPENDS_ON"), wantErr: "must be \"<source> <type> <source>\""},
+		{name: "unknown source", jkvs: kvs("relationship", "primary DEPENDS_ON other"), wantErr: `no codeInput from source "other"`},
+		{name: "same source", jkvs: kvs("relationship", "deps COPY_OF deps"), wantErr: "between two different codeInputs"},
+		{name: "unknown type", jkvs: kvs("relationship", "primary DESCRIBES deps"), wantErr: "type must be one of"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rels, err := newInputRelationships(agent.JobConfig{Jkvs: tt.jkvs}, inputs)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+			got := []string{}
+			for _, rel := range rels {
+				got = append(got, rel.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got relationships %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultipleInputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idsearcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir, map[string]string{
+		"primary/main.go": "// SPDX-License-Identifier: MIT\n",
+		"deps/lib/lib.go": "// SPDX-License-Identifier: Apache-2.0\n",
+	})
+	cfg := agent.JobConfig{
+		CodeInputs: []*agent.JobConfig_CodeInput{
+			{Source: "deps", Path: filepath.Join(dir, "deps")},
+			{Source: "primary", Path: filepath.Join(dir, "primary")},
+		},
+		Jkvs: kvs("packageName", "app", "relationship", "primary DEPENDS_ON deps"),
+	}
+	doc, output, err := runJob(t, cfg)
+	if err != nil {
+		t.Fatalf("got error %v, want nil", err)
+	}
+
+	// the combined document describes the primary package
+	if doc.DocumentName != "app" {
+		t.Errorf("got document name %q, want %q", doc.DocumentName, "app")
+	}
+	pkgs := map[string][]string{}
+	fileIDs := map[string]bool{}
+	for _, pkg := range doc.Packages {
+		for _, f := range pkg.Files {
+			pkgs[string(pkg.PackageSPDXIdentifier)] = append(pkgs[string(pkg.PackageSPDXIdentifier)], f.FileName+" "+strings.Join(f.LicenseInfoInFiles, ","))
+			fileIDs[string(f.FileSPDXIdentifier)] = true
+		}
+	}
+	wantPkgs := map[string][]string{
+		"Package-app":  {"/main.go MIT"},
+		"Package-deps": {"/lib/lib.go Apache-2.0"},
+	}
+	if !reflect.DeepEqual(pkgs, wantPkgs) {
+		t.Errorf("got packages %v, want %v", pkgs, wantPkgs)
+	}
+	if len(fileIDs) != 2 {
+		t.Errorf("got file IDs %v, want one for each file", fileIDs)
+	}
+
+	rels := []string{}
+	for _, rel := range doc.Relationships {
+		rels = append(rels, string(rel.RefA.ElementRefID)+" "+rel.Relationship+" "+string(rel.RefB.ElementRefID))
+	}
+	wantRels := []string{"DOCUMENT DESCRIBES Package-app", "DOCUMENT DESCRIBES Package-deps", "Package-app DEPENDS_ON Package-deps"}
+	if !reflect.DeepEqual(rels, wantRels) {
+		t.Errorf("got relationships %v, want %v", rels, wantRels)
+	}
+
+	for _, want := range []string{"input: primary\npackage: app\n", "input: deps\npackage: deps\n", "relationship: primary DEPENDS_ON deps\n"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("got output %q, want it to contain %q", output, want)
+		}
+	}
+}
+
+func TestPerInputDocuments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idsearcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir, map[string]string{
+		"primary/main.go": "// SPDX-License-Identifier: MIT\n",
+		"deps/lib.go":     "// SPDX-License-Identifier: Apache-2.0\n",
+	})
+	cfg := agent.JobConfig{
+		CodeInputs: []*agent.JobConfig_CodeInput{
+			{Source: "primary", Path: filepath.Join(dir, "primary")},
+			{Source: "deps", Path: filepath.Join(dir, "deps")},
+		},
+		Jkvs: kvs("documents", "perInput"),
+	}
+	_, output, err := runJob(t, cfg)
+	if err != nil {
+		t.Fatalf("got error %v, want nil", err)
+	}
+	if !strings.Contains(output, "documents: primary.spdx, deps.spdx") {
+		t.Errorf("got output %q, want a document for each input", output)
+	}
+
+	// relationships need the packages in one document
+	cfg.Jkvs = kvs("documents", "perInput", "relationship", "primary DEPENDS_ON deps")
+	if _, _, err := runJob(t, cfg); err == nil || !strings.Contains(err.Error(), "need documents combined") {
+		t.Errorf("got error %v, want one saying relationships need a combined document", err)
+	}
+}
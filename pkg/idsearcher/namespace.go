@@ -0,0 +1,8 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+// namespaceBaseEnv names the environment variable that sets the base
+// URI of the namespaces of the documents that the agent writes, for
+// jobs that don't set their own with the namespaceBase key/value. The
+// rest of the namespace is built as spdxdoc.NamespaceConfig says.
+const namespaceBaseEnv = "IDSEARCHER_NAMESPACE_BASE"
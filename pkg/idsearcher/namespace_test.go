@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// How namespaces are built is tested in agentkit/spdxdoc; these tests
+// cover what idsearcher itself decides: where the base comes from, what
+// the namespace is hashed over, and how it is reported.
+func TestNamespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idsearcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir, map[string]string{"a.go": "// SPDX-License-Identifier: MIT\n"})
+
+	tests := []struct {
+		name string
+		env  string
+		jkvs []*agent.JobConfig_JobKV
+		// want matches the whole namespace
+		want    string
+		wantErr string
+	}{
+		{
+			name: "default base",
+			jkvs: kvs("namespaceMode", "jobID", "jobID", "42"),
+			want: `https://peridot/spdxdocs/example-42`,
+		},
+		{
+			name: "base from environment",
+			env:  "https://env.example.com/docs",
+			jkvs: kvs("namespaceMode", "jobID", "jobID", "42"),
+			want: `https://env\.example\.com/docs/example-42`,
+		},
+		{
+			name:    "invalid config fails the job",
+			jkvs:    kvs("namespaceMode", "random"),
+			wantErr: `namespaceMode "random" is invalid`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				os.Setenv(namespaceBaseEnv, tt.env)
+				defer os.Unsetenv(namespaceBaseEnv)
+			}
+			cfg := agent.JobConfig{
+				CodeInputs: []*agent.JobConfig_CodeInput{{Source: primarySource, Path: dir}},
+				Jkvs:       append(kvs("packageName", "example"), tt.jkvs...),
+			}
+			doc, output, err := runJob(t, cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+			got := doc.DocumentNamespace
+			if !regexp.MustCompile(`^` + tt.want + `$`).MatchString(got) {
+				t.Errorf("got namespace %q, want one matching %q", got, tt.want)
+			}
+			if !strings.Contains(output, "namespace: "+got+"\n") {
+				t.Errorf("got output %q, want it to give namespace %q", output, got)
+			}
+		})
+	}
+}
+
+func TestNamespaceHashCoversInputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idsearcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir, map[string]string{"a.go": "// SPDX-License-Identifier: MIT\n"})
+
+	namespace := func(jkvs ...string) string {
+		t.Helper()
+		cfg := agent.JobConfig{
+			CodeInputs: []*agent.JobConfig_CodeInput{{Source: primarySource, Path: dir}},
+			Jkvs:       kvs(append([]string{"packageName", "example", "namespaceMode", "hash"}, jkvs...)...),
+		}
+		doc, _, err := runJob(t, cfg)
+		if err != nil {
+			t.Fatalf("got error %v, want nil", err)
+		}
+		return doc.DocumentNamespace
+	}
+
+	base := namespace()
+	if got := namespace(); got != base {
+		t.Errorf("namespace changed from %q to %q for the same inputs", base, got)
+	}
+	if got := namespace("packageVersion", "1.0"); got == base {
+		t.Errorf("namespace %q didn't change with the package version", got)
+	}
+	// the files are covered through the package verification code
+	writeTree(t, dir, map[string]string{"b.go": "package b\n"})
+	defer os.Remove(filepath.Join(dir, "b.go"))
+	if got := namespace(); got == base {
+		t.Errorf("namespace %q didn't change with the files", got)
+	}
+}
@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/spdx/v2/common"
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// primarySource is the source of the job's main code input. Each code
+// input's package is named after its source, unless, for the primary
+// input, the job or a provenance record gives it another name.
+const primarySource = spdxdoc.PrimarySource
+
+// packageInfo holds the package fields of the SPDX document that come
+// from the job's configuration, or from the provenance record of the
+// agent that retrieved the code, rather than from the files.
+type packageInfo struct {
+	name    string
+	version string
+
+	// supplier and originator are as in SPDX tag-value, such as
+	// "Organization: ExampleCo" or "Person: Jane Doe (jane@example.com)",
+	// or "" if not known.
+	supplier   string
+	originator string
+
+	downloadLocation string
+
+	// checksums are of the file the package was retrieved as, keyed by
+	// SPDX algorithm name.
+	checksums map[string]string
+
+	// provenancePath is where the provenance record came from, if any.
+	provenancePath string
+}
+
+// newPackageInfo works out the package fields for the code input from
+// source in cfg's job. Any that the job's key/values don't set are
+// filled in from the first provenance record among the job's
+// spdxInputs from the same source. The primary input also uses those
+// from sources that aren't code inputs, such as the agent that
+// retrieved it, looking at its own first. The job's key/values only
+// apply to the primary input; codeSources are the sources of all of
+// the job's code inputs.
+func newPackageInfo(cfg agent.JobConfig, source string, codeSources map[string]bool) (*packageInfo, error) {
+	pi := &packageInfo{
+		name:             source,
+		downloadLocation: "NOASSERTION",
+		checksums:        map[string]string{},
+	}
+
+	// start with the provenance record, if there is one
+	paths := []string{}
+	for _, spdxInput := range cfg.SpdxInputs {
+		if spdxInput.Source == source {
+			paths = append([]string{spdxInput.Path}, paths...)
+		} else if source == primarySource && !codeSources[spdxInput.Source] {
+			paths = append(paths, spdxInput.Path)
+		}
+	}
+	prov, provPath, err := agentkit.FindProvenance(paths)
+	if err != nil {
+		return nil, err
+	}
+	if prov != nil {
+		pi.provenancePath = provPath
+		if prov.Name != "" && source == primarySource {
+			pi.name = prov.Name
+		}
+		pi.version = prov.Version
+		if prov.DownloadLocation != "" {
+			pi.downloadLocation = prov.DownloadLocation
+		}
+		for _, alg := range []string{"SHA1", "SHA256"} {
+			if sum := prov.Checksums[alg]; sum != "" {
+				pi.checksums[alg] = sum
+			}
+		}
+	}
+	if source != primarySource {
+		return pi, nil
+	}
+
+	// and let the job override it
+	for _, jkv := range cfg.Jkvs {
+		switch jkv.Key {
+		case "packageName":
+			if jkv.Value == "" {
+				return nil, fmt.Errorf("packageName must not be empty")
+			}
+			pi.name = jkv.Value
+		case "packageVersion":
+			pi.version = jkv.Value
+		case "packageSupplier":
+			if err := validateActor(jkv.Value); err != nil {
+				return nil, fmt.Errorf("invalid packageSupplier: %v", err)
+			}
+			pi.supplier = jkv.Value
+		case "packageOriginator":
+			if err := validateActor(jkv.Value); err != nil {
+				return nil, fmt.Errorf("invalid packageOriginator: %v", err)
+			}
+			pi.originator = jkv.Value
+		}
+	}
+
+	return pi, nil
+}
+
+// spdxID returns the SPDX identifier for the package, without its
+// "SPDXRef-" prefix, which is based on its name but can only use
+// letters, numbers, "." and "-".
+func (pi *packageInfo) spdxID() common.ElementID {
+	return spdxdoc.PackageID(pi.name)
+}
+
+// apply fills in pkg's fields from pi.
+func (pi *packageInfo) apply(pkg *spdx.Package) {
+	pkg.PackageName = pi.name
+	pkg.PackageSPDXIdentifier = pi.spdxID()
+	pkg.PackageVersion = pi.version
+	pkg.PackageDownloadLocation = pi.downloadLocation
+	pkg.PackageChecksums = nil
+	for _, alg := range []common.ChecksumAlgorithm{common.SHA1, common.SHA256} {
+		if sum := pi.checksums[string(alg)]; sum != "" {
+			pkg.PackageChecksums = append(pkg.PackageChecksums, common.Checksum{Algorithm: alg, Value: sum})
+		}
+	}
+	pkg.PackageSupplier = nil
+	if pi.supplier != "" {
+		actorType, name := splitActor(pi.supplier)
+		pkg.PackageSupplier = &common.Supplier{Supplier: name, SupplierType: actorType}
+	}
+	pkg.PackageOriginator = nil
+	if pi.originator != "" {
+		actorType, name := splitActor(pi.originator)
+		pkg.PackageOriginator = &common.Originator{Originator: name, OriginatorType: actorType}
+	}
+}
+
+// validateActor checks that s is a supplier or originator as SPDX
+// tag-value writes it: "Person: <name>", "Organization: <name>" or
+// "NOASSERTION".
+func validateActor(s string) error {
+	if s == "NOASSERTION" {
+		return nil
+	}
+	for _, prefix := range []string{"Person:", "Organization:"} {
+		if strings.HasPrefix(s, prefix) {
+			if strings.TrimSpace(strings.TrimPrefix(s, prefix)) == "" {
+				return fmt.Errorf("%q has no name", s)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%q must start with \"Person:\" or \"Organization:\", or be NOASSERTION", s)
+}
+
+// splitActor splits s, which has passed validateActor, into the type
+// ("Person" or "Organization") and name that tools-golang uses for
+// suppliers and originators. NOASSERTION has no type, and is returned
+// as the name.
+func splitActor(s string) (string, string) {
+	for _, actorType := range []string{"Person", "Organization"} {
+		if strings.HasPrefix(s, actorType+":") {
+			return actorType, strings.TrimSpace(strings.TrimPrefix(s, actorType+":"))
+		}
+	}
+	return "", s
+}
@@ -0,0 +1,497 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/spdx/v2/common"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+)
+
+// tools-golang can read RDF/XML documents but not write them, so the
+// agent writes them itself. It only writes the parts of the SPDX model
+// that the agent fills in. As in the examples in the SPDX
+// specification, each package and file is written inside the first
+// property that refers to it, starting from the document's
+// relationships, and is referred to by its URI after that.
+
+const (
+	rdfNS      = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	rdfsNS     = "http://www.w3.org/2000/01/rdf-schema#"
+	spdxNS     = "http://spdx.org/rdf/terms#"
+	licensesNS = "http://spdx.org/licenses/"
+	xsdBoolean = "http://www.w3.org/2001/XMLSchema#boolean"
+)
+
+// writeRDF writes doc to w as RDF/XML, labelled as the given SPDX
+// version.
+func writeRDF(doc *spdx.Document, version string, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	rw := &rdfWriter{
+		w:        bw,
+		doc:      doc,
+		packages: map[common.ElementID]*spdx.Package{},
+		files:    map[common.ElementID]*spdx.File{},
+		written:  map[common.ElementID]bool{},
+	}
+	for _, pkg := range doc.Packages {
+		rw.packages[pkg.PackageSPDXIdentifier] = pkg
+		for _, f := range pkg.Files {
+			rw.files[f.FileSPDXIdentifier] = f
+		}
+	}
+	for _, f := range doc.Files {
+		rw.files[f.FileSPDXIdentifier] = f
+	}
+
+	fmt.Fprintf(bw, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	rw.open("rdf:RDF", "xmlns:rdf", rdfNS, "xmlns:rdfs", rdfsNS, "xmlns:spdx", spdxNS)
+
+	rw.open("spdx:SpdxDocument", "rdf:about", rw.elementURI("DOCUMENT"))
+	rw.literal("spdx:specVersion", version)
+	rw.resource("spdx:dataLicense", licensesNS+doc.DataLicense)
+	rw.literal("spdx:name", doc.DocumentName)
+	rw.literal("rdfs:comment", doc.DocumentComment)
+	if ci := doc.CreationInfo; ci != nil {
+		rw.open("spdx:creationInfo")
+		rw.open("spdx:CreationInfo")
+		for _, c := range ci.Creators {
+			rw.literal("spdx:creator", fmt.Sprintf("%s: %s", c.CreatorType, c.Creator))
+		}
+		rw.literal("spdx:created", ci.Created)
+		rw.literal("spdx:licenseListVersion", ci.LicenseListVersion)
+		rw.literal("rdfs:comment", ci.CreatorComment)
+		rw.close("spdx:CreationInfo")
+		rw.close("spdx:creationInfo")
+	}
+	for _, ol := range doc.OtherLicenses {
+		rw.open("spdx:hasExtractedLicensingInfo")
+		rw.extractedLicense(ol.LicenseIdentifier)
+		rw.close("spdx:hasExtractedLicensingInfo")
+	}
+	rw.relationships("DOCUMENT")
+	rw.close("spdx:SpdxDocument")
+
+	// and anything that no relationship led to
+	for _, pkg := range doc.Packages {
+		if !rw.written[pkg.PackageSPDXIdentifier] {
+			rw.pkg(pkg)
+		}
+	}
+	for _, f := range doc.Files {
+		if !rw.written[f.FileSPDXIdentifier] {
+			rw.file(f)
+		}
+	}
+
+	rw.close("rdf:RDF")
+	// bufio.Writer keeps the first error, so this is the only check
+	// we need
+	return bw.Flush()
+}
+
+// rdfWriter writes the elements of doc as RDF/XML.
+type rdfWriter struct {
+	w     io.Writer
+	doc   *spdx.Document
+	depth int
+
+	// packages and files are doc's elements, by identifier, and
+	// written records which of them have been written.
+	packages map[common.ElementID]*spdx.Package
+	files    map[common.ElementID]*spdx.File
+	written  map[common.ElementID]bool
+}
+
+// open writes a start tag, with attrs as name, value pairs.
+func (rw *rdfWriter) open(tag string, attrs ...string) {
+	fmt.Fprintf(rw.w, "%s<%s%s>\n", rw.indent(), tag, rw.attrs(attrs))
+	rw.depth++
+}
+
+// close writes an end tag.
+func (rw *rdfWriter) close(tag string) {
+	rw.depth--
+	fmt.Fprintf(rw.w, "%s</%s>\n", rw.indent(), tag)
+}
+
+// literal writes a property with value as its text, unless value is "".
+func (rw *rdfWriter) literal(tag string, value string, attrs ...string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(rw.w, "%s<%s%s>%s</%s>\n", rw.indent(), tag, rw.attrs(attrs), escapeText.Replace(value), tag)
+}
+
+// resource writes a property whose value is the resource at uri.
+func (rw *rdfWriter) resource(tag string, uri string) {
+	fmt.Fprintf(rw.w, "%s<%s rdf:resource=\"%s\"/>\n", rw.indent(), tag, escapeAttr.Replace(uri))
+}
+
+// valueOrSpecial writes a property whose value is s, unless s is
+// NOASSERTION or NONE, which SPDX's RDF writes as resources.
+func (rw *rdfWriter) valueOrSpecial(tag string, s string) {
+	switch s {
+	case "":
+	case "NOASSERTION":
+		rw.resource(tag, spdxNS+"noassertion")
+	case "NONE":
+		rw.resource(tag, spdxNS+"none")
+	default:
+		rw.literal(tag, s)
+	}
+}
+
+func (rw *rdfWriter) indent() string {
+	return strings.Repeat("  ", rw.depth)
+}
+
+func (rw *rdfWriter) attrs(attrs []string) string {
+	s := ""
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s += fmt.Sprintf(" %s=\"%s\"", attrs[i], escapeAttr.Replace(attrs[i+1]))
+	}
+	return s
+}
+
+// elementURI returns the URI of the element with SPDX identifier id,
+// in this document.
+func (rw *rdfWriter) elementURI(id common.ElementID) string {
+	return fmt.Sprintf("%s#%s", rw.doc.DocumentNamespace, common.RenderElementID(id))
+}
+
+// docElementURI returns the URI of the element that id refers to, which
+// may be in another document.
+func (rw *rdfWriter) docElementURI(id common.DocElementID) string {
+	switch id.SpecialID {
+	case "NOASSERTION":
+		return spdxNS + "noassertion"
+	case "NONE":
+		return spdxNS + "none"
+	}
+	if id.DocumentRefID == "" {
+		return rw.elementURI(id.ElementRefID)
+	}
+	for _, ref := range rw.doc.ExternalDocumentReferences {
+		if ref.DocumentRefID == id.DocumentRefID {
+			return fmt.Sprintf("%s#%s", ref.URI, common.RenderElementID(id.ElementRefID))
+		}
+	}
+	// not a document we know of; write it as SPDX would in tag-value
+	return common.RenderDocElementID(id)
+}
+
+// element writes a property whose value is the element that id refers
+// to: the element itself, if it is a package or file in this document
+// that hasn't been written yet, or otherwise its URI.
+func (rw *rdfWriter) element(tag string, id common.DocElementID) {
+	if id.DocumentRefID == "" && id.SpecialID == "" && !rw.written[id.ElementRefID] {
+		if pkg := rw.packages[id.ElementRefID]; pkg != nil {
+			rw.open(tag)
+			rw.pkg(pkg)
+			rw.close(tag)
+			return
+		}
+		if f := rw.files[id.ElementRefID]; f != nil {
+			rw.open(tag)
+			rw.file(f)
+			rw.close(tag)
+			return
+		}
+	}
+	rw.resource(tag, rw.docElementURI(id))
+}
+
+// checksums writes a checksum property for each of sums.
+func (rw *rdfWriter) checksums(sums []common.Checksum) {
+	for _, sum := range sums {
+		alg := strings.ToLower(strings.Replace(string(sum.Algorithm), "-", "_", -1))
+		rw.open("spdx:checksum")
+		rw.open("spdx:Checksum")
+		rw.resource("spdx:algorithm", spdxNS+"checksumAlgorithm_"+alg)
+		rw.literal("spdx:checksumValue", sum.Value)
+		rw.close("spdx:Checksum")
+		rw.close("spdx:checksum")
+	}
+}
+
+// relationships writes the relationships whose first element is id.
+func (rw *rdfWriter) relationships(id common.ElementID) {
+	for _, rln := range rw.doc.Relationships {
+		if rln.RefA.DocumentRefID != "" || rln.RefA.SpecialID != "" || rln.RefA.ElementRefID != id {
+			continue
+		}
+		rw.open("spdx:relationship")
+		rw.open("spdx:Relationship")
+		rw.resource("spdx:relationshipType", spdxNS+"relationshipType_"+camelCase(rln.Relationship))
+		rw.element("spdx:relatedSpdxElement", rln.RefB)
+		rw.literal("rdfs:comment", rln.RelationshipComment)
+		rw.close("spdx:Relationship")
+		rw.close("spdx:relationship")
+	}
+}
+
+// pkg writes pkg as an spdx:Package.
+func (rw *rdfWriter) pkg(pkg *spdx.Package) {
+	rw.written[pkg.PackageSPDXIdentifier] = true
+	comments := newLicenseComments(pkg.PackageLicenseComments)
+
+	rw.open("spdx:Package", "rdf:about", rw.elementURI(pkg.PackageSPDXIdentifier))
+	rw.literal("spdx:name", pkg.PackageName)
+	rw.literal("spdx:versionInfo", pkg.PackageVersion)
+	rw.literal("spdx:packageFileName", pkg.PackageFileName)
+	if s := pkg.PackageSupplier; s != nil && s.Supplier != "" {
+		rw.literal("spdx:supplier", actorString(s.SupplierType, s.Supplier))
+	}
+	if o := pkg.PackageOriginator; o != nil && o.Originator != "" {
+		rw.literal("spdx:originator", actorString(o.OriginatorType, o.Originator))
+	}
+	rw.valueOrSpecial("spdx:downloadLocation", pkg.PackageDownloadLocation)
+	rw.literal("spdx:filesAnalyzed", fmt.Sprintf("%t", pkg.FilesAnalyzed), "rdf:datatype", xsdBoolean)
+	if code := pkg.PackageVerificationCode; code != nil {
+		rw.open("spdx:packageVerificationCode")
+		rw.open("spdx:PackageVerificationCode")
+		rw.literal("spdx:packageVerificationCodeValue", code.Value)
+		for _, excluded := range code.ExcludedFiles {
+			rw.literal("spdx:packageVerificationCodeExcludedFile", excluded)
+		}
+		rw.close("spdx:PackageVerificationCode")
+		rw.close("spdx:packageVerificationCode")
+	}
+	rw.checksums(pkg.PackageChecksums)
+	rw.literal("spdx:sourceInfo", pkg.PackageSourceInfo)
+	rw.license("spdx:licenseConcluded", pkg.PackageLicenseConcluded, comments)
+	for _, lic := range pkg.PackageLicenseInfoFromFiles {
+		rw.license("spdx:licenseInfoFromFiles", lic, comments)
+	}
+	rw.license("spdx:licenseDeclared", pkg.PackageLicenseDeclared, comments)
+	rw.literal("spdx:licenseComments", comments.String())
+	rw.valueOrSpecial("spdx:copyrightText", pkg.PackageCopyrightText)
+	rw.literal("spdx:summary", pkg.PackageSummary)
+	rw.literal("spdx:description", pkg.PackageDescription)
+	rw.literal("rdfs:comment", pkg.PackageComment)
+	for _, f := range pkg.Files {
+		rw.element("spdx:hasFile", common.MakeDocElementID("", string(f.FileSPDXIdentifier)))
+	}
+	rw.relationships(pkg.PackageSPDXIdentifier)
+	rw.close("spdx:Package")
+}
+
+// file writes f as an spdx:File.
+func (rw *rdfWriter) file(f *spdx.File) {
+	rw.written[f.FileSPDXIdentifier] = true
+	comments := newLicenseComments(f.LicenseComments)
+
+	rw.open("spdx:File", "rdf:about", rw.elementURI(f.FileSPDXIdentifier))
+	rw.literal("spdx:fileName", f.FileName)
+	for _, t := range f.FileTypes {
+		rw.resource("spdx:fileType", spdxNS+"fileType_"+strings.ToLower(t))
+	}
+	rw.checksums(f.Checksums)
+	rw.license("spdx:licenseConcluded", f.LicenseConcluded, comments)
+	for _, lic := range f.LicenseInfoInFiles {
+		rw.license("spdx:licenseInfoInFile", lic, comments)
+	}
+	rw.literal("spdx:licenseComments", comments.String())
+	rw.valueOrSpecial("spdx:copyrightText", f.FileCopyrightText)
+	rw.literal("rdfs:comment", f.FileComment)
+	rw.literal("spdx:noticeText", f.FileNotice)
+	for _, c := range f.FileContributors {
+		rw.literal("spdx:fileContributor", c)
+	}
+	rw.relationships(f.FileSPDXIdentifier)
+	rw.close("spdx:File")
+}
+
+// license writes a property whose value is the license expression
+// expr. An expression that can't be parsed, such as one found in a
+// file that isn't valid, or that can't be written in RDF, is written
+// as NOASSERTION, and noted in comments so that it isn't lost.
+func (rw *rdfWriter) license(tag string, expr string, comments *licenseComments) {
+	switch expr {
+	case "":
+		return
+	case "NOASSERTION", "NONE":
+		rw.valueOrSpecial(tag, expr)
+		return
+	}
+	node, err := spdxdoc.ParseLicenseExpression(expr)
+	if err != nil {
+		rw.valueOrSpecial(tag, "NOASSERTION")
+		comments.add(fmt.Sprintf("%s %q is not a valid license expression", strings.TrimPrefix(tag, "spdx:"), expr))
+		return
+	}
+	if !rdfWritable(node) {
+		rw.valueOrSpecial(tag, "NOASSERTION")
+		comments.add(fmt.Sprintf("%s %q can't be written in RDF", strings.TrimPrefix(tag, "spdx:"), expr))
+		return
+	}
+	rw.licenseNode(tag, node)
+}
+
+// rdfWritable reports whether n can be written in RDF. The SPDX RDF
+// model only allows a single license as the member of a WITH operator,
+// so an exception to an "or later" license, such as
+// "GPL-2.0+ WITH Classpath-exception-2.0", can't be written, and
+// readers such as tools-golang reject the whole document if it is.
+func rdfWritable(n *spdxdoc.LicenseNode) bool {
+	if n.Op == "WITH" && n.Members[0].Op != "" {
+		return false
+	}
+	for _, m := range n.Members {
+		if !rdfWritable(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// licenseNode writes a property whose value is the license, or the set
+// of licenses, that n describes.
+func (rw *rdfWriter) licenseNode(tag string, n *spdxdoc.LicenseNode) {
+	if n.Op == "" && strings.HasPrefix(n.ID, "LicenseRef-") {
+		rw.open(tag)
+		rw.extractedLicense(n.ID)
+		rw.close(tag)
+		return
+	}
+	if n.Op == "" {
+		rw.resource(tag, rw.licenseURI(n.ID))
+		return
+	}
+	rw.open(tag)
+	switch n.Op {
+	case "AND", "OR":
+		class := "spdx:ConjunctiveLicenseSet"
+		if n.Op == "OR" {
+			class = "spdx:DisjunctiveLicenseSet"
+		}
+		rw.open(class)
+		for _, m := range n.Members {
+			rw.licenseNode("spdx:member", m)
+		}
+		rw.close(class)
+	case "WITH":
+		rw.open("spdx:WithExceptionOperator")
+		rw.operatorMember(n.Members[0])
+		rw.open("spdx:licenseException")
+		rw.open("spdx:LicenseException")
+		rw.literal("spdx:licenseExceptionId", n.ID)
+		rw.close("spdx:LicenseException")
+		rw.close("spdx:licenseException")
+		rw.close("spdx:WithExceptionOperator")
+	case "+":
+		rw.open("spdx:OrLaterOperator")
+		rw.operatorMember(n.Members[0])
+		rw.close("spdx:OrLaterOperator")
+	}
+	rw.close(tag)
+}
+
+// operatorMember writes the license that a WITH or "+" operator applies
+// to, which rdfWritable makes sure is a single license. It is written
+// in full rather than as a reference, as readers expect it to be.
+func (rw *rdfWriter) operatorMember(n *spdxdoc.LicenseNode) {
+	if n.Op != "" || strings.HasPrefix(n.ID, "LicenseRef-") {
+		rw.licenseNode("spdx:member", n)
+		return
+	}
+	rw.open("spdx:member")
+	rw.open("spdx:ListedLicense", "rdf:about", rw.licenseURI(n.ID))
+	rw.literal("spdx:licenseId", n.ID)
+	rw.close("spdx:ListedLicense")
+	rw.close("spdx:member")
+}
+
+// extractedLicense writes the license defined in this document with
+// identifier id. Unlike other elements, it is written in full wherever
+// it is used, as readers expect it to be.
+func (rw *rdfWriter) extractedLicense(id string) {
+	rw.open("spdx:ExtractedLicensingInfo", "rdf:about", rw.licenseURI(id))
+	rw.literal("spdx:licenseId", id)
+	for _, ol := range rw.doc.OtherLicenses {
+		if ol.LicenseIdentifier != id {
+			continue
+		}
+		rw.literal("spdx:extractedText", ol.ExtractedText)
+		rw.literal("spdx:name", ol.LicenseName)
+		for _, ref := range ol.LicenseCrossReferences {
+			rw.literal("rdfs:seeAlso", ref)
+		}
+		rw.literal("rdfs:comment", ol.LicenseComment)
+		break
+	}
+	rw.close("spdx:ExtractedLicensingInfo")
+}
+
+// licenseURI returns the URI for the license with identifier id:
+// licenses defined in the document are under its namespace, those
+// defined in other documents are under theirs, and others are on the
+// SPDX License List.
+func (rw *rdfWriter) licenseURI(id string) string {
+	if strings.HasPrefix(id, "DocumentRef-") {
+		parts := strings.SplitN(strings.TrimPrefix(id, "DocumentRef-"), ":", 2)
+		for _, ref := range rw.doc.ExternalDocumentReferences {
+			if ref.DocumentRefID == parts[0] {
+				return fmt.Sprintf("%s#%s", ref.URI, parts[1])
+			}
+		}
+		return id
+	}
+	if strings.HasPrefix(id, "LicenseRef-") {
+		return fmt.Sprintf("%s#%s", rw.doc.DocumentNamespace, id)
+	}
+	return licensesNS + id
+}
+
+// licenseComments collects the license comments for an element.
+type licenseComments struct {
+	lines []string
+}
+
+func newLicenseComments(s string) *licenseComments {
+	lc := &licenseComments{}
+	lc.add(s)
+	return lc
+}
+
+func (lc *licenseComments) add(s string) {
+	if s != "" {
+		lc.lines = append(lc.lines, s)
+	}
+}
+
+func (lc *licenseComments) String() string {
+	return strings.Join(lc.lines, "\n")
+}
+
+// actorString returns a supplier or originator as SPDX writes it.
+func actorString(actorType string, name string) string {
+	if actorType == "" {
+		return name
+	}
+	return fmt.Sprintf("%s: %s", actorType, name)
+}
+
+// camelCase converts an SPDX relationship type, such as DEPENDS_ON, to
+// the form used in RDF, such as dependsOn.
+func camelCase(s string) string {
+	words := strings.Split(strings.ToLower(s), "_")
+	for i := 1; i < len(words); i++ {
+		if words[i] != "" {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+	}
+	return strings.Join(words, "")
+}
+
+// escapeText and escapeAttr escape strings for use as XML text and
+// attribute values.
+var (
+	escapeText = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	escapeAttr = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+)
@@ -0,0 +1,223 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/spdx/tools-golang/rdf"
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/spdx/v2/common"
+	"github.com/spdx/tools-golang/spdx/v2/v2_2"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+)
+
+// testDocument returns a document with the parts that the agent fills
+// in, including license expressions using each operator.
+func testDocument() *spdx.Document {
+	files := []*spdx.File{
+		{
+			FileName:           "./a.go",
+			FileSPDXIdentifier: "File0",
+			Checksums: []common.Checksum{
+				{Algorithm: common.SHA1, Value: "da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+				{Algorithm: common.SHA256, Value: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+			},
+			LicenseConcluded:   "NOASSERTION",
+			LicenseInfoInFiles: []string{"MIT", "LicenseRef-custom"},
+			FileCopyrightText:  "NOASSERTION",
+		},
+		{
+			FileName:           "./b.go",
+			FileSPDXIdentifier: "File1",
+			Checksums: []common.Checksum{
+				{Algorithm: common.SHA1, Value: "adc83b19e793491b1c6ea0fd8b46cd9f32e592fc"},
+			},
+			LicenseConcluded:   "(Apache-2.0 OR MIT) AND GPL-2.0 WITH Classpath-exception-2.0",
+			LicenseInfoInFiles: []string{"Apache-2.0", "GPL-2.0+"},
+			FileCopyrightText:  "NONE",
+		},
+	}
+	files = append(files, &spdx.File{
+		FileName:           "./c.go",
+		FileSPDXIdentifier: "File2",
+		Checksums: []common.Checksum{
+			{Algorithm: common.SHA1, Value: "356a192b7913b04c54574d18c28d46e6395428ab"},
+		},
+		// can't be written in RDF, nor can one that isn't valid
+		LicenseConcluded:   "GPL-2.0+ WITH Classpath-exception-2.0",
+		LicenseInfoInFiles: []string{"not a license"},
+		FileCopyrightText:  "NOASSERTION",
+	})
+	pkg := &spdx.Package{
+		PackageName:               "example",
+		PackageSPDXIdentifier:     "Package-example",
+		PackageVersion:            "1.0",
+		PackageDownloadLocation:   "https://example.com/example.tar.gz",
+		FilesAnalyzed:             true,
+		IsFilesAnalyzedTagPresent: true,
+		PackageVerificationCode: &common.PackageVerificationCode{
+			Value: "0123456789abcdef0123456789abcdef01234567",
+		},
+		PackageLicenseConcluded:     "NOASSERTION",
+		PackageLicenseInfoFromFiles: []string{"Apache-2.0", "LicenseRef-custom", "MIT"},
+		PackageLicenseDeclared:      "Apache-2.0 OR MIT",
+		PackageCopyrightText:        "NOASSERTION",
+		Files:                       files,
+	}
+	return &spdx.Document{
+		SPDXVersion:       spdx.Version,
+		DataLicense:       spdx.DataLicense,
+		SPDXIdentifier:    "DOCUMENT",
+		DocumentName:      "example",
+		DocumentNamespace: "https://example.com/spdxdocs/example-1",
+		CreationInfo: &spdx.CreationInfo{
+			Creators: []common.Creator{{CreatorType: "Tool", Creator: "github.com/spdx/tools-golang/idsearcher"}},
+			Created:  "2020-01-01T00:00:00Z",
+		},
+		Packages: []*spdx.Package{pkg},
+		OtherLicenses: []*spdx.OtherLicense{
+			{
+				LicenseIdentifier: "LicenseRef-custom",
+				ExtractedText:     "Some custom license text.",
+				LicenseName:       "Custom License",
+			},
+		},
+		Relationships: []*spdx.Relationship{
+			{
+				RefA:         common.MakeDocElementID("", "DOCUMENT"),
+				RefB:         common.MakeDocElementID("", "Package-example"),
+				Relationship: "DESCRIBES",
+			},
+		},
+	}
+}
+
+// licenseIDs returns the licenses that the expression expr names, in
+// order. tools-golang drops the brackets, "+" operators and exceptions
+// when it reads an expression from RDF, so the licenses are all that
+// can be compared.
+func licenseIDs(t *testing.T, exprs ...string) []string {
+	t.Helper()
+	ids := []string{}
+	var add func(n *spdxdoc.LicenseNode)
+	add = func(n *spdxdoc.LicenseNode) {
+		if n.Op == "" {
+			ids = append(ids, n.ID)
+		}
+		for _, m := range n.Members {
+			add(m)
+		}
+	}
+	for _, expr := range exprs {
+		if expr == "NOASSERTION" || expr == "NONE" {
+			ids = append(ids, expr)
+			continue
+		}
+		n, err := spdxdoc.ParseLicenseExpression(expr)
+		if err != nil {
+			t.Fatalf("couldn't parse %q: %v", expr, err)
+		}
+		add(n)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestWriteRDFRoundTrip(t *testing.T) {
+	// tools-golang only reads RDF documents from SPDX 2.2 on
+	for _, version := range []string{v2_2.Version, spdx.Version} {
+		want := testDocument()
+		var buf bytes.Buffer
+		if err := writeRDF(want, version, &buf); err != nil {
+			t.Fatalf("%s: writeRDF: %v", version, err)
+		}
+		got, err := rdf.Read(&buf)
+		if err != nil {
+			t.Fatalf("%s: couldn't read back written document: %v\n%s", version, err, buf.String())
+		}
+
+		if got.DocumentName != want.DocumentName || got.DocumentNamespace != want.DocumentNamespace {
+			t.Errorf("%s: document = %q %q, want %q %q", version, got.DocumentName, got.DocumentNamespace, want.DocumentName, want.DocumentNamespace)
+		}
+		if got.CreationInfo == nil || len(got.CreationInfo.Creators) != 1 || got.CreationInfo.Creators[0] != want.CreationInfo.Creators[0] {
+			t.Errorf("%s: creation info = %+v, want %+v", version, got.CreationInfo, want.CreationInfo)
+		}
+
+		if len(got.Packages) != 1 {
+			t.Fatalf("%s: got %d packages, want 1", version, len(got.Packages))
+		}
+		gp, wp := got.Packages[0], want.Packages[0]
+		if gp.PackageSPDXIdentifier != wp.PackageSPDXIdentifier || gp.PackageName != wp.PackageName || gp.PackageVersion != wp.PackageVersion {
+			t.Errorf("%s: package = %s %q %q, want %s %q %q", version, gp.PackageSPDXIdentifier, gp.PackageName, gp.PackageVersion, wp.PackageSPDXIdentifier, wp.PackageName, wp.PackageVersion)
+		}
+		if gp.PackageDownloadLocation != wp.PackageDownloadLocation {
+			t.Errorf("%s: download location = %q, want %q", version, gp.PackageDownloadLocation, wp.PackageDownloadLocation)
+		}
+		if gp.PackageVerificationCode == nil || gp.PackageVerificationCode.Value != wp.PackageVerificationCode.Value {
+			t.Errorf("%s: verification code = %+v, want %+v", version, gp.PackageVerificationCode, wp.PackageVerificationCode)
+		}
+		if g, w := licenseIDs(t, gp.PackageLicenseDeclared), licenseIDs(t, wp.PackageLicenseDeclared); !reflect.DeepEqual(g, w) {
+			t.Errorf("%s: package license declared = %q, want %q", version, g, w)
+		}
+		if g, w := licenseIDs(t, gp.PackageLicenseInfoFromFiles...), licenseIDs(t, wp.PackageLicenseInfoFromFiles...); !reflect.DeepEqual(g, w) {
+			t.Errorf("%s: package license info from files = %v, want %v", version, g, w)
+		}
+
+		gotFiles := map[common.ElementID]*spdx.File{}
+		for _, f := range append(gp.Files, got.Files...) {
+			gotFiles[f.FileSPDXIdentifier] = f
+		}
+		for _, wf := range wp.Files[:2] {
+			gf := gotFiles[wf.FileSPDXIdentifier]
+			if gf == nil {
+				t.Errorf("%s: file %s missing", version, wf.FileSPDXIdentifier)
+				continue
+			}
+			if gf.FileName != wf.FileName {
+				t.Errorf("%s: file %s name = %q, want %q", version, wf.FileSPDXIdentifier, gf.FileName, wf.FileName)
+			}
+			if len(gf.Checksums) != len(wf.Checksums) {
+				t.Errorf("%s: file %s checksums = %v, want %v", version, wf.FileSPDXIdentifier, gf.Checksums, wf.Checksums)
+			}
+			if g, w := licenseIDs(t, gf.LicenseConcluded), licenseIDs(t, wf.LicenseConcluded); !reflect.DeepEqual(g, w) {
+				t.Errorf("%s: file %s license concluded = %q, want %q", version, wf.FileSPDXIdentifier, g, w)
+			}
+			if g, w := licenseIDs(t, gf.LicenseInfoInFiles...), licenseIDs(t, wf.LicenseInfoInFiles...); !reflect.DeepEqual(g, w) {
+				t.Errorf("%s: file %s license info in file = %v, want %v", version, wf.FileSPDXIdentifier, g, w)
+			}
+		}
+
+		// licenses that can't be written are kept in the comments
+		if gf := gotFiles["File2"]; gf == nil {
+			t.Errorf("%s: file File2 missing", version)
+		} else {
+			if gf.LicenseConcluded != "NOASSERTION" || len(gf.LicenseInfoInFiles) != 1 || gf.LicenseInfoInFiles[0] != "NOASSERTION" {
+				t.Errorf("%s: file File2 licenses = %q %q, want NOASSERTION", version, gf.LicenseConcluded, gf.LicenseInfoInFiles)
+			}
+			for _, expr := range []string{"GPL-2.0+ WITH Classpath-exception-2.0", "not a license"} {
+				if !strings.Contains(gf.LicenseComments, expr) {
+					t.Errorf("%s: file File2 license comments = %q, want mention of %q", version, gf.LicenseComments, expr)
+				}
+			}
+		}
+
+		if len(got.OtherLicenses) != 1 || got.OtherLicenses[0].LicenseIdentifier != "LicenseRef-custom" || got.OtherLicenses[0].ExtractedText != "Some custom license text." {
+			t.Errorf("%s: other licenses = %+v, want LicenseRef-custom", version, got.OtherLicenses)
+		}
+
+		describes := false
+		for _, rel := range got.Relationships {
+			// tools-golang reads relationship types as RDF writes them
+			if camelCase(rel.Relationship) == camelCase("DESCRIBES") && rel.RefA.ElementRefID == "DOCUMENT" && rel.RefB.ElementRefID == "Package-example" {
+				describes = true
+			}
+		}
+		if !describes {
+			t.Errorf("%s: relationships = %+v, want DOCUMENT DESCRIBES Package-example", version, got.Relationships)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The functions in this file are the utility functions from
+// tools-golang's idsearcher package, which are not exported there.
+
+var trashRe = regexp.MustCompile(`[^\w\s\d.\-\+()]+`)
+
+// searchFileIDs returns the sorted, de-duplicated short-form IDs found
+// in the file at filePath.
+func searchFileIDs(filePath string) ([]string, error) {
+	idsMap := map[string]int{}
+	ids := []string{}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), "SPDX-License-Identifier:") {
+			strs := strings.SplitN(scanner.Text(), "SPDX-License-Identifier:", 2)
+
+			// if prefixed by more than n characters, it's probably not a
+			// short-form ID; it's probably code to detect short-form IDs.
+			// Like this function itself, for example  =)
+			prefix := stripTrash(strs[0])
+			if len(prefix) > 5 {
+				continue
+			}
+
+			// stop before trailing */ if it is present
+			lidToExtract := strs[1]
+			lidToExtract = strings.Split(lidToExtract, "*/")[0]
+			lid := strings.TrimSpace(lidToExtract)
+			lid = stripTrash(lid)
+			idsMap[lid] = 1
+		}
+	}
+
+	// FIXME for now, ignore scanner errors because we want to return whatever
+	// FIXME IDs were in fact found.
+
+	// now, convert map to string
+	for lid := range idsMap {
+		ids = append(ids, lid)
+	}
+
+	// and sort it
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+func stripTrash(lid string) string {
+	return trashRe.ReplaceAllString(lid, "")
+}
+
+func makeElement(lic string) string {
+	if strings.Contains(lic, " AND ") || strings.Contains(lic, " OR ") {
+		return fmt.Sprintf("(%s)", lic)
+	}
+
+	return lic
+}
+
+func getIndividualLicenses(lic string) []string {
+	// replace parens and '+' with spaces
+	lic = strings.Replace(lic, "(", " ", -1)
+	lic = strings.Replace(lic, ")", " ", -1)
+	lic = strings.Replace(lic, "+", " ", -1)
+
+	// now, split by spaces, trim, and add to slice
+	licElements := strings.Split(lic, " ")
+	lics := []string{}
+	for _, elt := range licElements {
+		elt := strings.TrimSpace(elt)
+		// don't add if empty or if case-insensitive operator
+		if elt == "" || strings.EqualFold(elt, "AND") ||
+			strings.EqualFold(elt, "OR") || strings.EqualFold(elt, "WITH") {
+			continue
+		}
+
+		lics = append(lics, elt)
+	}
+
+	// sort before returning
+	sort.Strings(lics)
+	return lics
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+)
+
+// maxSearchBytes is how much of each file is matched against the
+// license list. License texts are rarely further in than this.
+const maxSearchBytes = 4 << 20
+
+// matchResults records what was found while matching a package's files.
+type matchResults struct {
+	// ignored lists the paths left out of the document; unsearched
+	// counts the binary files that were not matched.
+	ignored    []string
+	unsearched int
+
+	// filesMatched counts the files in which licenses were found, and
+	// licenseFiles counts the files in which each license was.
+	filesMatched int
+	licenseFiles map[string]int
+}
+
+// buildPackage builds the package for the code in mc.Dir, and matches
+// each of its files against ll, filling in the license fields from the
+// licenses it finds. It returns ctx's error if ctx is done first.
+func buildPackage(ctx context.Context, rpt agentkit.Reporter, mc *matchConfig, ll *licenseList) (*spdx.Package, *matchResults, error) {
+	res := &matchResults{licenseFiles: map[string]int{}}
+	pkg, ignored, err := spdxdoc.BuildPackage(ctx, rpt, mc.PackageConfig, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	res.ignored = ignored
+
+	// and match each file against the license list
+	licsForPackage := map[string]bool{}
+	total := int64(len(pkg.Files))
+	for i, f := range pkg.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		rpt.Progress(agentkit.Progress{Phase: "matching", Unit: "files", Done: int64(i), Total: total})
+
+		// the matches are evidence of what the file contains, not a
+		// conclusion about its license, which is left to a reviewer
+		f.LicenseInfoInFiles = []string{"NOASSERTION"}
+		f.LicenseConcluded = "NOASSERTION"
+
+		b, binary, err := spdxdoc.ReadFileStart(filepath.Join(mc.Dir, f.FileName), maxSearchBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		if binary {
+			res.unsearched++
+			continue
+		}
+		matches := ll.match(normalizeWords(string(b)), mc.minConfidence)
+		if len(matches) == 0 {
+			continue
+		}
+
+		res.filesMatched++
+		f.LicenseInfoInFiles = []string{}
+		found := []string{}
+		for _, m := range matches {
+			f.LicenseInfoInFiles = append(f.LicenseInfoInFiles, m.id)
+			found = append(found, m.String())
+			licsForPackage[m.id] = true
+			res.licenseFiles[m.id]++
+		}
+		f.LicenseComments = fmt.Sprintf("License texts found, with the percentage of each one's text that matched: %s", strings.Join(found, ", "))
+	}
+
+	// and finally, we can fill in the package's details
+	if len(licsForPackage) > 0 {
+		pkg.PackageLicenseInfoFromFiles = []string{}
+		for lic := range licsForPackage {
+			pkg.PackageLicenseInfoFromFiles = append(pkg.PackageLicenseInfoFromFiles, lic)
+		}
+		sort.Strings(pkg.PackageLicenseInfoFromFiles)
+	}
+
+	return pkg, res, nil
+}
+
+// buildDocument creates an SPDX Document describing pkg, noting the
+// version of the license list that its files were matched against.
+func buildDocument(pkg *spdx.Package, mc *matchConfig, ll *licenseList) (*spdx.Document, error) {
+	// the same package, with the same files, matched in the same way,
+	// gives the same document
+	namespace, err := mc.DocumentNamespace(pkg, ll.version, strconv.FormatFloat(mc.minConfidence, 'g', -1, 64))
+	if err != nil {
+		return nil, err
+	}
+	doc, err := spdxdoc.NewDocument("github.com/swinslow/peridot-agents/pkg/license-matcher", namespace, []*spdx.Package{pkg})
+	if err != nil {
+		return nil, err
+	}
+	doc.CreationInfo.LicenseListVersion = ll.version
+	return doc, nil
+}
@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+const (
+	// namespaceBaseEnv names the environment variable that sets the
+	// base URI of the namespaces of the documents that the agent
+	// writes, for jobs that don't set their own with the namespaceBase
+	// key/value.
+	namespaceBaseEnv = "LICENSE_MATCHER_NAMESPACE_BASE"
+)
+
+// matchConfig holds the configuration for a job: the package's, as for
+// any agent that describes the primary code input, and how closely its
+// files have to match a license.
+type matchConfig struct {
+	*spdxdoc.PackageConfig
+
+	minConfidence float64
+}
+
+// newMatchConfig reads the configuration for cfg's job.
+func newMatchConfig(cfg agent.JobConfig) (*matchConfig, error) {
+	pc, err := spdxdoc.NewPackageConfig(cfg, namespaceBaseEnv)
+	if err != nil {
+		return nil, err
+	}
+	mc := &matchConfig{
+		PackageConfig: pc,
+		minConfidence: defaultMinConfidence,
+	}
+
+	for _, jkv := range cfg.Jkvs {
+		if jkv.Key == "minConfidence" {
+			c, err := strconv.ParseFloat(strings.TrimSuffix(jkv.Value, "%"), 64)
+			if err != nil || c <= 0 || c > 100 {
+				return nil, fmt.Errorf("minConfidence %q must be a percentage above 0 and at most 100", jkv.Value)
+			}
+			mc.minConfidence = c
+		}
+	}
+	return mc, nil
+}
@@ -0,0 +1,11 @@
+module github.com/swinslow/peridot-agents/pkg/license-matcher
+
+go 1.13
+
+require (
+	github.com/spdx/tools-golang v0.5.5
+	github.com/swinslow/peridot-agents/pkg/agentkit v0.0.0
+	github.com/swinslow/peridot-jobrunner v0.0.0-20191124161321-701dbac8170c
+)
+
+replace github.com/swinslow/peridot-agents/pkg/agentkit => ../agentkit
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// licenseMatcher finds full license texts in code, by matching its
+// files against the SPDX license list, which is loaded once when the
+// agent starts.
+type licenseMatcher struct {
+	licenses *licenseList
+}
+
+// Run is the function that actually carries out the substantive
+// action of the agent, for this job.
+func (lm *licenseMatcher) Run(ctx context.Context, cfg agent.JobConfig, rpt agentkit.Reporter) error {
+	// check that we got a non-empty output directory
+	if cfg.SpdxOutputDir == "" {
+		// we didn't; error out
+		return fmt.Errorf("no spdxOutputDir specified")
+	}
+
+	// get the code to match, along with the package's name and other
+	// details, from the job or from the agent that retrieved the code
+	mc, err := newMatchConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	// we're all configured; set status as running
+	rpt.Running()
+
+	// build the SPDX package, matching its files as we go
+	pkg, res, err := buildPackage(ctx, rpt, mc, lm.licenses)
+	if err != nil {
+		// matcher failed or was cancelled; error out
+		return fmt.Errorf("license-matcher failed: %v", err)
+	}
+	doc, err := buildDocument(pkg, mc, lm.licenses)
+	if err != nil {
+		return fmt.Errorf("license-matcher failed: %v", err)
+	}
+
+	// save the SPDX document to disk
+	const docName = "primary.spdx"
+	if err := spdxdoc.WriteTagValue(doc, filepath.Join(cfg.SpdxOutputDir, docName)); err != nil {
+		return err
+	}
+
+	lines := mc.Summary(doc.DocumentNamespace)
+	list := fmt.Sprintf("license list: %d licenses", len(lm.licenses.licenses))
+	if lm.licenses.version != "" {
+		list += fmt.Sprintf(", version %s", lm.licenses.version)
+	}
+	lines = append(lines, list)
+	lines = append(lines, fmt.Sprintf("min confidence: %g%%", mc.minConfidence))
+	lines = append(lines, fmt.Sprintf("matched: %d of %d files", res.filesMatched, len(pkg.Files)))
+	if len(res.licenseFiles) > 0 {
+		found := []string{}
+		for id, n := range res.licenseFiles {
+			found = append(found, fmt.Sprintf("%s (%d)", id, n))
+		}
+		sort.Strings(found)
+		lines = append(lines, fmt.Sprintf("licenses: %s", strings.Join(found, ", ")))
+	}
+	if len(res.ignored) > 0 {
+		lines = append(lines, fmt.Sprintf("ignored: %s", spdxdoc.ListPaths(res.ignored)))
+	}
+	if res.unsearched > 0 {
+		lines = append(lines, fmt.Sprintf("binary files not searched: %d", res.unsearched))
+	}
+	lines = append(lines, fmt.Sprintf("document: %s", docName))
+	rpt.Output(strings.Join(lines, "\n"))
+
+	// success!
+	return nil
+}
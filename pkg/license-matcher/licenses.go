@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit/licenselist"
+)
+
+// licenseListEnv names the environment variable that gives the
+// directory holding the SPDX license list that the agent matches
+// against, laid out as in the spdx/license-list-data repository. The
+// agent's Docker image bundles a copy at licenselist.DefaultDir.
+const licenseListEnv = "LICENSE_MATCHER_LICENSE_LIST"
+
+// minShingles is the fewest shingles that a license must have to be
+// matched against. Shorter texts are too easily found by chance.
+const minShingles = 10
+
+// license is one of the licenses on the SPDX license list.
+type license struct {
+	id string
+
+	// shingles is how many distinct shingles the license's required
+	// text has.
+	shingles int
+}
+
+// licenseList holds the licenses that files are matched against.
+type licenseList struct {
+	version string
+
+	licenses []*license
+
+	// index maps the hash of each shingle to the licenses, as indexes
+	// into licenses, whose required text has it.
+	index map[uint64][]int
+}
+
+// loadLicenseList reads the SPDX license list in dir. Each license's
+// required text is read as licenselist.List.Segments says, so that
+// only the text that a matching file must contain is compared.
+// Deprecated licenses are skipped.
+func loadLicenseList(dir string) (*licenseList, error) {
+	list, err := licenselist.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	ll := &licenseList{version: list.Version, index: map[uint64][]int{}}
+
+	for _, id := range list.Current() {
+		segments, err := list.Segments(id)
+		if err != nil {
+			return nil, err
+		}
+		set := map[uint64]bool{}
+		for _, seg := range segments {
+			shingles(normalizeWords(seg), set)
+		}
+		if len(set) < minShingles {
+			continue
+		}
+
+		n := len(ll.licenses)
+		ll.licenses = append(ll.licenses, &license{id: id, shingles: len(set)})
+		for h := range set {
+			ll.index[h] = append(ll.index[h], n)
+		}
+	}
+	if len(ll.licenses) == 0 {
+		return nil, fmt.Errorf("no license texts found in %s", dir)
+	}
+	return ll, nil
+}
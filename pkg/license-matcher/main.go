@@ -0,0 +1,28 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"log"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/licenselist"
+)
+
+const (
+	port = ":3018"
+)
+
+func main() {
+	// load the license list that jobs' files are matched against
+	dir := licenselist.Dir(licenseListEnv)
+	licenses, err := loadLicenseList(dir)
+	if err != nil {
+		log.Fatalf("couldn't load license list: %v", err)
+	}
+	log.Printf("loaded %d licenses from %s", len(licenses.licenses), dir)
+
+	// serve jobs until we're asked to shut down
+	if err := agentkit.Serve(port, &licenseMatcher{licenses: licenses}); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// defaultMinConfidence is the lowest confidence, as a percentage, at
+// which a license is reported as found in a file, unless the job sets
+// another with the minConfidence key/value.
+const defaultMinConfidence = 90.0
+
+// licenseMatch is a license whose text was found in a file.
+type licenseMatch struct {
+	id string
+
+	// confidence is the percentage of the license's required text
+	// that the file contains.
+	confidence float64
+
+	// matched is the license's shingles that were found in the file.
+	matched []uint64
+}
+
+// String returns the match as it is written in the document.
+func (m *licenseMatch) String() string {
+	return fmt.Sprintf("%s (%.1f%%)", m.id, m.confidence)
+}
+
+// match finds the licenses whose text is in words, a file's words in
+// normal form, with at least minConfidence. A file can contain more
+// than one license. Where one license's text is mostly the same as
+// another's, as BSD-2-Clause is part of BSD-3-Clause, only the one that
+// better accounts for the file is reported; so is only the first, by
+// identifier, of licenses with the same text, such as GPL-2.0-only and
+// GPL-2.0-or-later, which the text alone can't tell apart.
+func (ll *licenseList) match(words []string, minConfidence float64) []*licenseMatch {
+	set := map[uint64]bool{}
+	shingles(words, set)
+
+	// count each license's shingles in the file
+	counts := map[int]int{}
+	for h := range set {
+		for _, n := range ll.index[h] {
+			counts[n]++
+		}
+	}
+	candidates := map[int]*licenseMatch{}
+	for n, count := range counts {
+		l := ll.licenses[n]
+		confidence := 100 * float64(count) / float64(l.shingles)
+		if confidence >= minConfidence {
+			candidates[n] = &licenseMatch{id: l.id, confidence: confidence}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// and find which of the file's shingles each candidate matched
+	for h := range set {
+		for _, n := range ll.index[h] {
+			if m, ok := candidates[n]; ok {
+				m.matched = append(m.matched, h)
+			}
+		}
+	}
+	ordered := []*licenseMatch{}
+	for _, m := range candidates {
+		ordered = append(ordered, m)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if a.confidence != b.confidence {
+			return a.confidence > b.confidence
+		}
+		if len(a.matched) != len(b.matched) {
+			return len(a.matched) > len(b.matched)
+		}
+		return a.id < b.id
+	})
+
+	// take the closest matches first, and the largest of those, so
+	// that a license found in full wins over a longer one found in
+	// part, skipping those that are mostly text that an earlier one
+	// has already accounted for
+	matches := []*licenseMatch{}
+	claimed := map[uint64]bool{}
+	for _, m := range ordered {
+		novel := 0
+		for _, h := range m.matched {
+			if !claimed[h] {
+				novel++
+			}
+		}
+		if 2*novel < len(m.matched) {
+			continue
+		}
+		for _, h := range m.matched {
+			claimed[h] = true
+		}
+		matches = append(matches, m)
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].id < matches[j].id })
+	return matches
+}
@@ -0,0 +1,194 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	bsdPreamble = "Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:\n"
+	bsdClause1  = "1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.\n"
+	bsdClause2  = "2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.\n"
+	bsdClause3  = "3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.\n"
+	bsdWarranty = "THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS \"AS IS\" AND ANY EXPRESS OR IMPLIED WARRANTIES ARE DISCLAIMED.\n"
+
+	gplText = "This program is free software; you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation; either version 2 of the License, or (at your option) any later version.\n"
+
+	mitText = "Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files, to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software.\nThe above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.\n"
+)
+
+// writeLicenseList writes a small license list to a new directory, and
+// returns it.
+func writeLicenseList(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "license-matcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"json/licenses.json": `{"licenseListVersion": "3.7", "licenses": [
+			{"licenseId": "BSD-2-Clause", "isDeprecatedLicenseId": false},
+			{"licenseId": "BSD-3-Clause", "isDeprecatedLicenseId": false},
+			{"licenseId": "GPL-2.0", "isDeprecatedLicenseId": true},
+			{"licenseId": "GPL-2.0-only", "isDeprecatedLicenseId": false},
+			{"licenseId": "GPL-2.0-or-later", "isDeprecatedLicenseId": false},
+			{"licenseId": "MIT", "isDeprecatedLicenseId": false},
+			{"licenseId": "Short", "isDeprecatedLicenseId": false}
+		]}`,
+		"json/exceptions.json":        `{"exceptions": []}`,
+		"text/BSD-2-Clause.txt":       bsdPreamble + bsdClause1 + bsdClause2 + bsdWarranty,
+		"text/BSD-3-Clause.txt":       bsdPreamble + bsdClause1 + bsdClause2 + bsdClause3 + bsdWarranty,
+		"text/GPL-2.0.txt":            gplText,
+		"text/GPL-2.0-only.txt":       gplText,
+		"text/GPL-2.0-or-later.txt":   gplText,
+		"text/Short.txt":              "You may use this as you like.\n",
+		"template/MIT.template.txt":   "<<beginOptional>>MIT License\n\n<<endOptional>>Copyright <<var;name=\"copyright\";original=\"(c) <year> <copyright holders>\";match=\".{0,5000}\">>\n\n" + mitText,
+		"template/Short.template.txt": "You may use this as you like.\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// commented returns text as a block comment, with a copyright notice,
+// as it is often found at the top of a source file.
+func commented(text string) string {
+	lines := []string{"/*", " * Copyright (c) 2019 Example Corp."}
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		lines = append(lines, " * "+line)
+	}
+	return strings.Join(append(lines, " */"), "\n")
+}
+
+func TestLoadLicenseList(t *testing.T) {
+	dir := writeLicenseList(t)
+	defer os.RemoveAll(dir)
+
+	ll, err := loadLicenseList(dir)
+	if err != nil {
+		t.Fatalf("loadLicenseList: %v", err)
+	}
+	if ll.version != "3.7" {
+		t.Errorf("got version %q, want %q", ll.version, "3.7")
+	}
+	// deprecated licenses, and those too short to match, are left out
+	ids := []string{}
+	for _, l := range ll.licenses {
+		ids = append(ids, l.id)
+	}
+	want := "BSD-2-Clause BSD-3-Clause GPL-2.0-only GPL-2.0-or-later MIT"
+	if got := strings.Join(ids, " "); got != want {
+		t.Errorf("got licenses %s, want %s", got, want)
+	}
+
+	// nor is there anything to match against if every license is too
+	// short
+	short := filepath.Join(dir, "short")
+	files := map[string]string{
+		"json/licenses.json":   `{"licenseListVersion": "3.7", "licenses": [{"licenseId": "Short", "isDeprecatedLicenseId": false}]}`,
+		"json/exceptions.json": `{"exceptions": []}`,
+		"text/Short.txt":       "You may use this as you like.\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(short, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := loadLicenseList(short); err == nil || !strings.Contains(err.Error(), "no license texts found") {
+		t.Errorf("got error %v, want one saying no license texts were found", err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	dir := writeLicenseList(t)
+	defer os.RemoveAll(dir)
+	ll, err := loadLicenseList(dir)
+	if err != nil {
+		t.Fatalf("loadLicenseList: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		text          string
+		minConfidence float64
+		// want is the matches as they are written in the document
+		want string
+	}{
+		{
+			name: "exact",
+			text: bsdPreamble + bsdClause1 + bsdClause2 + bsdClause3 + bsdWarranty,
+			want: "BSD-3-Clause (100.0%)",
+		},
+		{
+			name: "in a comment, with a copyright notice",
+			text: commented(bsdPreamble + bsdClause1 + bsdClause2 + bsdWarranty),
+			want: "BSD-2-Clause (100.0%)",
+		},
+		{
+			name: "varietal spellings and rewrapped lines",
+			text: "MIT Licence\n\nCopyright 2020 Someone\n\n" + strings.Replace(strings.ToUpper(mitText), "SUBLICENSE", "SUB-LICENCE", 1) + "\n",
+			want: "MIT (100.0%)",
+		},
+		{
+			name: "the same text as another license",
+			text: commented(gplText),
+			want: "GPL-2.0-only (100.0%)",
+		},
+		{
+			name: "more than one license",
+			text: commented(mitText) + "\n\n" + commented(gplText),
+			want: "GPL-2.0-only (100.0%), MIT (100.0%)",
+		},
+		{
+			name: "part of a license",
+			text: bsdPreamble + bsdClause1,
+			want: "",
+		},
+		{
+			name:          "part of a license, with a lower minimum",
+			text:          bsdPreamble + bsdClause1 + bsdClause2,
+			minConfidence: 60,
+			want:          "BSD-2-Clause (73.7%)",
+		},
+		{
+			name: "too short to match",
+			text: "You may use this as you like.",
+			want: "",
+		},
+		{
+			name: "empty",
+			text: "",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			minConfidence := tt.minConfidence
+			if minConfidence == 0 {
+				minConfidence = defaultMinConfidence
+			}
+			found := []string{}
+			for _, m := range ll.match(normalizeWords(tt.text), minConfidence) {
+				found = append(found, m.String())
+			}
+			if got := strings.Join(found, ", "); got != tt.want {
+				t.Errorf("got matches %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
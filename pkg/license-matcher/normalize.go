@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// shingleSize is the number of consecutive words in each of the
+// shingles that texts are compared by.
+const shingleSize = 3
+
+// The functions in this file put license texts, and the files being
+// compared against them, into a normal form following the SPDX License
+// List Matching Guidelines, so that differences the guidelines say to
+// ignore don't count against a match. Case, whitespace and the
+// markers of code comments, bullets and numbered lists are ignored;
+// copyright notices are removed; and the varietal spellings that the
+// guidelines list as equivalent are made the same. Punctuation is
+// dropped rather than matched, which the confidence score tolerates.
+
+// markerRe matches the comment markers, bullets and list numbering at
+// the start of a line, such as " * 1. " or "// (a) ".
+var markerRe = regexp.MustCompile(`^(?:[\s/*#;!%>|•·–—-]+|\(?(?:[0-9]+(?:\.[0-9]+)*|[a-z]|[ivx]+)[.)](?:\s|$))+`)
+
+// copyrightRe matches a line that is a copyright notice, once the line
+// has had its markers removed.
+var copyrightRe = regexp.MustCompile(`^(?:copyright\b|©|\(c\)\s)`)
+
+// yearNoticeRe matches a line that is a copyright notice starting with
+// "(c)" and a year, before markerRe would take the "(c)" for a list
+// item's lettering.
+var yearNoticeRe = regexp.MustCompile(`^[\s/*#;!%>|]*\(c\)\s*[0-9]`)
+
+// phraseReplacer makes the equivalent phrases that span more than one
+// word the same, before the text is split into words.
+var phraseReplacer = strings.NewReplacer(
+	"sub-licen", "sublicen",
+	"sub licen", "sublicen",
+	"non-commercial", "noncommercial",
+	"per cent", "percent",
+	"copyright owner", "copyright holder",
+)
+
+// equivalentWords maps varietal spellings to the one that is used for
+// comparison, following the equivalent words list that accompanies the
+// matching guidelines.
+var equivalentWords = map[string]string{
+	"acknowledgement": "acknowledgment",
+	"analogue":        "analog",
+	"analyse":         "analyze",
+	"artefact":        "artifact",
+	"authorisation":   "authorization",
+	"authorised":      "authorized",
+	"calibre":         "caliber",
+	"cancelled":       "canceled",
+	"capitalisations": "capitalizations",
+	"catalogue":       "catalog",
+	"categorise":      "categorize",
+	"centre":          "center",
+	"emphasised":      "emphasized",
+	"favour":          "favor",
+	"favourite":       "favorite",
+	"fulfil":          "fulfill",
+	"fulfilment":      "fulfillment",
+	"https":           "http",
+	"initialise":      "initialize",
+	"judgement":       "judgment",
+	"labelling":       "labeling",
+	"labour":          "labor",
+	"licence":         "license",
+	"licenced":        "licensed",
+	"licences":        "licenses",
+	"licencing":       "licensing",
+	"maximise":        "maximize",
+	"modelled":        "modeled",
+	"modelling":       "modeling",
+	"offence":         "offense",
+	"optimise":        "optimize",
+	"organisation":    "organization",
+	"organise":        "organize",
+	"practise":        "practice",
+	"programme":       "program",
+	"realise":         "realize",
+	"recognise":       "recognize",
+	"signalling":      "signaling",
+	"sublicence":      "sublicense",
+	"utilisation":     "utilization",
+	"whilst":          "while",
+	"wilfull":         "wilful",
+}
+
+// normalizeWords returns the words of text in normal form.
+func normalizeWords(text string) []string {
+	text = phraseReplacer.Replace(strings.ToLower(text))
+
+	words := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if yearNoticeRe.MatchString(line) {
+			continue
+		}
+		line = markerRe.ReplaceAllString(line, "")
+		if copyrightRe.MatchString(line) {
+			continue
+		}
+		for _, w := range strings.FieldsFunc(line, isNotWordChar) {
+			if eq, ok := equivalentWords[w]; ok {
+				w = eq
+			}
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// isNotWordChar reports whether r separates words.
+func isNotWordChar(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// shingles returns the hashes of the distinct runs of shingleSize
+// consecutive words in words, adding them to set. Texts with fewer
+// words than that have no shingles.
+func shingles(words []string, set map[uint64]bool) {
+	for i := 0; i+shingleSize <= len(words); i++ {
+		h := fnv.New64a()
+		for _, w := range words[i : i+shingleSize] {
+			h.Write([]byte(w))
+			h.Write([]byte{0})
+		}
+		set[h.Sum64()] = true
+	}
+}
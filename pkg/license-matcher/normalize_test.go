@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeWords(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "case, whitespace and punctuation",
+			text: "Permission is  hereby\tGRANTED,\nfree of charge.",
+			want: "permission is hereby granted free of charge",
+		},
+		{
+			name: "comment markers",
+			text: "/*\n * Licensed under\n */\n// the terms\n# of the\n; license\n",
+			want: "licensed under the terms of the license",
+		},
+		{
+			name: "bullets and list numbering",
+			text: "1. first\n 2.1. second\n(a) third\nb) fourth\n  iv. fifth\n - sixth\n• seventh\n",
+			want: "first second third fourth fifth sixth seventh",
+		},
+		{
+			name: "numbers that aren't list numbering",
+			text: "version 2.0 of\n2.0 licensed\ni.e. this",
+			want: "version 2 0 of 2 0 licensed i e this",
+		},
+		{
+			name: "copyright notices",
+			text: "Copyright 2019 Example\n * Copyright (c) 2020 Example Corp.\n© 2021 Someone\n(c) 2022 Someone Else\n// (c)2023 Another\nthe software\n",
+			want: "the software",
+		},
+		{
+			name: "list item lettered (c)",
+			text: "(b) the first\n(c) the second\n",
+			want: "the first the second",
+		},
+		{
+			name: "copyright in a sentence",
+			text: "retain the above copyright notice",
+			want: "retain the above copyright notice",
+		},
+		{
+			name: "equivalent words",
+			text: "This Licence is authorised by the organisation, see https://example.com",
+			want: "this license is authorized by the organization see http example com",
+		},
+		{
+			name: "equivalent phrases",
+			text: "to sub-license, sub licence or be the Copyright Owner",
+			want: "to sublicense sublicense or be the copyright holder",
+		},
+		{
+			name: "empty",
+			text: "",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(normalizeWords(tt.text), " ")
+			if got != tt.want {
+				t.Errorf("normalizeWords(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShingles(t *testing.T) {
+	set := map[uint64]bool{}
+	shingles([]string{"a", "b"}, set)
+	if len(set) != 0 {
+		t.Errorf("got %d shingles for two words, want none", len(set))
+	}
+
+	// repeated runs of words are counted once
+	shingles(strings.Fields("a b c a b c"), set)
+	if len(set) != 3 {
+		t.Errorf("got %d shingles, want 3", len(set))
+	}
+
+	// words are kept apart, so that runs spelling the same are not
+	// the same
+	other := map[uint64]bool{}
+	shingles([]string{"ab", "c", "d"}, other)
+	shingles([]string{"a", "bc", "d"}, other)
+	if len(other) != 2 {
+		t.Errorf("got %d shingles, want 2", len(other))
+	}
+
+	// the same words give the same shingles
+	again := map[uint64]bool{}
+	shingles(strings.Fields("c a b c a b"), again)
+	if !reflect.DeepEqual(again, set) {
+		t.Errorf("got shingles %v, want %v", again, set)
+	}
+}
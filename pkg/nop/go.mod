@@ -3,6 +3,8 @@ module github.com/swinslow/peridot-agents/pkg/nop
 go 1.13
 
 require (
+	github.com/swinslow/peridot-agents/pkg/agentkit v0.0.0
 	github.com/swinslow/peridot-jobrunner v0.0.0-20191124161321-701dbac8170c
-	google.golang.org/grpc v1.25.1
 )
+
+replace github.com/swinslow/peridot-agents/pkg/agentkit => ../agentkit
@@ -3,11 +3,8 @@ package main
 
 import (
 	"log"
-	"net"
 
-	"google.golang.org/grpc"
-
-	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
 )
 
 const (
@@ -15,18 +12,8 @@ const (
 )
 
 func main() {
-	// open a socket for listening
-	lis, err := net.Listen("tcp", port)
-	if err != nil {
-		log.Fatalf("couldn't open port %v: %v", port, err)
-	}
-
-	// create and register new GRPC server for agent
-	server := grpc.NewServer()
-	agent.RegisterAgentServer(server, &nop{})
-
-	// start grpc server
-	if err := server.Serve(lis); err != nil {
-		log.Fatalf("couldn't start server: %v", err)
+	// serve jobs until we're asked to shut down
+	if err := agentkit.Serve(port, &nop{}); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -4,47 +4,24 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
 	"strings"
 	"time"
 
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
 	"github.com/swinslow/peridot-jobrunner/pkg/agent"
-	"github.com/swinslow/peridot-jobrunner/pkg/status"
 )
 
-// setStatusError is a helper function to send a statusUpdate
-// to the setStatus channel with ERROR status, and with the specified
-// error message.
-func setStatusError(setStatus chan<- statusUpdate, msg string) {
-	setStatus <- statusUpdate{
-		run:       status.Status_STOPPED,
-		health:    status.Health_ERROR,
-		now:       time.Now(),
-		outputMsg: msg,
-	}
-}
-
-// runAgent is the function that actually carries out the substantive
-// action of the agent, for this job. It does not do any gRPC communication
-// itself, but instead uses signals back to the separate sender goroutine
-// to set job status information.
-func (n *nop) runAgent(
-	ctx context.Context,
-	cfg agent.JobConfig,
-	setStatus chan<- statusUpdate,
-) {
-	defer log.Printf("==> CLOSING runAgent")
-
-	// now that we exist, we own setStatus and are responsible for
-	// closing it when we are done
-	defer close(setStatus)
+type nop struct{}
 
+// Run is the function that actually carries out the substantive
+// action of the agent, for this job.
+func (n *nop) Run(ctx context.Context, cfg agent.JobConfig, rpt agentkit.Reporter) error {
 	// all we're going to do is to get the key-value pairs from
 	// the job configuration; sleep for a couple of seconds; then
 	// return them as output
 
 	// we're all configured; set status as running
-	setStatus <- statusUpdate{run: status.Status_RUNNING}
+	rpt.Running()
 
 	// build output string
 	strs := []string{}
@@ -53,13 +30,14 @@ func (n *nop) runAgent(
 		strs = append(strs, s)
 	}
 
-	// sleep for a couple of seconds
-	time.Sleep(2 * time.Second)
+	// sleep for a couple of seconds, unless we're cancelled first
+	select {
+	case <-time.After(2 * time.Second):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 
 	// success!
-	setStatus <- statusUpdate{
-		run:       status.Status_STOPPED,
-		now:       time.Now(),
-		outputMsg: strings.Join(strs, "\n"),
-	}
+	rpt.Output(strings.Join(strs, "\n"))
+	return nil
 }
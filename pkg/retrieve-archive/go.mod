@@ -0,0 +1,10 @@
+module github.com/swinslow/peridot-agents/pkg/retrieve-archive
+
+go 1.13
+
+require (
+	github.com/swinslow/peridot-agents/pkg/agentkit v0.0.0
+	github.com/swinslow/peridot-jobrunner v0.0.0-20191124161321-701dbac8170c
+)
+
+replace github.com/swinslow/peridot-agents/pkg/agentkit => ../agentkit
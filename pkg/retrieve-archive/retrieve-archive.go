@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/archive"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+type retrieveArchive struct{}
+
+// Run is the function that actually carries out the substantive
+// action of the agent, for this job.
+func (ag *retrieveArchive) Run(ctx context.Context, cfg agent.JobConfig, rpt agentkit.Reporter) error {
+	// make sure we've got the config values we need
+	srcURL := ""
+	name := ""
+	version := ""
+	formatName := ""
+	stripComponents := 0
+	expected := archive.Checksums{}
+
+	for _, jkv := range cfg.Jkvs {
+		switch jkv.Key {
+		case "url":
+			srcURL = jkv.Value
+		case "name":
+			name = jkv.Value
+		case "version":
+			version = jkv.Value
+		case "format":
+			formatName = jkv.Value
+		case "stripComponents":
+			n, err := strconv.Atoi(jkv.Value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("stripComponents %q is not a non-negative integer", jkv.Value)
+			}
+			stripComponents = n
+		case "sha256", "sha1":
+			alg := strings.ToUpper(jkv.Key)
+			if err := archive.ValidateChecksum(alg, jkv.Value); err != nil {
+				return err
+			}
+			expected[alg] = jkv.Value
+		}
+	}
+
+	if srcURL == "" {
+		return fmt.Errorf("url key/value not specified")
+	}
+	if err := validateArchiveURL(srcURL); err != nil {
+		return err
+	}
+	// an archive is only unpacked once it's known to be the right one
+	if len(expected) == 0 {
+		return fmt.Errorf("sha256 or sha1 key/value not specified")
+	}
+
+	var format archive.Format
+	if formatName != "" {
+		var err error
+		format, err = archive.ParseFormat(formatName)
+		if err != nil {
+			return err
+		}
+	}
+
+	// check that we've got an empty directory to extract into
+	if err := agentkit.PrepareCodeOutputDir(cfg.CodeOutputDir); err != nil {
+		return err
+	}
+
+	// we're all configured; set status as running
+	rpt.Running()
+
+	// from here on, if we fail, remove anything that we've extracted
+	// so that later agents don't pick up part of an archive
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			agentkit.RemoveDirContents(cfg.CodeOutputDir)
+		}
+	}()
+
+	archivePath, sums, err := archive.Download(ctx, srcURL, rpt)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archivePath)
+
+	// don't unpack anything that isn't what we expected
+	if err := sums.Verify(expected); err != nil {
+		return fmt.Errorf("downloaded %s, but %v", srcURL, err)
+	}
+
+	if format == "" {
+		format, err = archive.DetectFormat(archivePath)
+		if err != nil {
+			return fmt.Errorf("downloaded %s, but %v", srcURL, err)
+		}
+	}
+
+	files, err := archive.Extract(ctx, archivePath, format, cfg.CodeOutputDir, archive.Options{StripComponents: stripComponents}, rpt)
+	if err != nil {
+		return fmt.Errorf("couldn't extract %s: %v", srcURL, err)
+	}
+
+	// record where the code came from, for later agents
+	if cfg.SpdxOutputDir != "" {
+		prov := &agentkit.Provenance{
+			Agent:            "retrieve-archive",
+			Name:             name,
+			URL:              srcURL,
+			DownloadLocation: srcURL,
+			Version:          version,
+			Checksums: map[string]string{
+				"SHA1":   sums["SHA1"],
+				"SHA256": sums["SHA256"],
+			},
+			RetrievedAt: time.Now().UTC().Truncate(time.Second),
+		}
+		if err := agentkit.WriteProvenance(cfg.SpdxOutputDir, prov); err != nil {
+			return err
+		}
+	}
+
+	rpt.Output(fmt.Sprintf("url: %s\nformat: %s\nsha256: %s\nfiles: %d", srcURL, format, sums["SHA256"], files))
+
+	// success!
+	succeeded = true
+	return nil
+}
+
+// validateArchiveURL checks that u is an http or https URL that we are
+// willing to download from, and returns an error explaining why if not.
+func validateArchiveURL(u string) error {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("url %q is invalid: %v", u, err)
+	}
+	if pu.Scheme != "http" && pu.Scheme != "https" {
+		return fmt.Errorf("url %q has unsupported scheme %q; must be http or https", u, pu.Scheme)
+	}
+	if pu.Host == "" {
+		return fmt.Errorf("url %q has no host", u)
+	}
+	// keep credentials out of logs, output messages and provenance
+	if pu.User != nil {
+		return fmt.Errorf("url for %s must not include a user name or password", pu.Host)
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+// authConfig holds the job key/values that say where to find the
+// credentials for cloning a private repository. Secrets are never
+// passed in the job configuration itself; instead, each one is read
+// either from a file or from an environment variable of the agent,
+// named by the corresponding "...File" or "...Env" key.
+//
+// For https remotes, the token or password is sent using HTTP basic
+// auth, with user name "authUser" (default "git"; most hosts accept
+// any user name alongside a token).
+//
+// For ssh remotes, the private key is used with user name "authUser",
+// or else the user in the URL, or else "git". Host keys are checked
+// against "sshKnownHostsFile" if set, or else the usual known_hosts
+// files.
+type authConfig struct {
+	user string
+
+	passwordFile string
+	passwordEnv  string
+
+	sshKeyFile        string
+	sshKeyEnv         string
+	sshPassphraseFile string
+	sshPassphraseEnv  string
+	knownHostsFile    string
+}
+
+// setFromJkv records the job key/value if it is one of the auth keys,
+// and returns whether it was.
+func (ac *authConfig) setFromJkv(key string, value string) bool {
+	switch key {
+	case "authUser":
+		ac.user = value
+	case "authPasswordFile":
+		ac.passwordFile = value
+	case "authPasswordEnv":
+		ac.passwordEnv = value
+	case "sshKeyFile":
+		ac.sshKeyFile = value
+	case "sshKeyEnv":
+		ac.sshKeyEnv = value
+	case "sshPassphraseFile":
+		ac.sshPassphraseFile = value
+	case "sshPassphraseEnv":
+		ac.sshPassphraseEnv = value
+	case "sshKnownHostsFile":
+		ac.knownHostsFile = value
+	default:
+		return false
+	}
+	return true
+}
+
+func (ac *authConfig) wantsPassword() bool {
+	return ac.passwordFile != "" || ac.passwordEnv != ""
+}
+
+func (ac *authConfig) wantsSSHKey() bool {
+	return ac.sshKeyFile != "" || ac.sshKeyEnv != ""
+}
+
+// buildAuth reads the configured credentials and returns the go-git
+// AuthMethod to use for cloning remote, or nil if no credentials were
+// configured. It also returns the secrets that it read, so that they
+// can be redacted from anything that we log or report.
+func (ac *authConfig) buildAuth(remote string) (transport.AuthMethod, []string, error) {
+	if ac.wantsPassword() && ac.wantsSSHKey() {
+		return nil, nil, fmt.Errorf("both password and ssh key credentials were specified, but are mutually exclusive")
+	}
+
+	isSSH := isSSHRemote(remote)
+
+	if ac.wantsPassword() {
+		if isSSH {
+			return nil, nil, fmt.Errorf("password credentials can only be used with https urls")
+		}
+		password, err := readSecret("authPassword", ac.passwordFile, ac.passwordEnv)
+		if err != nil {
+			return nil, nil, err
+		}
+		user := ac.user
+		if user == "" {
+			user = "git"
+		}
+		return &http.BasicAuth{Username: user, Password: password}, []string{password}, nil
+	}
+
+	if ac.wantsSSHKey() {
+		if !isSSH {
+			return nil, nil, fmt.Errorf("ssh key credentials can only be used with ssh urls")
+		}
+		key, err := readSecret("sshKey", ac.sshKeyFile, ac.sshKeyEnv)
+		if err != nil {
+			return nil, nil, err
+		}
+		secrets := []string{key}
+		passphrase := ""
+		if ac.sshPassphraseFile != "" || ac.sshPassphraseEnv != "" {
+			passphrase, err = readSecret("sshPassphrase", ac.sshPassphraseFile, ac.sshPassphraseEnv)
+			if err != nil {
+				return nil, nil, err
+			}
+			secrets = append(secrets, passphrase)
+		}
+		user := ac.user
+		if user == "" {
+			user = sshRemoteUser(remote)
+		}
+		pk, err := ssh.NewPublicKeys(user, []byte(key), passphrase)
+		if err != nil {
+			// the error could quote the key, so don't pass it on
+			return nil, nil, fmt.Errorf("couldn't parse ssh key; check that it is a PEM private key and that its passphrase is correct")
+		}
+		if ac.knownHostsFile != "" {
+			pk.HostKeyCallback, err = ssh.NewKnownHostsCallback(ac.knownHostsFile)
+			if err != nil {
+				return nil, nil, fmt.Errorf("couldn't read sshKnownHostsFile %s: %v", ac.knownHostsFile, err)
+			}
+		}
+		return pk, secrets, nil
+	}
+
+	return nil, nil, nil
+}
+
+// readSecret reads a secret from either the file at path fromFile or
+// the environment variable named fromEnv, whichever is set. name is
+// used in error messages, which never include the secret itself.
+func readSecret(name string, fromFile string, fromEnv string) (string, error) {
+	if fromFile != "" && fromEnv != "" {
+		return "", fmt.Errorf("both %sFile and %sEnv were specified, but are mutually exclusive", name, name)
+	}
+
+	var secret string
+	if fromFile != "" {
+		b, err := ioutil.ReadFile(fromFile)
+		if err != nil {
+			return "", fmt.Errorf("couldn't read %sFile %s: %v", name, fromFile, err)
+		}
+		// tokens are often saved with a trailing newline
+		secret = strings.TrimRight(string(b), "\r\n")
+	} else {
+		secret = os.Getenv(fromEnv)
+	}
+
+	if secret == "" {
+		if fromFile != "" {
+			return "", fmt.Errorf("%sFile %s is empty", name, fromFile)
+		}
+		return "", fmt.Errorf("%sEnv variable %s is empty or not set", name, fromEnv)
+	}
+	return secret, nil
+}
+
+// isSSHRemote returns whether remote, which must already have passed
+// validateRemoteURL, is an ssh remote.
+func isSSHRemote(remote string) bool {
+	return strings.HasPrefix(remote, "ssh://") || !strings.Contains(remote, "://")
+}
+
+// sshRemoteUser returns the user name given in the ssh remote, or
+// "git" if there isn't one.
+func sshRemoteUser(remote string) string {
+	if strings.HasPrefix(remote, "ssh://") {
+		if u, err := url.Parse(remote); err == nil && u.User != nil && u.User.Username() != "" {
+			return u.User.Username()
+		}
+		return "git"
+	}
+	if m := scpRemoteRe.FindStringSubmatch(remote); m != nil && m[1] != "" {
+		return m[1]
+	}
+	return "git"
+}
+
+// submoduleAuth returns the credentials to retrieve submodule sub
+// with, given that its superproject came from parent using auth. Both
+// must already have passed validateRemoteURL. A submodule only gets
+// the superproject's credentials if it is on the same host, reached
+// the same way, so that a .gitmodules entry pointing elsewhere can't
+// collect them.
+func submoduleAuth(parent string, sub string, auth transport.AuthMethod) transport.AuthMethod {
+	if auth == nil {
+		return nil
+	}
+	ps, ph := remoteSchemeAndHost(parent)
+	ss, sh := remoteSchemeAndHost(sub)
+	if ps == "" || ps != ss || ph != sh {
+		return nil
+	}
+	return auth
+}
+
+// remoteSchemeAndHost returns the scheme and host, including any port,
+// of remote, which must already have passed validateRemoteURL. scp-like
+// remotes have the scheme "ssh". It returns empty strings if remote
+// can't be parsed.
+func remoteSchemeAndHost(remote string) (string, string) {
+	if !strings.Contains(remote, "://") {
+		if m := scpRemoteRe.FindStringSubmatch(remote); m != nil {
+			return "ssh", strings.ToLower(m[2])
+		}
+		return "", ""
+	}
+	u, err := url.Parse(remote)
+	if err != nil {
+		return "", ""
+	}
+	return u.Scheme, strings.ToLower(u.Host)
+}
+
+// redactor replaces secrets in strings that might be logged or reported.
+type redactor struct {
+	secrets []string
+}
+
+// redact returns s with any secrets replaced.
+func (rd *redactor) redact(s string) string {
+	for _, secret := range rd.secrets {
+		if secret != "" {
+			s = strings.Replace(s, secret, "[REDACTED]", -1)
+		}
+	}
+	return s
+}
+
+// logf logs a message like log.Printf, with any secrets replaced.
+func (rd *redactor) logf(format string, v ...interface{}) {
+	log.Print(rd.redact(fmt.Sprintf(format, v...)))
+}
+
+// redactErr returns err with any secrets in its message replaced.
+func (rd *redactor) redactErr(err error) error {
+	if err == nil {
+		return err
+	}
+	msg := rd.redact(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return fmt.Errorf("%s", msg)
+}
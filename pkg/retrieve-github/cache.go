@@ -0,0 +1,433 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+const (
+	// cacheDirEnv names the environment variable that turns on the
+	// mirror cache, by giving the directory to keep it in.
+	cacheDirEnv = "RETRIEVE_GITHUB_CACHE_DIR"
+
+	// cacheMaxSizeEnv names the environment variable that limits the
+	// total size of the mirror cache, such as "500M" or "20G". If it
+	// isn't set, the cache can grow without limit.
+	cacheMaxSizeEnv = "RETRIEVE_GITHUB_CACHE_MAX_SIZE"
+
+	// lockPollInterval is how often we check whether a mirror that
+	// another job is using has become free.
+	lockPollInterval = 250 * time.Millisecond
+)
+
+// mirrorCache keeps a bare mirror of each repository that the agent
+// retrieves, so that later jobs for the same repository only need to
+// fetch what has changed since. Each mirror is named after a hash of
+// its remote URL, and has a lock file alongside it that a job holds
+// while fetching into or exporting from the mirror, so that jobs
+// running at the same time, in this agent or in another one sharing
+// the directory, don't step on each other.
+//
+// Retrieving from the cache exports the requested commit's files into
+// codeOutputDir, without a .git directory of its own. The depth and
+// singleBranch options don't apply, since the mirror always has the
+// full history; submoduleRecursion does, and submodules are mirrored
+// in the cache too.
+//
+// When the cache grows past its maximum size, the least recently used
+// mirrors that aren't in use are removed.
+//
+// The locks are only shared between processes on platforms with
+// flock(2); elsewhere, they only keep apart the jobs of one agent, so
+// agents there mustn't share a cache directory.
+type mirrorCache struct {
+	dir      string
+	maxBytes int64
+}
+
+// newMirrorCacheFromEnv returns the mirrorCache that the agent's
+// environment configures, or nil if it doesn't configure one.
+func newMirrorCacheFromEnv() (*mirrorCache, error) {
+	dir := os.Getenv(cacheDirEnv)
+	if dir == "" {
+		return nil, nil
+	}
+	mc := &mirrorCache{dir: dir}
+	if s := os.Getenv(cacheMaxSizeEnv); s != "" {
+		n, err := parseSize(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %v", cacheMaxSizeEnv, s, err)
+		}
+		mc.maxBytes = n
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("couldn't create cache directory %s: %v", dir, err)
+	}
+	return mc, nil
+}
+
+// parseSize parses a size in bytes, optionally followed by K, M, G or
+// T for multiples of 1024.
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		mult = 1 << 10
+	case "M":
+		mult = 1 << 20
+	case "G":
+		mult = 1 << 30
+	case "T":
+		mult = 1 << 40
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("must be a non-negative number of bytes, optionally followed by K, M, G or T")
+	}
+	return n * mult, nil
+}
+
+// mirrorName returns the name of the mirror for remote, and of its
+// lock file without the ".lock" suffix.
+func mirrorName(remote string) string {
+	sum := sha256.Sum256([]byte(remote))
+	return hex.EncodeToString(sum[:16])
+}
+
+// retrieve brings the mirror of remote up to date, and exports into dir
+// either commit, or refName, or if neither is set, the remote's default
+// branch, along with submodules up to submoduleRecursion levels deep.
+// It returns the hash of the commit that was exported, and the
+// provenance of the submodules exported with it. If sv isn't nil, it
+// checks the signature of what was exported, but not of submodules.
+// Submodules only get auth if submoduleAuth allows it.
+func (mc *mirrorCache) retrieve(ctx context.Context, dir string, remote string, auth transport.AuthMethod, commit string, refName plumbing.ReferenceName, submoduleRecursion git.SubmoduleRescursivity, sv *sigVerifier, cp *cloneProgress) (plumbing.Hash, []agentkit.SubmoduleProvenance, error) {
+	h, links, err := mc.exportFromMirror(ctx, dir, remote, auth, commit, refName, sv, cp)
+	// now that we're done with the mirror, make room for it if the
+	// cache has grown too big
+	mc.evict(mirrorName(remote))
+	if err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+
+	// submodules are retrieved after we've let go of the parent's
+	// mirror, so that a repository that is its own submodule can't
+	// deadlock waiting for itself
+	subs := []agentkit.SubmoduleProvenance{}
+	if submoduleRecursion == 0 {
+		return h, subs, nil
+	}
+	for _, link := range links {
+		if link.url == "" {
+			log.Printf("==> submodule %s at %s isn't in .gitmodules; skipping it", link.path, link.hash)
+			continue
+		}
+		subURL, err := resolveSubmoduleURL(remote, link.url)
+		if err != nil {
+			return plumbing.ZeroHash, nil, fmt.Errorf("invalid url for submodule %s: %v", link.path, err)
+		}
+		subAuth := submoduleAuth(remote, subURL, auth)
+		_, nested, err := mc.retrieve(ctx, filepath.Join(dir, filepath.FromSlash(link.path)), subURL, subAuth, link.hash.String(), "", submoduleRecursion-1, nil, cp)
+		if err != nil {
+			return plumbing.ZeroHash, nil, fmt.Errorf("couldn't retrieve submodule %s: %v", link.path, err)
+		}
+		subs = append(subs, agentkit.SubmoduleProvenance{
+			Path:   link.path,
+			URL:    subURL,
+			Commit: link.hash.String(),
+		})
+		for _, n := range nested {
+			n.Path = path.Join(link.path, n.Path)
+			subs = append(subs, n)
+		}
+	}
+	return h, subs, nil
+}
+
+// exportFromMirror does the part of retrieve that needs the mirror of
+// remote to be locked: updating it, finding the commit and exporting
+// it. It returns the submodules that the commit refers to.
+func (mc *mirrorCache) exportFromMirror(ctx context.Context, dir string, remote string, auth transport.AuthMethod, commit string, refName plumbing.ReferenceName, sv *sigVerifier, cp *cloneProgress) (plumbing.Hash, []gitlink, error) {
+	name := mirrorName(remote)
+	lock, err := lockFile(ctx, filepath.Join(mc.dir, name+".lock"))
+	if err != nil {
+		return plumbing.ZeroHash, nil, fmt.Errorf("couldn't lock cached mirror of %s: %v", remote, err)
+	}
+	defer unlockFile(lock)
+
+	mirrorPath := filepath.Join(mc.dir, name+".git")
+	r, err := openMirror(mirrorPath, remote)
+	if err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+	// mark the mirror as recently used, for eviction
+	now := time.Now()
+	if err := os.Chtimes(mirrorPath, now, now); err != nil {
+		log.Printf("==> couldn't update time of cached mirror %s: %v", mirrorPath, err)
+	}
+
+	// if we already have the commit that was asked for, there's no need
+	// to fetch at all
+	var h plumbing.Hash
+	if commit != "" {
+		h, err = resolveCommit(r, commit)
+		if err == nil {
+			log.Printf("==> found commit %s in cached mirror of %s", h, remote)
+		}
+	}
+	if h.IsZero() {
+		h, err = updateMirror(ctx, r, mirrorPath, remote, auth, commit, refName, cp)
+		if err != nil {
+			return plumbing.ZeroHash, nil, err
+		}
+	}
+
+	if err := sv.check(r, refName, h); err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+	cp.setPhaseDone("checking out")
+	links, err := exportCommit(ctx, r, h, dir)
+	if err != nil {
+		return plumbing.ZeroHash, nil, fmt.Errorf("failed to check out commit %s from %s: %v", h, remote, err)
+	}
+	return h, links, nil
+}
+
+// openMirror opens the bare mirror of remote at path, creating it if
+// it doesn't exist yet, or if it can't be opened.
+func openMirror(path string, remote string) (*git.Repository, error) {
+	r, err := git.PlainOpen(path)
+	if err == nil {
+		return r, nil
+	}
+	if err != git.ErrRepositoryNotExists {
+		log.Printf("==> couldn't open cached mirror %s, so recreating it: %v", path, err)
+		if err := os.RemoveAll(path); err != nil {
+			return nil, fmt.Errorf("couldn't remove broken cached mirror %s: %v", path, err)
+		}
+	}
+
+	r, err = git.PlainInit(path, true)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create cached mirror %s: %v", path, err)
+	}
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name:  git.DefaultRemoteName,
+		URLs:  []string{remote},
+		Fetch: []config.RefSpec{"+refs/*:refs/*"},
+	})
+	if err != nil {
+		os.RemoveAll(path)
+		return nil, fmt.Errorf("couldn't configure cached mirror %s: %v", path, err)
+	}
+	return r, nil
+}
+
+// updateMirror fetches whatever has changed on remote into the mirror
+// r, and then finds the commit that was asked for.
+func updateMirror(ctx context.Context, r *git.Repository, mirrorPath string, remote string, auth transport.AuthMethod, commit string, refName plumbing.ReferenceName, cp *cloneProgress) (plumbing.Hash, error) {
+	// list the remote's refs first, to check that any branch, tag or
+	// ref that was asked for exists, and to find its default branch
+	cp.setPhaseDone("listing refs")
+	refs, err := listRemoteRefs(remote, auth)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if refName != "" {
+		if _, err := findRemoteRef(refs, refName, remote); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		cp.watchBytes(watchCtx, mirrorPath, time.Second)
+	}()
+	err = r.FetchContext(ctx, &git.FetchOptions{
+		Progress: cp,
+		Auth:     auth,
+		Tags:     git.NoTags,
+	})
+	stopWatching()
+	<-watchDone
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return plumbing.ZeroHash, fmt.Errorf("failed to fetch %s into cached mirror: %v", remote, err)
+	}
+
+	// keep the mirror's HEAD pointing where the remote's does
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD {
+			if err := r.Storer.SetReference(ref); err != nil {
+				return plumbing.ZeroHash, fmt.Errorf("couldn't set HEAD of cached mirror: %v", err)
+			}
+		}
+	}
+
+	switch {
+	case commit != "":
+		h, err := resolveCommit(r, commit)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("can't check out commit from %s: %v", remote, err)
+		}
+		return h, nil
+	case refName != "":
+		ref, err := r.Reference(refName, true)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("can't find %s in cached mirror of %s: %v", refName, remote, err)
+		}
+		return peelToCommit(r, ref.Hash())
+	default:
+		head, err := r.Head()
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("can't get HEAD of cached mirror of %s: %v", remote, err)
+		}
+		return head.Hash(), nil
+	}
+}
+
+// evict removes the least recently used mirrors, other than keep, until
+// the cache is no bigger than its maximum size. Mirrors that another
+// job has locked are left alone.
+func (mc *mirrorCache) evict(keep string) {
+	if mc.maxBytes <= 0 {
+		return
+	}
+
+	type mirror struct {
+		name string
+		used time.Time
+		size int64
+	}
+	fis, err := ioutil.ReadDir(mc.dir)
+	if err != nil {
+		log.Printf("==> couldn't list cache directory %s: %v", mc.dir, err)
+		return
+	}
+	mirrors := []mirror{}
+	var total int64
+	for _, fi := range fis {
+		if !fi.IsDir() || !strings.HasSuffix(fi.Name(), ".git") {
+			continue
+		}
+		m := mirror{
+			name: strings.TrimSuffix(fi.Name(), ".git"),
+			used: fi.ModTime(),
+			size: dirSize(filepath.Join(mc.dir, fi.Name())),
+		}
+		mirrors = append(mirrors, m)
+		total += m.size
+	}
+
+	// oldest first
+	sort.Slice(mirrors, func(i, j int) bool {
+		return mirrors[i].used.Before(mirrors[j].used)
+	})
+	for _, m := range mirrors {
+		if total <= mc.maxBytes {
+			return
+		}
+		if m.name == keep {
+			continue
+		}
+		lock, err := tryLockFile(filepath.Join(mc.dir, m.name+".lock"))
+		if err != nil {
+			// in use, or we can't tell; either way leave it be
+			continue
+		}
+		// the lock file itself stays, since another job might be
+		// waiting on it
+		path := filepath.Join(mc.dir, m.name+".git")
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("==> couldn't evict cached mirror %s: %v", path, err)
+		} else {
+			log.Printf("==> evicted cached mirror %s (%d bytes)", path, m.size)
+			total -= m.size
+		}
+		unlockFile(lock)
+	}
+	if total > mc.maxBytes {
+		log.Printf("==> cache directory %s is still %d bytes, over its limit of %d", mc.dir, total, mc.maxBytes)
+	}
+}
+
+// lockFile takes an exclusive lock on the file at path, creating it if
+// need be, and waiting until any other holder lets go of it or until
+// ctx is done.
+func lockFile(ctx context.Context, path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	logged := false
+	for {
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if ok {
+			return f, nil
+		}
+		if !logged {
+			log.Printf("==> waiting for another job to finish with %s", path)
+			logged = true
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// tryLockFile takes an exclusive lock on the existing file at path,
+// or returns an error if it can't do so straight away.
+func tryLockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := tryLock(f)
+	if err == nil && !ok {
+		err = fmt.Errorf("%s is locked by another job", path)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// unlockFile releases a lock taken by lockFile or tryLockFile.
+func unlockFile(f *os.File) {
+	unlock(f)
+	f.Close()
+}
@@ -0,0 +1,200 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    int64
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"512", 512, false},
+		{"10K", 10 << 10, false},
+		{"500M", 500 << 20, false},
+		{"10G", 10 << 30, false},
+		{"10g", 10 << 30, false},
+		{"2T", 2 << 40, false},
+		{"G", 0, true},
+		{"10GB", 0, true},
+		{"1.5G", 0, true},
+		{"-1", 0, true},
+		{"lots", 0, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.s, func(t *testing.T) {
+			got, err := parseSize(tc.s)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("got %d, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("got %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+// makeMirror makes a stand-in for a cached mirror called name, holding
+// size bytes and last used at the given time, along with its lock file.
+func makeMirror(t *testing.T, dir string, name string, size int, used time.Time) {
+	mirrorPath := filepath.Join(dir, name+".git")
+	if err := os.Mkdir(mirrorPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(mirrorPath, "pack"), make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".lock"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(mirrorPath, used, used); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// cachedMirrors returns the names of the mirrors left in dir.
+func cachedMirrors(t *testing.T, dir string) []string {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, fi := range fis {
+		if strings.HasSuffix(fi.Name(), ".git") {
+			names = append(names, strings.TrimSuffix(fi.Name(), ".git"))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestEvict(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int64
+		keep     string
+		locked   string
+		want     []string
+	}{
+		{"under limit", 400, "", "", []string{"a", "b", "c", "d"}},
+		{"no limit", 0, "", "", []string{"a", "b", "c", "d"}},
+		{"least recently used first", 250, "", "", []string{"c", "d"}},
+		{"keeps keep", 250, "a", "", []string{"a", "d"}},
+		{"skips locked", 250, "a", "b", []string{"a", "b"}},
+		{"everything else", 1, "b", "", []string{"b"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "retrieve-github-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			// a is the least recently used, and d the most
+			start := time.Now().Add(-time.Hour)
+			for i, name := range []string{"a", "b", "c", "d"} {
+				makeMirror(t, dir, name, 100, start.Add(time.Duration(i)*time.Minute))
+			}
+			if tc.locked != "" {
+				lock, err := lockFile(context.Background(), filepath.Join(dir, tc.locked+".lock"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer unlockFile(lock)
+			}
+
+			mc := &mirrorCache{dir: dir, maxBytes: tc.maxBytes}
+			mc.evict(tc.keep)
+			got := cachedMirrors(t, dir)
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("mirrors left = %v, want %v", got, tc.want)
+			}
+			// lock files stay, for jobs that might be waiting on them
+			for _, name := range []string{"a", "b", "c", "d"} {
+				if _, err := os.Stat(filepath.Join(dir, name+".lock")); err != nil {
+					t.Errorf("lock file for %s: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retrieve-github-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mirror.lock")
+
+	first, err := lockFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("first lock: %v", err)
+	}
+	if lock, err := tryLockFile(path); err == nil {
+		unlockFile(lock)
+		t.Fatalf("tryLockFile succeeded while the lock was held")
+	}
+
+	// a second lock gives up when its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 2*lockPollInterval)
+	defer cancel()
+	if lock, err := lockFile(ctx, path); err != context.DeadlineExceeded {
+		if err == nil {
+			unlockFile(lock)
+		}
+		t.Fatalf("second lock with expiring context: got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// and otherwise waits until the first is released
+	type result struct {
+		lock *os.File
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		lock, err := lockFile(context.Background(), path)
+		done <- result{lock, err}
+	}()
+	select {
+	case r := <-done:
+		if r.err == nil {
+			unlockFile(r.lock)
+		}
+		t.Fatalf("second lock returned while the first was held: %v", r.err)
+	case <-time.After(2 * lockPollInterval):
+	}
+	unlockFile(first)
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatalf("second lock after release: %v", r.err)
+		}
+		unlockFile(r.lock)
+	case <-time.After(10 * lockPollInterval):
+		t.Fatalf("second lock still waiting after the first was released")
+	}
+
+	// once that's released too, the lock is free again
+	lock, err := tryLockFile(path)
+	if err != nil {
+		t.Fatalf("tryLockFile after both released: %v", err)
+	}
+	unlockFile(lock)
+}
@@ -0,0 +1,289 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// deepenFactor is how much deeper the second attempt at a shallow clone
+// goes, if the commit that we want wasn't within the requested depth.
+const deepenFactor = 10
+
+// cloneConfig holds the job key/values that control how much of the
+// repository is cloned:
+//
+//   - "depth": clone only this many commits of history from the tip of
+//     each branch; 0 (the default) clones the full history
+//   - "singleBranch": "true" to clone only the requested branch or tag,
+//     or the remote's default branch if none was requested
+//   - "submoduleRecursion": how many levels of nested submodules to
+//     retrieve; 0 skips submodules entirely (default 10)
+//
+// Submodules are always cloned with their full history, since go-git
+// can't clone them shallowly.
+type cloneConfig struct {
+	depth              int
+	singleBranch       bool
+	submoduleRecursion git.SubmoduleRescursivity
+}
+
+// newCloneConfig returns a cloneConfig for a full clone, with
+// submodules, which is what we do if no options are given.
+func newCloneConfig() *cloneConfig {
+	return &cloneConfig{submoduleRecursion: git.DefaultSubmoduleRecursionDepth}
+}
+
+// setFromJkv records the job key/value if it is one of the clone
+// option keys, and returns whether it was. It returns an error if the
+// value isn't valid for that key.
+func (cc *cloneConfig) setFromJkv(key string, value string) (bool, error) {
+	switch key {
+	case "depth":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return true, fmt.Errorf("depth %q is not a non-negative integer", value)
+		}
+		cc.depth = n
+	case "singleBranch":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return true, fmt.Errorf("singleBranch %q is not true or false", value)
+		}
+		cc.singleBranch = b
+	case "submoduleRecursion":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return true, fmt.Errorf("submoduleRecursion %q is not a non-negative integer", value)
+		}
+		cc.submoduleRecursion = git.SubmoduleRescursivity(n)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// cloneAttempt is the depth and branch scope of one try at cloning.
+type cloneAttempt struct {
+	depth        int
+	singleBranch bool
+}
+
+// attempts returns the clones to try, in order, when looking for a
+// particular commit. The first is what was asked for. If that's
+// shallow or limited to one branch, the commit might not be in it, so
+// we then try again deeper and finally with the full repository.
+//
+// We re-clone rather than deepening the existing clone, because go-git
+// doesn't tell the remote where a shallow clone's history stops, so
+// fetching more of it leaves gaps.
+func (cc *cloneConfig) attempts() []cloneAttempt {
+	first := cloneAttempt{depth: cc.depth, singleBranch: cc.singleBranch}
+	full := cloneAttempt{}
+	if first == full {
+		return []cloneAttempt{full}
+	}
+
+	atts := []cloneAttempt{first}
+	if cc.depth > 0 {
+		atts = append(atts, cloneAttempt{depth: cc.depth * deepenFactor, singleBranch: cc.singleBranch})
+	}
+	return append(atts, full)
+}
+
+// cloneRepo clones into dir with the given options, reporting progress
+// through cp as it goes. If the clone fails or is cancelled part-way,
+// go-git removes whatever it had written to the empty dir.
+func cloneRepo(ctx context.Context, dir string, opts *git.CloneOptions, cp *cloneProgress) (*git.Repository, error) {
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		cp.watchBytes(watchCtx, filepath.Join(dir, ".git"), time.Second)
+	}()
+	r, err := git.PlainCloneContext(ctx, dir, false, opts)
+	// the watcher must be finished before we can return, since it
+	// reports through cp's Reporter
+	stopWatching()
+	<-watchDone
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone %s: %v", opts.URL, err)
+	}
+	return r, nil
+}
+
+// cloneAndCheckout clones remote into dir and checks out either commit,
+// or refName, or if neither is set, the remote's default branch. It
+// returns the hash of the commit that was checked out, and the
+// provenance of the submodules that were checked out with it. If sv
+// isn't nil, it checks the signature of what was checked out. Anything
+// logged along the way has rd's secrets replaced.
+func cloneAndCheckout(ctx context.Context, dir string, remote string, auth transport.AuthMethod, commit string, refName plumbing.ReferenceName, cc *cloneConfig, sv *sigVerifier, cp *cloneProgress, rd *redactor) (plumbing.Hash, []agentkit.SubmoduleProvenance, error) {
+	// submodules are retrieved separately once we've checked out the
+	// right commit, so that we can check their URLs first
+	cloneOpts := &git.CloneOptions{
+		URL:      remote,
+		Progress: cp,
+		Auth:     auth,
+	}
+
+	// check that any branch, tag or ref that was asked for exists
+	// before cloning, so that if not, we can say what does exist
+	var remoteRef *plumbing.Reference
+	if refName != "" {
+		cp.setPhaseDone("listing refs")
+		refs, err := listRemoteRefs(remote, auth)
+		if err != nil {
+			return plumbing.ZeroHash, nil, err
+		}
+		remoteRef, err = findRemoteRef(refs, refName, remote)
+		if err != nil {
+			return plumbing.ZeroHash, nil, err
+		}
+		// branches and tags can be cloned directly; other refs are
+		// fetched separately after cloning
+		if refName.IsBranch() || refName.IsTag() {
+			cloneOpts.ReferenceName = refName
+		}
+	}
+
+	// if a particular commit was specified, or a ref that isn't a
+	// branch or tag, we need to work out which commit that is after
+	// cloning. If the clone was shallow or limited to one branch, it
+	// might not be there, in which case we try again with more.
+	var r *git.Repository
+	var h plumbing.Hash
+	var err error
+	for i, att := range cc.attempts() {
+		if i > 0 {
+			rd.logf("==> %v; cloning again with depth %d, single branch %t", err, att.depth, att.singleBranch)
+			agentkit.RemoveDirContents(dir)
+			cp.setPhaseDone("deepening clone")
+		}
+		cloneOpts.Depth = att.depth
+		cloneOpts.SingleBranch = att.singleBranch
+
+		r, err = cloneRepo(ctx, dir, cloneOpts, cp)
+		if err != nil {
+			return plumbing.ZeroHash, nil, err
+		}
+
+		switch {
+		case commit != "":
+			h, err = resolveCommit(r, commit)
+		case remoteRef != nil && !refName.IsBranch() && !refName.IsTag():
+			cp.setPhaseDone("fetching ref")
+			h, err = fetchRef(ctx, r, remoteRef, att.depth, auth)
+		}
+		if err == nil || !errors.Is(err, errCommitNotFound) {
+			break
+		}
+	}
+	if err != nil {
+		if commit != "" {
+			return plumbing.ZeroHash, nil, fmt.Errorf("can't check out commit from %s: %v", remote, err)
+		}
+		return plumbing.ZeroHash, nil, fmt.Errorf("can't check out ref from %s: %v", remote, err)
+	}
+
+	// check that we can get the repo worktree
+	w, err := r.Worktree()
+	if err != nil {
+		// couldn't get the repo worktree; error out
+		return plumbing.ZeroHash, nil, fmt.Errorf("can't get worktree after cloning %s: %v", remote, err)
+	}
+
+	// checking out can't be interrupted, so don't start if we've
+	// already been cancelled or timed out
+	if err := ctx.Err(); err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+
+	// and check it out
+	if !h.IsZero() {
+		cp.setPhaseDone("checking out")
+		err = w.Checkout(&git.CheckoutOptions{
+			Hash:  h,
+			Force: true,
+		})
+		if err != nil {
+			return plumbing.ZeroHash, nil, fmt.Errorf("failed to check out commit %s from %s: %v", h, remote, err)
+		}
+	}
+
+	// along with the submodule commits that it records
+	if err := updateSubmodules(ctx, r, remote, auth, cc.submoduleRecursion); err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+
+	// report exactly which commit we ended up with
+	head, err := r.Head()
+	if err != nil {
+		return plumbing.ZeroHash, nil, fmt.Errorf("can't get HEAD after retrieving %s: %v", remote, err)
+	}
+	if err := sv.check(r, refName, head.Hash()); err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+	subs, err := clonedSubmodules(r, "", remote)
+	if err != nil {
+		return plumbing.ZeroHash, nil, fmt.Errorf("can't list submodules after retrieving %s: %v", remote, err)
+	}
+	return head.Hash(), subs, nil
+}
+
+// updateSubmodules checks out the submodules recorded in r's worktree,
+// which was cloned from remote using auth, and their own submodules in
+// turn, up to recursion levels deep. As when retrieving from the mirror
+// cache, each submodule's URL is checked with resolveSubmoduleURL first,
+// and it only gets auth if submoduleAuth allows it.
+func updateSubmodules(ctx context.Context, r *git.Repository, remote string, auth transport.AuthMethod, recursion git.SubmoduleRescursivity) error {
+	if recursion == 0 {
+		return nil
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return fmt.Errorf("can't get worktree of %s: %v", remote, err)
+	}
+	subs, err := w.Submodules()
+	if err != nil {
+		return fmt.Errorf("can't get submodules of %s: %v", remote, err)
+	}
+
+	for _, sub := range subs {
+		subCfg := sub.Config()
+		subURL, err := resolveSubmoduleURL(remote, subCfg.URL)
+		if err != nil {
+			return fmt.Errorf("invalid url for submodule %s: %v", subCfg.Path, err)
+		}
+		// go-git fetches the submodule from whatever URL its config
+		// has, so make that the one we checked
+		subCfg.URL = subURL
+		subAuth := submoduleAuth(remote, subURL, auth)
+		err = sub.UpdateContext(ctx, &git.SubmoduleUpdateOptions{
+			Init:              true,
+			RecurseSubmodules: git.NoRecurseSubmodules,
+			Auth:              subAuth,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't retrieve submodule %s: %v", subCfg.Path, err)
+		}
+
+		subRepo, err := sub.Repository()
+		if err != nil {
+			return fmt.Errorf("couldn't open submodule %s: %v", subCfg.Path, err)
+		}
+		if err := updateSubmodules(ctx, subRepo, subURL, subAuth, recursion-1); err != nil {
+			return fmt.Errorf("in submodule %s: %v", subCfg.Path, err)
+		}
+	}
+	return nil
+}
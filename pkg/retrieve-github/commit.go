@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// commitRe matches a full or abbreviated commit hash. As with git
+// itself, abbreviations must be at least four hex digits.
+var commitRe = regexp.MustCompile(`^[0-9a-fA-F]{4,40}$`)
+
+// errCommitNotFound is wrapped by the errors for commits that aren't in
+// the clone, so that callers can tell when cloning more history might
+// help.
+var errCommitNotFound = errors.New("not found")
+
+// isValidCommit returns whether commit looks like a full or
+// abbreviated commit hash.
+func isValidCommit(commit string) bool {
+	return commitRe.MatchString(commit)
+}
+
+// resolveCommit finds the commit in r that the full or abbreviated
+// hash commit refers to. It returns an error if there is no such
+// commit, or if an abbreviated hash matches more than one commit.
+func resolveCommit(r *git.Repository, commit string) (plumbing.Hash, error) {
+	commit = strings.ToLower(commit)
+
+	// full hashes can be looked up directly
+	if len(commit) == 40 {
+		h := plumbing.NewHash(commit)
+		if _, err := r.CommitObject(h); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("commit %s %w: %v", commit, errCommitNotFound, err)
+		}
+		return h, nil
+	}
+
+	// go-git can't resolve abbreviated hashes itself, so look through
+	// all of the commits for ones that match
+	iter, err := r.CommitObjects()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("couldn't list commits to resolve %s: %v", commit, err)
+	}
+	matches := []plumbing.Hash{}
+	err = iter.ForEach(func(c *object.Commit) error {
+		if strings.HasPrefix(c.Hash.String(), commit) {
+			matches = append(matches, c.Hash)
+			// no need to keep looking once we know it's ambiguous
+			if len(matches) > 1 {
+				return storer.ErrStop
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("couldn't list commits to resolve %s: %v", commit, err)
+	}
+
+	switch len(matches) {
+	case 0:
+		return plumbing.ZeroHash, fmt.Errorf("commit %s %w", commit, errCommitNotFound)
+	case 1:
+		return matches[0], nil
+	default:
+		return plumbing.ZeroHash, fmt.Errorf("commit %s is ambiguous: matches %s and %s", commit, matches[0], matches[1])
+	}
+}
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// gitlink is a submodule recorded in a commit's tree: the path it is
+// checked out at, the commit it is pinned to, and the URL that
+// .gitmodules gives for it, if any.
+type gitlink struct {
+	path string
+	hash plumbing.Hash
+	url  string
+}
+
+// exportCommit writes the files in commit h of r into dir, much like
+// "git archive" would, and returns the submodules that it refers to.
+// Submodule directories are created, but left empty.
+func exportCommit(ctx context.Context, r *git.Repository, h plumbing.Hash, dir string) ([]gitlink, error) {
+	c, err := r.CommitObject(h)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	links := []gitlink{}
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// git itself refuses to check out trees like these, since they
+		// could write outside dir or into a .git directory
+		if !isSafeTreePath(name) {
+			return nil, fmt.Errorf("tree contains unsafe path %q", name)
+		}
+		p := filepath.Join(dir, filepath.FromSlash(name))
+
+		switch entry.Mode {
+		case filemode.Dir:
+			err = os.MkdirAll(p, 0755)
+		case filemode.Regular, filemode.Deprecated:
+			err = writeBlob(r, entry.Hash, p, 0644)
+		case filemode.Executable:
+			err = writeBlob(r, entry.Hash, p, 0755)
+		case filemode.Symlink:
+			err = writeSymlink(r, entry.Hash, p)
+		case filemode.Submodule:
+			err = os.MkdirAll(p, 0755)
+			links = append(links, gitlink{path: name, hash: entry.Hash})
+		default:
+			err = fmt.Errorf("unsupported file mode %s", entry.Mode)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't write %s: %v", name, err)
+		}
+	}
+
+	if len(links) > 0 {
+		if err := addSubmoduleURLs(tree, links); err != nil {
+			return nil, err
+		}
+	}
+	return links, nil
+}
+
+// isSafeTreePath returns whether name, a slash-separated path from a
+// git tree, stays within the directory it is written to and avoids any
+// .git directory.
+func isSafeTreePath(name string) bool {
+	if name == "" || strings.HasPrefix(name, "/") {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." || strings.EqualFold(part, ".git") {
+			return false
+		}
+	}
+	return true
+}
+
+// writeBlob writes the contents of blob h of r to a new file at p.
+func writeBlob(r *git.Repository, h plumbing.Hash, p string, perm os.FileMode) error {
+	blob, err := r.BlobObject(h)
+	if err != nil {
+		return err
+	}
+	rd, err := blob.Reader()
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, rd); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeSymlink creates a symbolic link at p, to the target that blob h
+// of r holds. Later agents skip symbolic links, so we don't check where
+// the target is.
+func writeSymlink(r *git.Repository, h plumbing.Hash, p string) error {
+	blob, err := r.BlobObject(h)
+	if err != nil {
+		return err
+	}
+	rd, err := blob.Reader()
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	target, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(string(target), p)
+}
+
+// addSubmoduleURLs fills in the URLs of links from the .gitmodules file
+// in tree, if there is one.
+func addSubmoduleURLs(tree *object.Tree, links []gitlink) error {
+	f, err := tree.File(".gitmodules")
+	if err == object.ErrFileNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read .gitmodules: %v", err)
+	}
+	contents, err := f.Contents()
+	if err != nil {
+		return fmt.Errorf("couldn't read .gitmodules: %v", err)
+	}
+	modules := config.NewModules()
+	if err := modules.Unmarshal([]byte(contents)); err != nil {
+		return fmt.Errorf("couldn't parse .gitmodules: %v", err)
+	}
+
+	for i := range links {
+		for _, sub := range modules.Submodules {
+			if sub.Path == links[i].path {
+				links[i].url = sub.URL
+			}
+		}
+	}
+	return nil
+}
+
+// resolveSubmoduleURL returns the URL to retrieve submodule sub from,
+// given that its superproject came from parent. As with git itself,
+// URLs starting with "./" or "../" are relative to the parent's URL.
+func resolveSubmoduleURL(parent string, sub string) (string, error) {
+	if strings.HasPrefix(sub, "./") || strings.HasPrefix(sub, "../") {
+		if strings.Contains(parent, "://") {
+			u, err := url.Parse(parent)
+			if err != nil {
+				return "", err
+			}
+			u.Path = path.Join(u.Path, sub)
+			sub = u.String()
+		} else if m := scpRemoteRe.FindStringSubmatch(parent); m != nil {
+			sub = strings.TrimSuffix(parent, m[3]) + path.Join(m[3], sub)
+		}
+	}
+	if err := validateRemoteURL(sub); err != nil {
+		return "", err
+	}
+	// like git, don't let a remote repository's submodules read local
+	// repositories
+	if strings.HasPrefix(sub, "file:") && !strings.HasPrefix(parent, "file:") {
+		return "", fmt.Errorf("url %q is a local repository, but its superproject isn't", sub)
+	}
+	return sub, nil
+}
@@ -3,7 +3,10 @@ module github.com/swinslow/peridot-agents/pkg/retrieve-github
 go 1.13
 
 require (
+	github.com/swinslow/peridot-agents/pkg/agentkit v0.0.0
 	github.com/swinslow/peridot-jobrunner v0.0.0-20191124161321-701dbac8170c
-	google.golang.org/grpc v1.25.1
+	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4
 	gopkg.in/src-d/go-git.v4 v4.13.1
 )
+
+replace github.com/swinslow/peridot-agents/pkg/agentkit => ../agentkit
@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Without flock, locks are only held against other jobs in this
+// process, by the lock file's absolute path.
+var (
+	heldMu sync.Mutex
+	held   = map[string]bool{}
+)
+
+// lockKey returns the name that f's lock is held under.
+func lockKey(f *os.File) string {
+	if p, err := filepath.Abs(f.Name()); err == nil {
+		return p
+	}
+	return f.Name()
+}
+
+// tryLock takes an exclusive lock on f if it can do so straight away,
+// and returns whether it did.
+func tryLock(f *os.File) (bool, error) {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	key := lockKey(f)
+	if held[key] {
+		return false, nil
+	}
+	held[key] = true
+	return true, nil
+}
+
+// unlock releases a lock taken by tryLock.
+func unlock(f *os.File) {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	delete(held, lockKey(f))
+}
@@ -3,11 +3,8 @@ package main
 
 import (
 	"log"
-	"net"
 
-	"google.golang.org/grpc"
-
-	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
 )
 
 const (
@@ -15,18 +12,17 @@ const (
 )
 
 func main() {
-	// open a socket for listening
-	lis, err := net.Listen("tcp", port)
+	// set up the mirror cache, if the environment asks for one
+	cache, err := newMirrorCacheFromEnv()
 	if err != nil {
-		log.Fatalf("couldn't open port %v: %v", port, err)
+		log.Fatalf("couldn't set up mirror cache: %v", err)
+	}
+	if cache != nil {
+		log.Printf("using mirror cache in %s", cache.dir)
 	}
 
-	// create and register new GRPC server for agent
-	server := grpc.NewServer()
-	agent.RegisterAgentServer(server, &retrieveGithub{})
-
-	// start grpc server
-	if err := server.Serve(lis); err != nil {
-		log.Fatalf("couldn't start server: %v", err)
+	// serve jobs until we're asked to shut down
+	if err := agentkit.Serve(port, &retrieveGithub{cache: cache}); err != nil {
+		log.Fatal(err)
 	}
 }
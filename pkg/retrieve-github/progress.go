@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+)
+
+// cloneProgress turns the progress output that go-git relays from the
+// remote, such as "Counting objects:  40% (2/5)", into agentkit.Progress
+// reports. It also tracks how many bytes of packfile have been written
+// to the clone so far, since go-git doesn't report that itself.
+type cloneProgress struct {
+	rpt agentkit.Reporter
+
+	mu      sync.Mutex
+	partial string
+	p       agentkit.Progress
+}
+
+var (
+	// e.g. "Compressing objects:  66% (2/3)"
+	progressCountRe = regexp.MustCompile(`^([A-Za-z][A-Za-z ]*):\s+(?:\d+%\s+)?\((\d+)/(\d+)\)`)
+	// e.g. "Enumerating objects: 5, done."
+	progressTotalRe = regexp.MustCompile(`^([A-Za-z][A-Za-z ]*):\s+(\d+)`)
+)
+
+func newCloneProgress(rpt agentkit.Reporter) *cloneProgress {
+	return &cloneProgress{
+		rpt: rpt,
+		p:   agentkit.Progress{Phase: "cloning"},
+	}
+}
+
+// Write implements io.Writer, so that a cloneProgress can be used as
+// go-git's CloneOptions.Progress. The remote separates lines with
+// either "\r" or "\n".
+func (cp *cloneProgress) Write(b []byte) (int, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	cp.partial += string(b)
+	lines := strings.FieldsFunc(cp.partial, func(r rune) bool {
+		return r == '\r' || r == '\n'
+	})
+	// hang on to the last line if it isn't finished yet
+	if !strings.HasSuffix(cp.partial, "\r") && !strings.HasSuffix(cp.partial, "\n") && len(lines) > 0 {
+		cp.partial = lines[len(lines)-1]
+		lines = lines[:len(lines)-1]
+	} else {
+		cp.partial = ""
+	}
+
+	changed := false
+	for _, line := range lines {
+		if cp.parseLine(strings.TrimSpace(line)) {
+			changed = true
+		}
+	}
+	if changed {
+		cp.rpt.Progress(cp.p)
+	}
+
+	return len(b), nil
+}
+
+// parseLine updates the current progress from one line of remote
+// output, and returns whether it recognised the line.
+func (cp *cloneProgress) parseLine(line string) bool {
+	if m := progressCountRe.FindStringSubmatch(line); m != nil {
+		cp.setPhase(m[1])
+		cp.p.Done, _ = strconv.ParseInt(m[2], 10, 64)
+		cp.p.Total, _ = strconv.ParseInt(m[3], 10, 64)
+		return true
+	}
+	if m := progressTotalRe.FindStringSubmatch(line); m != nil {
+		cp.setPhase(m[1])
+		cp.p.Done, _ = strconv.ParseInt(m[2], 10, 64)
+		cp.p.Total = 0
+		return true
+	}
+	return false
+}
+
+// setPhase sets the phase and unit from a description such as
+// "Counting objects".
+func (cp *cloneProgress) setPhase(desc string) {
+	cp.p.Phase = strings.ToLower(desc)
+	cp.p.Unit = ""
+	if strings.HasSuffix(cp.p.Phase, " objects") {
+		cp.p.Unit = "objects"
+	}
+}
+
+// setPhaseDone moves on to a new phase that go-git doesn't describe
+// itself, such as checking out the working tree.
+func (cp *cloneProgress) setPhaseDone(phase string) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	cp.p.Phase = phase
+	cp.p.Done = 0
+	cp.p.Total = 0
+	cp.p.Unit = ""
+	cp.rpt.Progress(cp.p)
+}
+
+// watchBytes reports the size of the packfiles under gitDir every
+// interval, until ctx is done.
+func (cp *cloneProgress) watchBytes(ctx context.Context, gitDir string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n := dirSize(filepath.Join(gitDir, "objects", "pack"))
+			cp.mu.Lock()
+			if n != cp.p.Bytes {
+				cp.p.Bytes = n
+				cp.rpt.Progress(cp.p)
+			}
+			cp.mu.Unlock()
+		}
+	}
+}
+
+// dirSize returns the total size of the regular files in dir and its
+// subdirectories. Errors are ignored, since files come and go while
+// a clone is in progress.
+func dirSize(dir string) int64 {
+	var n int64
+	filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			n += fi.Size()
+		}
+		return nil
+	})
+	return n
+}
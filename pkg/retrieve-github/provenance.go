@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// gitDownloadLocation returns the SPDX PackageDownloadLocation for
+// commit h of remote, which must already have passed validateRemoteURL,
+// such as "git+https://github.com/org/repo.git@<commit>".
+func gitDownloadLocation(remote string, h plumbing.Hash) string {
+	loc := remote
+	// SPDX wants a URL, so turn scp-like remotes into ssh:// ones
+	if !strings.Contains(remote, "://") {
+		if m := scpRemoteRe.FindStringSubmatch(remote); m != nil {
+			user := ""
+			if m[1] != "" {
+				user = m[1] + "@"
+			}
+			loc = fmt.Sprintf("ssh://%s%s/%s", user, m[2], m[3])
+		}
+	}
+	return fmt.Sprintf("git+%s@%s", loc, h)
+}
+
+// newProvenance returns the provenance record for commit h of remote,
+// retrieved as refName if that isn't empty, along with subs.
+func newProvenance(remote string, refName plumbing.ReferenceName, h plumbing.Hash, subs []agentkit.SubmoduleProvenance) *agentkit.Provenance {
+	p := &agentkit.Provenance{
+		Agent:            "retrieve-github",
+		Name:             repoName(remote),
+		URL:              remote,
+		DownloadLocation: gitDownloadLocation(remote, h),
+		Version:          h.String(),
+		Ref:              refName.String(),
+		Commit:           h.String(),
+		Submodules:       subs,
+		RetrievedAt:      time.Now().UTC().Truncate(time.Second),
+	}
+	// a tag names the version better than a hash does
+	if refName.IsTag() {
+		p.Version = refName.Short()
+	}
+	sort.Slice(p.Submodules, func(i, j int) bool {
+		return p.Submodules[i].Path < p.Submodules[j].Path
+	})
+	return p
+}
+
+// repoName returns the name of the repository at remote, which is the
+// last part of its path without any ".git" suffix.
+func repoName(remote string) string {
+	return strings.TrimSuffix(path.Base(strings.TrimSuffix(remote, "/")), ".git")
+}
+
+// clonedSubmodules returns the provenance of the submodules that have
+// been checked out in r, and in their own submodules in turn. prefix
+// is r's path within the top-level clone, and remote is its URL.
+func clonedSubmodules(r *git.Repository, prefix string, remote string) ([]agentkit.SubmoduleProvenance, error) {
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	subs, err := w.Submodules()
+	if err != nil {
+		return nil, err
+	}
+
+	provs := []agentkit.SubmoduleProvenance{}
+	for _, sub := range subs {
+		st, err := sub.Status()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get status of submodule %s: %v", sub.Config().Path, err)
+		}
+		// submodules past the recursion depth aren't checked out
+		if st.Current.IsZero() {
+			continue
+		}
+
+		subPath := path.Join(prefix, sub.Config().Path)
+		subURL, err := resolveSubmoduleURL(remote, sub.Config().URL)
+		if err != nil {
+			// go-git cloned it anyway, so record the URL as given
+			subURL = sub.Config().URL
+		}
+		provs = append(provs, agentkit.SubmoduleProvenance{
+			Path:   subPath,
+			URL:    subURL,
+			Commit: st.Current.String(),
+		})
+
+		subRepo, err := sub.Repository()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't open submodule %s: %v", subPath, err)
+		}
+		nested, err := clonedSubmodules(subRepo, subPath, subURL)
+		if err != nil {
+			return nil, err
+		}
+		provs = append(provs, nested...)
+	}
+	return provs, nil
+}
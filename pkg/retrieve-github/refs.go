@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// refNameRe matches the branch, tag and ref names that we accept. It is
+// stricter than git itself, but allows everything that is used in
+// practice, such as "v1.2.3", "release/1.x" or "refs/pull/123/head".
+var refNameRe = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_./+-]*$`)
+
+// maxRefsListed limits how many alternatives are listed when a
+// requested branch, tag or ref isn't found.
+const maxRefsListed = 20
+
+// isValidRefName returns whether name is acceptable as a branch or tag
+// name, or (if it starts with "refs/") as a full ref name.
+func isValidRefName(name string) bool {
+	return refNameRe.MatchString(name) &&
+		!strings.Contains(name, "..") &&
+		!strings.Contains(name, "//") &&
+		!strings.HasSuffix(name, "/") &&
+		!strings.HasSuffix(name, ".lock")
+}
+
+// listRemoteRefs returns the references that the remote advertises.
+func listRemoteRefs(remote string, auth transport.AuthMethod) ([]*plumbing.Reference, error) {
+	rem := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{remote},
+	})
+	refs, err := rem.List(&git.ListOptions{Auth: auth})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't list refs for %s: %v", remote, err)
+	}
+	return refs, nil
+}
+
+// findRemoteRef returns the reference called name from refs. If there
+// isn't one, the error lists the branches and tags that the remote
+// does have.
+func findRemoteRef(refs []*plumbing.Reference, name plumbing.ReferenceName, remote string) (*plumbing.Reference, error) {
+	for _, ref := range refs {
+		if ref.Name() == name {
+			return ref, nil
+		}
+	}
+
+	var what string
+	switch {
+	case name.IsBranch():
+		what = fmt.Sprintf("branch %s", name.Short())
+	case name.IsTag():
+		what = fmt.Sprintf("tag %s", name.Short())
+	default:
+		what = fmt.Sprintf("ref %s", name)
+	}
+	return nil, fmt.Errorf("%s not found in %s; available branches: %s; available tags: %s",
+		what, remote, describeRefs(refs, "refs/heads/"), describeRefs(refs, "refs/tags/"))
+}
+
+// describeRefs lists the short names of the refs that start with
+// prefix, for use in error messages.
+func describeRefs(refs []*plumbing.Reference, prefix string) string {
+	names := []string{}
+	for _, ref := range refs {
+		if strings.HasPrefix(ref.Name().String(), prefix) {
+			names = append(names, strings.TrimPrefix(ref.Name().String(), prefix))
+		}
+	}
+	if len(names) == 0 {
+		return "(none)"
+	}
+	sort.Strings(names)
+	if len(names) > maxRefsListed {
+		return fmt.Sprintf("%s and %d more", strings.Join(names[:maxRefsListed], ", "), len(names)-maxRefsListed)
+	}
+	return strings.Join(names, ", ")
+}
+
+// fetchRef fetches remoteRef, which need not be a branch or tag, into
+// the cloned repository r under the same name, and returns the hash
+// of the commit that it points to. depth limits the history fetched,
+// as for a shallow clone; 0 fetches all of it.
+func fetchRef(ctx context.Context, r *git.Repository, remoteRef *plumbing.Reference, depth int, auth transport.AuthMethod) (plumbing.Hash, error) {
+	name := remoteRef.Name().String()
+	err := r.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec("+" + name + ":" + name)},
+		Depth:    depth,
+		Auth:     auth,
+		Tags:     git.NoTags,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return plumbing.ZeroHash, fmt.Errorf("couldn't fetch ref %s: %v", name, err)
+	}
+	return peelToCommit(r, remoteRef.Hash())
+}
+
+// peelToCommit returns h if it is a commit, or the commit that it
+// points to if it is an annotated tag.
+func peelToCommit(r *git.Repository, h plumbing.Hash) (plumbing.Hash, error) {
+	if _, err := r.CommitObject(h); err == nil {
+		return h, nil
+	}
+	// a fetch into a shallow clone can leave out objects that the
+	// remote thinks we already have
+	if _, err := r.Object(plumbing.AnyObject, h); err == plumbing.ErrObjectNotFound {
+		return plumbing.ZeroHash, fmt.Errorf("commit %s %w", h, errCommitNotFound)
+	}
+	tag, err := r.TagObject(h)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("%s is neither a commit nor a tag", h)
+	}
+	c, err := tag.Commit()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("tag %s does not point to a commit: %v", tag.Name, err)
+	}
+	return c.Hash, nil
+}
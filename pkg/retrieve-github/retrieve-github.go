@@ -3,58 +3,62 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os"
-	"time"
+	"strconv"
+	"strings"
 
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
 	"github.com/swinslow/peridot-jobrunner/pkg/agent"
-	"github.com/swinslow/peridot-jobrunner/pkg/status"
-	git "gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 )
 
-// setStatusError is a helper function to send a statusUpdate
-// to the setStatus channel with ERROR status, and with the specified
-// error message.
-func setStatusError(setStatus chan<- statusUpdate, msg string) {
-	setStatus <- statusUpdate{
-		run:       status.Status_STOPPED,
-		health:    status.Health_ERROR,
-		now:       time.Now(),
-		outputMsg: msg,
-	}
+type retrieveGithub struct {
+	// cache is where bare mirrors of the repositories that we retrieve
+	// are kept, or nil if the agent isn't configured to use one
+	cache *mirrorCache
 }
 
-func getURLToRepo(org string, repo string) string {
-	// FIXME check for e.g. no slashes or problematic chars in org or repo!
-	// FIXME perhaps use path.Join, except not clear yet how to use it with two slashes
-	// FIXME for protocol name
-	return "https://github.com/" + org + "/" + repo + ".git"
+// Run is the function that actually carries out the substantive
+// action of the agent, for this job.
+func (ag *retrieveGithub) Run(ctx context.Context, cfg agent.JobConfig, rpt agentkit.Reporter) error {
+	// make sure no credentials make it into the job's final status
+	rd := &redactor{}
+	err := ag.retrieve(ctx, cfg, rpt, rd)
+	return rd.redactErr(err)
 }
 
-// runAgent is the function that actually carries out the substantive
-// action of the agent, for this job. It does not do any gRPC communication
-// itself, but instead uses signals back to the separate sender goroutine
-// to set job status information.
-func (ag *retrieveGithub) runAgent(
-	ctx context.Context,
-	cfg agent.JobConfig,
-	setStatus chan<- statusUpdate,
-) {
-	defer log.Printf("==> CLOSING runAgent")
-
-	// now that we exist, we own setStatus and are responsible for
-	// closing it when we are done
-	defer close(setStatus)
-
-	// make sure we've got the config values we need
+// retrieve carries out the job for Run. It adds any credentials that
+// it reads to rd, so that Run can redact them from the result.
+func (ag *retrieveGithub) retrieve(ctx context.Context, cfg agent.JobConfig, rpt agentkit.Reporter, rd *redactor) error {
+	// make sure we've got the config values we need: either a url,
+	// or an org and repo on github.com
+	srcURL := ""
 	org := ""
 	repo := ""
 	branch := ""
 	commit := ""
+	tag := ""
+	ref := ""
+	useCache := true
+	verifyMode := ""
+	keyringFile := ""
+	ac := &authConfig{}
+	cc := newCloneConfig()
 
 	for _, jkv := range cfg.Jkvs {
+		if ac.setFromJkv(jkv.Key, jkv.Value) {
+			continue
+		}
+		if ok, err := cc.setFromJkv(jkv.Key, jkv.Value); ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if jkv.Key == "url" {
+			srcURL = jkv.Value
+		}
 		if jkv.Key == "org" {
 			org = jkv.Value
 		}
@@ -67,104 +71,170 @@ func (ag *retrieveGithub) runAgent(
 		if jkv.Key == "branch" {
 			branch = jkv.Value
 		}
+		if jkv.Key == "tag" {
+			tag = jkv.Value
+		}
+		if jkv.Key == "ref" {
+			ref = jkv.Value
+		}
+		if jkv.Key == "verifySignature" {
+			verifyMode = jkv.Value
+		}
+		if jkv.Key == "keyringFile" {
+			keyringFile = jkv.Value
+		}
+		if jkv.Key == "useCache" {
+			b, err := strconv.ParseBool(jkv.Value)
+			if err != nil {
+				return fmt.Errorf("useCache %q is not true or false", jkv.Value)
+			}
+			useCache = b
+		}
 	}
 
-	errorMsg := ""
-	if org == "" {
-		errorMsg += "org key/value not specified"
-	}
-	if repo == "" {
+	if srcURL != "" {
+		if org != "" || repo != "" {
+			return fmt.Errorf("both url and org/repo were specified, but are mutually exclusive")
+		}
+		if err := validateRemoteURL(srcURL); err != nil {
+			return err
+		}
+	} else {
+		errorMsg := ""
+		if org == "" {
+			errorMsg += "org key/value not specified"
+		}
+		if repo == "" {
+			if errorMsg != "" {
+				errorMsg += "; "
+			}
+			errorMsg += "repo key/value not specified"
+		}
 		if errorMsg != "" {
-			errorMsg += "; "
+			return errors.New(errorMsg)
+		}
+		var err error
+		srcURL, err = getURLToRepo(org, repo)
+		if err != nil {
+			return err
 		}
-		errorMsg += "repo key/value not specified"
-	}
-	if errorMsg != "" {
-		setStatusError(setStatus, errorMsg)
-		return
 	}
 
-	if commit != "" && branch != "" {
-		setStatusError(setStatus, "both commit and branch were specified, but are mutually exclusive")
-		return
+	// read any credentials we need now, so that we don't get as far
+	// as cloning if they're missing
+	auth, secrets, err := ac.buildAuth(srcURL)
+	if err != nil {
+		return err
 	}
+	rd.secrets = append(rd.secrets, secrets...)
 
-	// check that we got a non-empty code output directory
-	if cfg.CodeOutputDir == "" {
-		// we didn't; error out
-		setStatusError(setStatus, "no codeOutputDir specified")
-		return
+	// likewise for the keys to check signatures against
+	sv, err := newSigVerifier(verifyMode, keyringFile)
+	if err != nil {
+		return err
 	}
 
-	// try to create directory at this location
-	err := os.MkdirAll(cfg.CodeOutputDir, os.ModePerm)
-	if err != nil {
-		// we couldn't; error out
-		setStatusError(setStatus, fmt.Sprintf("couldn't create codeOutputDir %s: %v", cfg.CodeOutputDir, err))
-		return
+	// at most one of commit, branch, tag and ref can say which
+	// version to retrieve
+	versionKeys := []string{}
+	for _, kv := range [][2]string{{"commit", commit}, {"branch", branch}, {"tag", tag}, {"ref", ref}} {
+		if kv[1] != "" {
+			versionKeys = append(versionKeys, kv[0])
+		}
+	}
+	if len(versionKeys) > 1 {
+		return fmt.Errorf("only one of commit, branch, tag and ref may be specified, but got %s", strings.Join(versionKeys, " and "))
 	}
 
-	// check whether path exists in filesystem
-	fi, err := os.Stat(cfg.CodeOutputDir)
-	if err != nil {
-		// it doesn't; error out
-		setStatusError(setStatus, fmt.Sprintf("tried to create codeOutputDir %s but path not found: %v", cfg.CodeOutputDir, err))
-		return
+	if commit != "" && !isValidCommit(commit) {
+		return fmt.Errorf("commit %q is not a full or abbreviated commit hash", commit)
+	}
+	if branch != "" && !isValidRefName(branch) {
+		return fmt.Errorf("branch %q is not a valid branch name", branch)
+	}
+	if tag != "" && !isValidRefName(tag) {
+		return fmt.Errorf("tag %q is not a valid tag name", tag)
+	}
+	if ref != "" && (!strings.HasPrefix(ref, "refs/") || !isValidRefName(ref)) {
+		return fmt.Errorf("ref %q is not a valid full ref name, such as refs/pull/123/head", ref)
 	}
 
-	// check whether path is a directory
-	if !fi.IsDir() {
-		// it isn't; error out
-		setStatusError(setStatus, fmt.Sprintf("tried to create codeOutputDir %s but it is not a directory: %v", cfg.CodeOutputDir, err))
-		return
+	// check that we've got an empty directory to clone into
+	if err := agentkit.PrepareCodeOutputDir(cfg.CodeOutputDir); err != nil {
+		return err
 	}
 
 	// // check whether path is writable
 	// if unix.Access(path, unix.W_OK) != nil {
 	// 	// it isn't; error out
-	// 	setStatusError(setStatus, fmt.Sprintf("tried to create codeOutputDir %s but it is not writable: %v", cfg.CodeOutputDir, err))
-	// 	return
+	// 	return fmt.Errorf("tried to create codeOutputDir %s but it is not writable: %v", cfg.CodeOutputDir, err)
 	// }
 
 	// we're all configured; set status as running
-	setStatus <- statusUpdate{run: status.Status_RUNNING}
-
-	// clone the repo
-	srcURL := getURLToRepo(org, repo)
-	cloneOpts := &git.CloneOptions{
-		URL:               srcURL,
-		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
-		Progress:          os.Stdout,
+	rpt.Running()
+
+	// from here on, if we fail, remove anything that we've retrieved
+	// so that later agents don't pick up the wrong version
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			agentkit.RemoveDirContents(cfg.CodeOutputDir)
+		}
+	}()
+
+	var refName plumbing.ReferenceName
+	switch {
+	case branch != "":
+		refName = plumbing.NewBranchReferenceName(branch)
+	case tag != "":
+		refName = plumbing.NewTagReferenceName(tag)
+	case ref != "":
+		refName = plumbing.ReferenceName(ref)
+	}
+
+	// retrieve the repo, passing progress on to the controller as
+	// well as to our own log
+	cp := newCloneProgress(rpt)
+	var h plumbing.Hash
+	var subs []agentkit.SubmoduleProvenance
+	if ag.cache != nil && useCache {
+		h, subs, err = ag.cache.retrieve(ctx, cfg.CodeOutputDir, srcURL, auth, commit, refName, cc.submoduleRecursion, sv, cp)
+	} else {
+		h, subs, err = cloneAndCheckout(ctx, cfg.CodeOutputDir, srcURL, auth, commit, refName, cc, sv, cp, rd)
 	}
-	if branch != "" {
-		cloneOpts.ReferenceName = plumbing.NewBranchReferenceName(branch)
+	if err != nil {
+		return err
 	}
 
-	r, err := git.PlainClone(cfg.CodeOutputDir, false, cloneOpts)
-	if err != nil {
-		// couldn't clone the repo; error out
-		setStatusError(setStatus, fmt.Sprintf("failed to clone %s: %v", srcURL, err))
-		return
+	// an unverified signature only gets this far if we were asked to
+	// warn about it
+	if sv != nil && sv.problem != nil {
+		rpt.Degraded(fmt.Sprintf("signature not verified: %v", sv.problem))
 	}
 
-	// check that we can get the repo worktree
-	w, err := r.Worktree()
-	if err != nil {
-		// couldn't get the repo worktree; error out
-		setStatusError(setStatus, fmt.Sprintf("can't get worktree after cloning %s: %v", srcURL, err))
-		return
+	// record where the code came from, for later agents
+	if cfg.SpdxOutputDir != "" {
+		prov := newProvenance(srcURL, refName, h, subs)
+		if sv != nil {
+			prov.Signer = sv.signer
+		}
+		if err := agentkit.WriteProvenance(cfg.SpdxOutputDir, prov); err != nil {
+			return err
+		}
 	}
 
-	// if a particular commit was specified, check it out
-	if commit != "" {
-		err = w.Checkout(&git.CheckoutOptions{
-			Hash: plumbing.NewHash(commit),
-		})
+	// report exactly which commit we ended up with
+	out := fmt.Sprintf("url: %s", srcURL)
+	if refName != "" {
+		out += fmt.Sprintf("\nref: %s", refName)
 	}
+	out += fmt.Sprintf("\ncommit: %s", h)
+	if sv != nil && sv.signer != "" {
+		out += fmt.Sprintf("\nsigned by: %s", sv.signer)
+	}
+	rpt.Output(out)
 
 	// success!
-	setStatus <- statusUpdate{
-		run: status.Status_STOPPED,
-		now: time.Now(),
-	}
+	succeeded = true
+	return nil
 }
@@ -0,0 +1,520 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// testReporter records what a job reports.
+type testReporter struct {
+	running bool
+	output  []string
+}
+
+func (r *testReporter) Running()                     { r.running = true }
+func (r *testReporter) Output(msg string)            { r.output = append(r.output, msg) }
+func (r *testReporter) Degraded(msg string)          { r.output = append(r.output, msg) }
+func (r *testReporter) Progress(p agentkit.Progress) {}
+
+// testRepo is a bare repository for the tests to retrieve from, over a
+// file:// URL.
+type testRepo struct {
+	dir string
+	url string
+	r   *git.Repository
+}
+
+// newTestRepo creates an empty bare repository in dir.
+func newTestRepo(t *testing.T, dir string) *testRepo {
+	t.Helper()
+	r, err := git.PlainInit(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testRepo{dir: dir, url: "file://" + filepath.ToSlash(dir), r: r}
+}
+
+// commit stores a commit whose tree holds files, and gitlinks to the
+// commits in links, on top of parent if it isn't zero; and points
+// branch at it. Paths can't have directories in them.
+func (tr *testRepo) commit(t *testing.T, branch string, parent plumbing.Hash, files map[string]string, links map[string]plumbing.Hash) plumbing.Hash {
+	t.Helper()
+	tree := &object.Tree{}
+	for name, contents := range files {
+		obj := tr.r.Storer.NewEncodedObject()
+		obj.SetType(plumbing.BlobObject)
+		w, err := obj.Writer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(contents))
+		w.Close()
+		h, err := tr.r.Storer.SetEncodedObject(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: filemode.Regular, Hash: h})
+	}
+	for name, h := range links {
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: filemode.Submodule, Hash: h})
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool { return tree.Entries[i].Name < tree.Entries[j].Name })
+	treeHash := tr.store(t, tree)
+
+	sig := object.Signature{Name: "Test", Email: "test@example.com", When: time.Unix(1500000000, 0)}
+	c := &object.Commit{
+		Author:    sig,
+		Committer: sig,
+		Message:   fmt.Sprintf("commit on %s\n", branch),
+		TreeHash:  treeHash,
+	}
+	if !parent.IsZero() {
+		c.ParentHashes = []plumbing.Hash{parent}
+	}
+	h := tr.store(t, c)
+	tr.setRef(t, plumbing.NewBranchReferenceName(branch), h)
+	return h
+}
+
+// tag points the lightweight tag name at h.
+func (tr *testRepo) tag(t *testing.T, name string, h plumbing.Hash) {
+	t.Helper()
+	tr.setRef(t, plumbing.NewTagReferenceName(name), h)
+}
+
+func (tr *testRepo) setRef(t *testing.T, name plumbing.ReferenceName, h plumbing.Hash) {
+	t.Helper()
+	if err := tr.r.Storer.SetReference(plumbing.NewHashReference(name, h)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (tr *testRepo) store(t *testing.T, o interface {
+	Encode(plumbing.EncodedObject) error
+}) plumbing.Hash {
+	t.Helper()
+	obj := tr.r.Storer.NewEncodedObject()
+	if err := o.Encode(obj); err != nil {
+		t.Fatal(err)
+	}
+	h, err := tr.r.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// testRepos holds the repositories that the tests retrieve: one with a
+// couple of branches and a tag, and one that has another as a
+// submodule.
+type testRepos struct {
+	main   *testRepo
+	first  plumbing.Hash // tagged v1.0
+	second plumbing.Hash // tip of master
+	dev    plumbing.Hash // tip of dev
+	pull   plumbing.Hash // only reachable from refs/pull/1/head
+
+	super   *testRepo
+	superAt plumbing.Hash // tip of master, with sub as lib
+	sub     *testRepo
+	subAt   plumbing.Hash
+}
+
+func newTestRepos(t *testing.T, dir string) *testRepos {
+	t.Helper()
+	trs := &testRepos{}
+
+	trs.main = newTestRepo(t, filepath.Join(dir, "main.git"))
+	trs.first = trs.main.commit(t, "master", plumbing.ZeroHash, map[string]string{"README": "first\n"}, nil)
+	trs.main.tag(t, "v1.0", trs.first)
+	trs.second = trs.main.commit(t, "master", trs.first, map[string]string{"README": "second\n"}, nil)
+	trs.dev = trs.main.commit(t, "dev", trs.first, map[string]string{"README": "first\n", "DEV": "dev\n"}, nil)
+	// like a pull request on GitHub, which isn't on any branch
+	trs.pull = trs.main.commit(t, "pull", trs.second, map[string]string{"README": "pull\n"}, nil)
+	trs.main.setRef(t, "refs/pull/1/head", trs.pull)
+	if err := trs.main.r.Storer.RemoveReference(plumbing.NewBranchReferenceName("pull")); err != nil {
+		t.Fatal(err)
+	}
+
+	trs.sub = newTestRepo(t, filepath.Join(dir, "sub.git"))
+	trs.subAt = trs.sub.commit(t, "master", plumbing.ZeroHash, map[string]string{"LIB": "library\n"}, nil)
+	// a later commit on the submodule's branch that the superproject
+	// doesn't use
+	trs.sub.commit(t, "master", trs.subAt, map[string]string{"LIB": "newer library\n"}, nil)
+
+	trs.super = newTestRepo(t, filepath.Join(dir, "super.git"))
+	gitmodules := fmt.Sprintf("[submodule \"lib\"]\n\tpath = lib\n\turl = %s\n", trs.sub.url)
+	trs.superAt = trs.super.commit(t, "master", plumbing.ZeroHash,
+		map[string]string{"README": "super\n", ".gitmodules": gitmodules},
+		map[string]plumbing.Hash{"lib": trs.subAt})
+	return trs
+}
+
+// readFiles returns the contents of the regular files in dir, by their
+// slash-separated paths, leaving out any .git directories.
+func readFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	got := map[string]string{}
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Name() == ".git" {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.Mode().IsRegular() {
+			rel, _ := filepath.Rel(dir, p)
+			b, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			got[filepath.ToSlash(rel)] = string(b)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+// runJob runs a retrieve-github job with jkvs into a new directory in
+// dir, and returns the directory, the job's output and its error. The
+// job's provenance goes into the directory's name with ".spdx" added.
+func runJob(t *testing.T, ag *retrieveGithub, dir string, jkvs map[string]string) (string, string, error) {
+	t.Helper()
+	codeDir, err := ioutil.TempDir(dir, "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := agent.JobConfig{CodeOutputDir: codeDir, SpdxOutputDir: codeDir + ".spdx"}
+	for k, v := range jkvs {
+		cfg.Jkvs = append(cfg.Jkvs, &agent.JobConfig_JobKV{Key: k, Value: v})
+	}
+	rpt := &testReporter{}
+	err = ag.Run(context.Background(), cfg, rpt)
+	return codeDir, strings.Join(rpt.output, "\n"), err
+}
+
+// needGit skips the test if there's no git binary, which go-git needs
+// for file:// remotes.
+func needGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed, and go-git needs it for file:// remotes")
+	}
+}
+
+func TestRetrieve(t *testing.T) {
+	needGit(t)
+	dir, err := ioutil.TempDir("", "retrieve-github-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	trs := newTestRepos(t, dir)
+
+	tests := []struct {
+		name        string
+		jkvs        map[string]string
+		wantErr     string
+		wantCommit  plumbing.Hash
+		wantRef     string
+		wantVersion string // the commit hash if empty
+		wantSubs    []agentkit.SubmoduleProvenance
+		wantFiles   map[string]string
+	}{
+		{
+			name:       "default branch",
+			jkvs:       map[string]string{"url": trs.main.url},
+			wantCommit: trs.second,
+			wantFiles:  map[string]string{"README": "second\n"},
+		},
+		{
+			name:       "branch",
+			jkvs:       map[string]string{"url": trs.main.url, "branch": "dev"},
+			wantCommit: trs.dev,
+			wantRef:    "refs/heads/dev",
+			wantFiles:  map[string]string{"README": "first\n", "DEV": "dev\n"},
+		},
+		{
+			name:        "tag",
+			jkvs:        map[string]string{"url": trs.main.url, "tag": "v1.0"},
+			wantCommit:  trs.first,
+			wantRef:     "refs/tags/v1.0",
+			wantVersion: "v1.0",
+			wantFiles:   map[string]string{"README": "first\n"},
+		},
+		{
+			name:       "abbreviated commit",
+			jkvs:       map[string]string{"url": trs.main.url, "commit": trs.first.String()[:10]},
+			wantCommit: trs.first,
+			wantFiles:  map[string]string{"README": "first\n"},
+		},
+		{
+			name:       "commit missing from a shallow clone",
+			jkvs:       map[string]string{"url": trs.main.url, "commit": trs.first.String(), "depth": "1", "singleBranch": "true"},
+			wantCommit: trs.first,
+			wantFiles:  map[string]string{"README": "first\n"},
+		},
+		{
+			name:       "pull request ref",
+			jkvs:       map[string]string{"url": trs.main.url, "ref": "refs/pull/1/head"},
+			wantCommit: trs.pull,
+			wantRef:    "refs/pull/1/head",
+			wantFiles:  map[string]string{"README": "pull\n"},
+		},
+		{
+			name:       "pull request ref in a shallow clone",
+			jkvs:       map[string]string{"url": trs.main.url, "ref": "refs/pull/1/head", "depth": "1", "singleBranch": "true"},
+			wantCommit: trs.pull,
+			wantRef:    "refs/pull/1/head",
+			wantFiles:  map[string]string{"README": "pull\n"},
+		},
+		{
+			name:    "unknown branch",
+			jkvs:    map[string]string{"url": trs.main.url, "branch": "nope"},
+			wantErr: "branch nope not found in " + trs.main.url + "; available branches: dev, master; available tags: v1.0",
+		},
+		{
+			name:    "unknown ref",
+			jkvs:    map[string]string{"url": trs.main.url, "ref": "refs/pull/2/head"},
+			wantErr: "ref refs/pull/2/head not found in " + trs.main.url + "; available branches: dev, master; available tags: v1.0",
+		},
+		{
+			name:    "unknown tag with no tags",
+			jkvs:    map[string]string{"url": trs.sub.url, "tag": "v1.0"},
+			wantErr: "tag v1.0 not found in " + trs.sub.url + "; available branches: master; available tags: (none)",
+		},
+		{
+			name:    "unknown commit",
+			jkvs:    map[string]string{"url": trs.main.url, "commit": "0123456789"},
+			wantErr: "not found",
+		},
+		{
+			name:       "submodule at the recorded commit",
+			jkvs:       map[string]string{"url": trs.super.url},
+			wantCommit: trs.superAt,
+			wantSubs:   []agentkit.SubmoduleProvenance{{Path: "lib", URL: trs.sub.url, Commit: trs.subAt.String()}},
+			wantFiles:  map[string]string{"README": "super\n", ".gitmodules": "", "lib/LIB": "library\n"},
+		},
+		{
+			name:       "submodules skipped",
+			jkvs:       map[string]string{"url": trs.super.url, "submoduleRecursion": "0"},
+			wantCommit: trs.superAt,
+			wantFiles:  map[string]string{"README": "super\n", ".gitmodules": ""},
+		},
+	}
+
+	cacheDir, err := ioutil.TempDir(dir, "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agents := map[string]*retrieveGithub{
+		"clone": {},
+		"cache": {cache: &mirrorCache{dir: cacheDir}},
+	}
+	for agName, ag := range agents {
+		for _, tt := range tests {
+			t.Run(agName+"/"+tt.name, func(t *testing.T) {
+				codeDir, out, err := runJob(t, ag, dir, tt.jkvs)
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+					}
+					// nothing is left behind for later agents
+					if got := readFiles(t, codeDir); len(got) != 0 {
+						t.Errorf("got files %v after failing, want none", got)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("got error %v, want nil", err)
+				}
+				if !strings.Contains(out, "commit: "+tt.wantCommit.String()) {
+					t.Errorf("output %q doesn't report commit %s", out, tt.wantCommit)
+				}
+				checkProvenance(t, codeDir+".spdx", tt.jkvs["url"], tt.wantRef, tt.wantCommit, tt.wantVersion, tt.wantSubs)
+
+				got := readFiles(t, codeDir)
+				if len(got) != len(tt.wantFiles) {
+					t.Errorf("got files %v, want %v", got, tt.wantFiles)
+				}
+				for name, want := range tt.wantFiles {
+					if _, ok := got[name]; !ok {
+						t.Errorf("%s: missing", name)
+					} else if want != "" && got[name] != want {
+						t.Errorf("%s: got %q, want %q", name, got[name], want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDescribeRefs(t *testing.T) {
+	refs := []*plumbing.Reference{
+		plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/master"),
+		plumbing.NewHashReference("refs/pull/1/head", plumbing.ZeroHash),
+	}
+	for i := 0; i < maxRefsListed+3; i++ {
+		refs = append(refs, plumbing.NewHashReference(plumbing.NewTagReferenceName(fmt.Sprintf("v%02d", i)), plumbing.ZeroHash))
+	}
+	if got := describeRefs(refs, "refs/heads/"); got != "(none)" {
+		t.Errorf("branches = %q, want %q", got, "(none)")
+	}
+	got := describeRefs(refs, "refs/tags/")
+	if !strings.HasPrefix(got, "v00, v01, ") || !strings.HasSuffix(got, ", v19 and 3 more") {
+		t.Errorf("tags = %q, want v00 to v19 and 3 more", got)
+	}
+}
+
+// checkProvenance checks the provenance that a job wrote into dir,
+// both the JSON record and the SPDX fields.
+func checkProvenance(t *testing.T, dir string, url string, ref string, commit plumbing.Hash, version string, subs []agentkit.SubmoduleProvenance) {
+	t.Helper()
+	prov, err := agentkit.ReadProvenance(dir)
+	if err != nil {
+		t.Fatalf("couldn't read provenance: %v", err)
+	}
+	loc := "git+" + url + "@" + commit.String()
+	if version == "" {
+		version = commit.String()
+	}
+	if prov.Agent != "retrieve-github" {
+		t.Errorf("provenance agent = %q, want %q", prov.Agent, "retrieve-github")
+	}
+	if prov.URL != url {
+		t.Errorf("provenance url = %q, want %q", prov.URL, url)
+	}
+	if prov.Ref != ref {
+		t.Errorf("provenance ref = %q, want %q", prov.Ref, ref)
+	}
+	if prov.Commit != commit.String() {
+		t.Errorf("provenance commit = %q, want %q", prov.Commit, commit)
+	}
+	if prov.DownloadLocation != loc {
+		t.Errorf("provenance download location = %q, want %q", prov.DownloadLocation, loc)
+	}
+	if prov.Version != version {
+		t.Errorf("provenance version = %q, want %q", prov.Version, version)
+	}
+	if len(prov.Submodules) != len(subs) {
+		t.Errorf("provenance submodules = %+v, want %+v", prov.Submodules, subs)
+	} else {
+		for i := range subs {
+			if prov.Submodules[i] != subs[i] {
+				t.Errorf("provenance submodule %d = %+v, want %+v", i, prov.Submodules[i], subs[i])
+			}
+		}
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, agentkit.ProvenanceSPDXFilename))
+	if err != nil {
+		t.Fatalf("couldn't read SPDX provenance: %v", err)
+	}
+	for _, want := range []string{
+		"PackageName: " + repoName(url) + "\n",
+		"PackageDownloadLocation: " + loc + "\n",
+		"PackageVersion: " + version + "\n",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("SPDX provenance %q doesn't contain %q", b, want)
+		}
+	}
+}
+
+func TestGitDownloadLocation(t *testing.T) {
+	h := plumbing.NewHash("0123456789abcdef0123456789abcdef01234567")
+	tests := []struct {
+		remote string
+		want   string
+	}{
+		{"https://github.com/org/repo.git", "git+https://github.com/org/repo.git@" + h.String()},
+		{"ssh://git@example.com/org/repo.git", "git+ssh://git@example.com/org/repo.git@" + h.String()},
+		{"git@example.com:org/repo.git", "git+ssh://git@example.com/org/repo.git@" + h.String()},
+		{"example.com:org/repo", "git+ssh://example.com/org/repo@" + h.String()},
+		{"file:///srv/git/repo.git", "git+file:///srv/git/repo.git@" + h.String()},
+	}
+	for _, tc := range tests {
+		if got := gitDownloadLocation(tc.remote, h); got != tc.want {
+			t.Errorf("gitDownloadLocation(%q) = %q, want %q", tc.remote, got, tc.want)
+		}
+	}
+}
+
+func TestRetrieveFromCache(t *testing.T) {
+	needGit(t)
+	dir, err := ioutil.TempDir("", "retrieve-github-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	trs := newTestRepos(t, dir)
+	cacheDir := filepath.Join(dir, "cache")
+	if err := os.Mkdir(cacheDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	ag := &retrieveGithub{cache: &mirrorCache{dir: cacheDir}}
+
+	// the first job misses, and mirrors the repository
+	if _, _, err := runJob(t, ag, dir, map[string]string{"url": trs.main.url}); err != nil {
+		t.Fatalf("first job: %v", err)
+	}
+	mirrorPath := filepath.Join(cacheDir, mirrorName(trs.main.url)+".git")
+	if _, err := os.Stat(mirrorPath); err != nil {
+		t.Fatalf("no mirror after first job: %v", err)
+	}
+
+	// a commit that arrives on the remote later is a miss, and is
+	// fetched into the mirror
+	third := trs.main.commit(t, "master", trs.second, map[string]string{"README": "third\n"}, nil)
+	codeDir, out, err := runJob(t, ag, dir, map[string]string{"url": trs.main.url, "branch": "master"})
+	if err != nil {
+		t.Fatalf("job after new commit: %v", err)
+	}
+	if !strings.Contains(out, "commit: "+third.String()) {
+		t.Errorf("output %q doesn't report new commit %s", out, third)
+	}
+	if got := readFiles(t, codeDir)["README"]; got != "third\n" {
+		t.Errorf("README = %q, want %q", got, "third\n")
+	}
+
+	// commits that are in the mirror are hits, and don't need the
+	// remote at all
+	moved := trs.main.dir + ".moved"
+	if err := os.Rename(trs.main.dir, moved); err != nil {
+		t.Fatal(err)
+	}
+	codeDir, _, err = runJob(t, ag, dir, map[string]string{"url": trs.main.url, "commit": trs.first.String()})
+	if err != nil {
+		t.Fatalf("job for cached commit with the remote gone: %v", err)
+	}
+	if got := readFiles(t, codeDir); len(got) != 1 || got["README"] != "first\n" {
+		t.Errorf("got files %v, want README from the first commit", got)
+	}
+
+	// but a branch still has to be looked up on the remote
+	if _, _, err := runJob(t, ag, dir, map[string]string{"url": trs.main.url, "branch": "master"}); err == nil {
+		t.Errorf("job for a branch with the remote gone succeeded, want error")
+	}
+}
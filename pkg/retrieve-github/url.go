@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// org and repo names are limited to what GitHub itself allows,
+	// which conveniently rules out slashes, "..", whitespace and
+	// anything that would need escaping in a URL
+	githubNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+	// scp-like ssh remotes, such as "git@gitlab.com:org/repo.git"
+	scpRemoteRe = regexp.MustCompile(`^(?:([A-Za-z0-9._-]+)@)?([A-Za-z0-9][A-Za-z0-9.-]*):([^/].*)$`)
+
+	// host names, without any port
+	hostRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.-]*$`)
+)
+
+// getURLToRepo returns the URL for cloning repo from org on github.com.
+// It returns an error if either name isn't one that GitHub would allow.
+func getURLToRepo(org string, repo string) (string, error) {
+	if !githubNameRe.MatchString(org) || strings.Contains(org, "..") {
+		return "", fmt.Errorf("invalid org name %q", org)
+	}
+	if !githubNameRe.MatchString(repo) || strings.Contains(repo, "..") {
+		return "", fmt.Errorf("invalid repo name %q", repo)
+	}
+	return fmt.Sprintf("https://github.com/%s/%s.git", org, repo), nil
+}
+
+// validateRemoteURL checks that remote is a git remote that we are
+// willing to clone from: an https://, ssh:// or file:// URL, or an
+// scp-like ssh remote such as "git@example.com:org/repo.git". It
+// returns an error explaining why if not. The error doesn't quote
+// remote, which could hold credentials if it isn't valid.
+func validateRemoteURL(remote string) error {
+	for _, r := range remote {
+		if r <= ' ' || r == 0x7f {
+			return fmt.Errorf("url contains whitespace or control characters")
+		}
+	}
+
+	// scp-like remotes have no scheme, so check for those first
+	if !strings.Contains(remote, "://") {
+		m := scpRemoteRe.FindStringSubmatch(remote)
+		if m == nil {
+			return fmt.Errorf("url is not an https, ssh or file URL")
+		}
+		if strings.HasPrefix(m[3], "-") {
+			return fmt.Errorf("url for %s has an invalid path", m[2])
+		}
+		return nil
+	}
+
+	u, err := url.Parse(remote)
+	if err != nil {
+		// url.Parse's errors quote the URL, so leave that out
+		if ue, ok := err.(*url.Error); ok {
+			err = ue.Err
+		}
+		return fmt.Errorf("url is invalid: %v", err)
+	}
+
+	switch u.Scheme {
+	case "https", "ssh":
+		if !hostRe.MatchString(u.Hostname()) {
+			return fmt.Errorf("url has an invalid host")
+		}
+		if u.Path == "" || u.Path == "/" {
+			return fmt.Errorf("url for %s has no repository path", u.Host)
+		}
+		// credentials are configured separately, so that they don't
+		// end up in logs or output messages
+		if _, hasPassword := u.User.Password(); hasPassword {
+			return fmt.Errorf("url for %s must not include a password", u.Host)
+		}
+		if u.Scheme == "https" && u.User != nil {
+			return fmt.Errorf("url for %s must not include a user name", u.Host)
+		}
+	case "file":
+		if u.Host != "" && u.Host != "localhost" {
+			return fmt.Errorf("file url must not name a remote host")
+		}
+		if u.Path == "" {
+			return fmt.Errorf("file url has no repository path")
+		}
+	default:
+		return fmt.Errorf("url has unsupported scheme %q; must be https, ssh or file", u.Scheme)
+	}
+
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("url must not include a query or fragment")
+	}
+
+	return nil
+}
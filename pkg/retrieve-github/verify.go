@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+const (
+	// verifyRequire fails the job unless the retrieved version has a
+	// good signature from a trusted key.
+	verifyRequire = "require"
+
+	// verifyWarn sets the job's health to DEGRADED, rather than failing
+	// it, if the retrieved version doesn't have a good signature.
+	verifyWarn = "warn"
+)
+
+// sigVerifier checks the GPG signature of the version that was
+// retrieved, against the keys in the keyring file given by the
+// "keyringFile" job key/value. If a tag was asked for and it is an
+// annotated tag, the tag's signature is checked; otherwise, the
+// commit's is. Submodules aren't checked.
+//
+// The "verifySignature" key/value says what to do if the signature is
+// missing or isn't from a key in the keyring: "require" fails the job,
+// and "warn" lets it carry on with DEGRADED health.
+type sigVerifier struct {
+	mode    string
+	keyring string
+
+	// signer describes the key that made a good signature, and
+	// problem says why there wasn't one; check sets one or the other
+	signer  string
+	problem error
+}
+
+// newSigVerifier returns a sigVerifier for the given mode, reading the
+// armored keyring from keyringFile. It returns nil if mode is empty,
+// meaning that signatures aren't checked.
+func newSigVerifier(mode string, keyringFile string) (*sigVerifier, error) {
+	if mode == "" {
+		if keyringFile != "" {
+			return nil, fmt.Errorf("keyringFile was specified without verifySignature")
+		}
+		return nil, nil
+	}
+	if mode != verifyRequire && mode != verifyWarn {
+		return nil, fmt.Errorf("verifySignature %q must be %s or %s", mode, verifyRequire, verifyWarn)
+	}
+	if keyringFile == "" {
+		return nil, fmt.Errorf("verifySignature was specified without keyringFile")
+	}
+
+	b, err := ioutil.ReadFile(keyringFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read keyringFile %s: %v", keyringFile, err)
+	}
+	// check the keyring now, rather than after cloning
+	keys, err := openpgp.ReadArmoredKeyRing(strings.NewReader(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read keys from keyringFile %s: %v", keyringFile, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("keyringFile %s has no keys", keyringFile)
+	}
+	return &sigVerifier{mode: mode, keyring: string(b)}, nil
+}
+
+// check verifies the signature on refName, if that is a tag, or else on
+// commit h of r. It returns an error only if the signature isn't good
+// and the mode requires one. It does nothing if sv is nil.
+func (sv *sigVerifier) check(r *git.Repository, refName plumbing.ReferenceName, h plumbing.Hash) error {
+	if sv == nil {
+		return nil
+	}
+	sv.signer, sv.problem = sv.verify(r, refName, h)
+	if sv.problem != nil && sv.mode == verifyRequire {
+		return fmt.Errorf("signature check failed: %v", sv.problem)
+	}
+	return nil
+}
+
+// verify returns a description of the key that signed refName or h, or
+// an error if there isn't a good signature from a key in the keyring.
+func (sv *sigVerifier) verify(r *git.Repository, refName plumbing.ReferenceName, h plumbing.Hash) (string, error) {
+	if refName.IsTag() {
+		ref, err := r.Reference(refName, true)
+		if err != nil {
+			return "", fmt.Errorf("couldn't find %s: %v", refName, err)
+		}
+		// lightweight tags have no signature of their own, so for
+		// those we fall through to checking the commit
+		if tag, err := r.TagObject(ref.Hash()); err == nil {
+			if tag.PGPSignature == "" {
+				return "", fmt.Errorf("tag %s is not signed", refName.Short())
+			}
+			entity, err := tag.Verify(sv.keyring)
+			if err != nil {
+				return "", fmt.Errorf("tag %s does not have a good signature from a trusted key: %v", refName.Short(), err)
+			}
+			return describeEntity(entity), nil
+		}
+	}
+
+	c, err := r.CommitObject(h)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get commit %s: %v", h, err)
+	}
+	if c.PGPSignature == "" {
+		return "", fmt.Errorf("commit %s is not signed", h)
+	}
+	entity, err := c.Verify(sv.keyring)
+	if err != nil {
+		return "", fmt.Errorf("commit %s does not have a good signature from a trusted key: %v", h, err)
+	}
+	return describeEntity(entity), nil
+}
+
+// describeEntity returns the primary user ID and key ID of entity, such
+// as "Jane Doe <jane@example.com> (key 0123456789ABCDEF)".
+func describeEntity(entity *openpgp.Entity) string {
+	names := []string{}
+	primary := ""
+	for name, id := range entity.Identities {
+		names = append(names, name)
+		if id.SelfSignature != nil && id.SelfSignature.IsPrimaryId != nil && *id.SelfSignature.IsPrimaryId {
+			primary = name
+		}
+	}
+	if primary == "" && len(names) > 0 {
+		sort.Strings(names)
+		primary = names[0]
+	}
+	return fmt.Sprintf("%s (key %s)", primary, strings.ToUpper(entity.PrimaryKey.KeyIdString()))
+}
@@ -0,0 +1,291 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// newTestEntity returns a new key for name, small enough to make
+// quickly.
+func newTestEntity(t *testing.T, name string) *openpgp.Entity {
+	t.Helper()
+	e, err := openpgp.NewEntity(name, "", strings.ToLower(name)+"@example.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// writeKeyring writes the public keys of entities to an armored
+// keyring file in dir, and returns its path.
+func writeKeyring(t *testing.T, dir string, entities ...*openpgp.Entity) string {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entities {
+		if err := e.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	f, err := ioutil.TempFile(dir, "keyring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+// detachSign returns the armored signature by signer of what o encodes
+// to without a signature.
+func (tr *testRepo) detachSign(t *testing.T, signer *openpgp.Entity, o interface {
+	EncodeWithoutSignature(plumbing.EncodedObject) error
+}) string {
+	t.Helper()
+	obj := tr.r.Storer.NewEncodedObject()
+	if err := o.EncodeWithoutSignature(obj); err != nil {
+		t.Fatal(err)
+	}
+	rd, err := obj.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := &bytes.Buffer{}
+	if err := openpgp.ArmoredDetachSign(sig, signer, rd, nil); err != nil {
+		t.Fatal(err)
+	}
+	return sig.String()
+}
+
+// signCommit stores a copy of commit h signed by signer, points branch
+// at it, and returns it.
+func (tr *testRepo) signCommit(t *testing.T, branch string, h plumbing.Hash, signer *openpgp.Entity) plumbing.Hash {
+	t.Helper()
+	c, err := tr.r.CommitObject(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.PGPSignature = tr.detachSign(t, signer, c)
+	signed := tr.store(t, c)
+	tr.setRef(t, plumbing.NewBranchReferenceName(branch), signed)
+	return signed
+}
+
+// annotatedTag points the annotated tag name at commit h, signed by
+// signer if it isn't nil.
+func (tr *testRepo) annotatedTag(t *testing.T, name string, h plumbing.Hash, signer *openpgp.Entity) {
+	t.Helper()
+	tag := &object.Tag{
+		Name:       name,
+		Tagger:     object.Signature{Name: "Test", Email: "test@example.com", When: time.Unix(1500000000, 0)},
+		Message:    "release " + name + "\n",
+		TargetType: plumbing.CommitObject,
+		Target:     h,
+	}
+	if signer != nil {
+		tag.PGPSignature = tr.detachSign(t, signer, tag)
+	}
+	tr.setRef(t, plumbing.NewTagReferenceName(name), tr.store(t, tag))
+}
+
+func TestNewSigVerifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retrieve-github-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyring := writeKeyring(t, dir, newTestEntity(t, "Trusted"))
+	notKeys := filepath.Join(dir, "not-keys")
+	if err := ioutil.WriteFile(notKeys, []byte("not a keyring\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		mode        string
+		keyringFile string
+		wantErr     string
+		wantNil     bool
+	}{
+		{name: "off", wantNil: true},
+		{name: "require", mode: verifyRequire, keyringFile: keyring},
+		{name: "warn", mode: verifyWarn, keyringFile: keyring},
+		{name: "keyring without mode", keyringFile: keyring, wantErr: "keyringFile was specified without verifySignature"},
+		{name: "mode without keyring", mode: verifyRequire, wantErr: "verifySignature was specified without keyringFile"},
+		{name: "unknown mode", mode: "maybe", keyringFile: keyring, wantErr: `verifySignature "maybe" must be require or warn`},
+		{name: "missing keyring", mode: verifyRequire, keyringFile: filepath.Join(dir, "missing"), wantErr: "couldn't read keyringFile"},
+		{name: "not a keyring", mode: verifyRequire, keyringFile: notKeys, wantErr: "couldn't read keys from keyringFile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sv, err := newSigVerifier(tt.mode, tt.keyringFile)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+			if (sv == nil) != tt.wantNil {
+				t.Errorf("got verifier %v, want nil %t", sv, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestSigVerifierCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retrieve-github-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	trusted := newTestEntity(t, "Trusted")
+	other := newTestEntity(t, "Other")
+	keyring := writeKeyring(t, dir, trusted)
+
+	tr := newTestRepo(t, filepath.Join(dir, "signed.git"))
+	unsigned := tr.commit(t, "unsigned", plumbing.ZeroHash, map[string]string{"README": "unsigned\n"}, nil)
+	signed := tr.signCommit(t, "signed", tr.commit(t, "signed", plumbing.ZeroHash, map[string]string{"README": "signed\n"}, nil), trusted)
+	untrusted := tr.signCommit(t, "untrusted", tr.commit(t, "untrusted", plumbing.ZeroHash, map[string]string{"README": "untrusted\n"}, nil), other)
+	tr.annotatedTag(t, "v1.0", unsigned, trusted)
+	tr.annotatedTag(t, "v1.1", signed, nil)
+	tr.annotatedTag(t, "v1.2", signed, other)
+	tr.tag(t, "light", signed)
+
+	trustedDesc := "Trusted <trusted@example.com> (key " + strings.ToUpper(trusted.PrimaryKey.KeyIdString()) + ")"
+	tests := []struct {
+		name    string
+		ref     plumbing.ReferenceName
+		h       plumbing.Hash
+		wantErr string
+		// wantSigner is the key that made a good signature, if there
+		// is one
+		wantSigner string
+	}{
+		{name: "signed commit", h: signed, wantSigner: trustedDesc},
+		{name: "unsigned commit", h: unsigned, wantErr: "commit " + unsigned.String() + " is not signed"},
+		{name: "commit signed by another key", h: untrusted, wantErr: "does not have a good signature from a trusted key"},
+		{name: "branch is checked by its commit", ref: plumbing.NewBranchReferenceName("signed"), h: signed, wantSigner: trustedDesc},
+		// an annotated tag's own signature is checked, rather than the
+		// commit's
+		{name: "signed tag of an unsigned commit", ref: plumbing.NewTagReferenceName("v1.0"), h: unsigned, wantSigner: trustedDesc},
+		{name: "unsigned tag of a signed commit", ref: plumbing.NewTagReferenceName("v1.1"), h: signed, wantErr: "tag v1.1 is not signed"},
+		{name: "tag signed by another key", ref: plumbing.NewTagReferenceName("v1.2"), h: signed, wantErr: "tag v1.2 does not have a good signature from a trusted key"},
+		{name: "lightweight tag", ref: plumbing.NewTagReferenceName("light"), h: signed, wantSigner: trustedDesc},
+	}
+	for _, mode := range []string{verifyRequire, verifyWarn} {
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				sv, err := newSigVerifier(mode, keyring)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = sv.check(tr.r, tt.ref, tt.h)
+
+				// only a required signature fails the job
+				if tt.wantErr != "" && mode == verifyRequire {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+					}
+				} else if err != nil {
+					t.Errorf("got error %v, want nil", err)
+				}
+				if tt.wantErr != "" && (sv.problem == nil || !strings.Contains(sv.problem.Error(), tt.wantErr)) {
+					t.Errorf("got problem %v, want one containing %q", sv.problem, tt.wantErr)
+				}
+				if tt.wantErr == "" && sv.problem != nil {
+					t.Errorf("got problem %v, want none", sv.problem)
+				}
+				if sv.signer != tt.wantSigner {
+					t.Errorf("got signer %q, want %q", sv.signer, tt.wantSigner)
+				}
+			})
+		}
+	}
+
+	var off *sigVerifier
+	if err := off.check(tr.r, "", unsigned); err != nil {
+		t.Errorf("check with no verifier: got error %v, want nil", err)
+	}
+}
+
+func TestRetrieveVerified(t *testing.T) {
+	needGit(t)
+	dir, err := ioutil.TempDir("", "retrieve-github-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	trusted := newTestEntity(t, "Trusted")
+	keyring := writeKeyring(t, dir, trusted)
+
+	tr := newTestRepo(t, filepath.Join(dir, "signed.git"))
+	unsigned := tr.commit(t, "master", plumbing.ZeroHash, map[string]string{"README": "unsigned\n"}, nil)
+	signed := tr.signCommit(t, "signed", tr.commit(t, "signed", unsigned, map[string]string{"README": "signed\n"}, nil), trusted)
+
+	tests := []struct {
+		name    string
+		jkvs    map[string]string
+		wantErr string
+		// wantOutput is part of what the job reports
+		wantOutput string
+	}{
+		{
+			name:       "signed",
+			jkvs:       map[string]string{"branch": "signed", "verifySignature": verifyRequire},
+			wantOutput: "commit: " + signed.String() + "\nsigned by: Trusted <trusted@example.com>",
+		},
+		{
+			name:    "unsigned and required",
+			jkvs:    map[string]string{"verifySignature": verifyRequire},
+			wantErr: "signature check failed: commit " + unsigned.String() + " is not signed",
+		},
+		{
+			name:       "unsigned with a warning",
+			jkvs:       map[string]string{"verifySignature": verifyWarn},
+			wantOutput: "signature not verified: commit " + unsigned.String() + " is not signed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.jkvs["url"] = tr.url
+			tt.jkvs["keyringFile"] = keyring
+			codeDir, out, err := runJob(t, &retrieveGithub{}, dir, tt.jkvs)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				if got := readFiles(t, codeDir); len(got) != 0 {
+					t.Errorf("got files %v after failing, want none", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+			if !strings.Contains(out, tt.wantOutput) {
+				t.Errorf("got output %q, want it to contain %q", out, tt.wantOutput)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+module github.com/swinslow/peridot-agents/pkg/retrieve-gomod
+
+go 1.13
+
+require (
+	github.com/swinslow/peridot-agents/pkg/agentkit v0.0.0
+	github.com/swinslow/peridot-jobrunner v0.0.0-20191124161321-701dbac8170c
+	golang.org/x/mod v0.4.2
+)
+
+replace github.com/swinslow/peridot-agents/pkg/agentkit => ../agentkit
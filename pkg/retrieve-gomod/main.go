@@ -0,0 +1,33 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"log"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+)
+
+const (
+	port = ":3015"
+)
+
+func main() {
+	// find out where to get modules and checksums from
+	proxy, err := proxyFromEnv()
+	if err != nil {
+		log.Fatalf("couldn't set up module proxy: %v", err)
+	}
+	db, err := sumdbFromEnv()
+	if err != nil {
+		log.Fatalf("couldn't set up checksum database: %v", err)
+	}
+	log.Printf("using module proxy %s", proxy)
+	if db == nil {
+		log.Printf("checksum database is off; jobs must give each module's sum")
+	}
+
+	// serve jobs until we're asked to shut down
+	if err := agentkit.Serve(port, &retrieveGomod{proxy: proxy, sumdb: db}); err != nil {
+		log.Fatal(err)
+	}
+}
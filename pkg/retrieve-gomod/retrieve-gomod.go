@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/archive"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+	modzip "golang.org/x/mod/zip"
+)
+
+type retrieveGomod struct {
+	// proxy is the base URL of the module proxy.
+	proxy string
+
+	// sumdb is the checksum database to check modules against, or nil
+	// if there isn't one.
+	sumdb *sumdbOps
+}
+
+// Run is the function that actually carries out the substantive
+// action of the agent, for this job.
+func (ag *retrieveGomod) Run(ctx context.Context, cfg agent.JobConfig, rpt agentkit.Reporter) error {
+	// make sure we've got the config values we need
+	modPath := ""
+	version := ""
+	sum := ""
+
+	for _, jkv := range cfg.Jkvs {
+		switch jkv.Key {
+		case "module":
+			modPath = jkv.Value
+		case "version":
+			version = jkv.Value
+		case "sum":
+			sum = jkv.Value
+		}
+	}
+
+	if modPath == "" {
+		return fmt.Errorf("module key/value not specified")
+	}
+	if version == "" {
+		return fmt.Errorf("version key/value not specified")
+	}
+	if err := module.Check(modPath, version); err != nil {
+		return err
+	}
+	if sum != "" && !strings.HasPrefix(sum, "h1:") {
+		return fmt.Errorf("sum %q is not a go.sum hash starting with h1:", sum)
+	}
+	if sum == "" && ag.sumdb == nil {
+		return fmt.Errorf("sum key/value not specified, and no checksum database is configured")
+	}
+
+	// check that we've got an empty directory to unpack into
+	if err := agentkit.PrepareCodeOutputDir(cfg.CodeOutputDir); err != nil {
+		return err
+	}
+
+	// we're all configured; set status as running
+	rpt.Running()
+
+	// from here on, if we fail, remove anything that we've unpacked
+	// so that later agents don't pick up part of a module
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			agentkit.RemoveDirContents(cfg.CodeOutputDir)
+		}
+	}()
+
+	// collect the hashes that the module must match: the job's, and the
+	// checksum database's if there is one
+	expected := []string{}
+	if sum != "" {
+		expected = append(expected, sum)
+	}
+	if ag.sumdb != nil {
+		dbSum, err := ag.sumdb.lookupSum(ctx, modPath, version)
+		if err != nil {
+			return fmt.Errorf("couldn't look up %s@%s in checksum database: %v", modPath, version, err)
+		}
+		expected = append(expected, dbSum)
+	}
+
+	escPath, err := module.EscapePath(modPath)
+	if err != nil {
+		return err
+	}
+	escVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return err
+	}
+	zipURL := fmt.Sprintf("%s/%s/@v/%s.zip", ag.proxy, escPath, escVersion)
+
+	zipPath, sums, err := archive.Download(ctx, zipURL, rpt)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(zipPath)
+
+	// don't unpack anything that isn't what we expected
+	h1, err := dirhash.HashZip(zipPath, dirhash.Hash1)
+	if err != nil {
+		return fmt.Errorf("couldn't hash %s: %v", zipURL, err)
+	}
+	for _, want := range expected {
+		if h1 != want {
+			return fmt.Errorf("downloaded %s, but go.sum hash mismatch: expected %s, got %s", zipURL, want, h1)
+		}
+	}
+	mv := module.Version{Path: modPath, Version: version}
+	if _, err := modzip.CheckZip(mv, zipPath); err != nil {
+		return fmt.Errorf("downloaded %s, but it isn't a valid module zip file: %v", zipURL, err)
+	}
+
+	// files in module zips all start with "<path>@<version>/"
+	strip := strings.Count(modPath, "/") + 1
+	files, err := archive.Extract(ctx, zipPath, archive.FormatZip, cfg.CodeOutputDir, archive.Options{StripComponents: strip}, rpt)
+	if err != nil {
+		return fmt.Errorf("couldn't extract %s: %v", zipURL, err)
+	}
+
+	// record where the code came from, for later agents
+	if cfg.SpdxOutputDir != "" {
+		prov := &agentkit.Provenance{
+			Agent:            "retrieve-gomod",
+			Name:             modPath,
+			URL:              zipURL,
+			DownloadLocation: zipURL,
+			Version:          version,
+			Checksums: map[string]string{
+				"SHA1":   sums["SHA1"],
+				"SHA256": sums["SHA256"],
+			},
+			RetrievedAt: time.Now().UTC().Truncate(time.Second),
+		}
+		if err := agentkit.WriteProvenance(cfg.SpdxOutputDir, prov); err != nil {
+			return err
+		}
+	}
+
+	rpt.Output(fmt.Sprintf("module: %s\nversion: %s\nsum: %s\nfiles: %d", modPath, version, h1, files))
+
+	// success!
+	succeeded = true
+	return nil
+}
@@ -0,0 +1,303 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+	modzip "golang.org/x/mod/zip"
+)
+
+// testReporter records what a job reports.
+type testReporter struct {
+	running bool
+	output  []string
+}
+
+func (r *testReporter) Running()                     { r.running = true }
+func (r *testReporter) Output(msg string)            { r.output = append(r.output, msg) }
+func (r *testReporter) Degraded(msg string)          { r.output = append(r.output, msg) }
+func (r *testReporter) Progress(p agentkit.Progress) {}
+
+const (
+	testModule  = "example.com/mod"
+	testVersion = "v1.0.0"
+)
+
+// moduleZip returns the zip file of the module testModule@testVersion
+// holding files, which map names to contents, and its go.sum hash.
+func moduleZip(t *testing.T, files map[string]string) ([]byte, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "retrieve-gomod-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	for name, body := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	zipPath := filepath.Join(dir, "mod.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mv := module.Version{Path: testModule, Version: testVersion}
+	if err := modzip.CreateFromDir(f, mv, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	h1, err := dirhash.HashZip(zipPath, dirhash.Hash1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, h1
+}
+
+// newTestSumdb starts a checksum database that records sum as the hash
+// of testModule@testVersion, and returns the agent's client for it.
+func newTestSumdb(t *testing.T, sum string) (*sumdbOps, func()) {
+	t.Helper()
+	h, vkey := testSumdbHandler(t, sum)
+	srv := httptest.NewServer(h)
+	return newSumdbOps(srv.URL, vkey), srv.Close
+}
+
+// testSumdbHandler returns the handler for a checksum database that
+// records sum as the hash of testModule@testVersion, and its verifier
+// key.
+func testSumdbHandler(t *testing.T, sum string) (http.Handler, string) {
+	t.Helper()
+	skey, vkey, err := note.GenerateKey(rand.Reader, "sumdb.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gosum := func(path, vers string) ([]byte, error) {
+		if path != testModule || vers != testVersion {
+			return nil, os.ErrNotExist
+		}
+		return []byte(path + " " + vers + " " + sum + "\n"), nil
+	}
+	return sumdb.NewServer(sumdb.NewTestServer(skey, gosum)), vkey
+}
+
+func TestRun(t *testing.T) {
+	zipData, h1 := moduleZip(t, map[string]string{
+		"go.mod":   "module " + testModule + "\n",
+		"mod.go":   "package mod\n",
+		"sub/a.go": "package sub\n",
+	})
+	wantFiles := map[string]string{
+		"go.mod":   "module " + testModule + "\n",
+		"mod.go":   "package mod\n",
+		"sub/a.go": "package sub\n",
+	}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+testModule+"/@v/"+testVersion+".zip" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(zipData)
+	}))
+	defer proxy.Close()
+	badSum := "h1:" + strings.Repeat("A", 43) + "="
+
+	tests := []struct {
+		name        string
+		jkvs        map[string]string
+		sumdb       string
+		cancel      bool
+		wantErr     string
+		wantRunning bool
+		wantFiles   map[string]string
+	}{
+		{
+			name:        "sum",
+			jkvs:        map[string]string{"module": testModule, "version": testVersion, "sum": h1},
+			wantRunning: true,
+			wantFiles:   wantFiles,
+		},
+		{
+			name:        "wrong sum",
+			jkvs:        map[string]string{"module": testModule, "version": testVersion, "sum": badSum},
+			wantErr:     "go.sum hash mismatch",
+			wantRunning: true,
+			wantFiles:   map[string]string{},
+		},
+		{
+			name:        "checksum database",
+			jkvs:        map[string]string{"module": testModule, "version": testVersion},
+			sumdb:       h1,
+			wantRunning: true,
+			wantFiles:   wantFiles,
+		},
+		{
+			name:        "checksum database and sum",
+			jkvs:        map[string]string{"module": testModule, "version": testVersion, "sum": h1},
+			sumdb:       h1,
+			wantRunning: true,
+			wantFiles:   wantFiles,
+		},
+		{
+			name:        "wrong hash in checksum database",
+			jkvs:        map[string]string{"module": testModule, "version": testVersion},
+			sumdb:       badSum,
+			wantErr:     "go.sum hash mismatch",
+			wantRunning: true,
+			wantFiles:   map[string]string{},
+		},
+		{
+			name:        "sum disagrees with checksum database",
+			jkvs:        map[string]string{"module": testModule, "version": testVersion, "sum": badSum},
+			sumdb:       h1,
+			wantErr:     "go.sum hash mismatch",
+			wantRunning: true,
+			wantFiles:   map[string]string{},
+		},
+		{
+			name:        "cancelled during lookup",
+			jkvs:        map[string]string{"module": testModule, "version": testVersion},
+			sumdb:       h1,
+			cancel:      true,
+			wantErr:     "couldn't look up",
+			wantRunning: true,
+			wantFiles:   map[string]string{},
+		},
+		{
+			name:    "no sum and no checksum database",
+			jkvs:    map[string]string{"module": testModule, "version": testVersion},
+			wantErr: "no checksum database is configured",
+		},
+		{
+			name:    "malformed sum",
+			jkvs:    map[string]string{"module": testModule, "version": testVersion, "sum": "abc"},
+			wantErr: "starting with h1:",
+		},
+		{
+			name:    "invalid version",
+			jkvs:    map[string]string{"module": testModule, "version": "1.0", "sum": h1},
+			wantErr: "not a semantic version",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "retrieve-gomod-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			codeDir := filepath.Join(dir, "code")
+
+			ag := &retrieveGomod{proxy: proxy.URL}
+			if tt.sumdb != "" {
+				db, stop := newTestSumdb(t, tt.sumdb)
+				defer stop()
+				ag.sumdb = db
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			cfg := agent.JobConfig{CodeOutputDir: codeDir}
+			for k, v := range tt.jkvs {
+				cfg.Jkvs = append(cfg.Jkvs, &agent.JobConfig_JobKV{Key: k, Value: v})
+			}
+			rpt := &testReporter{}
+			err = ag.Run(ctx, cfg, rpt)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+			if rpt.running != tt.wantRunning {
+				t.Errorf("got running %t, want %t", rpt.running, tt.wantRunning)
+			}
+			if tt.wantFiles == nil {
+				return
+			}
+
+			got := map[string]string{}
+			filepath.Walk(codeDir, func(p string, fi os.FileInfo, err error) error {
+				if err == nil && fi.Mode().IsRegular() {
+					rel, _ := filepath.Rel(codeDir, p)
+					b, _ := ioutil.ReadFile(p)
+					got[filepath.ToSlash(rel)] = string(b)
+				}
+				return nil
+			})
+			if len(got) != len(tt.wantFiles) {
+				t.Errorf("got files %v, want %v", got, tt.wantFiles)
+			}
+			for name, want := range tt.wantFiles {
+				if got[name] != want {
+					t.Errorf("%s: got %q, want %q", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLookupSumAfterFailure(t *testing.T) {
+	_, h1 := moduleZip(t, map[string]string{"go.mod": "module " + testModule + "\n"})
+	h, vkey := testSumdbHandler(t, h1)
+	failing := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	ops := newSumdbOps(srv.URL, vkey)
+
+	// neither a failed read nor a cancelled job is kept for the jobs
+	// after it
+	if _, err := ops.lookupSum(context.Background(), testModule, testVersion); err == nil {
+		t.Fatalf("got nil error from failing database, want one")
+	}
+	failing = false
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ops.lookupSum(ctx, testModule, testVersion); err == nil {
+		t.Fatalf("got nil error from cancelled lookup, want one")
+	}
+	for i := 0; i < 2; i++ {
+		sum, err := ops.lookupSum(context.Background(), testModule, testVersion)
+		if err != nil {
+			t.Fatalf("lookup %d: got error %v, want nil", i, err)
+		}
+		if sum != h1 {
+			t.Errorf("lookup %d: got hash %q, want %q", i, sum, h1)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit/archive"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/note"
+)
+
+const (
+	// proxyEnv names the environment variable that gives the base URL
+	// of the Go module proxy to download from. It may be a file URL,
+	// for a mirror laid out the same way on disk.
+	proxyEnv     = "RETRIEVE_GOMOD_PROXY"
+	defaultProxy = "https://proxy.golang.org"
+
+	// sumdbEnv names the environment variable that gives the checksum
+	// database to check modules against, as the database's verifier
+	// key, optionally followed by a space and its base URL, as in
+	// GOSUMDB. It is "off" to not use one, in which case each job must
+	// give the module's expected checksum itself.
+	sumdbEnv     = "RETRIEVE_GOMOD_SUMDB"
+	defaultSumdb = "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ljy5lnR4eEBXQNk"
+)
+
+// proxyFromEnv returns the base URL of the module proxy that the
+// agent's environment configures.
+func proxyFromEnv() (string, error) {
+	proxy := os.Getenv(proxyEnv)
+	if proxy == "" {
+		proxy = defaultProxy
+	}
+	return archive.ValidateBaseURL(proxy)
+}
+
+// sumdbFromEnv returns the checksum database that the agent's
+// environment configures, or nil if it turns it off.
+func sumdbFromEnv() (*sumdbOps, error) {
+	cfg := strings.TrimSpace(os.Getenv(sumdbEnv))
+	if cfg == "" {
+		cfg = defaultSumdb
+	}
+	if cfg == "off" {
+		return nil, nil
+	}
+
+	fields := strings.Fields(cfg)
+	key := fields[0]
+	verifier, err := note.NewVerifier(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verifier key %q: %v", key, err)
+	}
+	u := "https://" + verifier.Name()
+	if len(fields) > 1 {
+		u = fields[1]
+	}
+	if u, err = archive.ValidateBaseURL(u); err != nil {
+		return nil, err
+	}
+
+	return newSumdbOps(u, key), nil
+}
+
+// newSumdbOps returns the checksum database at url, whose verifier key
+// is key.
+func newSumdbOps(url string, key string) *sumdbOps {
+	return &sumdbOps{
+		url:    url,
+		key:    key,
+		config: map[string][]byte{},
+		cache:  map[string][]byte{},
+	}
+}
+
+// lookupSum looks up the go.sum hash of the module path@version's zip
+// file in the checksum database, which verifies the database's proof
+// that it has recorded that hash for everyone. Requests that it makes
+// to the database are cancelled when ctx is.
+func (ops *sumdbOps) lookupSum(ctx context.Context, path string, version string) (string, error) {
+	// a client keeps the errors from its reads for good, so each
+	// lookup has its own, and only what was verified is shared
+	client := sumdb.NewClient(&sumdbLookup{sumdbOps: ops, ctx: ctx})
+	lines, err := client.Lookup(path, version)
+	if err != nil {
+		return "", err
+	}
+	prefix := path + " " + version + " "
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimPrefix(line, prefix), nil
+		}
+	}
+	return "", fmt.Errorf("no hash for %s@%s in checksum database", path, version)
+}
+
+// sumdbOps keeps the checksum database's latest signed tree and the
+// tiles that have been read from it in memory. It is shared by every
+// job that the agent runs, so that each one is checked against the
+// tree that earlier jobs saw.
+type sumdbOps struct {
+	url string
+	key string
+
+	mu     sync.Mutex
+	config map[string][]byte
+	cache  map[string][]byte
+}
+
+// sumdbLookup implements sumdb.ClientOps for one lookup, reading from
+// the database with the lookup's ctx.
+type sumdbLookup struct {
+	*sumdbOps
+	ctx context.Context
+}
+
+func (l *sumdbLookup) ReadRemote(path string) ([]byte, error) {
+	return archive.Fetch(l.ctx, l.url+path)
+}
+
+func (ops *sumdbOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(ops.key), nil
+	}
+	ops.mu.Lock()
+	defer ops.mu.Unlock()
+	// no tree at all yet is an empty one
+	return ops.config[file], nil
+}
+
+func (ops *sumdbOps) WriteConfig(file string, old []byte, new []byte) error {
+	ops.mu.Lock()
+	defer ops.mu.Unlock()
+	if string(ops.config[file]) != string(old) {
+		return sumdb.ErrWriteConflict
+	}
+	ops.config[file] = new
+	return nil
+}
+
+func (ops *sumdbOps) ReadCache(file string) ([]byte, error) {
+	ops.mu.Lock()
+	defer ops.mu.Unlock()
+	data, ok := ops.cache[file]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
+
+func (ops *sumdbOps) WriteCache(file string, data []byte) {
+	ops.mu.Lock()
+	defer ops.mu.Unlock()
+	ops.cache[file] = data
+}
+
+func (ops *sumdbOps) Log(msg string) {
+	log.Print(msg)
+}
+
+func (ops *sumdbOps) SecurityError(msg string) {
+	log.Printf("==> checksum database security error: %s", msg)
+}
@@ -0,0 +1,296 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+)
+
+// importer copies or hard-links the files under src into dest, which
+// must already exist and be empty.
+type importer struct {
+	ctx  context.Context
+	src  string
+	dest string
+
+	// link says to hard-link regular files rather than copying them.
+	// Falls back to copying any file that is on a different device
+	// from dest.
+	link bool
+
+	// includes and excludes are patterns for agentkit.MatchPath. If
+	// there are any includes, only files matching one of them, or
+	// inside a directory that does, are imported. Anything matching
+	// an exclude is left out, along with everything inside it.
+	includes []string
+	excludes []string
+
+	rpt agentkit.Reporter
+	p   agentkit.Progress
+
+	files    int
+	excluded int
+	// unsafeLinks counts the symbolic links that were left out
+	// because they point outside src.
+	unsafeLinks int
+
+	symlinks []string
+
+	// dirs holds the directories under dest, in the order they were
+	// visited, so that their permissions can be set at the end.
+	dirs []importedDir
+}
+
+// importedDir is a directory that importer has visited, along with the
+// permissions of the directory in src.
+type importedDir struct {
+	path string
+	perm os.FileMode
+}
+
+// run imports everything under src.
+func (im *importer) run() error {
+	im.p = agentkit.Progress{Phase: "copying", Unit: "files"}
+	if im.link {
+		im.p.Phase = "linking"
+	}
+	im.rpt.Progress(im.p)
+
+	if err := filepath.Walk(im.src, im.visit); err != nil {
+		return err
+	}
+	if err := im.checkSymlinks(); err != nil {
+		return err
+	}
+	return im.setDirModes()
+}
+
+// visit is the filepath.WalkFunc that handles each thing under src.
+// filepath.Walk doesn't follow symbolic links, so nothing outside src
+// is visited.
+func (im *importer) visit(p string, fi os.FileInfo, err error) error {
+	if err != nil {
+		return err
+	}
+	if err := im.ctx.Err(); err != nil {
+		return err
+	}
+	if p == im.src {
+		return nil
+	}
+	rel, err := filepath.Rel(im.src, p)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+
+	if im.isExcluded(rel, fi.IsDir()) {
+		im.excluded++
+		if fi.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+
+	destPath := filepath.Join(im.dest, filepath.FromSlash(rel))
+	mode := fi.Mode()
+	switch {
+	case mode.IsDir():
+		im.dirs = append(im.dirs, importedDir{path: destPath, perm: mode.Perm()})
+		// with includes, only create the directories that end up
+		// holding something, as they are needed
+		if len(im.includes) == 0 {
+			return os.MkdirAll(destPath, 0755)
+		}
+		return nil
+	case !im.isIncluded(rel, false):
+		return nil
+	case mode&os.ModeSymlink != 0:
+		return im.symlink(p, rel, destPath)
+	case mode.IsRegular():
+		return im.file(p, rel, destPath, fi)
+	default:
+		log.Printf("==> skipping %s: unsupported file type %v", p, mode.Type())
+		return nil
+	}
+}
+
+func (im *importer) isExcluded(rel string, isDir bool) bool {
+	for _, pattern := range im.excludes {
+		if agentkit.MatchPath(pattern, rel, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+func (im *importer) isIncluded(rel string, isDir bool) bool {
+	if len(im.includes) == 0 {
+		return true
+	}
+	for _, pattern := range im.includes {
+		if agentkit.MatchPathOrParent(pattern, rel, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// file imports the regular file at p, which fi describes, keeping its
+// permissions.
+func (im *importer) file(p string, rel string, destPath string, fi os.FileInfo) error {
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return err
+	}
+
+	linked := false
+	if im.link {
+		err := os.Link(p, destPath)
+		var le *os.LinkError
+		switch {
+		case err == nil:
+			// link(2) doesn't follow symbolic links, so if p was
+			// swapped for one since it was visited, we've linked to
+			// that instead
+			if lfi, err := os.Lstat(destPath); err != nil || !os.SameFile(fi, lfi) {
+				os.Remove(destPath)
+				return fmt.Errorf("couldn't link %s: it changed while being imported", rel)
+			}
+			linked = true
+		case errors.As(err, &le) && le.Err == syscall.EXDEV:
+			log.Printf("==> can't hard-link %s across devices; copying it instead", p)
+		default:
+			return fmt.Errorf("couldn't link %s: %v", rel, err)
+		}
+	}
+	if !linked {
+		if err := copyFile(p, destPath, fi); err != nil {
+			return fmt.Errorf("couldn't copy %s: %v", rel, err)
+		}
+	}
+
+	im.files++
+	im.p.Done = int64(im.files)
+	im.rpt.Progress(im.p)
+	return nil
+}
+
+// copyFile copies the regular file at src, which want describes as
+// found by os.Lstat, to a new file at dest, with the same permissions
+// regardless of umask. If src is no longer that file, such as because
+// it has been replaced by a symbolic link out of the tree, it copies
+// nothing.
+func copyFile(src string, dest string, want os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	got, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if !got.Mode().IsRegular() || !os.SameFile(want, got) {
+		return fmt.Errorf("%s changed while being imported", src)
+	}
+
+	perm := want.Mode().Perm()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(dest, perm)
+}
+
+// symlink recreates the symbolic link at p, unless it points to an
+// absolute path or outside src, in which case it is left out.
+func (im *importer) symlink(p string, rel string, destPath string) error {
+	target, err := os.Readlink(p)
+	if err != nil {
+		return err
+	}
+	if !isSafeLinkTarget(rel, target) {
+		log.Printf("==> skipping %s: symbolic link to %s is outside %s", p, target, im.src)
+		im.unsafeLinks++
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return err
+	}
+	if err := os.Symlink(target, destPath); err != nil {
+		return err
+	}
+	im.symlinks = append(im.symlinks, destPath)
+	return nil
+}
+
+// isSafeLinkTarget reports whether a symbolic link at rel, relative to
+// the top of the tree, to target stays within the tree, going only by
+// the paths themselves.
+func isSafeLinkTarget(rel string, target string) bool {
+	if target == "" || filepath.IsAbs(target) {
+		return false
+	}
+	resolved := path.Join(path.Dir(rel), filepath.ToSlash(target))
+	return resolved != ".." && !strings.HasPrefix(resolved, "../")
+}
+
+// checkSymlinks checks that each symbolic link that was created, now
+// that all of them exist, still resolves to somewhere within dest, and
+// removes any that don't. This catches links that only escape by way
+// of another link.
+func (im *importer) checkSymlinks() error {
+	root, err := filepath.EvalSymlinks(im.dest)
+	if err != nil {
+		return err
+	}
+	for _, l := range im.symlinks {
+		resolved, err := filepath.EvalSymlinks(l)
+		if err != nil {
+			// dangling links can't be followed anywhere
+			continue
+		}
+		if isWithin(resolved, root) {
+			continue
+		}
+		log.Printf("==> removing %s: symbolic link resolves outside %s", l, im.dest)
+		if err := os.Remove(l); err != nil {
+			return err
+		}
+		im.unsafeLinks++
+	}
+	return nil
+}
+
+// setDirModes gives the directories that were imported the same
+// permissions as in src, now that nothing more needs to be written
+// into them. Directories are done after those inside them, in case a
+// directory's permissions don't let us reach inside it any more.
+// Directories left out because nothing in them was included are
+// skipped.
+func (im *importer) setDirModes() error {
+	for i := len(im.dirs) - 1; i >= 0; i-- {
+		d := im.dirs[i]
+		if err := os.Chmod(d.path, d.perm); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCopyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retrieve-local-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	secret := filepath.Join(dir, "secret")
+	other := filepath.Join(dir, "other")
+	for name, body := range map[string]string{src: "source\n", secret: "secret\n", other: "other\n"} {
+		if err := ioutil.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(src, 0751); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Lstat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file is copied with its permissions
+	dest := filepath.Join(dir, "dest")
+	if err := copyFile(src, dest, fi); err != nil {
+		t.Fatalf("copyFile: %v", err)
+	}
+	if b, err := ioutil.ReadFile(dest); err != nil || string(b) != "source\n" {
+		t.Errorf("got %q, %v, want %q", b, err, "source\n")
+	}
+	if dfi, err := os.Stat(dest); err != nil || dfi.Mode().Perm() != 0751 {
+		t.Errorf("got mode %v, %v, want %v", dfi.Mode().Perm(), err, os.FileMode(0751))
+	}
+
+	// but not once it's been swapped for something else since it was
+	// visited
+	tests := []struct {
+		name string
+		swap func() error
+	}{
+		{"symbolic link", func() error { return os.Symlink(secret, src) }},
+		{"other file", func() error { return os.Rename(other, src) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(src)
+			if err := tt.swap(); err != nil {
+				t.Fatal(err)
+			}
+			dest := filepath.Join(dir, "dest-"+strings.Replace(tt.name, " ", "-", -1))
+			err := copyFile(src, dest, fi)
+			if err == nil || !strings.Contains(err.Error(), "changed while being imported") {
+				t.Errorf("got error %v, want one saying the file changed", err)
+			}
+			if _, err := os.Lstat(dest); !os.IsNotExist(err) {
+				t.Errorf("%s was created: %v", dest, err)
+			}
+		})
+	}
+}
+
+// makeWritable makes the directories under dir writable again, so
+// that they can be removed.
+func makeWritable(dir string) {
+	filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err == nil && fi.IsDir() {
+			os.Chmod(p, 0755)
+		}
+		return nil
+	})
+}
+
+func TestImportDirModes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retrieve-local-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	files := map[string]string{
+		"shared/a.txt":         "a\n",
+		"private/b.txt":        "b\n",
+		"readonly/inner/c.txt": "c\n",
+		"left-out/d.log":       "d\n",
+	}
+	for name, body := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	modes := map[string]os.FileMode{
+		"shared":         0775,
+		"private":        0700,
+		"readonly/inner": 0555,
+		"readonly":       0555,
+	}
+	defer makeWritable(src)
+	for name, mode := range modes {
+		if err := os.Chmod(filepath.Join(src, filepath.FromSlash(name)), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, link := range []bool{false, true} {
+		name := "copy"
+		if link {
+			name = "hardlink"
+		}
+		t.Run(name, func(t *testing.T) {
+			dest := filepath.Join(dir, name)
+			if err := os.Mkdir(dest, 0755); err != nil {
+				t.Fatal(err)
+			}
+			defer makeWritable(dest)
+
+			im := &importer{
+				ctx:      context.Background(),
+				src:      src,
+				dest:     dest,
+				link:     link,
+				includes: []string{"shared/", "private/", "readonly/"},
+				rpt:      &testReporter{},
+			}
+			if err := im.run(); err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+			if im.files != 3 {
+				t.Errorf("imported %d files, want 3", im.files)
+			}
+			for name, want := range modes {
+				fi, err := os.Stat(filepath.Join(dest, filepath.FromSlash(name)))
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+				} else if fi.Mode().Perm() != want {
+					t.Errorf("%s: got mode %v, want %v", name, fi.Mode().Perm(), want)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(dest, "left-out")); !os.IsNotExist(err) {
+				t.Errorf("left-out was created: %v", err)
+			}
+		})
+	}
+}
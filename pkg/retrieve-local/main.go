@@ -0,0 +1,28 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"log"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+)
+
+const (
+	port = ":3014"
+)
+
+func main() {
+	// find out where jobs may import code from
+	roots, err := allowedRootsFromEnv()
+	if err != nil {
+		log.Fatalf("couldn't set up allowed roots: %v", err)
+	}
+	if len(roots) == 0 {
+		log.Printf("%s is not set; all jobs will be refused", allowedRootsEnv)
+	}
+
+	// serve jobs until we're asked to shut down
+	if err := agentkit.Serve(port, &retrieveLocal{roots: roots}); err != nil {
+		log.Fatal(err)
+	}
+}
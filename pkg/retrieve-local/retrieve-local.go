@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+const (
+	modeCopy = "copy"
+	modeLink = "hardlink"
+)
+
+type retrieveLocal struct {
+	// roots are the directories that jobs may import code from.
+	roots []string
+}
+
+// Run is the function that actually carries out the substantive
+// action of the agent, for this job.
+func (ag *retrieveLocal) Run(ctx context.Context, cfg agent.JobConfig, rpt agentkit.Reporter) error {
+	// make sure we've got the config values we need
+	srcPath := ""
+	mode := modeCopy
+	name := ""
+	version := ""
+	includes := []string{}
+	excludes := []string{}
+
+	for _, jkv := range cfg.Jkvs {
+		switch jkv.Key {
+		case "path":
+			srcPath = jkv.Value
+		case "mode":
+			mode = jkv.Value
+		case "name":
+			name = jkv.Value
+		case "version":
+			version = jkv.Value
+		case "include", "exclude":
+			if err := agentkit.ValidatePathPattern(jkv.Value); err != nil {
+				return err
+			}
+			if jkv.Key == "include" {
+				includes = append(includes, jkv.Value)
+			} else {
+				excludes = append(excludes, jkv.Value)
+			}
+		}
+	}
+
+	if srcPath == "" {
+		return fmt.Errorf("path key/value not specified")
+	}
+	if mode != modeCopy && mode != modeLink {
+		return fmt.Errorf("mode %q is invalid; must be %s or %s", mode, modeCopy, modeLink)
+	}
+
+	src, err := resolveSourcePath(filepath.Clean(srcPath), ag.roots)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("couldn't read path %s: %v", srcPath, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("path %s is not a directory", srcPath)
+	}
+
+	// check that we've got an empty directory to import into, and that
+	// it isn't inside what we're importing
+	if err := agentkit.PrepareCodeOutputDir(cfg.CodeOutputDir); err != nil {
+		return err
+	}
+	dest, err := filepath.EvalSymlinks(cfg.CodeOutputDir)
+	if err != nil {
+		return fmt.Errorf("couldn't resolve codeOutputDir %s: %v", cfg.CodeOutputDir, err)
+	}
+	if dest, err = filepath.Abs(dest); err != nil {
+		return fmt.Errorf("couldn't resolve codeOutputDir %s: %v", cfg.CodeOutputDir, err)
+	}
+	if isWithin(dest, src) {
+		return fmt.Errorf("codeOutputDir %s is inside path %s", cfg.CodeOutputDir, srcPath)
+	}
+
+	// we're all configured; set status as running
+	rpt.Running()
+
+	// from here on, if we fail, remove anything that we've imported
+	// so that later agents don't pick up part of the tree
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			agentkit.RemoveDirContents(cfg.CodeOutputDir)
+		}
+	}()
+
+	im := &importer{
+		ctx:      ctx,
+		src:      src,
+		dest:     dest,
+		link:     mode == modeLink,
+		includes: includes,
+		excludes: excludes,
+		rpt:      rpt,
+	}
+	if err := im.run(); err != nil {
+		return fmt.Errorf("couldn't import %s: %v", srcPath, err)
+	}
+	if im.unsafeLinks > 0 {
+		rpt.Degraded(fmt.Sprintf("left out %d symbolic links that point outside %s", im.unsafeLinks, srcPath))
+	}
+
+	// record where the code came from, for later agents
+	if cfg.SpdxOutputDir != "" {
+		prov := &agentkit.Provenance{
+			Agent:            "retrieve-local",
+			Name:             name,
+			URL:              (&url.URL{Scheme: "file", Path: filepath.ToSlash(srcPath)}).String(),
+			DownloadLocation: "NOASSERTION",
+			Version:          version,
+			RetrievedAt:      time.Now().UTC().Truncate(time.Second),
+		}
+		if err := agentkit.WriteProvenance(cfg.SpdxOutputDir, prov); err != nil {
+			return err
+		}
+	}
+
+	rpt.Output(fmt.Sprintf("path: %s\nmode: %s\nfiles: %d\nexcluded: %d", srcPath, mode, im.files, im.excluded))
+
+	// success!
+	succeeded = true
+	return nil
+}
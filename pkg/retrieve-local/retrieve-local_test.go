@@ -0,0 +1,269 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// testReporter records what a job reports.
+type testReporter struct {
+	running bool
+	output  []string
+}
+
+func (r *testReporter) Running()                     { r.running = true }
+func (r *testReporter) Output(msg string)            { r.output = append(r.output, msg) }
+func (r *testReporter) Degraded(msg string)          { r.output = append(r.output, msg) }
+func (r *testReporter) Progress(p agentkit.Progress) {}
+
+// testTree lays out, under a new directory, an allowed root holding a
+// project, and things outside it, and returns the directory with any
+// symbolic links in it resolved.
+func testTree(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "retrieve-local-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"allowed/project/README":     "readme\n",
+		"allowed/project/src/a.go":   "package a\n",
+		"allowed/project/src/a.log":  "log\n",
+		"allowed/project/docs/x.txt": "docs\n",
+		"allowed-other/project/b.go": "package b\n",
+		"outside/secret":             "secret\n",
+	}
+	for name, body := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		// a link out of the allowed root
+		"allowed/escape": "../outside",
+		// links inside the project: one that stays in it, one that
+		// leaves it, and one that only leaves it by way of another
+		"allowed/project/readme-link": "README",
+		"allowed/project/secret-link": "../../outside/secret",
+		"allowed/project/src/up":      "..",
+		"allowed/project/chained":     "src/up/..",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	dir := testTree(t)
+	defer os.RemoveAll(dir)
+	allowed := filepath.Join(dir, "allowed")
+
+	tests := []struct {
+		name        string
+		path        string
+		jkvs        map[string]string
+		roots       []string
+		wantErr     string
+		wantRunning bool
+		// wantFiles are the regular files imported, and wantLinks the
+		// symbolic links
+		wantFiles map[string]string
+		wantLinks []string
+		// wantDegraded is part of the message about links left out
+		wantDegraded string
+	}{
+		{
+			name:         "copy",
+			path:         filepath.Join(allowed, "project"),
+			roots:        []string{allowed},
+			wantRunning:  true,
+			wantFiles:    map[string]string{"README": "readme\n", "src/a.go": "package a\n", "src/a.log": "log\n", "docs/x.txt": "docs\n"},
+			wantLinks:    []string{"readme-link", "src/up"},
+			wantDegraded: "left out 2 symbolic links",
+		},
+		{
+			name:         "hard links, include and exclude",
+			path:         filepath.Join(allowed, "project"),
+			jkvs:         map[string]string{"mode": "hardlink", "include": "src/", "exclude": "*.log"},
+			roots:        []string{allowed},
+			wantRunning:  true,
+			wantFiles:    map[string]string{"src/a.go": "package a\n"},
+			wantLinks:    []string{"src/up"},
+			wantDegraded: "",
+		},
+		{
+			name:    "dot-dot out of root",
+			path:    filepath.Join(allowed, "project", "..", "..", "outside"),
+			roots:   []string{allowed},
+			wantErr: "is not within any of the allowed roots",
+		},
+		{
+			name:    "symbolic link out of root",
+			path:    filepath.Join(allowed, "escape"),
+			roots:   []string{allowed},
+			wantErr: "is not within any of the allowed roots",
+		},
+		{
+			name:    "sibling with root as prefix",
+			path:    filepath.Join(dir, "allowed-other", "project"),
+			roots:   []string{allowed},
+			wantErr: "is not within any of the allowed roots",
+		},
+		{
+			name:    "relative path",
+			path:    "allowed/project",
+			roots:   []string{allowed},
+			wantErr: "is not an absolute path",
+		},
+		{
+			name:    "no roots",
+			path:    filepath.Join(allowed, "project"),
+			wantErr: "no allowed roots are configured",
+		},
+		{
+			name:    "bad mode",
+			path:    filepath.Join(allowed, "project"),
+			jkvs:    map[string]string{"mode": "move"},
+			roots:   []string{allowed},
+			wantErr: `mode "move" is invalid`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outDir, err := ioutil.TempDir("", "retrieve-local-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(outDir)
+			codeDir := filepath.Join(outDir, "code")
+
+			cfg := agent.JobConfig{
+				CodeOutputDir: codeDir,
+				Jkvs:          []*agent.JobConfig_JobKV{{Key: "path", Value: tt.path}},
+			}
+			for k, v := range tt.jkvs {
+				cfg.Jkvs = append(cfg.Jkvs, &agent.JobConfig_JobKV{Key: k, Value: v})
+			}
+			rpt := &testReporter{}
+			err = (&retrieveLocal{roots: tt.roots}).Run(context.Background(), cfg, rpt)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+			if rpt.running != tt.wantRunning {
+				t.Errorf("got running %t, want %t", rpt.running, tt.wantRunning)
+			}
+			if tt.wantErr != "" {
+				return
+			}
+
+			degraded := ""
+			for _, msg := range rpt.output {
+				if strings.HasPrefix(msg, "left out") {
+					degraded = msg
+				}
+			}
+			if tt.wantDegraded == "" && degraded != "" || !strings.Contains(degraded, tt.wantDegraded) {
+				t.Errorf("got message about links %q, want %q", degraded, tt.wantDegraded)
+			}
+
+			gotFiles := map[string]string{}
+			gotLinks := []string{}
+			filepath.Walk(codeDir, func(p string, fi os.FileInfo, err error) error {
+				if err != nil {
+					return nil
+				}
+				rel, _ := filepath.Rel(codeDir, p)
+				rel = filepath.ToSlash(rel)
+				switch {
+				case fi.Mode()&os.ModeSymlink != 0:
+					gotLinks = append(gotLinks, rel)
+				case fi.Mode().IsRegular():
+					b, _ := ioutil.ReadFile(p)
+					gotFiles[rel] = string(b)
+				}
+				return nil
+			})
+			if len(gotFiles) != len(tt.wantFiles) {
+				t.Errorf("got files %v, want %v", gotFiles, tt.wantFiles)
+			}
+			for name, want := range tt.wantFiles {
+				if gotFiles[name] != want {
+					t.Errorf("%s: got %q, want %q", name, gotFiles[name], want)
+				}
+			}
+			if strings.Join(gotLinks, " ") != strings.Join(tt.wantLinks, " ") {
+				t.Errorf("got symbolic links %v, want %v", gotLinks, tt.wantLinks)
+			}
+
+			// hard-linked files are the originals
+			srcInfo, err := os.Stat(filepath.Join(tt.path, "src", "a.go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			destInfo, err := os.Stat(filepath.Join(codeDir, "src", "a.go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if linked := os.SameFile(srcInfo, destInfo); linked != (tt.jkvs["mode"] == modeLink) {
+				t.Errorf("got src/a.go linked %t, want %t", linked, tt.jkvs["mode"] == modeLink)
+			}
+		})
+	}
+}
+
+func TestCodeOutputDirInsideSource(t *testing.T) {
+	dir := testTree(t)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "allowed", "project")
+
+	cfg := agent.JobConfig{
+		CodeOutputDir: filepath.Join(src, "out"),
+		Jkvs:          []*agent.JobConfig_JobKV{{Key: "path", Value: src}},
+	}
+	err := (&retrieveLocal{roots: []string{filepath.Join(dir, "allowed")}}).Run(context.Background(), cfg, &testReporter{})
+	if err == nil || !strings.Contains(err.Error(), "is inside path") {
+		t.Errorf("got error %v, want one saying codeOutputDir is inside path", err)
+	}
+}
+
+func TestIsSafeLinkTarget(t *testing.T) {
+	tests := []struct {
+		rel    string
+		target string
+		want   bool
+	}{
+		{"a", "b", true},
+		{"dir/a", "../b", true},
+		{"dir/a", "../../b", false},
+		{"a", "..", false},
+		{"a", "/etc/passwd", false},
+		{"a", "", false},
+		{"dir/sub/a", "../x/../../b", true},
+	}
+	for _, tt := range tests {
+		if got := isSafeLinkTarget(tt.rel, tt.target); got != tt.want {
+			t.Errorf("isSafeLinkTarget(%q, %q) = %t, want %t", tt.rel, tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// allowedRootsEnv names the environment variable that lists the
+// directories that jobs may import code from, separated as in PATH.
+// It is set where the agent runs rather than in each job, so that a
+// job can't give itself access to the rest of the filesystem. If it
+// isn't set, every job is refused.
+const allowedRootsEnv = "RETRIEVE_LOCAL_ALLOWED_ROOTS"
+
+// allowedRootsFromEnv returns the allowed roots that the agent's
+// environment configures, with any symbolic links in them resolved.
+func allowedRootsFromEnv() ([]string, error) {
+	roots := []string{}
+	for _, root := range filepath.SplitList(os.Getenv(allowedRootsEnv)) {
+		if root == "" {
+			continue
+		}
+		if !filepath.IsAbs(root) {
+			return nil, fmt.Errorf("allowed root %s is not an absolute path", root)
+		}
+		resolved, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't resolve allowed root %s: %v", root, err)
+		}
+		roots = append(roots, resolved)
+	}
+	return roots, nil
+}
+
+// isWithin reports whether p is dir or something inside it. Both must
+// be clean, absolute paths.
+func isWithin(p string, dir string) bool {
+	if p == dir {
+		return true
+	}
+	return strings.HasPrefix(p, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// resolveSourcePath resolves any symbolic links in src, an absolute
+// path, and checks that the result is within one of roots. It returns
+// the resolved path, which is what should be read from, so that the
+// check can't be got around by changing a link afterwards.
+func resolveSourcePath(src string, roots []string) (string, error) {
+	if !filepath.IsAbs(src) {
+		return "", fmt.Errorf("path %s is not an absolute path", src)
+	}
+	if len(roots) == 0 {
+		return "", fmt.Errorf("no allowed roots are configured; set %s where the agent runs", allowedRootsEnv)
+	}
+	resolved, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return "", fmt.Errorf("couldn't resolve path %s: %v", src, err)
+	}
+	for _, root := range roots {
+		if isWithin(resolved, root) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("path %s is not within any of the allowed roots", src)
+}
@@ -0,0 +1,26 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"log"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+)
+
+const (
+	port = ":3016"
+)
+
+func main() {
+	// find out where to get packages from
+	registry, err := registryFromEnv()
+	if err != nil {
+		log.Fatalf("couldn't set up npm registry: %v", err)
+	}
+	log.Printf("using npm registry %s", registry)
+
+	// serve jobs until we're asked to shut down
+	if err := agentkit.Serve(port, &retrieveNpm{registry: registry}); err != nil {
+		log.Fatal(err)
+	}
+}
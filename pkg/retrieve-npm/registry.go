@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit/archive"
+)
+
+const (
+	// registryEnv names the environment variable that gives the base
+	// URL of the npm registry to download from. It may be a file URL,
+	// for a mirror with each package's metadata in a file named after
+	// the package.
+	registryEnv     = "RETRIEVE_NPM_REGISTRY"
+	defaultRegistry = "https://registry.npmjs.org"
+)
+
+// registryFromEnv returns the base URL of the registry that the agent's
+// environment configures.
+func registryFromEnv() (string, error) {
+	registry := os.Getenv(registryEnv)
+	if registry == "" {
+		registry = defaultRegistry
+	}
+	return archive.ValidateBaseURL(registry)
+}
+
+// packageNameRe matches valid npm package names, which may have a
+// scope.
+var packageNameRe = regexp.MustCompile(`^(@[a-z0-9-~][a-z0-9-._~]*/)?[a-z0-9-~][a-z0-9-._~]*$`)
+
+// packument is the part of a package's metadata document from the
+// registry that we need.
+type packument struct {
+	DistTags map[string]string         `json:"dist-tags"`
+	Versions map[string]packageVersion `json:"versions"`
+}
+
+type packageVersion struct {
+	Dist struct {
+		Tarball   string `json:"tarball"`
+		Integrity string `json:"integrity"`
+		Shasum    string `json:"shasum"`
+	} `json:"dist"`
+}
+
+// release is one published version of a package.
+type release struct {
+	version    string
+	tarballURL string
+	// integrity is the Subresource Integrity string that the registry
+	// published, or "" if it only published a SHA-1 shasum.
+	integrity string
+	checksums archive.Checksums
+}
+
+// findRelease fetches the metadata for pkg from registry, and returns
+// the release for version, which may also be a dist-tag such as
+// "latest".
+func findRelease(ctx context.Context, registry string, pkg string, version string) (*release, error) {
+	// scoped packages keep the "@" but escape the "/"
+	docURL := registry + "/" + strings.Replace(pkg, "/", "%2f", 1)
+	js, err := archive.Fetch(ctx, docURL)
+	if err != nil {
+		return nil, err
+	}
+	doc := &packument{}
+	if err := json.Unmarshal(js, doc); err != nil {
+		return nil, fmt.Errorf("couldn't parse metadata for %s: %v", pkg, err)
+	}
+
+	pv, ok := doc.Versions[version]
+	if !ok {
+		tagged, isTag := doc.DistTags[version]
+		if !isTag {
+			return nil, fmt.Errorf("package %s has no version %s", pkg, version)
+		}
+		version = tagged
+		if pv, ok = doc.Versions[version]; !ok {
+			return nil, fmt.Errorf("package %s has no version %s", pkg, version)
+		}
+	}
+
+	rel := &release{version: version, integrity: pv.Dist.Integrity}
+	rel.tarballURL, err = resolveTarballURL(docURL, pv.Dist.Tarball)
+	if err != nil {
+		return nil, fmt.Errorf("package %s@%s: %v", pkg, version, err)
+	}
+	rel.checksums, err = parseIntegrity(pv.Dist.Integrity, pv.Dist.Shasum)
+	if err != nil {
+		return nil, fmt.Errorf("package %s@%s: %v", pkg, version, err)
+	}
+	return rel, nil
+}
+
+// resolveTarballURL resolves tarball, which may be relative, against
+// docURL, the URL of the metadata document that gave it. Only a
+// registry that is itself a file URL may give a file URL.
+func resolveTarballURL(docURL string, tarball string) (string, error) {
+	if tarball == "" {
+		return "", fmt.Errorf("no tarball URL published")
+	}
+	base, err := url.Parse(docURL)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(tarball)
+	if err != nil {
+		return "", fmt.Errorf("tarball URL %q is invalid: %v", tarball, err)
+	}
+	u := base.ResolveReference(ref)
+	switch u.Scheme {
+	case "http", "https":
+	case "file":
+		if base.Scheme != "file" {
+			return "", fmt.Errorf("tarball URL %q is a file URL, from a registry that isn't", tarball)
+		}
+	default:
+		return "", fmt.Errorf("tarball URL %q has unsupported scheme %q", tarball, u.Scheme)
+	}
+	if u.User != nil {
+		return "", fmt.Errorf("tarball URL for %s must not include a user name or password", u.Host)
+	}
+	return u.String(), nil
+}
+
+// integrityAlgs maps the hash algorithms that can appear in an npm
+// integrity string to their SPDX names.
+var integrityAlgs = map[string]string{
+	"sha1":   "SHA1",
+	"sha256": "SHA256",
+	"sha512": "SHA512",
+}
+
+// parseIntegrity turns integrity, a Subresource Integrity string such as
+// "sha512-<base64>", and shasum, a hex SHA-1 that older packages have
+// instead, into the checksums that the tarball must match.
+func parseIntegrity(integrity string, shasum string) (archive.Checksums, error) {
+	sums := archive.Checksums{}
+	for _, field := range strings.Fields(integrity) {
+		parts := strings.SplitN(field, "-", 2)
+		alg, ok := integrityAlgs[parts[0]]
+		if !ok || len(parts) != 2 {
+			// SRI says to ignore algorithms we don't know
+			continue
+		}
+		// drop any "?" options after the hash
+		b64 := strings.SplitN(parts[1], "?", 2)[0]
+		raw, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, fmt.Errorf("integrity %q is invalid: %v", field, err)
+		}
+		sum := hex.EncodeToString(raw)
+		if err := archive.ValidateChecksum(alg, sum); err != nil {
+			return nil, fmt.Errorf("integrity %q is invalid: %v", field, err)
+		}
+		sums[alg] = sum
+	}
+
+	if shasum != "" {
+		if err := archive.ValidateChecksum("SHA1", shasum); err != nil {
+			return nil, err
+		}
+		if _, ok := sums["SHA1"]; !ok {
+			sums["SHA1"] = shasum
+		}
+	}
+
+	if len(sums) == 0 {
+		return nil, fmt.Errorf("no checksum published")
+	}
+	return sums, nil
+}
@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/archive"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+type retrieveNpm struct {
+	// registry is the base URL of the npm registry.
+	registry string
+}
+
+// Run is the function that actually carries out the substantive
+// action of the agent, for this job.
+func (ag *retrieveNpm) Run(ctx context.Context, cfg agent.JobConfig, rpt agentkit.Reporter) error {
+	// make sure we've got the config values we need
+	pkg := ""
+	version := ""
+	var expected archive.Checksums
+
+	for _, jkv := range cfg.Jkvs {
+		switch jkv.Key {
+		case "package":
+			pkg = jkv.Value
+		case "version":
+			version = jkv.Value
+		case "integrity":
+			sums, err := parseIntegrity(jkv.Value, "")
+			if err != nil {
+				return err
+			}
+			expected = sums
+		}
+	}
+
+	if pkg == "" {
+		return fmt.Errorf("package key/value not specified")
+	}
+	if !packageNameRe.MatchString(pkg) {
+		return fmt.Errorf("package %q is not a valid npm package name", pkg)
+	}
+	if version == "" {
+		return fmt.Errorf("version key/value not specified")
+	}
+
+	// check that we've got an empty directory to unpack into
+	if err := agentkit.PrepareCodeOutputDir(cfg.CodeOutputDir); err != nil {
+		return err
+	}
+
+	// we're all configured; set status as running
+	rpt.Running()
+
+	// from here on, if we fail, remove anything that we've unpacked
+	// so that later agents don't pick up part of a package
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			agentkit.RemoveDirContents(cfg.CodeOutputDir)
+		}
+	}()
+
+	rel, err := findRelease(ctx, ag.registry, pkg, version)
+	if err != nil {
+		return err
+	}
+
+	tarballPath, sums, err := archive.Download(ctx, rel.tarballURL, rpt)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tarballPath)
+
+	// don't unpack anything that isn't what was published, or what the
+	// job expected
+	if err := sums.Verify(rel.checksums); err != nil {
+		return fmt.Errorf("downloaded %s, but %v", rel.tarballURL, err)
+	}
+	if err := sums.Verify(expected); err != nil {
+		return fmt.Errorf("downloaded %s, but %v", rel.tarballURL, err)
+	}
+
+	// npm tarballs keep everything in one top-level directory, which
+	// is usually "package"
+	files, err := archive.Extract(ctx, tarballPath, archive.FormatTarGz, cfg.CodeOutputDir, archive.Options{StripComponents: 1}, rpt)
+	if err != nil {
+		return fmt.Errorf("couldn't extract %s: %v", rel.tarballURL, err)
+	}
+
+	// record where the code came from, for later agents
+	if cfg.SpdxOutputDir != "" {
+		prov := &agentkit.Provenance{
+			Agent:            "retrieve-npm",
+			Name:             pkg,
+			URL:              rel.tarballURL,
+			DownloadLocation: rel.tarballURL,
+			Version:          rel.version,
+			Checksums: map[string]string{
+				"SHA1":   sums["SHA1"],
+				"SHA256": sums["SHA256"],
+			},
+			RetrievedAt: time.Now().UTC().Truncate(time.Second),
+		}
+		if err := agentkit.WriteProvenance(cfg.SpdxOutputDir, prov); err != nil {
+			return err
+		}
+	}
+
+	verified := "integrity: " + rel.integrity
+	if rel.integrity == "" {
+		verified = "shasum: " + sums["SHA1"]
+	}
+	rpt.Output(fmt.Sprintf("package: %s\nversion: %s\n%s\nfiles: %d", pkg, rel.version, verified, files))
+
+	// success!
+	succeeded = true
+	return nil
+}
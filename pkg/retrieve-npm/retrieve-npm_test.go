@@ -0,0 +1,224 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// testReporter records what a job reports.
+type testReporter struct {
+	running bool
+	output  []string
+}
+
+func (r *testReporter) Running()                     { r.running = true }
+func (r *testReporter) Output(msg string)            { r.output = append(r.output, msg) }
+func (r *testReporter) Degraded(msg string)          { r.output = append(r.output, msg) }
+func (r *testReporter) Progress(p agentkit.Progress) {}
+
+// tarGz returns a gzipped tar archive of files, which map names to
+// contents.
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, body := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(body))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRun(t *testing.T) {
+	tarball := tarGz(t, map[string]string{"package/index.js": "module.exports = 1;\n"})
+	sha512sum := sha512.Sum512(tarball)
+	sha256sum := sha256.Sum256(tarball)
+	integrity := "sha512-" + base64.StdEncoding.EncodeToString(sha512sum[:])
+	wrongIntegrity := "sha512-" + base64.StdEncoding.EncodeToString(make([]byte, sha512.Size))
+	shasum := fmt.Sprintf("%x", sha1.Sum(tarball))
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/left-pad/-/") {
+			w.Write(tarball)
+			return
+		}
+		if r.URL.Path != "/left-pad" {
+			http.NotFound(w, r)
+			return
+		}
+		dist := func(version string, integrity string, shasum string) map[string]interface{} {
+			return map[string]interface{}{"dist": map[string]string{
+				"tarball":   srv.URL + "/left-pad/-/left-pad-" + version + ".tgz",
+				"integrity": integrity,
+				"shasum":    shasum,
+			}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"dist-tags": map[string]string{"latest": "1.0.0"},
+			"versions": map[string]interface{}{
+				"1.0.0": dist("1.0.0", integrity, shasum),
+				"1.0.1": dist("1.0.1", wrongIntegrity, shasum),
+				"0.9.0": dist("0.9.0", "", shasum),
+				"0.9.1": dist("0.9.1", "", strings.Repeat("0", 40)),
+			},
+		})
+	}))
+	defer srv.Close()
+	wantFiles := map[string]string{"index.js": "module.exports = 1;\n"}
+
+	tests := []struct {
+		name        string
+		jkvs        map[string]string
+		wantErr     string
+		wantRunning bool
+		wantFiles   map[string]string
+		wantOutput  string
+	}{
+		{
+			name:        "integrity",
+			jkvs:        map[string]string{"package": "left-pad", "version": "1.0.0"},
+			wantRunning: true,
+			wantFiles:   wantFiles,
+			wantOutput:  "integrity: " + integrity,
+		},
+		{
+			name:        "dist-tag",
+			jkvs:        map[string]string{"package": "left-pad", "version": "latest"},
+			wantRunning: true,
+			wantFiles:   wantFiles,
+			wantOutput:  "version: 1.0.0",
+		},
+		{
+			name:        "job integrity",
+			jkvs:        map[string]string{"package": "left-pad", "version": "1.0.0", "integrity": "sha256-" + base64.StdEncoding.EncodeToString(sha256sum[:])},
+			wantRunning: true,
+			wantFiles:   wantFiles,
+		},
+		{
+			name:        "shasum only",
+			jkvs:        map[string]string{"package": "left-pad", "version": "0.9.0"},
+			wantRunning: true,
+			wantFiles:   wantFiles,
+			wantOutput:  "shasum: " + shasum,
+		},
+		{
+			name:        "wrong published integrity",
+			jkvs:        map[string]string{"package": "left-pad", "version": "1.0.1"},
+			wantErr:     "SHA512 checksum mismatch",
+			wantRunning: true,
+			wantFiles:   map[string]string{},
+		},
+		{
+			name:        "wrong published shasum",
+			jkvs:        map[string]string{"package": "left-pad", "version": "0.9.1"},
+			wantErr:     "SHA1 checksum mismatch",
+			wantRunning: true,
+			wantFiles:   map[string]string{},
+		},
+		{
+			name:        "wrong job integrity",
+			jkvs:        map[string]string{"package": "left-pad", "version": "1.0.0", "integrity": "sha256-" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))},
+			wantErr:     "SHA256 checksum mismatch",
+			wantRunning: true,
+			wantFiles:   map[string]string{},
+		},
+		{
+			name:        "unknown version",
+			jkvs:        map[string]string{"package": "left-pad", "version": "2.0.0"},
+			wantErr:     "has no version 2.0.0",
+			wantRunning: true,
+			wantFiles:   map[string]string{},
+		},
+		{
+			name:    "malformed integrity",
+			jkvs:    map[string]string{"package": "left-pad", "version": "1.0.0", "integrity": "sha512-!!!"},
+			wantErr: "is invalid",
+		},
+		{
+			name:    "invalid package name",
+			jkvs:    map[string]string{"package": "Left Pad", "version": "1.0.0"},
+			wantErr: "not a valid npm package name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "retrieve-npm-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			codeDir := filepath.Join(dir, "code")
+
+			cfg := agent.JobConfig{CodeOutputDir: codeDir}
+			for k, v := range tt.jkvs {
+				cfg.Jkvs = append(cfg.Jkvs, &agent.JobConfig_JobKV{Key: k, Value: v})
+			}
+			rpt := &testReporter{}
+			err = (&retrieveNpm{registry: srv.URL}).Run(context.Background(), cfg, rpt)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+			if rpt.running != tt.wantRunning {
+				t.Errorf("got running %t, want %t", rpt.running, tt.wantRunning)
+			}
+			if tt.wantOutput != "" && (len(rpt.output) != 1 || !strings.Contains(rpt.output[0], tt.wantOutput)) {
+				t.Errorf("got output %q, want one containing %q", rpt.output, tt.wantOutput)
+			}
+			if tt.wantFiles == nil {
+				return
+			}
+
+			got := map[string]string{}
+			filepath.Walk(codeDir, func(p string, fi os.FileInfo, err error) error {
+				if err == nil && fi.Mode().IsRegular() {
+					rel, _ := filepath.Rel(codeDir, p)
+					b, _ := ioutil.ReadFile(p)
+					got[filepath.ToSlash(rel)] = string(b)
+				}
+				return nil
+			})
+			if len(got) != len(tt.wantFiles) {
+				t.Errorf("got files %v, want %v", got, tt.wantFiles)
+			}
+			for name, want := range tt.wantFiles {
+				if got[name] != want {
+					t.Errorf("%s: got %q, want %q", name, got[name], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+module github.com/swinslow/peridot-agents/pkg/retrieve-pypi
+
+go 1.13
+
+require (
+	github.com/swinslow/peridot-agents/pkg/agentkit v0.0.0
+	github.com/swinslow/peridot-jobrunner v0.0.0-20191124161321-701dbac8170c
+	golang.org/x/net v0.0.0-20191112182307-2180aed22343
+)
+
+replace github.com/swinslow/peridot-agents/pkg/agentkit => ../agentkit
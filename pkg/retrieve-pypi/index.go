@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit/archive"
+	"golang.org/x/net/html"
+)
+
+const (
+	// indexEnv names the environment variable that gives the base URL
+	// of the PyPI simple index to download from. It may be a file URL,
+	// for a mirror with each project's page in <project>/index.html.
+	indexEnv     = "RETRIEVE_PYPI_INDEX"
+	defaultIndex = "https://pypi.org/simple"
+)
+
+// indexFromEnv returns the base URL of the index that the agent's
+// environment configures.
+func indexFromEnv() (string, error) {
+	index := os.Getenv(indexEnv)
+	if index == "" {
+		index = defaultIndex
+	}
+	return archive.ValidateBaseURL(index)
+}
+
+// projectNameRe matches valid Python project names.
+var projectNameRe = regexp.MustCompile(`^([A-Za-z0-9]|[A-Za-z0-9][A-Za-z0-9._-]*[A-Za-z0-9])$`)
+
+// normalizeRe matches the runs of characters that PEP 503 treats as
+// the same.
+var normalizeRe = regexp.MustCompile(`[-_.]+`)
+
+// normalizeName returns the PEP 503 normalized form of a project name,
+// which is how the simple index names each project's page.
+func normalizeName(name string) string {
+	return strings.ToLower(normalizeRe.ReplaceAllString(name, "-"))
+}
+
+// sdistFormats are the source distribution file extensions we can
+// unpack, with their archive formats.
+var sdistFormats = []struct {
+	ext    string
+	format archive.Format
+}{
+	{".tar.gz", archive.FormatTarGz},
+	{".tar.bz2", archive.FormatTarBz2},
+	{".zip", archive.FormatZip},
+}
+
+// sdist is a project's source distribution for one version.
+type sdist struct {
+	filename string
+	url      string
+	format   archive.Format
+	sha256   string
+}
+
+// findSdist fetches the simple index page for project, and returns its
+// source distribution for version.
+func findSdist(ctx context.Context, index string, project string, version string) (*sdist, error) {
+	pageURL := index + "/" + normalizeName(project) + "/"
+	fetchURL := pageURL
+	if strings.HasPrefix(pageURL, "file:") {
+		fetchURL += "index.html"
+	}
+	page, err := archive.Fetch(ctx, fetchURL)
+	if err != nil {
+		return nil, err
+	}
+	links, err := parseLinks(page)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse index page for %s: %v", project, err)
+	}
+
+	for _, href := range links {
+		ref, err := url.Parse(href)
+		if err != nil {
+			continue
+		}
+		filename := path.Base(ref.Path)
+		format, ok := sdistFormat(filename, project, version)
+		if !ok {
+			continue
+		}
+		u, err := resolveFileURL(pageURL, href)
+		if err != nil {
+			return nil, fmt.Errorf("project %s: %v", project, err)
+		}
+
+		sd := &sdist{filename: filename, format: format}
+		if frag, err := url.ParseQuery(u.Fragment); err == nil {
+			sd.sha256 = frag.Get("sha256")
+		}
+		if sd.sha256 == "" {
+			return nil, fmt.Errorf("project %s: no sha256 published for %s", project, filename)
+		}
+		if err := archive.ValidateChecksum("SHA256", sd.sha256); err != nil {
+			return nil, fmt.Errorf("project %s: %v", project, err)
+		}
+		u.Fragment = ""
+		sd.url = u.String()
+		return sd, nil
+	}
+	return nil, fmt.Errorf("project %s has no source distribution for version %s", project, version)
+}
+
+// parseLinks returns the targets of the links in an index page.
+func parseLinks(page []byte) ([]string, error) {
+	links := []string{}
+	z := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			return links, nil
+		case html.StartTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) != "a" || !hasAttr {
+				continue
+			}
+			for {
+				key, val, more := z.TagAttr()
+				if string(key) == "href" {
+					links = append(links, string(val))
+				}
+				if !more {
+					break
+				}
+			}
+		}
+	}
+}
+
+// resolveFileURL resolves href, which may be relative, against pageURL,
+// the index page that it came from. Only an index that is itself a file
+// URL may give a file URL.
+func resolveFileURL(pageURL string, href string) (*url.URL, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return nil, fmt.Errorf("link %q is invalid: %v", href, err)
+	}
+	u := base.ResolveReference(ref)
+	switch u.Scheme {
+	case "http", "https":
+	case "file":
+		if base.Scheme != "file" {
+			return nil, fmt.Errorf("link %q is a file URL, from an index that isn't", href)
+		}
+	default:
+		return nil, fmt.Errorf("link %q has unsupported scheme %q", href, u.Scheme)
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("link for %s must not include a user name or password", u.Host)
+	}
+	return u, nil
+}
+
+// sdistFormat reports whether filename is the source distribution of
+// project at version, and if so what format it is in. Source
+// distributions are named "<name>-<version><ext>", where the name may
+// be spelled differently from project but normalizes the same.
+func sdistFormat(filename string, project string, version string) (archive.Format, bool) {
+	for _, sf := range sdistFormats {
+		if !strings.HasSuffix(filename, sf.ext) {
+			continue
+		}
+		base := strings.TrimSuffix(filename, sf.ext)
+		i := strings.LastIndex(base, "-")
+		if i < 0 {
+			return "", false
+		}
+		if normalizeName(base[:i]) != normalizeName(project) || !strings.EqualFold(base[i+1:], version) {
+			return "", false
+		}
+		return sf.format, true
+	}
+	return "", false
+}
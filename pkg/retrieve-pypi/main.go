@@ -0,0 +1,26 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"log"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+)
+
+const (
+	port = ":3017"
+)
+
+func main() {
+	// find out where to get packages from
+	index, err := indexFromEnv()
+	if err != nil {
+		log.Fatalf("couldn't set up package index: %v", err)
+	}
+	log.Printf("using package index %s", index)
+
+	// serve jobs until we're asked to shut down
+	if err := agentkit.Serve(port, &retrievePypi{index: index}); err != nil {
+		log.Fatal(err)
+	}
+}
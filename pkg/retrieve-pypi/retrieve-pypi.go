@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/archive"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+type retrievePypi struct {
+	// index is the base URL of the simple index.
+	index string
+}
+
+// Run is the function that actually carries out the substantive
+// action of the agent, for this job.
+func (ag *retrievePypi) Run(ctx context.Context, cfg agent.JobConfig, rpt agentkit.Reporter) error {
+	// make sure we've got the config values we need
+	project := ""
+	version := ""
+	expected := archive.Checksums{}
+
+	for _, jkv := range cfg.Jkvs {
+		switch jkv.Key {
+		case "package":
+			project = jkv.Value
+		case "version":
+			version = jkv.Value
+		case "sha256":
+			if err := archive.ValidateChecksum("SHA256", jkv.Value); err != nil {
+				return err
+			}
+			expected["SHA256"] = jkv.Value
+		}
+	}
+
+	if project == "" {
+		return fmt.Errorf("package key/value not specified")
+	}
+	if !projectNameRe.MatchString(project) {
+		return fmt.Errorf("package %q is not a valid Python project name", project)
+	}
+	if version == "" {
+		return fmt.Errorf("version key/value not specified")
+	}
+
+	// check that we've got an empty directory to unpack into
+	if err := agentkit.PrepareCodeOutputDir(cfg.CodeOutputDir); err != nil {
+		return err
+	}
+
+	// we're all configured; set status as running
+	rpt.Running()
+
+	// from here on, if we fail, remove anything that we've unpacked
+	// so that later agents don't pick up part of a package
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			agentkit.RemoveDirContents(cfg.CodeOutputDir)
+		}
+	}()
+
+	sd, err := findSdist(ctx, ag.index, project, version)
+	if err != nil {
+		return err
+	}
+
+	sdistPath, sums, err := archive.Download(ctx, sd.url, rpt)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(sdistPath)
+
+	// don't unpack anything that isn't what was published, or what the
+	// job expected
+	if err := sums.Verify(archive.Checksums{"SHA256": sd.sha256}); err != nil {
+		return fmt.Errorf("downloaded %s, but %v", sd.url, err)
+	}
+	if err := sums.Verify(expected); err != nil {
+		return fmt.Errorf("downloaded %s, but %v", sd.url, err)
+	}
+
+	// source distributions keep everything in one top-level directory,
+	// named "<name>-<version>"
+	files, err := archive.Extract(ctx, sdistPath, sd.format, cfg.CodeOutputDir, archive.Options{StripComponents: 1}, rpt)
+	if err != nil {
+		return fmt.Errorf("couldn't extract %s: %v", sd.url, err)
+	}
+
+	// record where the code came from, for later agents
+	if cfg.SpdxOutputDir != "" {
+		prov := &agentkit.Provenance{
+			Agent:            "retrieve-pypi",
+			Name:             project,
+			URL:              sd.url,
+			DownloadLocation: sd.url,
+			Version:          version,
+			Checksums: map[string]string{
+				"SHA1":   sums["SHA1"],
+				"SHA256": sums["SHA256"],
+			},
+			RetrievedAt: time.Now().UTC().Truncate(time.Second),
+		}
+		if err := agentkit.WriteProvenance(cfg.SpdxOutputDir, prov); err != nil {
+			return err
+		}
+	}
+
+	rpt.Output(fmt.Sprintf("package: %s\nversion: %s\nfile: %s\nsha256: %s\nfiles: %d", project, version, sd.filename, sums["SHA256"], files))
+
+	// success!
+	succeeded = true
+	return nil
+}
@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// testReporter records what a job reports.
+type testReporter struct {
+	running bool
+	output  []string
+}
+
+func (r *testReporter) Running()                     { r.running = true }
+func (r *testReporter) Output(msg string)            { r.output = append(r.output, msg) }
+func (r *testReporter) Degraded(msg string)          { r.output = append(r.output, msg) }
+func (r *testReporter) Progress(p agentkit.Progress) {}
+
+// tarGz returns a gzipped tar archive of files, which map names to
+// contents.
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, body := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(body))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRun(t *testing.T) {
+	sdist := tarGz(t, map[string]string{"Foo_Bar-1.0/setup.py": "from setuptools import setup\n"})
+	sha256sum := fmt.Sprintf("%x", sha256.Sum256(sdist))
+	wrongSum := strings.Repeat("0", 64)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/files/"):
+			w.Write(sdist)
+		case r.URL.Path == "/simple/foo-bar/":
+			fmt.Fprintf(w, `<!DOCTYPE html>
+<html><body>
+<a href="../../files/Foo_Bar-1.0-py3-none-any.whl#sha256=%[2]s">Foo_Bar-1.0-py3-none-any.whl</a>
+<a href="../../files/Foo_Bar-1.0.tar.gz#sha256=%[1]s">Foo_Bar-1.0.tar.gz</a>
+<a href="../../files/Foo_Bar-1.1.tar.gz#sha256=%[2]s">Foo_Bar-1.1.tar.gz</a>
+<a href="../../files/Foo_Bar-1.2.tar.gz">Foo_Bar-1.2.tar.gz</a>
+</body></html>
+`, sha256sum, wrongSum)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	wantFiles := map[string]string{"setup.py": "from setuptools import setup\n"}
+
+	tests := []struct {
+		name        string
+		jkvs        map[string]string
+		wantErr     string
+		wantRunning bool
+		wantFiles   map[string]string
+		wantOutput  string
+	}{
+		{
+			name:        "published sha256",
+			jkvs:        map[string]string{"package": "Foo.Bar", "version": "1.0"},
+			wantRunning: true,
+			wantFiles:   wantFiles,
+			wantOutput:  "file: Foo_Bar-1.0.tar.gz\nsha256: " + sha256sum,
+		},
+		{
+			name:        "job sha256",
+			jkvs:        map[string]string{"package": "foo_bar", "version": "1.0", "sha256": strings.ToUpper(sha256sum)},
+			wantRunning: true,
+			wantFiles:   wantFiles,
+		},
+		{
+			name:        "wrong published sha256",
+			jkvs:        map[string]string{"package": "Foo.Bar", "version": "1.1"},
+			wantErr:     "SHA256 checksum mismatch",
+			wantRunning: true,
+			wantFiles:   map[string]string{},
+		},
+		{
+			name:        "wrong job sha256",
+			jkvs:        map[string]string{"package": "Foo.Bar", "version": "1.0", "sha256": wrongSum},
+			wantErr:     "SHA256 checksum mismatch",
+			wantRunning: true,
+			wantFiles:   map[string]string{},
+		},
+		{
+			name:        "no published sha256",
+			jkvs:        map[string]string{"package": "Foo.Bar", "version": "1.2"},
+			wantErr:     "no sha256 published for Foo_Bar-1.2.tar.gz",
+			wantRunning: true,
+			wantFiles:   map[string]string{},
+		},
+		{
+			name:        "no source distribution",
+			jkvs:        map[string]string{"package": "Foo.Bar", "version": "2.0"},
+			wantErr:     "no source distribution for version 2.0",
+			wantRunning: true,
+			wantFiles:   map[string]string{},
+		},
+		{
+			name:    "malformed sha256",
+			jkvs:    map[string]string{"package": "Foo.Bar", "version": "1.0", "sha256": "abc"},
+			wantErr: "is not 64 hex digits",
+		},
+		{
+			name:    "invalid package name",
+			jkvs:    map[string]string{"package": "-foo", "version": "1.0"},
+			wantErr: "not a valid Python project name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "retrieve-pypi-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			codeDir := filepath.Join(dir, "code")
+
+			cfg := agent.JobConfig{CodeOutputDir: codeDir}
+			for k, v := range tt.jkvs {
+				cfg.Jkvs = append(cfg.Jkvs, &agent.JobConfig_JobKV{Key: k, Value: v})
+			}
+			rpt := &testReporter{}
+			err = (&retrievePypi{index: srv.URL + "/simple"}).Run(context.Background(), cfg, rpt)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+			if rpt.running != tt.wantRunning {
+				t.Errorf("got running %t, want %t", rpt.running, tt.wantRunning)
+			}
+			if tt.wantOutput != "" && (len(rpt.output) != 1 || !strings.Contains(rpt.output[0], tt.wantOutput)) {
+				t.Errorf("got output %q, want one containing %q", rpt.output, tt.wantOutput)
+			}
+			if tt.wantFiles == nil {
+				return
+			}
+
+			got := map[string]string{}
+			filepath.Walk(codeDir, func(p string, fi os.FileInfo, err error) error {
+				if err == nil && fi.Mode().IsRegular() {
+					rel, _ := filepath.Rel(codeDir, p)
+					b, _ := ioutil.ReadFile(p)
+					got[filepath.ToSlash(rel)] = string(b)
+				}
+				return nil
+			})
+			if len(got) != len(tt.wantFiles) {
+				t.Errorf("got files %v, want %v", got, tt.wantFiles)
+			}
+			for name, want := range tt.wantFiles {
+				if got[name] != want {
+					t.Errorf("%s: got %q, want %q", name, got[name], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/spdx/v2/common"
+)
+
+// element is one of the packages, files or snippets of the merged
+// document, or the document itself. Its identifier is settled once
+// everything has been merged.
+type element struct {
+	id common.ElementID
+}
+
+// elementRef is what a relationship or annotation in one of the input
+// documents refers to: either an element of the merged document, or,
+// for an element of another document or NONE or NOASSERTION, the
+// reference as it was.
+type elementRef struct {
+	el    *element
+	other common.DocElementID
+}
+
+// docElementID returns the reference as it is written in the merged
+// document.
+func (r elementRef) docElementID() common.DocElementID {
+	if r.el != nil {
+		return common.MakeDocElementID("", string(r.el.id))
+	}
+	return r.other
+}
+
+// mergedPackage is a package of the merged document, along with each
+// input document's description of it.
+type mergedPackage struct {
+	element
+	from []*packageFrom
+
+	files  []*mergedFile
+	byPath map[string]*mergedFile
+}
+
+// packageFrom is one input document's description of a package.
+type packageFrom struct {
+	label string
+	pkg   *spdx.Package
+}
+
+// mergedFile is a file of the merged document, along with each input
+// document's description of it.
+type mergedFile struct {
+	element
+	sha1 string
+	from []*fileFrom
+
+	// snippets are those of the first input document that had any
+	// for the file.
+	snippets []*mergedSnippet
+}
+
+// fileFrom is one input document's description of a file.
+type fileFrom struct {
+	label string
+	file  *spdx.File
+}
+
+// mergedSnippet is a snippet of the merged document.
+type mergedSnippet struct {
+	element
+	snippet *spdx.Snippet
+}
+
+// pendingRelationship is a relationship from one of the input
+// documents, whose references are written once the merged document's
+// identifiers are settled.
+type pendingRelationship struct {
+	a, b elementRef
+	rel  *spdx.Relationship
+}
+
+// pendingAnnotation is an annotation, either from one of the input
+// documents or recording a conflict between them.
+type pendingAnnotation struct {
+	target elementRef
+	ann    *spdx.Annotation
+}
+
+// merger merges SPDX documents into one.
+type merger struct {
+	// created is when the merge was done, for the creation info and
+	// the annotations that record conflicts.
+	created string
+
+	docEl      element
+	packages   []*mergedPackage
+	byKey      map[string]*mergedPackage
+	unpackaged *mergedPackage
+
+	externalRefs  []spdx.ExternalDocumentRef
+	otherLicenses []*spdx.OtherLicense
+	licenseFrom   map[string]string
+
+	relationships []*pendingRelationship
+	annotations   []*pendingAnnotation
+	conflicts     int
+
+	labels             []string
+	creators           []common.Creator
+	licenseListVersion string
+}
+
+// newMerger returns a merger for documents merged at created, an SPDX
+// date and time.
+func newMerger(created string) *merger {
+	return &merger{
+		created:     created,
+		docEl:       element{id: "DOCUMENT"},
+		byKey:       map[string]*mergedPackage{},
+		unpackaged:  &mergedPackage{byPath: map[string]*mergedFile{}},
+		licenseFrom: map[string]string{},
+	}
+}
+
+// add merges in, the next of the input documents. Packages are matched
+// with those from earlier documents by name and version, and files
+// within them by path and checksum.
+func (m *merger) add(in *inputDocument) error {
+	doc := in.doc
+	m.labels = append(m.labels, in.label)
+
+	// ids maps the identifiers in this document to the elements of the
+	// merged document that they have become
+	ids := map[common.ElementID]*element{doc.SPDXIdentifier: &m.docEl}
+
+	for _, edr := range doc.ExternalDocumentReferences {
+		if err := m.addExternalRef(edr); err != nil {
+			return fmt.Errorf("%s: %v", in.label, err)
+		}
+	}
+
+	if ci := doc.CreationInfo; ci != nil {
+		for _, c := range ci.Creators {
+			if !hasCreator(m.creators, c) {
+				m.creators = append(m.creators, c)
+			}
+		}
+		if m.licenseListVersion == "" {
+			m.licenseListVersion = ci.LicenseListVersion
+		}
+	}
+
+	for _, p := range doc.Packages {
+		key := p.PackageName + "\x00" + p.PackageVersion
+		mp, ok := m.byKey[key]
+		if !ok {
+			mp = &mergedPackage{element: element{id: p.PackageSPDXIdentifier}, byPath: map[string]*mergedFile{}}
+			m.byKey[key] = mp
+			m.packages = append(m.packages, mp)
+		}
+		mp.from = append(mp.from, &packageFrom{label: in.label, pkg: p})
+		ids[p.PackageSPDXIdentifier] = &mp.element
+		m.addFiles(mp, in.label, p.Files, doc.Snippets, ids)
+	}
+	m.addFiles(m.unpackaged, in.label, doc.Files, doc.Snippets, ids)
+
+	for _, ol := range doc.OtherLicenses {
+		m.addOtherLicense(in.label, ol)
+	}
+
+	// the relationships and annotations about elements that weren't
+	// merged, such as a file that differs from an earlier document's,
+	// are left out
+	for _, r := range doc.Relationships {
+		a, okA := m.ref(ids, r.RefA)
+		b, okB := m.ref(ids, r.RefB)
+		if okA && okB {
+			m.relationships = append(m.relationships, &pendingRelationship{a: a, b: b, rel: r})
+		}
+	}
+	for _, ann := range doc.Annotations {
+		target := ann.AnnotationSPDXIdentifier
+		if target == (common.DocElementID{}) {
+			// an annotation on the document itself, as the JSON
+			// reader leaves it
+			target.ElementRefID = doc.SPDXIdentifier
+		}
+		if t, ok := m.ref(ids, target); ok {
+			m.annotations = append(m.annotations, &pendingAnnotation{target: t, ann: ann})
+		}
+	}
+	for _, p := range doc.Packages {
+		m.addElementAnnotations(ids[p.PackageSPDXIdentifier], p.Annotations)
+		for _, f := range p.Files {
+			m.addElementAnnotations(ids[f.FileSPDXIdentifier], f.Annotations)
+		}
+	}
+	for _, f := range doc.Files {
+		m.addElementAnnotations(ids[f.FileSPDXIdentifier], f.Annotations)
+	}
+	return nil
+}
+
+// addFiles merges files, from the input document labelled label, into
+// mp, recording in ids what their identifiers have become. A file at
+// the same path as one from an earlier document, but with a different
+// checksum, is a different version of it, so it isn't merged and the
+// conflict is recorded. A file's snippets are those it holds, and
+// those among docSnippets, which the JSON reader keeps with the
+// document instead, that are from it.
+func (m *merger) addFiles(mp *mergedPackage, label string, files []*spdx.File, docSnippets []spdx.Snippet, ids map[common.ElementID]*element) {
+	for _, f := range files {
+		sha1 := fileChecksum(f, common.SHA1)
+		mf, ok := mp.byPath[f.FileName]
+		if !ok {
+			mf = &mergedFile{element: element{id: f.FileSPDXIdentifier}, sha1: sha1}
+			mp.byPath[f.FileName] = mf
+			mp.files = append(mp.files, mf)
+		} else if sha1 != mf.sha1 {
+			m.conflict(&mf.element, "%s has a different file at %s, with SHA1 %s rather than %s; it was not merged", label, f.FileName, sha1, mf.sha1)
+			continue
+		}
+		mf.from = append(mf.from, &fileFrom{label: label, file: f})
+		ids[f.FileSPDXIdentifier] = &mf.element
+
+		if len(mf.snippets) > 0 {
+			continue
+		}
+		snippets := []*spdx.Snippet{}
+		for _, s := range f.Snippets {
+			snippets = append(snippets, s)
+		}
+		for i := range docSnippets {
+			if docSnippets[i].SnippetFromFileSPDXIdentifier == f.FileSPDXIdentifier {
+				snippets = append(snippets, &docSnippets[i])
+			}
+		}
+		sort.Slice(snippets, func(i, j int) bool {
+			return snippets[i].SnippetSPDXIdentifier < snippets[j].SnippetSPDXIdentifier
+		})
+		for _, s := range snippets {
+			if ids[s.SnippetSPDXIdentifier] != nil {
+				continue
+			}
+			ms := &mergedSnippet{element: element{id: s.SnippetSPDXIdentifier}, snippet: s}
+			mf.snippets = append(mf.snippets, ms)
+			ids[s.SnippetSPDXIdentifier] = &ms.element
+		}
+	}
+}
+
+// addExternalRef adds edr, unless an earlier document has the same
+// one. Two documents that use the same identifier for different
+// external documents can't be merged.
+func (m *merger) addExternalRef(edr spdx.ExternalDocumentRef) error {
+	for _, prev := range m.externalRefs {
+		if prev.DocumentRefID != edr.DocumentRefID {
+			continue
+		}
+		if prev.URI != edr.URI {
+			return fmt.Errorf("DocumentRef-%s is %s, but an earlier document uses it for %s", edr.DocumentRefID, edr.URI, prev.URI)
+		}
+		return nil
+	}
+	m.externalRefs = append(m.externalRefs, edr)
+	return nil
+}
+
+// addOtherLicense adds ol, from the input document labelled label,
+// unless an earlier document has a license with the same identifier.
+// If that license's text is different, the earlier one is kept and the
+// conflict is recorded.
+func (m *merger) addOtherLicense(label string, ol *spdx.OtherLicense) {
+	for _, prev := range m.otherLicenses {
+		if prev.LicenseIdentifier != ol.LicenseIdentifier {
+			continue
+		}
+		if strings.Join(strings.Fields(prev.ExtractedText), " ") != strings.Join(strings.Fields(ol.ExtractedText), " ") {
+			m.conflict(&m.docEl, "%s has different text for %s than %s, whose text was kept", label, ol.LicenseIdentifier, m.licenseFrom[ol.LicenseIdentifier])
+		}
+		return
+	}
+	m.otherLicenses = append(m.otherLicenses, ol)
+	m.licenseFrom[ol.LicenseIdentifier] = label
+}
+
+// addElementAnnotations adds the annotations that an input document
+// keeps with a package or file, as the JSON reader does, for el.
+func (m *merger) addElementAnnotations(el *element, anns []spdx.Annotation) {
+	if el == nil {
+		return
+	}
+	for i := range anns {
+		m.annotations = append(m.annotations, &pendingAnnotation{target: elementRef{el: el}, ann: &anns[i]})
+	}
+}
+
+// ref returns what id, from a document whose identifiers have become
+// ids, refers to in the merged document. ok is false if it refers to
+// an element that wasn't merged.
+func (m *merger) ref(ids map[common.ElementID]*element, id common.DocElementID) (ref elementRef, ok bool) {
+	if id.DocumentRefID != "" || id.SpecialID != "" {
+		return elementRef{other: id}, true
+	}
+	el, ok := ids[id.ElementRefID]
+	return elementRef{el: el}, ok
+}
+
+// conflict records a conflict between the input documents, about el,
+// as a review annotation.
+func (m *merger) conflict(el *element, format string, args ...interface{}) {
+	m.conflicts++
+	m.annotations = append(m.annotations, &pendingAnnotation{
+		target: elementRef{el: el},
+		ann: &spdx.Annotation{
+			Annotator:         common.Annotator{Annotator: creatorTool, AnnotatorType: "Tool"},
+			AnnotationDate:    m.created,
+			AnnotationType:    "REVIEW",
+			AnnotationComment: fmt.Sprintf(format, args...),
+		},
+	})
+}
+
+// fileChecksum returns f's checksum with algorithm alg, or "" if it
+// doesn't have one.
+func fileChecksum(f *spdx.File, alg common.ChecksumAlgorithm) string {
+	for _, c := range f.Checksums {
+		if c.Algorithm == alg {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// hasCreator reports whether creators includes c.
+func hasCreator(creators []common.Creator, c common.Creator) bool {
+	for _, prev := range creators {
+		if prev == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/spdx/v2/common"
+)
+
+// testFile returns a file at name with SHA1 sha1, in which lics were
+// found.
+func testFile(id string, name string, sha1 string, lics ...string) *spdx.File {
+	if len(lics) == 0 {
+		lics = []string{"NOASSERTION"}
+	}
+	return &spdx.File{
+		FileName:           name,
+		FileSPDXIdentifier: common.ElementID(id),
+		Checksums:          []common.Checksum{{Algorithm: common.SHA1, Value: sha1}},
+		LicenseConcluded:   "NOASSERTION",
+		LicenseInfoInFiles: lics,
+		FileCopyrightText:  "NOASSERTION",
+	}
+}
+
+// testDocument returns a document describing pkg, whose files are
+// files.
+func testDocument(name string, pkgID string, files ...*spdx.File) *spdx.Document {
+	pkg := &spdx.Package{
+		PackageName:             "app",
+		PackageVersion:          "1.0",
+		PackageSPDXIdentifier:   common.ElementID(pkgID),
+		PackageDownloadLocation: "NOASSERTION",
+		PackageLicenseConcluded: "NOASSERTION",
+		PackageLicenseDeclared:  "NOASSERTION",
+		PackageCopyrightText:    "NOASSERTION",
+		FilesAnalyzed:           true,
+		Files:                   files,
+	}
+	return &spdx.Document{
+		SPDXVersion:       spdx.Version,
+		DataLicense:       spdx.DataLicense,
+		SPDXIdentifier:    "DOCUMENT",
+		DocumentName:      name,
+		DocumentNamespace: "https://example.com/" + name,
+		CreationInfo: &spdx.CreationInfo{
+			Creators: []common.Creator{{Creator: "github.com/swinslow/peridot-agents/pkg/" + name, CreatorType: "Tool"}},
+			Created:  "2020-01-01T00:00:00Z",
+		},
+		Packages: []*spdx.Package{pkg},
+		Relationships: []*spdx.Relationship{{
+			RefA:         common.MakeDocElementID("", "DOCUMENT"),
+			RefB:         common.MakeDocElementID("", pkgID),
+			Relationship: "DESCRIBES",
+		}},
+	}
+}
+
+// mergeDocuments merges docs, each labelled with its name, and returns
+// the merged document and the number of conflicts.
+func mergeDocuments(t *testing.T, docs ...*spdx.Document) (*spdx.Document, int) {
+	t.Helper()
+	m := newMerger("2020-02-01T00:00:00Z")
+	for _, doc := range docs {
+		if err := m.add(&inputDocument{label: doc.DocumentName, doc: doc}); err != nil {
+			t.Fatalf("add(%s): %v", doc.DocumentName, err)
+		}
+	}
+	merged, err := m.document("merged", "https://example.com/merged")
+	if err != nil {
+		t.Fatalf("document: %v", err)
+	}
+	return merged, m.conflicts
+}
+
+// annotationsOn returns the comments of the annotations in doc on the
+// element id.
+func annotationsOn(doc *spdx.Document, id string) []string {
+	comments := []string{}
+	for _, ann := range doc.Annotations {
+		if string(ann.AnnotationSPDXIdentifier.ElementRefID) == id {
+			comments = append(comments, ann.AnnotationComment)
+		}
+	}
+	return comments
+}
+
+func TestMerge(t *testing.T) {
+	ids := testDocument("idsearcher", "Package-app",
+		testFile("File0", "/a.go", "aaa", "MIT"),
+		testFile("File1", "/b.go", "bbb", "MIT"),
+	)
+	matcher := testDocument("license-matcher", "Package-app-1.0",
+		testFile("File0", "/a.go", "aaa", "GPL-2.0-only"),
+		testFile("File1", "/b.go", "ccc"),
+		testFile("File2", "/c.go", "ddd"),
+	)
+	matcher.Packages[0].Files[2].FileCopyrightText = "Copyright 2020 Example"
+	// about the file that isn't merged, so left out
+	matcher.Relationships = append(matcher.Relationships, &spdx.Relationship{
+		RefA:         common.MakeDocElementID("", "Package-app-1.0"),
+		RefB:         common.MakeDocElementID("", "File1"),
+		Relationship: "CONTAINS",
+	})
+	copyrights := testDocument("copyright-extractor", "Package-app",
+		testFile("File0", "/a.go", "aaa"),
+		testFile("File1", "/b.go", "bbb"),
+	)
+	copyrights.Packages[0].Files[0].FileCopyrightText = "Copyright 2019 Example\nCopyright 2020 Other"
+
+	doc, conflicts := mergeDocuments(t, ids, matcher, copyrights)
+
+	if len(doc.Packages) != 1 {
+		t.Fatalf("got %d packages, want the same package merged", len(doc.Packages))
+	}
+	pkg := doc.Packages[0]
+	if pkg.PackageSPDXIdentifier != "Package-app" {
+		t.Errorf("got package %s, want the first document's identifier", pkg.PackageSPDXIdentifier)
+	}
+	files := []string{}
+	for _, f := range pkg.Files {
+		files = append(files, strings.Join([]string{string(f.FileSPDXIdentifier), f.FileName, strings.Join(f.LicenseInfoInFiles, ","), f.FileCopyrightText}, " "))
+	}
+	wantFiles := []string{
+		"File0 /a.go GPL-2.0-only,MIT Copyright 2019 Example\nCopyright 2020 Other",
+		"File1 /b.go MIT NOASSERTION",
+		"File2 /c.go NOASSERTION Copyright 2020 Example",
+	}
+	if !reflect.DeepEqual(files, wantFiles) {
+		t.Errorf("got files %q, want %q", files, wantFiles)
+	}
+	if want := []string{"GPL-2.0-only", "MIT"}; !reflect.DeepEqual(pkg.PackageLicenseInfoFromFiles, want) {
+		t.Errorf("got license info from files %v, want %v", pkg.PackageLicenseInfoFromFiles, want)
+	}
+	if pkg.PackageVerificationCode == nil || pkg.PackageVerificationCode.Value == "" {
+		t.Errorf("got no verification code, want one for the merged files")
+	}
+
+	rels := []string{}
+	for _, r := range doc.Relationships {
+		rels = append(rels, string(r.RefA.ElementRefID)+" "+r.Relationship+" "+string(r.RefB.ElementRefID))
+	}
+	if want := []string{"DOCUMENT DESCRIBES Package-app"}; !reflect.DeepEqual(rels, want) {
+		t.Errorf("got relationships %v, want %v", rels, want)
+	}
+
+	if conflicts != 2 {
+		t.Errorf("got %d conflicts, want 2", conflicts)
+	}
+	if got, want := annotationsOn(doc, "File0"), []string{"LicenseInfoInFile differs between inputs: MIT from idsearcher; GPL-2.0-only from license-matcher"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got annotations on File0 %q, want %q", got, want)
+	}
+	if got, want := annotationsOn(doc, "File1"), []string{"license-matcher has a different file at /b.go, with SHA1 ccc rather than bbb; it was not merged"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got annotations on File1 %q, want %q", got, want)
+	}
+	for _, ann := range doc.Annotations {
+		if ann.AnnotationType != "REVIEW" || ann.Annotator.Annotator != creatorTool || ann.AnnotationDate != "2020-02-01T00:00:00Z" {
+			t.Errorf("got annotation %+v, want a review by the merge tool", ann)
+		}
+	}
+
+	if got, want := doc.CreationInfo.CreatorComment, "Merged from: idsearcher, license-matcher, copyright-extractor"; got != want {
+		t.Errorf("got creator comment %q, want %q", got, want)
+	}
+	if got := len(doc.CreationInfo.Creators); got != 4 {
+		t.Errorf("got %d creators, want the merge tool and each input's", got)
+	}
+}
+
+func TestMergeDifferentPackages(t *testing.T) {
+	a := testDocument("a", "Package-app", testFile("File0", "/a.go", "aaa", "MIT"))
+	b := testDocument("b", "Package-app", testFile("File0", "/a.go", "aaa", "MIT"))
+	b.Packages[0].PackageVersion = "2.0"
+
+	doc, conflicts := mergeDocuments(t, a, b)
+	if conflicts != 0 {
+		t.Errorf("got %d conflicts, want none", conflicts)
+	}
+	ids := []string{}
+	for _, pkg := range doc.Packages {
+		ids = append(ids, string(pkg.PackageSPDXIdentifier))
+		for _, f := range pkg.Files {
+			ids = append(ids, string(f.FileSPDXIdentifier))
+		}
+	}
+	// packages that had the same identifier are told apart, and files
+	// are numbered again
+	if want := []string{"Package-app", "File0", "Package-app-2", "File1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got identifiers %v, want %v", ids, want)
+	}
+	rels := []string{}
+	for _, r := range doc.Relationships {
+		rels = append(rels, string(r.RefB.ElementRefID))
+	}
+	if want := []string{"Package-app", "Package-app-2"}; !reflect.DeepEqual(rels, want) {
+		t.Errorf("got relationships to %v, want %v", rels, want)
+	}
+}
+
+func TestMergePackageFields(t *testing.T) {
+	a := testDocument("a", "Package-app")
+	a.Packages[0].PackageLicenseDeclared = "MIT"
+	a.Packages[0].PackageDownloadLocation = "https://example.com/app-1.0.tar.gz"
+	b := testDocument("b", "Package-app")
+	b.Packages[0].PackageLicenseDeclared = "MIT"
+	b.Packages[0].PackageDownloadLocation = "https://example.com/other-1.0.tar.gz"
+	b.Packages[0].PackageHomePage = "https://example.com"
+
+	doc, conflicts := mergeDocuments(t, a, b)
+	pkg := doc.Packages[0]
+	if pkg.PackageLicenseDeclared != "MIT" {
+		t.Errorf("got license declared %q, want the one both agree on", pkg.PackageLicenseDeclared)
+	}
+	if pkg.PackageHomePage != "https://example.com" {
+		t.Errorf("got home page %q, want the only one given", pkg.PackageHomePage)
+	}
+	if pkg.PackageDownloadLocation != "NOASSERTION" || conflicts != 1 {
+		t.Errorf("got download location %q with %d conflicts, want NOASSERTION and a conflict", pkg.PackageDownloadLocation, conflicts)
+	}
+}
+
+func TestMergeOtherLicenses(t *testing.T) {
+	a := testDocument("a", "Package-app")
+	a.OtherLicenses = []*spdx.OtherLicense{{LicenseIdentifier: "LicenseRef-x", ExtractedText: "Some  text"}}
+	b := testDocument("b", "Package-app")
+	b.OtherLicenses = []*spdx.OtherLicense{{LicenseIdentifier: "LicenseRef-x", ExtractedText: "Some\ntext"}}
+	c := testDocument("c", "Package-app")
+	c.OtherLicenses = []*spdx.OtherLicense{{LicenseIdentifier: "LicenseRef-x", ExtractedText: "Other text"}}
+
+	doc, conflicts := mergeDocuments(t, a, b, c)
+	if len(doc.OtherLicenses) != 1 || doc.OtherLicenses[0].ExtractedText != "Some  text" {
+		t.Errorf("got other licenses %+v, want the first document's", doc.OtherLicenses)
+	}
+	if conflicts != 1 {
+		t.Errorf("got %d conflicts, want 1", conflicts)
+	}
+	if got, want := annotationsOn(doc, "DOCUMENT"), []string{"c has different text for LicenseRef-x than a, whose text was kept"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got annotations on the document %q, want %q", got, want)
+	}
+}
+
+func TestMergeExternalRefs(t *testing.T) {
+	a := testDocument("a", "Package-app")
+	a.ExternalDocumentReferences = []spdx.ExternalDocumentRef{{DocumentRefID: "lib", URI: "https://example.com/lib"}}
+	b := testDocument("b", "Package-app")
+	b.ExternalDocumentReferences = a.ExternalDocumentReferences
+	doc, _ := mergeDocuments(t, a, b)
+	if len(doc.ExternalDocumentReferences) != 1 {
+		t.Errorf("got external document references %v, want one", doc.ExternalDocumentReferences)
+	}
+
+	c := testDocument("c", "Package-app")
+	c.ExternalDocumentReferences = []spdx.ExternalDocumentRef{{DocumentRefID: "lib", URI: "https://example.com/other"}}
+	m := newMerger("2020-02-01T00:00:00Z")
+	if err := m.add(&inputDocument{label: "a", doc: a}); err != nil {
+		t.Fatalf("add(a): %v", err)
+	}
+	if err := m.add(&inputDocument{label: "c", doc: c}); err == nil || !strings.Contains(err.Error(), "an earlier document uses it") {
+		t.Errorf("got error %v, want one saying the identifier is used for another document", err)
+	}
+}
+
+func TestUnionText(t *testing.T) {
+	tests := []struct {
+		vals []string
+		want string
+	}{
+		{[]string{"NOASSERTION", ""}, "NOASSERTION"},
+		{[]string{"NONE", "NOASSERTION"}, "NONE"},
+		{[]string{"NONE", "Copyright 2020 A"}, "Copyright 2020 A"},
+		{[]string{"Copyright 2020 A\n\nCopyright 2021 B", " Copyright 2021 B\nCopyright 2022 C"}, "Copyright 2020 A\nCopyright 2021 B\nCopyright 2022 C"},
+	}
+	for _, tt := range tests {
+		vals := []labelled{}
+		for i, v := range tt.vals {
+			vals = append(vals, labelled{label: string(rune('a' + i)), value: v})
+		}
+		if got := unionText(vals); got != tt.want {
+			t.Errorf("unionText(%q) = %q, want %q", tt.vals, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// inputDocument is one of the SPDX documents that the job merges.
+type inputDocument struct {
+	// label names the document in annotations and output messages,
+	// as its spdxInput's source and its filename.
+	label string
+	doc   *spdx.Document
+}
+
+// readInputs reads the SPDX documents in cfg's spdxInputs, in order.
+// Each spdxInput is either a document or a directory of them, such as
+// an earlier agent's spdxOutputDir. In a directory, each document is
+// only read in its preferred format.
+func readInputs(cfg agent.JobConfig) ([]*inputDocument, error) {
+	found, err := spdxdoc.FindInputs(cfg, spdxdoc.AllFormats, true)
+	if err != nil {
+		return nil, err
+	}
+	inputs := []*inputDocument{}
+	for _, in := range found {
+		doc, _, err := in.Read()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read %s: %v", in.Label, err)
+		}
+		inputs = append(inputs, &inputDocument{label: in.Label, doc: doc})
+	}
+	return inputs, nil
+}
@@ -0,0 +1,429 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/spdx/v2/common"
+	"github.com/spdx/tools-golang/utils"
+)
+
+// creatorTool is the tool that is recorded as creating the merged
+// document, and as the annotator of the conflicts it finds.
+const creatorTool = "github.com/swinslow/peridot-agents/pkg/spdx-merge"
+
+// labelled is a field's value in one of the input documents.
+type labelled struct {
+	label string
+	value string
+}
+
+// document returns the merged document, named name and with namespace
+// namespace. The packages keep their identifiers from the first input
+// document that has them, unless two different packages had the same
+// one, and the files are numbered again in order.
+func (m *merger) document(name string, namespace string) (*spdx.Document, error) {
+	used := map[common.ElementID]bool{m.docEl.id: true}
+	allocate := func(want common.ElementID) common.ElementID {
+		id := want
+		for n := 2; used[id]; n++ {
+			id = common.ElementID(fmt.Sprintf("%s-%d", want, n))
+		}
+		used[id] = true
+		return id
+	}
+	for _, mp := range m.packages {
+		mp.id = allocate(mp.id)
+	}
+	fileNumber := 0
+	for _, mp := range append(append([]*mergedPackage{}, m.packages...), m.unpackaged) {
+		for _, mf := range mp.files {
+			mf.id = allocate(common.ElementID(fmt.Sprintf("File%d", fileNumber)))
+			fileNumber++
+		}
+	}
+	for _, mp := range append(append([]*mergedPackage{}, m.packages...), m.unpackaged) {
+		for _, mf := range mp.files {
+			for _, ms := range mf.snippets {
+				ms.id = allocate(ms.id)
+			}
+		}
+	}
+
+	// the files have to be settled before the packages that hold them
+	pkgs := []*spdx.Package{}
+	for _, mp := range m.packages {
+		pkg, err := m.resolvePackage(mp)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	files := []*spdx.File{}
+	for _, mf := range m.unpackaged.files {
+		files = append(files, m.resolveFile(mf))
+	}
+
+	rlns := []*spdx.Relationship{}
+	seenRlns := map[string]bool{}
+	for _, pr := range m.relationships {
+		r := *pr.rel
+		r.RefA, r.RefB = pr.a.docElementID(), pr.b.docElementID()
+		key := fmt.Sprintf("%s %s %s", common.RenderDocElementID(r.RefA), r.Relationship, common.RenderDocElementID(r.RefB))
+		if seenRlns[key] {
+			continue
+		}
+		seenRlns[key] = true
+		rlns = append(rlns, &r)
+	}
+
+	anns := []*spdx.Annotation{}
+	seenAnns := map[spdx.Annotation]bool{}
+	for _, pa := range m.annotations {
+		a := *pa.ann
+		a.AnnotationSPDXIdentifier = pa.target.docElementID()
+		if seenAnns[a] {
+			continue
+		}
+		seenAnns[a] = true
+		anns = append(anns, &a)
+	}
+
+	doc := &spdx.Document{
+		SPDXVersion:                spdx.Version,
+		DataLicense:                spdx.DataLicense,
+		SPDXIdentifier:             m.docEl.id,
+		DocumentName:               name,
+		DocumentNamespace:          namespace,
+		ExternalDocumentReferences: m.externalRefs,
+		CreationInfo: &spdx.CreationInfo{
+			LicenseListVersion: m.licenseListVersion,
+			Creators:           append([]common.Creator{{Creator: creatorTool, CreatorType: "Tool"}}, m.creators...),
+			Created:            m.created,
+			CreatorComment:     fmt.Sprintf("Merged from: %s", strings.Join(m.labels, ", ")),
+		},
+		Packages:      pkgs,
+		Files:         files,
+		OtherLicenses: m.otherLicenses,
+		Relationships: rlns,
+		Annotations:   anns,
+	}
+	return doc, nil
+}
+
+// resolvePackage returns the merged package for mp. It starts from the
+// first input document's package, and fills in or combines the fields
+// from the rest; conflicting values are recorded, and left as
+// NOASSERTION where the field allows it.
+func (m *merger) resolvePackage(mp *mergedPackage) (*spdx.Package, error) {
+	pkg := *mp.from[0].pkg
+	pkg.PackageSPDXIdentifier = mp.id
+	pkg.Annotations = nil
+
+	field := func(get func(p *spdx.Package) string) []labelled {
+		vals := []labelled{}
+		for _, pf := range mp.from {
+			vals = append(vals, labelled{label: pf.label, value: get(pf.pkg)})
+		}
+		return vals
+	}
+	pkg.PackageDownloadLocation = m.resolveValue(&mp.element, "PackageDownloadLocation", field(func(p *spdx.Package) string { return p.PackageDownloadLocation }))
+	pkg.PackageHomePage = m.resolveValue(&mp.element, "PackageHomePage", field(func(p *spdx.Package) string { return p.PackageHomePage }))
+	pkg.PackageLicenseConcluded = m.resolveValue(&mp.element, "PackageLicenseConcluded", field(func(p *spdx.Package) string { return p.PackageLicenseConcluded }))
+	pkg.PackageLicenseDeclared = m.resolveValue(&mp.element, "PackageLicenseDeclared", field(func(p *spdx.Package) string { return p.PackageLicenseDeclared }))
+	pkg.PackageCopyrightText = unionText(field(func(p *spdx.Package) string { return p.PackageCopyrightText }))
+	pkg.PackageLicenseComments = joinDistinct(field(func(p *spdx.Package) string { return p.PackageLicenseComments }))
+	pkg.PackageSourceInfo = joinDistinct(field(func(p *spdx.Package) string { return p.PackageSourceInfo }))
+	pkg.PackageSummary = joinDistinct(field(func(p *spdx.Package) string { return p.PackageSummary }))
+	pkg.PackageDescription = joinDistinct(field(func(p *spdx.Package) string { return p.PackageDescription }))
+	pkg.PackageComment = joinDistinct(field(func(p *spdx.Package) string { return p.PackageComment }))
+
+	for _, pf := range mp.from[1:] {
+		p := pf.pkg
+		if pkg.PackageSupplier == nil {
+			pkg.PackageSupplier = p.PackageSupplier
+		}
+		if pkg.PackageOriginator == nil {
+			pkg.PackageOriginator = p.PackageOriginator
+		}
+		if pkg.PackageFileName == "" {
+			pkg.PackageFileName = p.PackageFileName
+		}
+		pkg.FilesAnalyzed = pkg.FilesAnalyzed || p.FilesAnalyzed
+		pkg.IsFilesAnalyzedTagPresent = pkg.IsFilesAnalyzedTagPresent || p.IsFilesAnalyzedTagPresent
+		pkg.PackageChecksums = unionChecksums(pkg.PackageChecksums, p.PackageChecksums)
+		pkg.PackageAttributionTexts = unionStrings(pkg.PackageAttributionTexts, p.PackageAttributionTexts)
+		for _, ref := range p.PackageExternalReferences {
+			if !hasExternalReference(pkg.PackageExternalReferences, ref) {
+				pkg.PackageExternalReferences = append(pkg.PackageExternalReferences, ref)
+			}
+		}
+	}
+
+	// the package's files are those from all of the documents, and its
+	// license information is gathered from them as well as from each
+	// document's own
+	pkg.Files = []*spdx.File{}
+	infos := []string{}
+	for _, mf := range mp.files {
+		f := m.resolveFile(mf)
+		pkg.Files = append(pkg.Files, f)
+		infos = unionStrings(infos, knownValues(f.LicenseInfoInFiles))
+	}
+	for _, pf := range mp.from {
+		infos = unionStrings(infos, knownValues(pf.pkg.PackageLicenseInfoFromFiles))
+	}
+	sort.Strings(infos)
+	if len(infos) > 1 {
+		infos = withoutValue(infos, "NONE")
+	}
+	if len(infos) == 0 {
+		infos = []string{"NOASSERTION"}
+	}
+	pkg.PackageLicenseInfoFromFiles = infos
+
+	// and as the files may have changed, so does the verification code
+	if pkg.FilesAnalyzed && len(pkg.Files) > 0 {
+		code, err := utils.GetVerificationCode(pkg.Files, "")
+		if err != nil {
+			return nil, err
+		}
+		pkg.PackageVerificationCode = &code
+	}
+	return &pkg, nil
+}
+
+// resolveFile returns the merged file for mf, in the same way as
+// resolvePackage. The license information found in the file is the
+// union of what each document found, and it is a conflict if two
+// documents found different licenses, such as where one found an
+// SPDX-License-Identifier and another the full text of some other
+// license.
+func (m *merger) resolveFile(mf *mergedFile) *spdx.File {
+	f := *mf.from[0].file
+	f.FileSPDXIdentifier = mf.id
+	f.Annotations = nil
+
+	field := func(get func(f *spdx.File) string) []labelled {
+		vals := []labelled{}
+		for _, ff := range mf.from {
+			vals = append(vals, labelled{label: ff.label, value: get(ff.file)})
+		}
+		return vals
+	}
+	f.LicenseConcluded = m.resolveValue(&mf.element, "LicenseConcluded", field(func(f *spdx.File) string { return f.LicenseConcluded }))
+	f.FileCopyrightText = unionText(field(func(f *spdx.File) string { return f.FileCopyrightText }))
+	f.LicenseComments = joinDistinct(field(func(f *spdx.File) string { return f.LicenseComments }))
+	f.FileComment = joinDistinct(field(func(f *spdx.File) string { return f.FileComment }))
+	f.FileNotice = joinDistinct(field(func(f *spdx.File) string { return f.FileNotice }))
+
+	infos := []string{}
+	found := []labelled{}
+	for _, ff := range mf.from {
+		known := knownValues(ff.file.LicenseInfoInFiles)
+		if len(known) == 0 {
+			continue
+		}
+		sorted := append([]string{}, known...)
+		sort.Strings(sorted)
+		found = append(found, labelled{label: ff.label, value: strings.Join(sorted, ", ")})
+		infos = unionStrings(infos, known)
+	}
+	if distinctValues(found) > 1 {
+		m.conflict(&mf.element, "LicenseInfoInFile differs between inputs: %s", describe(found))
+	}
+	sort.Strings(infos)
+	if len(infos) > 1 {
+		infos = withoutValue(infos, "NONE")
+	}
+	if len(infos) == 0 {
+		infos = []string{"NOASSERTION"}
+	}
+	f.LicenseInfoInFiles = infos
+
+	for _, ff := range mf.from[1:] {
+		f.Checksums = unionChecksums(f.Checksums, ff.file.Checksums)
+		f.FileTypes = unionStrings(f.FileTypes, ff.file.FileTypes)
+		f.FileContributors = unionStrings(f.FileContributors, ff.file.FileContributors)
+		f.FileAttributionTexts = unionStrings(f.FileAttributionTexts, ff.file.FileAttributionTexts)
+		f.FileDependencies = unionStrings(f.FileDependencies, ff.file.FileDependencies)
+	}
+
+	f.Snippets = map[common.ElementID]*spdx.Snippet{}
+	for _, ms := range mf.snippets {
+		s := *ms.snippet
+		s.SnippetSPDXIdentifier = ms.id
+		s.SnippetFromFileSPDXIdentifier = mf.id
+		f.Snippets[ms.id] = &s
+	}
+	return &f
+}
+
+// resolveValue returns the value of a field that should be the same in
+// every input document, or NOASSERTION, recording the conflict, if it
+// isn't. Documents that have no value, or NOASSERTION, don't count.
+func (m *merger) resolveValue(el *element, name string, vals []labelled) string {
+	switch distinctValues(vals) {
+	case 0:
+		return vals[0].value
+	case 1:
+		for _, v := range vals {
+			if isKnown(v.value) {
+				return v.value
+			}
+		}
+	}
+	m.conflict(el, "%s differs between inputs: %s", name, describe(vals))
+	return "NOASSERTION"
+}
+
+// isKnown reports whether s is a value, rather than nothing or
+// NOASSERTION.
+func isKnown(s string) bool {
+	return s != "" && s != "NOASSERTION"
+}
+
+// knownValues returns the values in vals that are known.
+func knownValues(vals []string) []string {
+	known := []string{}
+	for _, v := range vals {
+		if isKnown(v) {
+			known = append(known, v)
+		}
+	}
+	return known
+}
+
+// distinctValues returns the number of different known values in vals.
+func distinctValues(vals []labelled) int {
+	seen := map[string]bool{}
+	for _, v := range vals {
+		if isKnown(v.value) {
+			seen[v.value] = true
+		}
+	}
+	return len(seen)
+}
+
+// describe lists the known values in vals, with the documents that
+// each came from, for recording a conflict.
+func describe(vals []labelled) string {
+	order := []string{}
+	labels := map[string][]string{}
+	for _, v := range vals {
+		if !isKnown(v.value) {
+			continue
+		}
+		if _, ok := labels[v.value]; !ok {
+			order = append(order, v.value)
+		}
+		labels[v.value] = append(labels[v.value], v.label)
+	}
+	parts := []string{}
+	for _, value := range order {
+		parts = append(parts, fmt.Sprintf("%s from %s", value, strings.Join(labels[value], " and ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// unionText returns the distinct lines of the known values of a text
+// field, such as a copyright text, or NONE or NOASSERTION if there are
+// none.
+func unionText(vals []labelled) string {
+	lines := []string{}
+	none := false
+	for _, v := range vals {
+		if v.value == "NONE" {
+			none = true
+			continue
+		}
+		if !isKnown(v.value) {
+			continue
+		}
+		for _, line := range strings.Split(v.value, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = unionStrings(lines, []string{line})
+			}
+		}
+	}
+	switch {
+	case len(lines) > 0:
+		return strings.Join(lines, "\n")
+	case none:
+		return "NONE"
+	default:
+		return "NOASSERTION"
+	}
+}
+
+// joinDistinct returns the distinct non-empty values of a comment or
+// other free-text field, one to a line.
+func joinDistinct(vals []labelled) string {
+	texts := []string{}
+	for _, v := range vals {
+		if v.value != "" {
+			texts = unionStrings(texts, []string{v.value})
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// unionStrings returns a with those of b that it doesn't have added.
+func unionStrings(a []string, b []string) []string {
+	for _, s := range b {
+		found := false
+		for _, prev := range a {
+			if prev == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, s)
+		}
+	}
+	return a
+}
+
+// withoutValue returns vals without value.
+func withoutValue(vals []string, value string) []string {
+	out := []string{}
+	for _, v := range vals {
+		if v != value {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// unionChecksums returns a with those of b for algorithms that it
+// doesn't have added.
+func unionChecksums(a []common.Checksum, b []common.Checksum) []common.Checksum {
+	for _, c := range b {
+		found := false
+		for _, prev := range a {
+			if prev.Algorithm == c.Algorithm {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, c)
+		}
+	}
+	return a
+}
+
+// hasExternalReference reports whether refs includes one to the same
+// thing as ref.
+func hasExternalReference(refs []*spdx.PackageExternalReference, ref *spdx.PackageExternalReference) bool {
+	for _, prev := range refs {
+		if prev.Category == ref.Category && prev.RefType == ref.RefType && prev.Locator == ref.Locator {
+			return true
+		}
+	}
+	return false
+}
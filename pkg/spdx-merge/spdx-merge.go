@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+const (
+	// namespaceBaseEnv names the environment variable that sets the
+	// base URI of the namespaces of the documents that the agent
+	// writes, for jobs that don't set their own with the namespaceBase
+	// key/value.
+	namespaceBaseEnv = "SPDX_MERGE_NAMESPACE_BASE"
+)
+
+// mergedDocName is the name of the file that the merged document is
+// written to.
+const mergedDocName = "merged.spdx"
+
+type spdxMerge struct{}
+
+// Run is the function that actually carries out the substantive
+// action of the agent, for this job.
+func (sm *spdxMerge) Run(ctx context.Context, cfg agent.JobConfig, rpt agentkit.Reporter) error {
+	// check that we got a non-empty output directory
+	if cfg.SpdxOutputDir == "" {
+		// we didn't; error out
+		return fmt.Errorf("no spdxOutputDir specified")
+	}
+
+	// get the name and namespace for the merged document
+	name := ""
+	for _, jkv := range cfg.Jkvs {
+		if jkv.Key == "documentName" {
+			name = jkv.Value
+		}
+	}
+	nc, err := spdxdoc.NewNamespaceConfig(cfg, namespaceBaseEnv)
+	if err != nil {
+		return err
+	}
+
+	// read the documents to merge
+	inputs, err := readInputs(cfg)
+	if err != nil {
+		return err
+	}
+
+	// we're all configured; set status as running
+	rpt.Running()
+
+	// merge them, in the order the job lists them
+	m := newMerger(time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	for i, in := range inputs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rpt.Progress(agentkit.Progress{Phase: "merging", Unit: "documents", Done: int64(i), Total: int64(len(inputs))})
+		if err := m.add(in); err != nil {
+			return fmt.Errorf("spdx-merge failed: %v", err)
+		}
+	}
+
+	if name == "" {
+		name = inputs[0].doc.DocumentName
+	}
+	// merging the same documents gives the same namespace
+	namespaces := []string{}
+	for _, in := range inputs {
+		namespaces = append(namespaces, in.doc.DocumentNamespace)
+	}
+	namespace, err := nc.Namespace(nameInvalidRe.ReplaceAllString(name, "-"), append([]string{name}, namespaces...)...)
+	if err != nil {
+		return err
+	}
+	doc, err := m.document(name, namespace)
+	if err != nil {
+		return fmt.Errorf("spdx-merge failed: %v", err)
+	}
+
+	// save the SPDX document to disk
+	if err := spdxdoc.WriteTagValue(doc, filepath.Join(cfg.SpdxOutputDir, mergedDocName)); err != nil {
+		return err
+	}
+
+	lines := []string{}
+	for _, in := range inputs {
+		lines = append(lines, fmt.Sprintf("input: %s", in.label))
+	}
+	nFiles := len(doc.Files)
+	for _, pkg := range doc.Packages {
+		nFiles += len(pkg.Files)
+	}
+	lines = append(lines, fmt.Sprintf("namespace: %s", doc.DocumentNamespace))
+	lines = append(lines, fmt.Sprintf("packages: %d", len(doc.Packages)))
+	lines = append(lines, fmt.Sprintf("files: %d", nFiles))
+	lines = append(lines, fmt.Sprintf("relationships: %d", len(doc.Relationships)))
+	lines = append(lines, fmt.Sprintf("document: %s", mergedDocName))
+	rpt.Output(strings.Join(lines, "\n"))
+
+	// conflicts don't stop the merge, but need someone to look at them
+	if m.conflicts > 0 {
+		rpt.Degraded(fmt.Sprintf("conflicts: %d, recorded as review annotations", m.conflicts))
+	}
+
+	// success!
+	return nil
+}
+
+var nameInvalidRe = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
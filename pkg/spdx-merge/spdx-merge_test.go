@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// testReporter records what a job reports.
+type testReporter struct {
+	running  bool
+	output   []string
+	degraded []string
+}
+
+func (r *testReporter) Running()                     { r.running = true }
+func (r *testReporter) Output(msg string)            { r.output = append(r.output, msg) }
+func (r *testReporter) Degraded(msg string)          { r.degraded = append(r.degraded, msg) }
+func (r *testReporter) Progress(p agentkit.Progress) {}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spdx-merge-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the documents, as two agents wrote them to their output
+	// directories
+	ids := testDocument("idsearcher", "Package-app", testFile("File0", "/a.go", "aaa", "MIT"))
+	matcher := testDocument("license-matcher", "Package-app", testFile("File0", "/a.go", "aaa", "GPL-2.0-only"))
+	for path, doc := range map[string]*spdx.Document{"ids": ids, "matcher": matcher} {
+		if err := os.Mkdir(filepath.Join(dir, path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := spdxdoc.WriteTagValue(doc, filepath.Join(dir, path, "primary.spdx")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outDir := filepath.Join(dir, "out")
+	if err := os.Mkdir(outDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := agent.JobConfig{
+		SpdxInputs: []*agent.JobConfig_SpdxInput{
+			{Source: "idsearcher", Path: filepath.Join(dir, "ids")},
+			{Source: "license-matcher", Path: filepath.Join(dir, "matcher")},
+		},
+		SpdxOutputDir: outDir,
+		Jkvs:          []*agent.JobConfig_JobKV{{Key: "documentName", Value: "app merged"}, {Key: "namespaceMode", Value: "hash"}},
+	}
+	rpt := &testReporter{}
+	if err := (&spdxMerge{}).Run(context.Background(), cfg, rpt); err != nil {
+		t.Fatalf("got error %v, want nil", err)
+	}
+	if !rpt.running {
+		t.Errorf("job never reported running")
+	}
+
+	in := &spdxdoc.Input{Label: "merged", Path: filepath.Join(outDir, mergedDocName), Format: spdxdoc.TagValue}
+	doc, _, err := in.Read()
+	if err != nil {
+		t.Fatalf("couldn't read merged document: %v", err)
+	}
+	if doc.DocumentName != "app merged" {
+		t.Errorf("got document name %q, want %q", doc.DocumentName, "app merged")
+	}
+	if !strings.Contains(doc.DocumentNamespace, "/app-merged-") {
+		t.Errorf("got namespace %q, want one from the document name", doc.DocumentNamespace)
+	}
+	if got := doc.Packages[0].Files[0].LicenseInfoInFiles; strings.Join(got, ",") != "GPL-2.0-only,MIT" {
+		t.Errorf("got license info in file %v, want both documents'", got)
+	}
+	if len(doc.Annotations) != 1 || doc.Annotations[0].AnnotationType != "REVIEW" {
+		t.Errorf("got annotations %+v, want the conflict recorded for review", doc.Annotations)
+	}
+
+	output := strings.Join(rpt.output, "\n")
+	for _, want := range []string{"namespace: " + doc.DocumentNamespace + "\n", "packages: 1\n", "files: 1\n", "document: merged.spdx"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("got output %q, want it to contain %q", output, want)
+		}
+	}
+	if want := "conflicts: 1, recorded as review annotations"; len(rpt.degraded) != 1 || rpt.degraded[0] != want {
+		t.Errorf("got degraded %q, want %q", rpt.degraded, want)
+	}
+
+	// merging the same documents again gives the same namespace
+	if err := (&spdxMerge{}).Run(context.Background(), cfg, &testReporter{}); err != nil {
+		t.Fatalf("second run: got error %v, want nil", err)
+	}
+	again, _, err := in.Read()
+	if err != nil {
+		t.Fatalf("couldn't read merged document: %v", err)
+	}
+	if again.DocumentNamespace != doc.DocumentNamespace {
+		t.Errorf("second run got namespace %q, want %q", again.DocumentNamespace, doc.DocumentNamespace)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spdx-merge-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "broken.spdx"), []byte("SPDXVersion: SPDX-2.2\nnot tag-value\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     agent.JobConfig
+		wantErr string
+	}{
+		{
+			name:    "no output directory",
+			cfg:     agent.JobConfig{SpdxInputs: []*agent.JobConfig_SpdxInput{{Source: "a", Path: dir}}},
+			wantErr: "no spdxOutputDir specified",
+		},
+		{
+			name:    "unreadable document",
+			cfg:     agent.JobConfig{SpdxInputs: []*agent.JobConfig_SpdxInput{{Source: "a", Path: filepath.Join(dir, "broken.spdx")}}, SpdxOutputDir: dir},
+			wantErr: "couldn't read",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rpt := &testReporter{}
+			err := (&spdxMerge{}).Run(context.Background(), tt.cfg, rpt)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+			if rpt.running {
+				t.Errorf("job reported running, want it to fail first")
+			}
+		})
+	}
+}
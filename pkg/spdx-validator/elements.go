@@ -0,0 +1,294 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/spdx/v2/common"
+)
+
+// packageName, fileName and snippetName return how messages refer to
+// a package, file or snippet: by its identifier, or by what else there
+// is if it doesn't have one.
+func packageName(p *spdx.Package) string {
+	if p.PackageSPDXIdentifier != "" {
+		return "SPDXRef-" + string(p.PackageSPDXIdentifier)
+	}
+	return fmt.Sprintf("package %q", p.PackageName)
+}
+
+func fileName(f *spdx.File) string {
+	if f.FileSPDXIdentifier != "" {
+		return "SPDXRef-" + string(f.FileSPDXIdentifier)
+	}
+	return fmt.Sprintf("file %q", f.FileName)
+}
+
+func snippetName(s *spdx.Snippet) string {
+	if s.SnippetSPDXIdentifier != "" {
+		return "SPDXRef-" + string(s.SnippetSPDXIdentifier)
+	}
+	return fmt.Sprintf("snippet from SPDXRef-%s", s.SnippetFromFileSPDXIdentifier)
+}
+
+// checkPackage checks p's fields, and that its verification code is
+// the one its files give.
+func (v *validator) checkPackage(p *spdx.Package) {
+	el := packageName(p)
+	if p.PackageName == "" {
+		v.errorf(el, "PackageName is missing")
+	}
+	if p.PackageDownloadLocation == "" {
+		v.errorf(el, "PackageDownloadLocation is missing")
+	}
+	v.checkChecksums(el, "PackageChecksum", p.PackageChecksums)
+
+	files := v.packageFiles(p)
+	code := p.PackageVerificationCode
+	if code != nil && code.Value == "" {
+		// as documents before SPDX 2.3 are read without one
+		code = nil
+	}
+	if !p.FilesAnalyzed {
+		if len(files) > 0 {
+			v.errorf(el, "FilesAnalyzed is false, but the package contains files")
+		}
+		if code != nil {
+			v.errorf(el, "FilesAnalyzed is false, but the package has a PackageVerificationCode")
+		}
+		if len(p.PackageLicenseInfoFromFiles) > 0 {
+			v.errorf(el, "FilesAnalyzed is false, but the package has PackageLicenseInfoFromFiles")
+		}
+	} else {
+		if code == nil {
+			if v.strict {
+				v.errorf(el, "PackageVerificationCode is missing")
+			}
+		} else {
+			v.checkVerificationCode(el, code, files)
+		}
+		v.checkLicenseInfo(el, "PackageLicenseInfoFromFiles", p.PackageLicenseInfoFromFiles, v.strict)
+	}
+
+	v.checkLicenseExpression(el, "PackageLicenseConcluded", p.PackageLicenseConcluded, v.strict)
+	v.checkLicenseExpression(el, "PackageLicenseDeclared", p.PackageLicenseDeclared, v.strict)
+	if v.strict && p.PackageCopyrightText == "" {
+		v.errorf(el, "PackageCopyrightText is missing")
+	}
+}
+
+// packageFiles returns p's files: those that the document lists with
+// it, and those that relationships say it contains.
+func (v *validator) packageFiles(p *spdx.Package) []*spdx.File {
+	files := []*spdx.File{}
+	seen := map[*spdx.File]bool{}
+	for _, f := range p.Files {
+		if f != nil && !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+	for id := range v.contains[p.PackageSPDXIdentifier] {
+		if f := v.byFileID[id]; f != nil && !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+var verificationCodeRe = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// checkVerificationCode checks that code, el's verification code, is
+// the one computed from the SHA1 checksums of files, the package's
+// files, less those it excludes.
+func (v *validator) checkVerificationCode(el string, code *common.PackageVerificationCode, files []*spdx.File) {
+	if !verificationCodeRe.MatchString(code.Value) {
+		v.errorf(el, "PackageVerificationCode %q must be 40 lower-case hexadecimal digits", code.Value)
+		return
+	}
+	if len(files) == 0 {
+		v.warningf(el, "PackageVerificationCode can't be checked, because the document doesn't list the package's files")
+		return
+	}
+
+	excluded := map[string]bool{}
+	for _, name := range code.ExcludedFiles {
+		excluded[trimFilePrefix(name)] = true
+	}
+	shas := []string{}
+	for _, f := range files {
+		if excluded[trimFilePrefix(f.FileName)] {
+			continue
+		}
+		sha := fileChecksum(f, common.SHA1)
+		if !isHex(sha, checksumDigits[common.SHA1]) {
+			// the file's own check reports this
+			return
+		}
+		shas = append(shas, strings.ToLower(sha))
+	}
+	sort.Strings(shas)
+	want := fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(shas, ""))))
+	if code.Value != want {
+		v.errorf(el, "PackageVerificationCode is %s, but the package's files give %s", code.Value, want)
+	}
+}
+
+// trimFilePrefix returns a file's name without the "./" or "/" that it
+// may start with, so that excluded files are matched however they are
+// written.
+func trimFilePrefix(name string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(name, "./"), "/")
+}
+
+// fileTypes are the types that a file can have.
+var fileTypes = map[string]bool{
+	"SOURCE": true, "BINARY": true, "ARCHIVE": true, "APPLICATION": true,
+	"AUDIO": true, "IMAGE": true, "TEXT": true, "VIDEO": true,
+	"DOCUMENTATION": true, "SPDX": true, "OTHER": true,
+}
+
+// checkFile checks f's fields.
+func (v *validator) checkFile(f *spdx.File) {
+	el := fileName(f)
+	if f.FileName == "" {
+		v.errorf(el, "FileName is missing")
+	}
+	for _, t := range f.FileTypes {
+		if !fileTypes[t] {
+			v.errorf(el, "FileType %q isn't a type of file", t)
+		}
+	}
+	if fileChecksum(f, common.SHA1) == "" {
+		v.errorf(el, "FileChecksum: SHA1 is missing")
+	}
+	v.checkChecksums(el, "FileChecksum", f.Checksums)
+
+	v.checkLicenseExpression(el, "LicenseConcluded", f.LicenseConcluded, v.strict)
+	v.checkLicenseInfo(el, "LicenseInfoInFile", f.LicenseInfoInFiles, v.strict)
+	if v.strict && f.FileCopyrightText == "" {
+		v.errorf(el, "FileCopyrightText is missing")
+	}
+}
+
+// checkSnippet checks s's fields, and that it is from one of the
+// document's files.
+func (v *validator) checkSnippet(s *spdx.Snippet) {
+	el := snippetName(s)
+	switch {
+	case s.SnippetFromFileSPDXIdentifier == "":
+		v.errorf(el, "SnippetFromFileSPDXID is missing")
+	case v.byFileID[s.SnippetFromFileSPDXIdentifier] == nil:
+		v.errorf(el, "SnippetFromFileSPDXID, SPDXRef-%s, isn't a file in the document", s.SnippetFromFileSPDXIdentifier)
+	}
+
+	hasByteRange := false
+	for _, r := range s.Ranges {
+		start, end := r.StartPointer, r.EndPointer
+		switch {
+		case start.Offset > 0 || end.Offset > 0:
+			hasByteRange = true
+			if start.Offset < 1 || end.Offset < start.Offset {
+				v.errorf(el, "SnippetByteRange %d:%d isn't a range of bytes", start.Offset, end.Offset)
+			}
+		case start.LineNumber > 0 || end.LineNumber > 0:
+			if start.LineNumber < 1 || end.LineNumber < start.LineNumber {
+				v.errorf(el, "SnippetLineRange %d:%d isn't a range of lines", start.LineNumber, end.LineNumber)
+			}
+		}
+	}
+	if !hasByteRange {
+		v.errorf(el, "SnippetByteRange is missing")
+	}
+
+	v.checkLicenseExpression(el, "SnippetLicenseConcluded", s.SnippetLicenseConcluded, v.strict)
+	v.checkLicenseInfo(el, "LicenseInfoInSnippet", s.LicenseInfoInSnippet, false)
+	if v.strict && s.SnippetCopyrightText == "" {
+		v.errorf(el, "SnippetCopyrightText is missing")
+	}
+}
+
+// checksumDigits is how many hexadecimal digits each checksum
+// algorithm's values have, or 0 for those whose values can be of any
+// length.
+var checksumDigits = map[common.ChecksumAlgorithm]int{
+	common.SHA1:        40,
+	common.SHA224:      56,
+	common.SHA256:      64,
+	common.SHA384:      96,
+	common.SHA512:      128,
+	common.MD2:         32,
+	common.MD4:         32,
+	common.MD5:         32,
+	common.MD6:         0,
+	common.SHA3_256:    64,
+	common.SHA3_384:    96,
+	common.SHA3_512:    128,
+	common.BLAKE2b_256: 64,
+	common.BLAKE2b_384: 96,
+	common.BLAKE2b_512: 128,
+	common.BLAKE3:      0,
+	common.ADLER32:     8,
+}
+
+// checkChecksums checks checksums, which field lists for el.
+func (v *validator) checkChecksums(el string, field string, checksums []common.Checksum) {
+	seen := map[common.ChecksumAlgorithm]bool{}
+	for _, c := range checksums {
+		if seen[c.Algorithm] {
+			v.errorf(el, "%s: %s is given more than once", field, c.Algorithm)
+			continue
+		}
+		seen[c.Algorithm] = true
+		v.checkChecksum(el, field, c)
+	}
+}
+
+// checkChecksum checks that c, the value of field for el, has a known
+// algorithm, and a value of the right length for it.
+func (v *validator) checkChecksum(el string, field string, c common.Checksum) {
+	digits, ok := checksumDigits[c.Algorithm]
+	switch {
+	case !ok:
+		v.errorf(el, "%s: %q isn't a checksum algorithm", field, c.Algorithm)
+	case !isHex(c.Value, digits):
+		if digits == 0 {
+			v.errorf(el, "%s: %s %q must be hexadecimal", field, c.Algorithm, c.Value)
+		} else {
+			v.errorf(el, "%s: %s %q must be %d hexadecimal digits", field, c.Algorithm, c.Value, digits)
+		}
+	case c.Value != strings.ToLower(c.Value):
+		v.warningf(el, "%s: %s %q should be in lower case", field, c.Algorithm, c.Value)
+	}
+}
+
+// isHex reports whether s is a non-empty string of hexadecimal digits,
+// and if digits isn't 0, of that many.
+func isHex(s string, digits int) bool {
+	if s == "" || digits != 0 && len(s) != digits {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// fileChecksum returns f's checksum with algorithm alg, or "" if it
+// doesn't have one.
+func fileChecksum(f *spdx.File, alg common.ChecksumAlgorithm) string {
+	for _, c := range f.Checksums {
+		if c.Algorithm == alg {
+			return c.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"strings"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+)
+
+// isNoneOrNoAssertion reports whether s is one of the special values
+// that a license field can have instead of a license expression.
+func isNoneOrNoAssertion(s string) bool {
+	return s == "NONE" || s == "NOASSERTION"
+}
+
+// checkLicenseExpression checks expr, the value of field for el. It
+// must be a valid license expression, or NONE or NOASSERTION, whose
+// licenses are each on the SPDX license list or defined in a document.
+// An empty value is only reported if the field is required.
+func (v *validator) checkLicenseExpression(el string, field string, expr string, required bool) {
+	if expr == "" {
+		if required {
+			v.errorf(el, "%s is missing", field)
+		}
+		return
+	}
+	if isNoneOrNoAssertion(expr) {
+		return
+	}
+	n, err := spdxdoc.ParseLicenseExpression(expr)
+	if err != nil {
+		v.errorf(el, "%s %q is not a valid license expression: %v", field, expr, err)
+		return
+	}
+	v.checkLicenseNode(el, field, n)
+}
+
+// checkLicenseInfo checks values, the licenses that field lists for
+// el, each of which must be a single license, or NONE or NOASSERTION.
+func (v *validator) checkLicenseInfo(el string, field string, values []string, required bool) {
+	if len(values) == 0 {
+		if required {
+			v.errorf(el, "%s is missing", field)
+		}
+		return
+	}
+	for _, value := range values {
+		if isNoneOrNoAssertion(value) {
+			if len(values) > 1 {
+				v.errorf(el, "%s lists %s along with other licenses", field, value)
+			}
+			continue
+		}
+		n, err := spdxdoc.ParseLicenseExpression(value)
+		if err != nil {
+			v.errorf(el, "%s %q is not a valid license: %v", field, value, err)
+			continue
+		}
+		if n.Op != "" && n.Op != "+" {
+			v.errorf(el, "%s %q should name a single license, not an expression", field, value)
+			continue
+		}
+		v.checkLicenseNode(el, field, n)
+	}
+}
+
+// checkLicenseNode checks the licenses and exceptions in n, part of
+// the value of field for el.
+func (v *validator) checkLicenseNode(el string, field string, n *spdxdoc.LicenseNode) {
+	if n.Op == "" {
+		v.checkLicenseID(el, field, n.ID)
+	}
+	for _, m := range n.Members {
+		v.checkLicenseNode(el, field, m)
+	}
+	if n.Op == "WITH" {
+		v.checkExceptionID(el, field, n.ID)
+	}
+}
+
+// checkLicenseID checks that id, a license in the value of field for
+// el, is on the SPDX license list or defined in a document.
+func (v *validator) checkLicenseID(el string, field string, id string) {
+	switch {
+	case isNoneOrNoAssertion(id):
+		v.errorf(el, "%s: %s can't be part of a license expression", field, id)
+
+	case strings.HasPrefix(id, "DocumentRef-"):
+		parts := strings.SplitN(strings.TrimPrefix(id, "DocumentRef-"), ":", 2)
+		if !v.externalRefs[parts[0]] {
+			v.errorf(el, "%s: %s refers to DocumentRef-%s, which isn't an external document reference", field, id, parts[0])
+		}
+		if len(parts) < 2 || !strings.HasPrefix(parts[1], "LicenseRef-") {
+			v.errorf(el, "%s: %s must name a LicenseRef- in the other document", field, id)
+		}
+
+	case strings.HasPrefix(id, "LicenseRef-"):
+		if !v.otherLicenses[id] {
+			v.errorf(el, "%s: %s isn't defined in the document", field, id)
+		}
+
+	default:
+		l, ok := v.licenses.Licenses[strings.ToLower(id)]
+		switch {
+		case !ok:
+			v.errorf(el, "%s: %s isn't on the SPDX license list (version %s)", field, id, v.licenses.Version)
+		case l.Deprecated:
+			v.warningf(el, "%s: %s is deprecated on the SPDX license list", field, l.ID)
+		case l.ID != id:
+			v.warningf(el, "%s: %s should be written as %s", field, id, l.ID)
+		}
+	}
+}
+
+// checkExceptionID checks that id, an exception in the value of field
+// for el, is on the SPDX license list.
+func (v *validator) checkExceptionID(el string, field string, id string) {
+	e, ok := v.licenses.Exceptions[strings.ToLower(id)]
+	switch {
+	case !ok:
+		v.errorf(el, "%s: %s isn't an exception on the SPDX license list (version %s)", field, id, v.licenses.Version)
+	case e.Deprecated:
+		v.warningf(el, "%s: exception %s is deprecated on the SPDX license list", field, e.ID)
+	case e.ID != id:
+		v.warningf(el, "%s: %s should be written as %s", field, id, e.ID)
+	}
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"log"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/licenselist"
+)
+
+const (
+	port = ":3021"
+
+	// licenseListEnv names the environment variable that gives the
+	// directory holding the SPDX license list that license expressions
+	// are checked against, laid out as in the spdx/license-list-data
+	// repository. The agent's Docker image bundles a copy at
+	// licenselist.DefaultDir.
+	licenseListEnv = "SPDX_VALIDATOR_LICENSE_LIST"
+)
+
+func main() {
+	// load the license list that documents' license expressions are
+	// checked against
+	dir := licenselist.Dir(licenseListEnv)
+	licenses, err := licenselist.Load(dir)
+	if err != nil {
+		log.Fatalf("couldn't load license list: %v", err)
+	}
+	log.Printf("loaded %d licenses and %d exceptions from %s", len(licenses.Licenses), len(licenses.Exceptions), dir)
+
+	// serve jobs until we're asked to shut down
+	if err := agentkit.Serve(port, &spdxValidator{licenses: licenses}); err != nil {
+		log.Fatal(err)
+	}
+}
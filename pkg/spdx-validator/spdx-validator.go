@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/licenselist"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// reportName is the name of the file that the full report is written
+// to, if the job has an spdxOutputDir.
+const reportName = "validation.json"
+
+// maxIssueLines is the most issues that the output messages list for
+// each document. The report lists them all.
+const maxIssueLines = 20
+
+// documentFormats are the formats that the agent validates. Every
+// document in them is validated, even if a directory holds the same
+// document in more than one, since each is written separately.
+var documentFormats = []*spdxdoc.Format{spdxdoc.TagValue, spdxdoc.JSON}
+
+type spdxValidator struct {
+	licenses *licenselist.List
+}
+
+// Run is the function that actually carries out the substantive
+// action of the agent, for this job.
+func (sv *spdxValidator) Run(ctx context.Context, cfg agent.JobConfig, rpt agentkit.Reporter) error {
+	// find the documents to validate
+	inputs, err := spdxdoc.FindInputs(cfg, documentFormats, false)
+	if err != nil {
+		return err
+	}
+
+	// we're all configured; set status as running
+	rpt.Running()
+
+	reports := []*documentReport{}
+	for i, in := range inputs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rpt.Progress(agentkit.Progress{Phase: "validating", Unit: "documents", Done: int64(i), Total: int64(len(inputs))})
+		reports = append(reports, validate(sv.licenses, in))
+	}
+
+	// save the full report, if there's somewhere to put it
+	if cfg.SpdxOutputDir != "" {
+		if err := writeReport(reports, filepath.Join(cfg.SpdxOutputDir, reportName)); err != nil {
+			return err
+		}
+	}
+
+	lines := []string{}
+	invalid := 0
+	warnings := 0
+	for _, r := range reports {
+		if !r.Valid {
+			invalid++
+		}
+		warnings += r.Warnings
+		lines = append(lines, reportLines(r, cfg.SpdxOutputDir != "")...)
+	}
+	lines = append(lines, fmt.Sprintf("documents: %d", len(reports)))
+	lines = append(lines, fmt.Sprintf("invalid: %d", invalid))
+	if cfg.SpdxOutputDir != "" {
+		lines = append(lines, fmt.Sprintf("report: %s", reportName))
+	}
+	rpt.Output(strings.Join(lines, "\n"))
+
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d documents are invalid", invalid, len(reports))
+	}
+	if warnings > 0 {
+		rpt.Degraded(fmt.Sprintf("warnings: %d", warnings))
+	}
+
+	// success!
+	return nil
+}
+
+// reportLines returns the output messages for r: a line for the
+// document, then one for each of the first maxIssueLines issues, each
+// starting with its severity. hasReport is true if the full report is
+// written, for a message to point at it when not all of the issues are
+// listed.
+func reportLines(r *documentReport, hasReport bool) []string {
+	result := "valid"
+	if !r.Valid {
+		result = "invalid"
+	}
+	details := []string{}
+	if r.Version != "" {
+		details = append(details, r.Version)
+	}
+	if r.Errors > 0 {
+		details = append(details, plural(r.Errors, "error"))
+	}
+	if r.Warnings > 0 {
+		details = append(details, plural(r.Warnings, "warning"))
+	}
+	if len(details) > 0 {
+		result = fmt.Sprintf("%s (%s)", result, strings.Join(details, ", "))
+	}
+
+	lines := []string{fmt.Sprintf("document: %s: %s", r.Document, result)}
+	for i, is := range r.Issues {
+		if i == maxIssueLines {
+			more := fmt.Sprintf("issues not listed: %d", len(r.Issues)-maxIssueLines)
+			if hasReport {
+				more += fmt.Sprintf(", see %s", reportName)
+			}
+			lines = append(lines, more)
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s: %s", is.Severity, is.Element, is.Message))
+	}
+	return lines
+}
+
+// plural returns n and noun, with an "s" if n isn't 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// writeReport writes reports as JSON to the file at path.
+func writeReport(reports []*documentReport, path string) error {
+	b, err := json.MarshalIndent(struct {
+		Documents []*documentReport `json:"documents"`
+	}{reports}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		// can't write report to disk; remove what we wrote of it and
+		// error out
+		os.Remove(path)
+		return fmt.Errorf("can't write validation report to disk: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit"
+	"github.com/swinslow/peridot-jobrunner/pkg/agent"
+)
+
+// testReporter records what a job reports.
+type testReporter struct {
+	running  bool
+	output   []string
+	degraded []string
+}
+
+func (r *testReporter) Running()                     { r.running = true }
+func (r *testReporter) Output(msg string)            { r.output = append(r.output, msg) }
+func (r *testReporter) Degraded(msg string)          { r.degraded = append(r.degraded, msg) }
+func (r *testReporter) Progress(p agentkit.Progress) {}
+
+func TestRun(t *testing.T) {
+	// a document with a warning, and one that is invalid
+	warned := strings.Replace(testTagValue, "SHA1: "+emptySHA1, "SHA1: "+strings.ToUpper(emptySHA1), 1)
+	invalid := strings.Replace(testJSON, `"dataLicense": "CC0-1.0"`, `"dataLicense": "MIT"`, 1)
+
+	tests := []struct {
+		name      string
+		documents map[string]string
+		wantErr   string
+		// wantDegraded is the job's degraded message, if any
+		wantDegraded string
+		wantOutput   []string
+		wantValid    map[string]bool
+	}{
+		{
+			name:       "valid",
+			documents:  map[string]string{"a.spdx": testTagValue},
+			wantOutput: []string{"document: docs: a.spdx: valid (SPDX-2.3)\n", "documents: 1\ninvalid: 0\nreport: validation.json"},
+			wantValid:  map[string]bool{"docs: a.spdx": true},
+		},
+		{
+			name:         "warnings",
+			documents:    map[string]string{"a.spdx": testTagValue, "b.spdx": warned},
+			wantDegraded: "warnings: 1",
+			wantOutput:   []string{"document: docs: b.spdx: valid (SPDX-2.3, 1 warning)\nwarning: SPDXRef-File0: FileChecksum", "invalid: 0\n"},
+			wantValid:    map[string]bool{"docs: a.spdx": true, "docs: b.spdx": true},
+		},
+		{
+			name:       "errors",
+			documents:  map[string]string{"b.spdx": warned, "c.spdx.json": invalid},
+			wantErr:    "1 of 2 documents are invalid",
+			wantOutput: []string{"document: docs: c.spdx.json: invalid (SPDX-2.3, 1 error)\nerror: document: DataLicense", "invalid: 1\n"},
+			wantValid:  map[string]bool{"docs: b.spdx": true, "docs: c.spdx.json": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "spdx-validator-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			docsDir := filepath.Join(dir, "docs")
+			outDir := filepath.Join(dir, "out")
+			for _, d := range []string{docsDir, outDir} {
+				if err := os.Mkdir(d, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for name, content := range tt.documents {
+				if err := ioutil.WriteFile(filepath.Join(docsDir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cfg := agent.JobConfig{
+				SpdxInputs:    []*agent.JobConfig_SpdxInput{{Source: "docs", Path: docsDir}},
+				SpdxOutputDir: outDir,
+			}
+			rpt := &testReporter{}
+			err = (&spdxValidator{licenses: testLicenses}).Run(context.Background(), cfg, rpt)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+			if !rpt.running {
+				t.Errorf("job never reported running")
+			}
+			// an invalid document fails the job, so warnings aren't
+			// reported as well
+			if got := strings.Join(rpt.degraded, "\n"); got != tt.wantDegraded {
+				t.Errorf("got degraded %q, want %q", got, tt.wantDegraded)
+			}
+			output := strings.Join(rpt.output, "\n")
+			for _, want := range tt.wantOutput {
+				if !strings.Contains(output, want) {
+					t.Errorf("got output %q, want it to contain %q", output, want)
+				}
+			}
+
+			b, err := ioutil.ReadFile(filepath.Join(outDir, reportName))
+			if err != nil {
+				t.Fatalf("couldn't read report: %v", err)
+			}
+			var report struct {
+				Documents []*documentReport `json:"documents"`
+			}
+			if err := json.Unmarshal(b, &report); err != nil {
+				t.Fatalf("couldn't parse report: %v", err)
+			}
+			got := map[string]bool{}
+			for _, r := range report.Documents {
+				got[r.Document] = r.Valid
+				if len(r.Issues) != r.Errors+r.Warnings {
+					t.Errorf("%s: got %d issues, want %d errors and warnings", r.Document, len(r.Issues), r.Errors+r.Warnings)
+				}
+			}
+			if len(got) != len(tt.wantValid) {
+				t.Errorf("got documents %v, want %v", got, tt.wantValid)
+			}
+			for doc, want := range tt.wantValid {
+				if valid, ok := got[doc]; !ok || valid != want {
+					t.Errorf("%s: got valid %t, want %t", doc, valid, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReportLines(t *testing.T) {
+	r := &documentReport{Document: "big.spdx", Version: "SPDX-2.3", Errors: maxIssueLines + 5}
+	for i := 0; i < r.Errors; i++ {
+		r.Issues = append(r.Issues, &issue{Severity: severityError, Element: "document", Message: "wrong"})
+	}
+	lines := reportLines(r, true)
+	if len(lines) != maxIssueLines+2 {
+		t.Fatalf("got %d lines, want the document, %d issues and a line for the rest", len(lines), maxIssueLines)
+	}
+	if want := "document: big.spdx: invalid (SPDX-2.3, 25 errors)"; lines[0] != want {
+		t.Errorf("got %q, want %q", lines[0], want)
+	}
+	if want := "issues not listed: 5, see validation.json"; lines[len(lines)-1] != want {
+		t.Errorf("got %q, want %q", lines[len(lines)-1], want)
+	}
+}
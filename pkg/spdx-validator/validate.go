@@ -0,0 +1,451 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/spdx/v2/common"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/licenselist"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+)
+
+// The severities of the issues found in documents. A document with any
+// errors is invalid; warnings are about what is allowed but probably
+// wrong, or couldn't be checked.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// spdxTimeFormat is the form of the dates and times in SPDX documents.
+const spdxTimeFormat = "2006-01-02T15:04:05Z"
+
+// idRe matches the part of an SPDX identifier after "SPDXRef-" or
+// "DocumentRef-".
+var idRe = regexp.MustCompile(`^[A-Za-z0-9.-]+$`)
+
+// issue is a problem found in a document.
+type issue struct {
+	Severity string `json:"severity"`
+
+	// Element names what the issue is with, such as an element's SPDX
+	// identifier or a relationship.
+	Element string `json:"element"`
+	Message string `json:"message"`
+}
+
+// documentReport is what was found when validating a document.
+type documentReport struct {
+	Document string   `json:"document"`
+	Version  string   `json:"spdxVersion,omitempty"`
+	Valid    bool     `json:"valid"`
+	Errors   int      `json:"errors"`
+	Warnings int      `json:"warnings"`
+	Issues   []*issue `json:"issues"`
+}
+
+// validator validates one document.
+type validator struct {
+	licenses *licenselist.List
+	doc      *spdx.Document
+	report   *documentReport
+
+	// strict is true for documents written in an SPDX version before
+	// 2.3, which requires license and copyright fields that later
+	// versions made optional.
+	strict bool
+
+	// ids maps the identifiers of the document's elements to what
+	// they are, for messages about identifiers that are used twice.
+	ids map[common.ElementID]string
+
+	files    []*spdx.File
+	byFileID map[common.ElementID]*spdx.File
+	snippets []*spdx.Snippet
+
+	// contains maps each package's identifier to those of the files
+	// that relationships say it contains, as the JSON reader leaves
+	// the files of packages.
+	contains map[common.ElementID]map[common.ElementID]bool
+
+	externalRefs  map[string]bool
+	otherLicenses map[string]bool
+}
+
+// validate validates the document in. A document that can't be parsed
+// is invalid.
+func validate(licenses *licenselist.List, in *spdxdoc.Input) *documentReport {
+	v := &validator{
+		licenses:      licenses,
+		report:        &documentReport{Document: in.Label, Issues: []*issue{}},
+		ids:           map[common.ElementID]string{},
+		byFileID:      map[common.ElementID]*spdx.File{},
+		contains:      map[common.ElementID]map[common.ElementID]bool{},
+		externalRefs:  map[string]bool{},
+		otherLicenses: map[string]bool{},
+	}
+
+	doc, version, err := in.Read()
+	if err != nil {
+		v.errorf("document", "couldn't parse document: %v", err)
+	} else {
+		v.doc = doc
+		v.report.Version = version
+		v.strict = version == "SPDX-2.1" || version == "SPDX-2.2"
+
+		v.index()
+		v.checkDocument()
+		for _, p := range doc.Packages {
+			v.checkPackage(p)
+		}
+		for _, f := range v.files {
+			v.checkFile(f)
+		}
+		for _, s := range v.snippets {
+			v.checkSnippet(s)
+		}
+		v.checkOtherLicenses()
+		v.checkRelationships()
+		v.checkAnnotations()
+	}
+
+	v.report.Valid = v.report.Errors == 0
+	return v.report
+}
+
+// errorf records an error with el.
+func (v *validator) errorf(el string, format string, args ...interface{}) {
+	v.report.Errors++
+	v.report.Issues = append(v.report.Issues, &issue{Severity: severityError, Element: el, Message: fmt.Sprintf(format, args...)})
+}
+
+// warningf records a warning about el.
+func (v *validator) warningf(el string, format string, args ...interface{}) {
+	v.report.Warnings++
+	v.report.Issues = append(v.report.Issues, &issue{Severity: severityWarning, Element: el, Message: fmt.Sprintf(format, args...)})
+}
+
+// index gathers the document's elements, identifiers, external
+// document references and other licenses, which the rest of the
+// checks refer to, and checks that each identifier is used once.
+func (v *validator) index() {
+	doc := v.doc
+	if doc.SPDXIdentifier != "DOCUMENT" {
+		v.errorf("document", "SPDXID is %q, but must be SPDXRef-DOCUMENT", "SPDXRef-"+string(doc.SPDXIdentifier))
+	}
+	v.ids[doc.SPDXIdentifier] = "the document"
+
+	for _, p := range doc.Packages {
+		v.addID(packageName(p), p.PackageSPDXIdentifier, "a package")
+	}
+
+	// the files are those of the packages, and those outside of any,
+	// which is where the JSON reader puts all of them
+	seenFiles := map[*spdx.File]bool{}
+	seenSnippets := map[*spdx.Snippet]bool{}
+	addFiles := func(files []*spdx.File) {
+		for _, f := range files {
+			if f == nil || seenFiles[f] {
+				continue
+			}
+			seenFiles[f] = true
+			v.files = append(v.files, f)
+			v.addID(fileName(f), f.FileSPDXIdentifier, "a file")
+			if f.FileSPDXIdentifier != "" {
+				v.byFileID[f.FileSPDXIdentifier] = f
+			}
+			for _, s := range f.Snippets {
+				if s != nil && !seenSnippets[s] {
+					seenSnippets[s] = true
+					v.snippets = append(v.snippets, s)
+				}
+			}
+		}
+	}
+	for _, p := range doc.Packages {
+		addFiles(p.Files)
+	}
+	addFiles(doc.Files)
+	for i := range doc.Snippets {
+		v.snippets = append(v.snippets, &doc.Snippets[i])
+	}
+	for _, s := range v.snippets {
+		v.addID(snippetName(s), s.SnippetSPDXIdentifier, "a snippet")
+	}
+
+	for _, edr := range doc.ExternalDocumentReferences {
+		el := "DocumentRef-" + edr.DocumentRefID
+		switch {
+		case edr.DocumentRefID == "":
+			v.errorf("document", "an ExternalDocumentRef has no identifier")
+		case !idRe.MatchString(edr.DocumentRefID):
+			v.errorf(el, "the identifier has characters other than letters, numbers, \".\" and \"-\"")
+		case v.externalRefs[edr.DocumentRefID]:
+			v.errorf(el, "the identifier is used for more than one ExternalDocumentRef")
+		}
+		v.externalRefs[edr.DocumentRefID] = true
+		v.checkNamespace(el, "the referenced document's namespace", edr.URI)
+		if edr.Checksum.Algorithm != common.SHA1 {
+			v.errorf(el, "the referenced document's checksum must be SHA1, not %q", edr.Checksum.Algorithm)
+		} else {
+			v.checkChecksum(el, "checksum", edr.Checksum)
+		}
+	}
+
+	for _, ol := range doc.OtherLicenses {
+		if ol != nil {
+			v.otherLicenses[ol.LicenseIdentifier] = true
+		}
+	}
+
+	for _, r := range doc.Relationships {
+		if r == nil || r.RefA.DocumentRefID != "" || r.RefB.DocumentRefID != "" {
+			continue
+		}
+		pkg, file := r.RefA.ElementRefID, r.RefB.ElementRefID
+		switch r.Relationship {
+		case common.TypeRelationshipContains:
+		case common.TypeRelationshipContainedBy:
+			pkg, file = file, pkg
+		default:
+			continue
+		}
+		if v.contains[pkg] == nil {
+			v.contains[pkg] = map[common.ElementID]bool{}
+		}
+		v.contains[pkg][file] = true
+	}
+}
+
+// addID records that el, which is kind of element, has the identifier
+// id, and checks that no other element does.
+func (v *validator) addID(el string, id common.ElementID, kind string) {
+	switch prev, ok := v.ids[id]; {
+	case id == "":
+		v.errorf(el, "SPDXID is missing")
+		return
+	case !idRe.MatchString(string(id)):
+		v.errorf(el, "SPDXID has characters other than letters, numbers, \".\" and \"-\"")
+	case ok:
+		v.errorf(el, "SPDXID is also the identifier of %s", prev)
+		return
+	}
+	v.ids[id] = kind
+}
+
+// checkDocument checks the document's own fields and creation info.
+func (v *validator) checkDocument() {
+	doc := v.doc
+	switch doc.DataLicense {
+	case "CC0-1.0":
+	case "":
+		v.errorf("document", "DataLicense is missing")
+	default:
+		v.errorf("document", "DataLicense is %q, but must be CC0-1.0", doc.DataLicense)
+	}
+	if doc.DocumentName == "" {
+		v.errorf("document", "DocumentName is missing")
+	}
+	v.checkNamespace("document", "DocumentNamespace", doc.DocumentNamespace)
+
+	ci := doc.CreationInfo
+	if ci == nil {
+		v.errorf("document", "creation info is missing")
+		return
+	}
+	if len(ci.Creators) == 0 {
+		v.errorf("document", "Creator is missing")
+	}
+	for _, c := range ci.Creators {
+		v.checkActor("document", "Creator", c.CreatorType, c.Creator)
+	}
+	v.checkTime("document", "Created", ci.Created)
+
+	// a document should say what it describes, though one written
+	// before SPDX 2.3 could leave it to be the only package
+	describes := false
+	for _, r := range doc.Relationships {
+		if r == nil {
+			continue
+		}
+		if r.Relationship == common.TypeRelationshipDescribe && r.RefA.ElementRefID == doc.SPDXIdentifier && r.RefA.DocumentRefID == "" ||
+			r.Relationship == common.TypeRelationshipDescribeBy && r.RefB.ElementRefID == doc.SPDXIdentifier && r.RefB.DocumentRefID == "" {
+			describes = true
+		}
+	}
+	if !describes && (len(doc.Packages) > 1 || len(doc.Packages) == 0 && len(v.files) > 0) {
+		v.warningf("document", "no DESCRIBES relationship says which of the document's elements it describes")
+	}
+}
+
+// checkNamespace checks that ns, the value of field for el, is a
+// document namespace: an absolute URI without a "#".
+func (v *validator) checkNamespace(el string, field string, ns string) {
+	if ns == "" {
+		v.errorf(el, "%s is missing", field)
+		return
+	}
+	u, err := url.Parse(ns)
+	if err != nil || !u.IsAbs() || strings.Contains(ns, "#") {
+		v.errorf(el, "%s %q must be an absolute URI without a \"#\"", field, ns)
+	}
+}
+
+// checkActor checks the type and name of a creator or annotator, the
+// value of field for el.
+func (v *validator) checkActor(el string, field string, actorType string, name string) {
+	switch actorType {
+	case "Person", "Organization", "Tool":
+	default:
+		v.errorf(el, "%s %q must be a Person, Organization or Tool", field, actorType+": "+name)
+		return
+	}
+	if strings.TrimSpace(name) == "" {
+		v.errorf(el, "%s has no name after %q", field, actorType+":")
+	}
+}
+
+// checkTime checks that value, the value of field for el, is a date
+// and time as SPDX writes them.
+func (v *validator) checkTime(el string, field string, value string) {
+	if value == "" {
+		v.errorf(el, "%s is missing", field)
+		return
+	}
+	if _, err := time.Parse(spdxTimeFormat, value); err != nil {
+		v.errorf(el, "%s %q must be a UTC date and time, in the form YYYY-MM-DDThh:mm:ssZ", field, value)
+	}
+}
+
+// checkOtherLicenses checks the licenses that the document defines.
+func (v *validator) checkOtherLicenses() {
+	seen := map[string]bool{}
+	for _, ol := range v.doc.OtherLicenses {
+		if ol == nil {
+			continue
+		}
+		el := ol.LicenseIdentifier
+		switch {
+		case el == "":
+			v.errorf("document", "a license defined in the document has no LicenseID")
+			continue
+		case !strings.HasPrefix(el, "LicenseRef-") || !idRe.MatchString(strings.TrimPrefix(el, "LicenseRef-")):
+			v.errorf(el, "LicenseID must be \"LicenseRef-\" followed by letters, numbers, \".\" and \"-\"")
+		case seen[el]:
+			v.errorf(el, "LicenseID is used for more than one license defined in the document")
+		}
+		seen[el] = true
+		if ol.ExtractedText == "" {
+			v.errorf(el, "ExtractedText is missing")
+		}
+	}
+}
+
+// relationshipTypes are the types of relationship between elements.
+var relationshipTypes = map[string]bool{
+	"DESCRIBES": true, "DESCRIBED_BY": true,
+	"CONTAINS": true, "CONTAINED_BY": true,
+	"DEPENDS_ON": true, "DEPENDENCY_OF": true, "DEPENDENCY_MANIFEST_OF": true,
+	"BUILD_DEPENDENCY_OF": true, "DEV_DEPENDENCY_OF": true, "OPTIONAL_DEPENDENCY_OF": true,
+	"PROVIDED_DEPENDENCY_OF": true, "TEST_DEPENDENCY_OF": true, "RUNTIME_DEPENDENCY_OF": true,
+	"EXAMPLE_OF": true, "GENERATES": true, "GENERATED_FROM": true,
+	"ANCESTOR_OF": true, "DESCENDANT_OF": true, "VARIANT_OF": true,
+	"DISTRIBUTION_ARTIFACT": true, "PATCH_FOR": true, "PATCH_APPLIED": true,
+	"COPY_OF": true, "FILE_ADDED": true, "FILE_DELETED": true, "FILE_MODIFIED": true,
+	"EXPANDED_FROM_ARCHIVE": true, "DYNAMIC_LINK": true, "STATIC_LINK": true,
+	"DATA_FILE_OF": true, "TEST_CASE_OF": true, "BUILD_TOOL_OF": true,
+	"DEV_TOOL_OF": true, "TEST_OF": true, "TEST_TOOL_OF": true,
+	"DOCUMENTATION_OF": true, "OPTIONAL_COMPONENT_OF": true, "METAFILE_OF": true,
+	"PACKAGE_OF": true, "AMENDS": true, "PREREQUISITE_FOR": true,
+	"HAS_PREREQUISITE": true, "REQUIREMENT_DESCRIPTION_FOR": true,
+	"SPECIFICATION_FOR": true, "OTHER": true,
+}
+
+// checkRelationships checks that each relationship is of a known type,
+// and refers to elements that the document has or that are in the
+// documents it references.
+func (v *validator) checkRelationships() {
+	for _, r := range v.doc.Relationships {
+		if r == nil {
+			continue
+		}
+		el := fmt.Sprintf("relationship %s %s %s", common.RenderDocElementID(r.RefA), r.Relationship, common.RenderDocElementID(r.RefB))
+		if !relationshipTypes[r.Relationship] {
+			v.errorf(el, "%q isn't a type of relationship", r.Relationship)
+		}
+		v.checkRef(el, "the first element", r.RefA, false)
+		v.checkRef(el, "the second element", r.RefB, true)
+	}
+}
+
+// checkRef checks that ref, which what refers to for el, is an element
+// of the document or of a document it references, or, if special is
+// true, NONE or NOASSERTION.
+func (v *validator) checkRef(el string, what string, ref common.DocElementID, special bool) {
+	switch {
+	case ref.SpecialID != "":
+		if !special {
+			v.errorf(el, "%s can't be %s", what, ref.SpecialID)
+		}
+	case ref.DocumentRefID != "":
+		if !v.externalRefs[ref.DocumentRefID] {
+			v.errorf(el, "%s is in DocumentRef-%s, which isn't an external document reference", what, ref.DocumentRefID)
+		}
+	case ref.ElementRefID == "":
+		v.errorf(el, "%s is missing", what)
+	default:
+		if _, ok := v.ids[ref.ElementRefID]; !ok {
+			v.errorf(el, "%s, SPDXRef-%s, isn't an element of the document", what, ref.ElementRefID)
+		}
+	}
+}
+
+// checkAnnotations checks the document's annotations, both those it
+// lists and those that the JSON reader keeps with packages and files.
+func (v *validator) checkAnnotations() {
+	for _, ann := range v.doc.Annotations {
+		if ann == nil {
+			continue
+		}
+		target := ann.AnnotationSPDXIdentifier
+		if target == (common.DocElementID{}) {
+			// an annotation on the document itself, as the JSON
+			// reader leaves it
+			target.ElementRefID = v.doc.SPDXIdentifier
+		}
+		el := "annotation on " + common.RenderDocElementID(target)
+		v.checkRef(el, "the annotated element", target, false)
+		v.checkAnnotation(el, ann)
+	}
+	for _, p := range v.doc.Packages {
+		for i := range p.Annotations {
+			v.checkAnnotation("annotation on "+packageName(p), &p.Annotations[i])
+		}
+	}
+	for _, f := range v.files {
+		for i := range f.Annotations {
+			v.checkAnnotation("annotation on "+fileName(f), &f.Annotations[i])
+		}
+	}
+}
+
+// checkAnnotation checks the fields of ann, which el names.
+func (v *validator) checkAnnotation(el string, ann *spdx.Annotation) {
+	v.checkActor(el, "Annotator", ann.Annotator.AnnotatorType, ann.Annotator.Annotator)
+	v.checkTime(el, "AnnotationDate", ann.AnnotationDate)
+	switch ann.AnnotationType {
+	case "REVIEW", "OTHER":
+	case "":
+		v.errorf(el, "AnnotationType is missing")
+	default:
+		v.errorf(el, "AnnotationType %q must be REVIEW or OTHER", ann.AnnotationType)
+	}
+	if ann.AnnotationComment == "" {
+		v.errorf(el, "AnnotationComment is missing")
+	}
+}
@@ -0,0 +1,322 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/swinslow/peridot-agents/pkg/agentkit/licenselist"
+	"github.com/swinslow/peridot-agents/pkg/agentkit/spdxdoc"
+)
+
+// emptySHA1 is the SHA1 checksum of an empty file, and emptyCode the
+// verification code of a package holding only that file.
+const (
+	emptySHA1 = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	emptyCode = "10a34637ad661d98ba3344717656fcc76209c2f8"
+)
+
+// testTagValue is a valid tag-value document, which the tests break in
+// one place each.
+const testTagValue = `SPDXVersion: SPDX-2.3
+DataLicense: CC0-1.0
+SPDXID: SPDXRef-DOCUMENT
+DocumentName: test
+DocumentNamespace: https://example.com/test
+Creator: Tool: test
+Created: 2020-01-01T00:00:00Z
+
+PackageName: app
+SPDXID: SPDXRef-Package-app
+PackageDownloadLocation: NOASSERTION
+FilesAnalyzed: true
+PackageVerificationCode: ` + emptyCode + `
+PackageLicenseConcluded: MIT
+PackageLicenseDeclared: MIT
+PackageLicenseInfoFromFiles: MIT
+PackageCopyrightText: NOASSERTION
+
+FileName: ./a.go
+SPDXID: SPDXRef-File0
+FileChecksum: SHA1: ` + emptySHA1 + `
+LicenseConcluded: MIT
+LicenseInfoInFile: MIT
+FileCopyrightText: NOASSERTION
+
+Relationship: SPDXRef-DOCUMENT DESCRIBES SPDXRef-Package-app
+`
+
+// testJSON is testTagValue in JSON, where the package's files are
+// given by relationships.
+const testJSON = `{
+  "spdxVersion": "SPDX-2.3",
+  "dataLicense": "CC0-1.0",
+  "SPDXID": "SPDXRef-DOCUMENT",
+  "name": "test",
+  "documentNamespace": "https://example.com/test",
+  "creationInfo": {"creators": ["Tool: test"], "created": "2020-01-01T00:00:00Z"},
+  "packages": [{
+    "name": "app",
+    "SPDXID": "SPDXRef-Package-app",
+    "downloadLocation": "NOASSERTION",
+    "filesAnalyzed": true,
+    "packageVerificationCode": {"packageVerificationCodeValue": "` + emptyCode + `"},
+    "licenseConcluded": "MIT",
+    "licenseDeclared": "MIT",
+    "licenseInfoFromFiles": ["MIT"],
+    "copyrightText": "NOASSERTION"
+  }],
+  "files": [{
+    "fileName": "./a.go",
+    "SPDXID": "SPDXRef-File0",
+    "checksums": [{"algorithm": "SHA1", "checksumValue": "` + emptySHA1 + `"}],
+    "licenseConcluded": "MIT",
+    "licenseInfoInFiles": ["MIT"],
+    "copyrightText": "NOASSERTION"
+  }],
+  "relationships": [
+    {"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-Package-app"},
+    {"spdxElementId": "SPDXRef-Package-app", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-File0"}
+  ]
+}
+`
+
+// testLicenses is the license list that the tests check licenses
+// against.
+var testLicenses = &licenselist.List{
+	Version: "3.20",
+	Licenses: map[string]*licenselist.ID{
+		"mit":          {ID: "MIT"},
+		"gpl-2.0":      {ID: "GPL-2.0", Deprecated: true},
+		"gpl-2.0-only": {ID: "GPL-2.0-only"},
+	},
+	Exceptions: map[string]*licenselist.ID{
+		"classpath-exception-2.0": {ID: "Classpath-exception-2.0"},
+	},
+}
+
+// writeDocument writes content to a new directory, as a document in
+// format, and returns the directory and the document.
+func writeDocument(t *testing.T, content string, format *spdxdoc.Format) (string, *spdxdoc.Input) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "spdx-validator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "test"+format.Ext)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir, &spdxdoc.Input{Label: "test", Path: path, Format: format}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		format *spdxdoc.Format
+		// edits are pairs of text in the base document and what to
+		// replace it with
+		edits []string
+		// want are the issues found, as "severity: element: message",
+		// where the message need only be the start of it
+		want []string
+	}{
+		{name: "valid"},
+		{name: "valid JSON", format: spdxdoc.JSON},
+		{
+			name:  "unparseable",
+			edits: []string{"SPDXVersion: SPDX-2.3", "SPDXVersion: SPDX-2.3\nNotATag"},
+			want:  []string{"error: document: couldn't parse document"},
+		},
+		{
+			name:  "data license",
+			edits: []string{"DataLicense: CC0-1.0", "DataLicense: MIT"},
+			want:  []string{`error: document: DataLicense is "MIT", but must be CC0-1.0`},
+		},
+		{
+			name:  "namespace with fragment",
+			edits: []string{"https://example.com/test", "https://example.com/test#part"},
+			want:  []string{`error: document: DocumentNamespace "https://example.com/test#part" must be an absolute URI`},
+		},
+		{
+			name:  "created",
+			edits: []string{"Created: 2020-01-01T00:00:00Z", "Created: 2020-01-01"},
+			want:  []string{`error: document: Created "2020-01-01" must be a UTC date and time`},
+		},
+		{
+			name:  "duplicate SPDXID",
+			edits: []string{"SPDXID: SPDXRef-File0", "SPDXID: SPDXRef-Package-app"},
+			want:  []string{"error: SPDXRef-Package-app: SPDXID is also the identifier of a package"},
+		},
+		{
+			name:  "dangling relationship",
+			edits: []string{"DESCRIBES SPDXRef-Package-app\n", "DESCRIBES SPDXRef-Package-app\nRelationship: SPDXRef-Package-app DEPENDS_ON SPDXRef-Package-lib\n"},
+			want:  []string{"error: relationship SPDXRef-Package-app DEPENDS_ON SPDXRef-Package-lib: the second element, SPDXRef-Package-lib, isn't an element of the document"},
+		},
+		{
+			name:   "dangling relationship in JSON",
+			format: spdxdoc.JSON,
+			edits:  []string{`"relatedSpdxElement": "SPDXRef-File0"`, `"relatedSpdxElement": "SPDXRef-File1"`},
+			want: []string{
+				// without its file, the package's code is only checked
+				// as far as it can be
+				"warning: SPDXRef-Package-app: PackageVerificationCode can't be checked",
+				"error: relationship SPDXRef-Package-app CONTAINS SPDXRef-File1: the second element, SPDXRef-File1, isn't an element of the document",
+			},
+		},
+		{
+			name:  "relationship to an unreferenced document",
+			edits: []string{"DESCRIBES SPDXRef-Package-app\n", "DESCRIBES SPDXRef-Package-app\nRelationship: SPDXRef-Package-app DEPENDS_ON DocumentRef-lib:SPDXRef-Package-lib\n"},
+			want:  []string{"error: relationship SPDXRef-Package-app DEPENDS_ON DocumentRef-lib:SPDXRef-Package-lib: the second element is in DocumentRef-lib, which isn't an external document reference"},
+		},
+		{
+			name:  "verification code",
+			edits: []string{emptyCode, strings.Repeat("0", 40)},
+			want:  []string{"error: SPDXRef-Package-app: PackageVerificationCode is " + strings.Repeat("0", 40) + ", but the package's files give " + emptyCode},
+		},
+		{
+			name:   "verification code in JSON",
+			format: spdxdoc.JSON,
+			edits:  []string{emptyCode, strings.Repeat("0", 40)},
+			want:   []string{"error: SPDXRef-Package-app: PackageVerificationCode is " + strings.Repeat("0", 40) + ", but the package's files give " + emptyCode},
+		},
+		{
+			name:  "verification code format",
+			edits: []string{emptyCode, strings.ToUpper(emptyCode)},
+			want:  []string{`error: SPDXRef-Package-app: PackageVerificationCode "` + strings.ToUpper(emptyCode) + `" must be 40 lower-case hexadecimal digits`},
+		},
+		{
+			name:  "checksum length",
+			edits: []string{"SHA1: " + emptySHA1, "SHA1: " + emptySHA1[:39]},
+			want:  []string{`error: SPDXRef-File0: FileChecksum: SHA1 "` + emptySHA1[:39] + `" must be 40 hexadecimal digits`},
+		},
+		{
+			name:  "checksum case",
+			edits: []string{"SHA1: " + emptySHA1, "SHA1: " + strings.ToUpper(emptySHA1)},
+			want:  []string{`warning: SPDXRef-File0: FileChecksum: SHA1 "` + strings.ToUpper(emptySHA1) + `" should be in lower case`},
+		},
+		{
+			name:  "missing SHA1",
+			edits: []string{"FileChecksum: SHA1: " + emptySHA1, "FileChecksum: MD5: d41d8cd98f00b204e9800998ecf8427e"},
+			want:  []string{"error: SPDXRef-File0: FileChecksum: SHA1 is missing"},
+		},
+		{
+			name:  "invalid license expression",
+			edits: []string{"PackageLicenseDeclared: MIT", "PackageLicenseDeclared: MIT AND"},
+			want:  []string{`error: SPDXRef-Package-app: PackageLicenseDeclared "MIT AND" is not a valid license expression`},
+		},
+		{
+			name:  "license not on the list",
+			edits: []string{"PackageLicenseDeclared: MIT", "PackageLicenseDeclared: MIT OR Example-1.0"},
+			want:  []string{"error: SPDXRef-Package-app: PackageLicenseDeclared: Example-1.0 isn't on the SPDX license list (version 3.20)"},
+		},
+		{
+			name:  "deprecated license",
+			edits: []string{"\nLicenseConcluded: MIT", "\nLicenseConcluded: GPL-2.0"},
+			want:  []string{"warning: SPDXRef-File0: LicenseConcluded: GPL-2.0 is deprecated on the SPDX license list"},
+		},
+		{
+			name:  "license in the wrong case",
+			edits: []string{"LicenseInfoInFile: MIT", "LicenseInfoInFile: mit"},
+			want:  []string{"warning: SPDXRef-File0: LicenseInfoInFile: mit should be written as MIT"},
+		},
+		{
+			name:  "expression where a license is wanted",
+			edits: []string{"LicenseInfoInFile: MIT", "LicenseInfoInFile: MIT OR GPL-2.0-only"},
+			want:  []string{`error: SPDXRef-File0: LicenseInfoInFile "MIT OR GPL-2.0-only" should name a single license, not an expression`},
+		},
+		{
+			name:  "exception",
+			edits: []string{"PackageLicenseDeclared: MIT", "PackageLicenseDeclared: GPL-2.0-only WITH classpath-exception-2.0 OR GPL-2.0-only WITH Example-exception"},
+			want: []string{
+				"warning: SPDXRef-Package-app: PackageLicenseDeclared: classpath-exception-2.0 should be written as Classpath-exception-2.0",
+				"error: SPDXRef-Package-app: PackageLicenseDeclared: Example-exception isn't an exception on the SPDX license list",
+			},
+		},
+		{
+			name:  "undefined LicenseRef",
+			edits: []string{"PackageLicenseDeclared: MIT", "PackageLicenseDeclared: LicenseRef-example"},
+			want:  []string{"error: SPDXRef-Package-app: PackageLicenseDeclared: LicenseRef-example isn't defined in the document"},
+		},
+		{
+			name: "defined LicenseRef",
+			edits: []string{
+				"PackageLicenseDeclared: MIT", "PackageLicenseDeclared: LicenseRef-example",
+				"DESCRIBES SPDXRef-Package-app\n", "DESCRIBES SPDXRef-Package-app\n\nLicenseID: LicenseRef-example\nExtractedText: <text>Example license</text>\nLicenseName: Example\n",
+			},
+		},
+		{
+			name:  "DocumentRef license",
+			edits: []string{"PackageLicenseDeclared: MIT", "PackageLicenseDeclared: DocumentRef-lib:LicenseRef-example"},
+			want:  []string{"error: SPDXRef-Package-app: PackageLicenseDeclared: DocumentRef-lib:LicenseRef-example refers to DocumentRef-lib, which isn't an external document reference"},
+		},
+		{
+			name: "DocumentRef license with a reference",
+			edits: []string{
+				"PackageLicenseDeclared: MIT", "PackageLicenseDeclared: DocumentRef-lib:LicenseRef-example",
+				"Creator: Tool: test", "ExternalDocumentRef: DocumentRef-lib https://example.com/lib SHA1: " + emptySHA1 + "\nCreator: Tool: test",
+			},
+		},
+		{
+			name:  "NOASSERTION in an expression",
+			edits: []string{"PackageLicenseDeclared: MIT", "PackageLicenseDeclared: MIT OR NOASSERTION"},
+			want:  []string{"error: SPDXRef-Package-app: PackageLicenseDeclared: NOASSERTION can't be part of a license expression"},
+		},
+		{
+			name:  "optional fields before SPDX 2.3",
+			edits: []string{"SPDX-2.3", "SPDX-2.2", "FileCopyrightText: NOASSERTION\n", "", "PackageVerificationCode: " + emptyCode + "\n", ""},
+			want: []string{
+				"error: SPDXRef-Package-app: PackageVerificationCode is missing",
+				"error: SPDXRef-File0: FileCopyrightText is missing",
+			},
+		},
+		{
+			name:  "optional fields from SPDX 2.3",
+			edits: []string{"FileCopyrightText: NOASSERTION\n", "", "PackageVerificationCode: " + emptyCode + "\n", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, content := tt.format, testTagValue
+			if format == nil {
+				format = spdxdoc.TagValue
+			}
+			if format == spdxdoc.JSON {
+				content = testJSON
+			}
+			for i := 0; i+1 < len(tt.edits); i += 2 {
+				if !strings.Contains(content, tt.edits[i]) {
+					t.Fatalf("document has no %q to edit", tt.edits[i])
+				}
+				content = strings.Replace(content, tt.edits[i], tt.edits[i+1], 1)
+			}
+			dir, in := writeDocument(t, content, format)
+			defer os.RemoveAll(dir)
+
+			r := validate(testLicenses, in)
+			got := []string{}
+			for _, is := range r.Issues {
+				got = append(got, fmt.Sprintf("%s: %s: %s", is.Severity, is.Element, is.Message))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got issues %q, want %q", got, tt.want)
+			}
+			errors := 0
+			for i, want := range tt.want {
+				if !strings.HasPrefix(got[i], want) {
+					t.Errorf("got issue %q, want %q", got[i], want)
+				}
+				if strings.HasPrefix(want, severityError) {
+					errors++
+				}
+			}
+			if r.Errors != errors || r.Warnings != len(tt.want)-errors || r.Valid != (errors == 0) {
+				t.Errorf("got %d errors and %d warnings, valid %t, want %d and %d", r.Errors, r.Warnings, r.Valid, errors, len(tt.want)-errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+#!/bin/sh
+# SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+# fetch-license-list.sh downloads the parts of the SPDX license list
+# that agentkit/licenselist reads -- the JSON indexes of licenses and
+# exceptions, and the licenses' plain texts and templates -- laid out
+# as in the spdx/license-list-data repository.
+#
+# usage: fetch-license-list.sh <version> <dir>
+#   e.g. fetch-license-list.sh v3.7 /spdx-license-list-data
+
+set -e
+
+if [ $# -ne 2 ]; then
+  echo "usage: $0 <version> <dir>" >&2
+  exit 2
+fi
+version=$1
+dir=$2
+
+mkdir -p "$dir"
+curl -fsSL "https://github.com/spdx/license-list-data/archive/${version}.tar.gz" | \
+  tar -xz -C "$dir" --strip-components=1 --wildcards \
+    '*/json/licenses.json' '*/json/exceptions.json' '*/text/' '*/template/'